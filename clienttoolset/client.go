@@ -2,15 +2,18 @@ package clienttoolset
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"time"
 
 	grpc_middleware "github.com/grpc-ecosystem/go-grpc-middleware"
 	"github.com/sgostarter/i/commerr"
 	"github.com/sgostarter/i/l"
+	"github.com/sgostarter/libeasygo/cuserror"
 	"github.com/sgostarter/librediscovery/discovery"
 	"github.com/sgostarter/libservicetoolset/grpce"
 	"github.com/sgostarter/libservicetoolset/grpce/interceptors"
+	"github.com/sgostarter/libservicetoolset/grpce/meta"
 	"github.com/sgostarter/libservicetoolset/servicetoolset"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
@@ -30,11 +33,44 @@ type GRPCClientConfig struct {
 	Target        string                              `yaml:"target" json:"target"`
 	TLSConfig     *servicetoolset.GRPCClientTLSConfig `yaml:"tls_config" json:"tls_config"`
 	MetaTransKeys []string                            `json:"-" yaml:"-" ignored:"true"`
+	// Propagation replaces MetaTransKeys if not nil, see meta.PropagationPolicy
+	Propagation *meta.PropagationPolicy `yaml:"propagation" json:"propagation"`
+	// TLSFileConfig is used when TLSConfig is nil
+	TLSFileConfig *servicetoolset.GRPCClientTLSFileConfig `yaml:"tls_file_config" json:"tls_file_config"`
 
 	KeepAliveTime    time.Duration `json:"keep_alive_time" yaml:"keep_alive_time"`
 	KeepAliveTimeout time.Duration `json:"keep_alive_timeout" yaml:"keep_alive_timeout"`
 }
 
+// GetTLSConfig returns TLSConfig, or the one loaded from TLSFileConfig if TLSConfig is nil.
+func (cfg *GRPCClientConfig) GetTLSConfig() (*servicetoolset.GRPCClientTLSConfig, error) {
+	if cfg.TLSConfig != nil || cfg.TLSFileConfig == nil {
+		return cfg.TLSConfig, nil
+	}
+
+	return servicetoolset.GRPCClientTLSConfigMap(cfg.TLSFileConfig)
+}
+
+// Validate is called by servicetoolset.LoadConfig, the tls files are loaded by DialGRPC.
+func (cfg *GRPCClientConfig) Validate() error {
+	var errs []error
+
+	if cfg.Target == "" {
+		errs = append(errs, cuserror.NewWithErrorMsg("target: required"))
+	}
+
+	errs = append(errs, servicetoolset.ValidateConfigDuration("keep_alive_time", cfg.KeepAliveTime),
+		servicetoolset.ValidateConfigDuration("keep_alive_timeout", cfg.KeepAliveTimeout))
+
+	if cfg.Propagation != nil {
+		if err := cfg.Propagation.Validate(); err != nil {
+			errs = append(errs, cuserror.NewWithErrorMsg(fmt.Sprintf("propagation.%v", err)))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
 type RegisterSchemasConfig struct {
 	Getter  discovery.Getter `json:"-" yaml:"-" ignored:"true"`
 	Schemas []string         `yaml:"schemas" json:"schemas"`
@@ -59,11 +95,16 @@ func DialGRPC(cfg *GRPCClientConfig, opts []grpc.DialOption) (*grpc.ClientConn,
 func DialGRPCEx(_ context.Context, cfg *GRPCClientConfig, opts []grpc.DialOption) (*grpc.ClientConn, error) {
 	dialOptions := make([]grpc.DialOption, 0, len(opts)+1)
 
+	propagation := cfg.Propagation
+	if propagation == nil {
+		propagation = meta.KeysPropagationPolicy(cfg.MetaTransKeys)
+	}
+
 	unaryInterceptors := []grpc.UnaryClientInterceptor{
-		interceptors.ClientIDInterceptor(cfg.MetaTransKeys),
+		interceptors.ClientPropagationInterceptor(propagation),
 	}
 	streamInterceptors := []grpc.StreamClientInterceptor{
-		interceptors.ClientStreamIDInterceptor(cfg.MetaTransKeys),
+		interceptors.ClientStreamPropagationInterceptor(propagation),
 	}
 
 	dialOptions = append(dialOptions, grpc.WithUnaryInterceptor(grpc_middleware.ChainUnaryClient(unaryInterceptors...)))
@@ -71,8 +112,13 @@ func DialGRPCEx(_ context.Context, cfg *GRPCClientConfig, opts []grpc.DialOption
 
 	dialOptions = append(dialOptions, opts...)
 
-	if cfg.TLSConfig != nil {
-		tlsConfig, err := servicetoolset.GenClientTLSConfig(cfg.TLSConfig)
+	clientTLSConfig, err := cfg.GetTLSConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	if clientTLSConfig != nil {
+		tlsConfig, err := servicetoolset.GenClientTLSConfig(clientTLSConfig)
 		if err != nil {
 			return nil, err
 		}
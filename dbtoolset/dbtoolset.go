@@ -1,6 +1,9 @@
 package dbtoolset
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"strings"
 	"sync"
 
@@ -9,6 +12,7 @@ import (
 
 	"github.com/go-redis/redis/v8"
 	"github.com/sgostarter/i/l"
+	"github.com/sgostarter/libeasygo/cuserror"
 	"github.com/sgostarter/libstg/mysqlgorm"
 	"github.com/sgostarter/libstg/mysqlxorm"
 	"github.com/sgostarter/libstg/redisv8"
@@ -18,14 +22,45 @@ import (
 
 const (
 	DefaultName = "default"
+
+	MysqlORMXOrm = "xorm"
+	MysqlORMGOrm = "gorm"
 )
 
 type Config struct {
-	RedisDSN     string            `yaml:"redis_dsn" json:"redis_dsn"`
-	RedisDSNList map[string]string `yaml:"redis_dsn_list" json:"redis_dsn_list"`
+	RedisDSN     string            `yaml:"redis_dsn" json:"redis_dsn" redact:"true"`
+	RedisDSNList map[string]string `yaml:"redis_dsn_list" json:"redis_dsn_list" redact:"true"`
+
+	MysqlDSN     string            `yaml:"mysql_dsn" json:"mysql_dsn" redact:"true"`
+	MysqlDSNList map[string]string `yaml:"mysql_dsn_list" json:"mysql_dsn_list" redact:"true"`
+
+	// PreloadMysqlORM which orm (xorm or gorm) OnStart opens the mysql pools with, empty means lazy
+	PreloadMysqlORM string `yaml:"preload_mysql_orm" json:"preload_mysql_orm"`
+}
+
+// Validate is called by servicetoolset.LoadConfig.
+func (cfg *Config) Validate() error {
+	var errs []error
+
+	for name, dsn := range cfg.RedisDSNList {
+		if name == "" || dsn == "" {
+			errs = append(errs, cuserror.NewWithErrorMsg(fmt.Sprintf("redis_dsn_list.%v: empty name or dsn", name)))
+		}
+	}
+
+	for name, dsn := range cfg.MysqlDSNList {
+		if name == "" || dsn == "" {
+			errs = append(errs, cuserror.NewWithErrorMsg(fmt.Sprintf("mysql_dsn_list.%v: empty name or dsn", name)))
+		}
+	}
 
-	MysqlDSN     string            `yaml:"mysql_dsn" json:"mysql_dsn"`
-	MysqlDSNList map[string]string `yaml:"mysql_dsn_list" json:"mysql_dsn_list"`
+	switch cfg.PreloadMysqlORM {
+	case "", MysqlORMXOrm, MysqlORMGOrm:
+	default:
+		errs = append(errs, cuserror.NewWithErrorMsg(fmt.Sprintf("preload_mysql_orm: unknown orm %q", cfg.PreloadMysqlORM)))
+	}
+
+	return errors.Join(errs...)
 }
 
 type Toolset struct {
@@ -189,3 +224,104 @@ func (toolset *Toolset) GetGOrmByName(name string) *gorm.DB {
 
 	return nil
 }
+
+// OnStart opens the configured pools eagerly, so the service fails on startup instead of on first use.
+func (toolset *Toolset) OnStart(_ context.Context) error {
+	if toolset.cfg.RedisDSN != "" && toolset.GetRedis() == nil {
+		return cuserror.NewWithErrorMsg("init redis failed")
+	}
+
+	for name := range toolset.cfg.RedisDSNList {
+		if toolset.GetRedisByName(name) == nil {
+			return cuserror.NewWithErrorMsg(fmt.Sprintf("init redis %v failed", name))
+		}
+	}
+
+	switch toolset.cfg.PreloadMysqlORM {
+	case "":
+	case MysqlORMXOrm:
+		if toolset.cfg.MysqlDSN != "" && toolset.GetXOrm() == nil {
+			return cuserror.NewWithErrorMsg("init xorm failed")
+		}
+
+		for name := range toolset.cfg.MysqlDSNList {
+			if toolset.GetXOrmByName(name) == nil {
+				return cuserror.NewWithErrorMsg(fmt.Sprintf("init xorm %v failed", name))
+			}
+		}
+	case MysqlORMGOrm:
+		if toolset.cfg.MysqlDSN != "" && toolset.GetGOrm() == nil {
+			return cuserror.NewWithErrorMsg("init gorm failed")
+		}
+
+		for name := range toolset.cfg.MysqlDSNList {
+			if toolset.GetGOrmByName(name) == nil {
+				return cuserror.NewWithErrorMsg(fmt.Sprintf("init gorm %v failed", name))
+			}
+		}
+	default:
+		return cuserror.NewWithErrorMsg(fmt.Sprintf("unknown mysql orm: %v", toolset.cfg.PreloadMysqlORM))
+	}
+
+	return nil
+}
+
+// OnStop closes all the opened pools and forgets them, the getters open new pools after it. OnStop should not
+// run concurrently with the getters.
+func (toolset *Toolset) OnStop(_ context.Context) error {
+	defer toolset.reset()
+
+	var errs []error
+
+	if toolset.redisCli != nil {
+		errs = append(errs, toolset.redisCli.Close())
+	}
+
+	for _, redisCli := range toolset.redisList {
+		errs = append(errs, redisCli.Close())
+	}
+
+	if toolset.xOrmEngine != nil {
+		errs = append(errs, toolset.xOrmEngine.Close())
+	}
+
+	for _, db := range toolset.xOrmList {
+		errs = append(errs, db.Close())
+	}
+
+	if toolset.gOrmDB != nil {
+		errs = append(errs, closeGOrm(toolset.gOrmDB))
+	}
+
+	for _, db := range toolset.gOrmList {
+		errs = append(errs, closeGOrm(db))
+	}
+
+	return errors.Join(errs...)
+}
+
+func (toolset *Toolset) reset() {
+	toolset.redisOnce = sync.Once{}
+	toolset.redisCli = nil
+	toolset.redisListOnce = sync.Once{}
+	toolset.redisList = make(map[string]*redis.Client)
+
+	toolset.xOrmOnce = sync.Once{}
+	toolset.xOrmEngine = nil
+	toolset.xOrmListOnce = sync.Once{}
+	toolset.xOrmList = make(map[string]*xorm.Engine)
+
+	toolset.gOrmOnce = sync.Once{}
+	toolset.gOrmDB = nil
+	toolset.gOrmListOnce = sync.Once{}
+	toolset.gOrmList = make(map[string]*gorm.DB)
+}
+
+func closeGOrm(db *gorm.DB) error {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+
+	return sqlDB.Close()
+}
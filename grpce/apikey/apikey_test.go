@@ -0,0 +1,140 @@
+package apikey
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"gopkg.in/yaml.v3"
+)
+
+func writeKeyFile(t *testing.T, file string, keys ...*Key) {
+	d, err := yaml.Marshal(&keyFile{Keys: keys})
+	assert.Nil(t, err)
+	assert.Nil(t, os.WriteFile(file, d, 0600))
+}
+
+func TestKey(t *testing.T) {
+	apiKey, key, err := GenerateKey("partner")
+	assert.Nil(t, err)
+
+	id, secret, err := ParseKey(apiKey)
+	assert.Nil(t, err)
+	assert.Equal(t, key.ID, id)
+	assert.True(t, key.Verify(secret))
+	assert.False(t, key.Verify(secret+"x"))
+	assert.NotContains(t, key.Hash, secret)
+
+	_, key2, err := GenerateKey("partner")
+	assert.Nil(t, err)
+	assert.NotEqual(t, key.Salt, key2.Salt)
+
+	_, _, err = ParseKey("nosecret")
+	assert.ErrorIs(t, err, ErrInvalidKey)
+}
+
+func TestAuthenticator(t *testing.T) {
+	apiKey, key, err := GenerateKey("partner")
+	assert.Nil(t, err)
+
+	key.Methods = []string{"/pkg.Svc/*"}
+	key.Roles = []string{"reader"}
+	key.Tier = "bronze"
+
+	disabledAPIKey, disabledKey, err := GenerateKey("disabled")
+	assert.Nil(t, err)
+
+	disabledKey.Disabled = true
+
+	expiredAPIKey, expiredKey, err := GenerateKey("expired")
+	assert.Nil(t, err)
+
+	expiredKey.ExpiresAt = time.Now().Add(-time.Second)
+
+	file := filepath.Join(t.TempDir(), "keys.yaml")
+	writeKeyFile(t, file, key, disabledKey, expiredKey)
+
+	store, err := NewFileStore(file, nil)
+	assert.Nil(t, err)
+
+	a, err := NewAuthenticator(Config{
+		Tiers:         map[string]RateLimitTier{"bronze": {QPS: 0.001, Burst: 2}},
+		PublicMethods: []string{"/pkg.Public/*"},
+	}, store, nil)
+	assert.Nil(t, err)
+
+	fnAuth := func(apiKey, method string) (*Principal, codes.Code) {
+		ctx := context.Background()
+		if apiKey != "" {
+			ctx = metadata.NewIncomingContext(ctx, metadata.Pairs(DefaultHeader, apiKey))
+		}
+
+		ctx, err := a.Authenticate(ctx, method)
+		if err != nil {
+			return nil, status.Code(err)
+		}
+
+		p, _ := PrincipalFromContext(ctx)
+
+		return p, codes.OK
+	}
+
+	_, code := fnAuth("", "/pkg.Public/A")
+	assert.Equal(t, codes.OK, code)
+
+	_, code = fnAuth("", "/pkg.Svc/A")
+	assert.Equal(t, codes.Unauthenticated, code)
+
+	_, code = fnAuth(key.ID+".wrong", "/pkg.Svc/A")
+	assert.Equal(t, codes.Unauthenticated, code)
+
+	_, code = fnAuth("unknown.secret", "/pkg.Svc/A")
+	assert.Equal(t, codes.Unauthenticated, code)
+
+	_, code = fnAuth(disabledAPIKey, "/pkg.Svc/A")
+	assert.Equal(t, codes.Unauthenticated, code)
+
+	_, code = fnAuth(expiredAPIKey, "/pkg.Svc/A")
+	assert.Equal(t, codes.Unauthenticated, code)
+
+	_, code = fnAuth(apiKey, "/pkg.Other/A")
+	assert.Equal(t, codes.PermissionDenied, code)
+
+	lastUsed, err := store.LastUsed(context.Background(), key.ID)
+	assert.Nil(t, err)
+	assert.True(t, lastUsed.IsZero())
+
+	p, code := fnAuth(apiKey, "/pkg.Svc/A")
+	assert.Equal(t, codes.OK, code)
+	assert.Equal(t, "partner", p.Name)
+	assert.Equal(t, []string{"reader"}, p.Roles)
+	assert.Equal(t, "bronze", p.Tier)
+
+	lastUsed, err = store.LastUsed(context.Background(), key.ID)
+	assert.Nil(t, err)
+	assert.False(t, lastUsed.IsZero())
+
+	_, code = fnAuth(apiKey, "/pkg.Svc/A")
+	assert.Equal(t, codes.OK, code)
+
+	_, code = fnAuth(apiKey, "/pkg.Svc/A")
+	assert.Equal(t, codes.ResourceExhausted, code)
+
+	// revoke the key by reloading the file
+	writeKeyFile(t, file, disabledKey)
+	assert.Nil(t, store.Reload())
+
+	_, code = fnAuth(apiKey, "/pkg.Svc/A")
+	assert.Equal(t, codes.Unauthenticated, code)
+
+	// the methods are parsed when the keys are loaded
+	key.Methods = []string{"pkg.Svc"}
+	writeKeyFile(t, file, key)
+	assert.NotNil(t, store.Reload())
+}
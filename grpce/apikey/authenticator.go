@@ -0,0 +1,263 @@
+package apikey
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sgostarter/i/commerr"
+	"github.com/sgostarter/i/l"
+	"github.com/sgostarter/libeasygo/cuserror"
+	"github.com/sgostarter/libservicetoolset/grpce/utils"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	DefaultHeader = "x-api-key"
+
+	defaultTouchInterval = time.Minute
+)
+
+// RateLimitTier the token bucket of every key in the tier.
+type RateLimitTier struct {
+	QPS   float64 `yaml:"qps" json:"qps"`
+	Burst int     `yaml:"burst" json:"burst"`
+}
+
+type Config struct {
+	// Header the metadata carrying the api key, DefaultHeader if empty
+	Header string `yaml:"header" json:"header"`
+	// Tiers the rate limits by Key.Tier, the keys of the tiers not here are not limited
+	Tiers       map[string]RateLimitTier `yaml:"tiers" json:"tiers"`
+	DefaultTier string                   `yaml:"default_tier" json:"default_tier"`
+	// PublicMethods the method patterns skipping the authentication, see utils.MethodMatcher
+	PublicMethods []string `yaml:"public_methods" json:"public_methods"`
+	// TouchInterval the last used time of a key is written at most once per interval, 1m if 0
+	TouchInterval time.Duration `yaml:"touch_interval" json:"touch_interval"`
+}
+
+func (cfg *Config) Validate() error {
+	var errs []error
+
+	for name, tier := range cfg.Tiers {
+		if tier.QPS <= 0 {
+			errs = append(errs, cuserror.NewWithErrorMsg(fmt.Sprintf("tiers.%v.qps: should be positive", name)))
+		}
+	}
+
+	if _, err := utils.NewMethodMatcher(cfg.PublicMethods); err != nil {
+		errs = append(errs, cuserror.NewWithErrorMsg(fmt.Sprintf("public_methods: %v", err)))
+	}
+
+	if cfg.TouchInterval < 0 {
+		errs = append(errs, cuserror.NewWithErrorMsg("touch_interval: should not be negative"))
+	}
+
+	return errors.Join(errs...)
+}
+
+// Principal the owner of the verified api key.
+type Principal struct {
+	KeyID    string
+	Name     string
+	Roles    []string
+	Tier     string
+	Metadata map[string]string
+}
+
+type principalKey struct{}
+
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// PrincipalFromContext returns the principal of the verified api key.
+func PrincipalFromContext(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(*Principal)
+
+	return p, ok
+}
+
+type keyState struct {
+	tier    string
+	bucket  *utils.TokenBucket
+	touched time.Time
+}
+
+// Authenticator verifies the api keys of the calls against a KeyStore.
+type Authenticator struct {
+	cfg           Config
+	store         KeyStore
+	publicMethods *utils.MethodMatcher
+	logger        l.Wrapper
+
+	lock   sync.Mutex
+	states map[string]*keyState
+}
+
+func NewAuthenticator(cfg Config, store KeyStore, logger l.Wrapper) (*Authenticator, error) {
+	if store == nil {
+		return nil, commerr.ErrInvalidArgument
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	if logger == nil {
+		logger = l.NewNopLoggerWrapper()
+	}
+
+	if cfg.Header == "" {
+		cfg.Header = DefaultHeader
+	}
+
+	if cfg.TouchInterval == 0 {
+		cfg.TouchInterval = defaultTouchInterval
+	}
+
+	publicMethods, _ := utils.NewMethodMatcher(cfg.PublicMethods)
+
+	return &Authenticator{
+		cfg:           cfg,
+		store:         store,
+		publicMethods: publicMethods,
+		logger:        logger.WithFields(l.StringField(l.ClsKey, "APIKeyAuthenticator")),
+		states:        make(map[string]*keyState),
+	}, nil
+}
+
+func (a *Authenticator) tier(key *Key) string {
+	if key.Tier == "" {
+		return a.cfg.DefaultTier
+	}
+
+	return key.Tier
+}
+
+// state returns the rate limiter of the key and whether the last used time should be written.
+func (a *Authenticator) state(key *Key, now time.Time) (bucket *utils.TokenBucket, touch bool) {
+	tierName := a.tier(key)
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	state, ok := a.states[key.ID]
+	if !ok || state.tier != tierName {
+		state = &keyState{
+			tier: tierName,
+		}
+
+		if tier, ok := a.cfg.Tiers[tierName]; ok {
+			state.bucket = utils.NewTokenBucket(tier.QPS, tier.Burst)
+		}
+
+		a.states[key.ID] = state
+	}
+
+	if now.Sub(state.touched) >= a.cfg.TouchInterval {
+		state.touched = now
+		touch = true
+	}
+
+	return state.bucket, touch
+}
+
+// Authenticate returns the context with the Principal, or an UNAUTHENTICATED, PERMISSION_DENIED or
+// RESOURCE_EXHAUSTED error.
+func (a *Authenticator) Authenticate(ctx context.Context, fullMethod string) (context.Context, error) {
+	if a.publicMethods.Match(fullMethod) {
+		return ctx, nil
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	values := md.Get(a.cfg.Header)
+	if len(values) == 0 || strings.TrimSpace(values[0]) == "" {
+		return nil, status.Error(codes.Unauthenticated, "no api key")
+	}
+
+	id, secret, err := ParseKey(strings.TrimSpace(values[0]))
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, "invalid api key")
+	}
+
+	key, err := a.store.Get(ctx, id)
+	if err != nil {
+		if errors.Is(err, ErrKeyNotFound) {
+			a.logger.WithFields(l.StringField("method", fullMethod), l.StringField("keyID", id)).Warn("apiKeyNotFound")
+
+			return nil, status.Error(codes.Unauthenticated, "invalid api key")
+		}
+
+		a.logger.WithFields(l.StringField("keyID", id), l.ErrorField(err)).Error("getAPIKeyFailed")
+
+		return nil, status.Error(codes.Unavailable, "verify api key failed")
+	}
+
+	now := time.Now()
+
+	switch {
+	case !key.Verify(secret):
+		a.logger.WithFields(l.StringField("method", fullMethod), l.StringField("keyID", id)).Warn("apiKeyMismatched")
+
+		return nil, status.Error(codes.Unauthenticated, "invalid api key")
+	case key.Disabled:
+		return nil, status.Error(codes.Unauthenticated, "api key is disabled")
+	case key.expired(now):
+		return nil, status.Error(codes.Unauthenticated, "api key is expired")
+	}
+
+	if !key.allowed(fullMethod) {
+		return nil, status.Errorf(codes.PermissionDenied, "api key is not allowed to call %v", fullMethod)
+	}
+
+	bucket, touch := a.state(key, now)
+
+	if bucket != nil && !bucket.Allow() {
+		return nil, status.Errorf(codes.ResourceExhausted, "api key %v is rate limited", key.ID)
+	}
+
+	if touch {
+		if err = a.store.Touch(ctx, key.ID, now); err != nil {
+			a.logger.WithFields(l.StringField("keyID", key.ID), l.ErrorField(err)).Warn("touchAPIKeyFailed")
+		}
+	}
+
+	return WithPrincipal(ctx, &Principal{
+		KeyID:    key.ID,
+		Name:     key.Name,
+		Roles:    key.Roles,
+		Tier:     a.tier(key),
+		Metadata: key.Metadata,
+	}), nil
+}
+
+func (a *Authenticator) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (
+		interface{}, error) {
+		ctx, err := a.Authenticate(ctx, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+func (a *Authenticator) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := a.Authenticate(ss.Context(), info.FullMethod)
+		if err != nil {
+			return err
+		}
+
+		return handler(srv, utils.NewServerStreamWrapper(ctx, ss))
+	}
+}
@@ -0,0 +1,171 @@
+package apikey
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/sgostarter/libservicetoolset/grpce/utils"
+)
+
+const (
+	keyIDLength     = 8
+	keySecretLength = 32
+	keySaltLength   = 16
+)
+
+var (
+	ErrKeyNotFound = errors.New("api key not found")
+	ErrInvalidKey  = errors.New("invalid api key")
+)
+
+// Key the stored form of an api key, the secret is kept as a salted sha256 hash only.
+// The api keys are <id>.<secret>, the secrets are random so a salted hash is strong enough.
+type Key struct {
+	ID string `yaml:"id" json:"id"`
+	// Name the owner of the key, e.g. the partner
+	Name string `yaml:"name" json:"name"`
+	Salt string `yaml:"salt" json:"salt"`
+	Hash string `yaml:"hash" json:"hash"`
+	// Methods the method patterns the key can call (see utils.MethodMatcher), all the methods if empty
+	Methods []string `yaml:"methods" json:"methods"`
+	// Roles of the principal, see interceptors.NewDefaultPrincipalResolver
+	Roles []string `yaml:"roles" json:"roles"`
+	// Tier the rate limit tier, Config.DefaultTier if empty
+	Tier      string            `yaml:"tier" json:"tier"`
+	ExpiresAt time.Time         `yaml:"expires_at,omitempty" json:"expires_at,omitempty"`
+	Disabled  bool              `yaml:"disabled" json:"disabled"`
+	Metadata  map[string]string `yaml:"metadata" json:"metadata"`
+
+	methods *utils.MethodMatcher
+}
+
+// GenerateKey returns the api key handed to the caller and its stored form, fill the other fields of the Key
+// before saving it.
+func GenerateKey(name string) (apiKey string, key *Key, err error) {
+	id := make([]byte, keyIDLength)
+	secret := make([]byte, keySecretLength)
+
+	if _, err = rand.Read(id); err != nil {
+		return
+	}
+
+	if _, err = rand.Read(secret); err != nil {
+		return
+	}
+
+	key = &Key{
+		ID:   hex.EncodeToString(id),
+		Name: name,
+	}
+
+	apiKey = key.ID + "." + base64.RawURLEncoding.EncodeToString(secret)
+
+	if err = key.SetSecret(apiKey); err != nil {
+		return "", nil, err
+	}
+
+	return
+}
+
+// ParseKey splits the api key into the id and the secret.
+func ParseKey(apiKey string) (id, secret string, err error) {
+	id, secret, ok := strings.Cut(apiKey, ".")
+	if !ok || id == "" || secret == "" {
+		return "", "", ErrInvalidKey
+	}
+
+	return id, secret, nil
+}
+
+func hashSecret(salt []byte, secret string) []byte {
+	h := sha256.New()
+	h.Write(salt)
+	h.Write([]byte(secret))
+
+	return h.Sum(nil)
+}
+
+// SetSecret salts and hashes the secret of apiKey, the id of apiKey must be the id of the key.
+func (key *Key) SetSecret(apiKey string) error {
+	id, secret, err := ParseKey(apiKey)
+	if err != nil {
+		return err
+	}
+
+	if id != key.ID {
+		return ErrInvalidKey
+	}
+
+	salt := make([]byte, keySaltLength)
+
+	if _, err = rand.Read(salt); err != nil {
+		return err
+	}
+
+	key.Salt = base64.StdEncoding.EncodeToString(salt)
+	key.Hash = base64.StdEncoding.EncodeToString(hashSecret(salt, secret))
+
+	return nil
+}
+
+// Verify compares the secret in constant time.
+func (key *Key) Verify(secret string) bool {
+	salt, err := base64.StdEncoding.DecodeString(key.Salt)
+	if err != nil {
+		return false
+	}
+
+	hash, err := base64.StdEncoding.DecodeString(key.Hash)
+	if err != nil {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare(hash, hashSecret(salt, secret)) == 1
+}
+
+// ParseMethods parses Methods for the later calls, FileStore and RedisStore call it when the keys are loaded.
+// The keys of the other stores are parsed on every call without it.
+func (key *Key) ParseMethods() error {
+	key.methods = nil
+
+	if len(key.Methods) == 0 {
+		return nil
+	}
+
+	methods, err := utils.NewMethodMatcher(key.Methods)
+	if err != nil {
+		return err
+	}
+
+	key.methods = methods
+
+	return nil
+}
+
+func (key *Key) allowed(fullMethod string) bool {
+	if len(key.Methods) == 0 {
+		return true
+	}
+
+	methods := key.methods
+	if methods == nil {
+		var err error
+
+		methods, err = utils.NewMethodMatcher(key.Methods)
+		if err != nil {
+			return false
+		}
+	}
+
+	return methods.Match(fullMethod)
+}
+
+func (key *Key) expired(now time.Time) bool {
+	return !key.ExpiresAt.IsZero() && !now.Before(key.ExpiresAt)
+}
@@ -0,0 +1,126 @@
+package apikey
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/sgostarter/i/commerr"
+	"github.com/sgostarter/libservicetoolset/dbtoolset"
+)
+
+const (
+	DefaultRedisKeyPrefix = "apikey:"
+
+	redisLastUsedSuffix = ":last_used"
+)
+
+// RedisStore keeps the keys as json, the keys with ExpiresAt expire in redis too.
+type RedisStore struct {
+	cli       redis.UniversalClient
+	keyPrefix string
+}
+
+// NewRedisStore keyPrefix is DefaultRedisKeyPrefix if empty.
+func NewRedisStore(cli redis.UniversalClient, keyPrefix string) (*RedisStore, error) {
+	if cli == nil {
+		return nil, commerr.ErrInvalidArgument
+	}
+
+	if keyPrefix == "" {
+		keyPrefix = DefaultRedisKeyPrefix
+	}
+
+	return &RedisStore{
+		cli:       cli,
+		keyPrefix: keyPrefix,
+	}, nil
+}
+
+// NewRedisStoreFromToolset uses the redis named name of toolset, see dbtoolset.Toolset.GetRedisByName.
+func NewRedisStoreFromToolset(toolset *dbtoolset.Toolset, name, keyPrefix string) (*RedisStore, error) {
+	if toolset == nil {
+		return nil, commerr.ErrInvalidArgument
+	}
+
+	cli := toolset.GetRedisByName(name)
+	if cli == nil {
+		return nil, fmt.Errorf("redis %v is not available", name)
+	}
+
+	return NewRedisStore(cli, keyPrefix)
+}
+
+func (store *RedisStore) Get(ctx context.Context, id string) (*Key, error) {
+	d, err := store.cli.Get(ctx, store.keyPrefix+id).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, ErrKeyNotFound
+		}
+
+		return nil, err
+	}
+
+	key := &Key{}
+
+	if err = json.Unmarshal(d, key); err != nil {
+		return nil, err
+	}
+
+	if err = key.ParseMethods(); err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+// Put adds or replaces the key.
+func (store *RedisStore) Put(ctx context.Context, key *Key) error {
+	if key == nil || key.ID == "" {
+		return commerr.ErrInvalidArgument
+	}
+
+	if err := key.ParseMethods(); err != nil {
+		return err
+	}
+
+	d, err := json.Marshal(key)
+	if err != nil {
+		return err
+	}
+
+	var ttl time.Duration
+
+	if !key.ExpiresAt.IsZero() {
+		ttl = time.Until(key.ExpiresAt)
+		if ttl <= 0 {
+			return store.Delete(ctx, key.ID)
+		}
+	}
+
+	return store.cli.Set(ctx, store.keyPrefix+key.ID, d, ttl).Err()
+}
+
+func (store *RedisStore) Delete(ctx context.Context, id string) error {
+	return store.cli.Del(ctx, store.keyPrefix+id, store.keyPrefix+id+redisLastUsedSuffix).Err()
+}
+
+func (store *RedisStore) Touch(ctx context.Context, id string, t time.Time) error {
+	return store.cli.Set(ctx, store.keyPrefix+id+redisLastUsedSuffix, t.Unix(), 0).Err()
+}
+
+func (store *RedisStore) LastUsed(ctx context.Context, id string) (time.Time, error) {
+	ts, err := store.cli.Get(ctx, store.keyPrefix+id+redisLastUsedSuffix).Int64()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return time.Time{}, nil
+		}
+
+		return time.Time{}, err
+	}
+
+	return time.Unix(ts, 0), nil
+}
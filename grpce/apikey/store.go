@@ -0,0 +1,147 @@
+package apikey
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sgostarter/i/l"
+	"github.com/sgostarter/libeasygo/cuserror"
+	"github.com/sgostarter/libservicetoolset/grpce/utils"
+	"go.uber.org/atomic"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	defaultFileWatchInterval = 5 * time.Second
+)
+
+// KeyStore keeps the hashed api keys.
+type KeyStore interface {
+	// Get returns ErrKeyNotFound if there is no key of id
+	Get(ctx context.Context, id string) (*Key, error)
+	// Touch records the last time the key was used
+	Touch(ctx context.Context, id string, t time.Time) error
+	// LastUsed returns the zero time if the key wasn't used
+	LastUsed(ctx context.Context, id string) (time.Time, error)
+}
+
+// FileStore loads the keys from a yaml or json file, {keys: [Key...]}. The last used times are kept in memory.
+type FileStore struct {
+	file   string
+	logger l.Wrapper
+
+	keys     atomic.Pointer[map[string]*Key]
+	lastUsed sync.Map
+}
+
+type keyFile struct {
+	Keys []*Key `yaml:"keys" json:"keys"`
+}
+
+func NewFileStore(file string, logger l.Wrapper) (*FileStore, error) {
+	if logger == nil {
+		logger = l.NewNopLoggerWrapper()
+	}
+
+	store := &FileStore{
+		file:   file,
+		logger: logger.WithFields(l.StringField(l.ClsKey, "FileStore")),
+	}
+
+	if err := store.Reload(); err != nil {
+		return nil, err
+	}
+
+	return store, nil
+}
+
+// Reload reads the file again, the current keys are kept if the file is invalid.
+func (store *FileStore) Reload() error {
+	d, err := os.ReadFile(store.file)
+	if err != nil {
+		return err
+	}
+
+	kf := &keyFile{}
+
+	switch strings.ToLower(filepath.Ext(store.file)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(d, kf)
+	case ".json":
+		err = json.Unmarshal(d, kf)
+	default:
+		return cuserror.NewWithErrorMsg(fmt.Sprintf("unknown api key file type: %v", store.file))
+	}
+
+	if err != nil {
+		return cuserror.NewWithErrorMsg(fmt.Sprintf("parse api key file %v failed: %v", store.file, err))
+	}
+
+	keys := make(map[string]*Key, len(kf.Keys))
+
+	for idx, key := range kf.Keys {
+		if key == nil || key.ID == "" || key.Hash == "" || key.Salt == "" {
+			return cuserror.NewWithErrorMsg(fmt.Sprintf("keys[%v]: id, salt and hash are required", idx))
+		}
+
+		if _, ok := keys[key.ID]; ok {
+			return cuserror.NewWithErrorMsg(fmt.Sprintf("keys[%v]: duplicated id %v", idx, key.ID))
+		}
+
+		if err = key.ParseMethods(); err != nil {
+			return cuserror.NewWithErrorMsg(fmt.Sprintf("keys[%v].methods: %v", idx, err))
+		}
+
+		keys[key.ID] = key
+	}
+
+	store.keys.Store(&keys)
+
+	return nil
+}
+
+// WatchFile reloads the file when its modification time changes, until ctx is done.
+func (store *FileStore) WatchFile(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = defaultFileWatchInterval
+	}
+
+	utils.WatchFile(ctx, store.file, interval, func() error {
+		if err := store.Reload(); err != nil {
+			return err
+		}
+
+		store.logger.WithFields(l.StringField("file", store.file), l.IntField("keys", len(*store.keys.Load()))).
+			Info("keysReloaded")
+
+		return nil
+	}, store.logger)
+}
+
+func (store *FileStore) Get(_ context.Context, id string) (*Key, error) {
+	key, ok := (*store.keys.Load())[id]
+	if !ok {
+		return nil, ErrKeyNotFound
+	}
+
+	return key, nil
+}
+
+func (store *FileStore) Touch(_ context.Context, id string, t time.Time) error {
+	store.lastUsed.Store(id, t)
+
+	return nil
+}
+
+func (store *FileStore) LastUsed(_ context.Context, id string) (time.Time, error) {
+	t, _ := store.lastUsed.Load(id)
+	lastUsed, _ := t.(time.Time)
+
+	return lastUsed, nil
+}
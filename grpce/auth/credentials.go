@@ -0,0 +1,50 @@
+package auth
+
+import (
+	"context"
+
+	"google.golang.org/grpc/credentials"
+)
+
+// TokenSource returns the token of the outgoing calls, e.g. a cached token refreshed before it expires.
+type TokenSource func(ctx context.Context) (string, error)
+
+type jwtCredentials struct {
+	source   TokenSource
+	insecure bool
+}
+
+// NewJWTCredentials the client side of JWTAuthenticator, use it with grpc.WithPerRPCCredentials.
+// The tokens are sent only over tls unless insecure is true.
+func NewJWTCredentials(source TokenSource, insecure bool) credentials.PerRPCCredentials {
+	return &jwtCredentials{
+		source:   source,
+		insecure: insecure,
+	}
+}
+
+// NewStaticJWTCredentials sends the same token on every call.
+func NewStaticJWTCredentials(token string, insecure bool) credentials.PerRPCCredentials {
+	return NewJWTCredentials(func(_ context.Context) (string, error) {
+		return token, nil
+	}, insecure)
+}
+
+func (c *jwtCredentials) GetRequestMetadata(ctx context.Context, _ ...string) (map[string]string, error) {
+	token, err := c.source(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if token == "" {
+		return nil, nil
+	}
+
+	return map[string]string{
+		"authorization": "Bearer " + token,
+	}, nil
+}
+
+func (c *jwtCredentials) RequireTransportSecurity() bool {
+	return !c.insecure
+}
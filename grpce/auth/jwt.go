@@ -0,0 +1,499 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/sgostarter/i/commerr"
+)
+
+const (
+	AlgHS256 = "HS256"
+	AlgHS384 = "HS384"
+	AlgHS512 = "HS512"
+	AlgRS256 = "RS256"
+	AlgRS384 = "RS384"
+	AlgRS512 = "RS512"
+	AlgPS256 = "PS256"
+	AlgPS384 = "PS384"
+	AlgPS512 = "PS512"
+	AlgES256 = "ES256"
+	AlgES384 = "ES384"
+	AlgES512 = "ES512"
+	AlgEdDSA = "EdDSA"
+)
+
+var supportedAlgorithms = map[string]bool{
+	AlgHS256: true, AlgHS384: true, AlgHS512: true,
+	AlgRS256: true, AlgRS384: true, AlgRS512: true,
+	AlgPS256: true, AlgPS384: true, AlgPS512: true,
+	AlgES256: true, AlgES384: true, AlgES512: true,
+	AlgEdDSA: true,
+}
+
+var (
+	ErrInvalidToken     = errors.New("invalid token")
+	ErrTokenExpired     = errors.New("token expired")
+	ErrTokenNotValidYet = errors.New("token not valid yet")
+	ErrUnknownKey       = errors.New("unknown key")
+	ErrInvalidSignature = errors.New("invalid signature")
+)
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid,omitempty"`
+	Typ string `json:"typ,omitempty"`
+}
+
+// Claims the registered claims are parsed, all the claims are kept in Raw.
+type Claims struct {
+	Issuer    string
+	Subject   string
+	Audience  []string
+	ExpiresAt time.Time
+	NotBefore time.Time
+	IssuedAt  time.Time
+	ID        string
+	Raw       map[string]interface{}
+}
+
+// String returns the claim if it's a string.
+func (claims *Claims) String(key string) string {
+	s, _ := claims.Raw[key].(string)
+
+	return s
+}
+
+// Strings returns the claim if it's a string or a string array, e.g. scope or roles.
+func (claims *Claims) Strings(key string) []string {
+	switch v := claims.Raw[key].(type) {
+	case string:
+		return strings.Fields(v)
+	case []interface{}:
+		ss := make([]string, 0, len(v))
+
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				ss = append(ss, s)
+			}
+		}
+
+		return ss
+	}
+
+	return nil
+}
+
+func parseClaims(d []byte) (*Claims, error) {
+	raw := make(map[string]interface{})
+
+	if err := json.Unmarshal(d, &raw); err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	claims := &Claims{
+		Raw: raw,
+	}
+
+	claims.Issuer, _ = raw["iss"].(string)
+	claims.Subject, _ = raw["sub"].(string)
+	claims.ID, _ = raw["jti"].(string)
+	claims.Audience = claims.Strings("aud")
+
+	for key, t := range map[string]*time.Time{"exp": &claims.ExpiresAt, "nbf": &claims.NotBefore, "iat": &claims.IssuedAt} {
+		v, ok := raw[key]
+		if !ok {
+			continue
+		}
+
+		n, ok := v.(float64)
+		if !ok {
+			return nil, ErrInvalidToken
+		}
+
+		*t = time.Unix(int64(n), 0)
+	}
+
+	return claims, nil
+}
+
+// JWK a key of the JWKS, the public key of the asymmetric algorithms or the secret of HS*.
+type JWK struct {
+	Kid string
+	Alg string
+	Key interface{}
+}
+
+// KeySet the verifying keys, it's immutable.
+type KeySet struct {
+	keys []*JWK
+}
+
+func NewKeySet(keys ...*JWK) *KeySet {
+	return &KeySet{
+		keys: keys,
+	}
+}
+
+type jwkJSON struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+	K   string `json:"k"`
+}
+
+// ParseJWKS parses the RSA, EC (P-256, P-384, P-521), OKP (Ed25519) and oct keys, the keys not for
+// signatures are skipped.
+func ParseJWKS(d []byte) (*KeySet, error) {
+	var jwks struct {
+		Keys []jwkJSON `json:"keys"`
+	}
+
+	if err := json.Unmarshal(d, &jwks); err != nil {
+		return nil, err
+	}
+
+	ks := &KeySet{}
+
+	for idx, k := range jwks.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+
+		key, err := k.key()
+		if err != nil {
+			return nil, fmt.Errorf("keys[%d]: %w", idx, err)
+		}
+
+		ks.keys = append(ks.keys, &JWK{Kid: k.Kid, Alg: k.Alg, Key: key})
+	}
+
+	return ks, nil
+}
+
+// LoadJWKSFile .
+func LoadJWKSFile(file string) (*KeySet, error) {
+	d, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseJWKS(d)
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	d, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+
+	return new(big.Int).SetBytes(d), nil
+}
+
+func (k *jwkJSON) key() (interface{}, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %v", k.Crv)
+		}
+
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+
+		if !curve.IsOnCurve(x, y) { // nolint: staticcheck
+			return nil, errors.New("point is not on the curve")
+		}
+
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %v", k.Crv)
+		}
+
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid ed25519 key")
+		}
+
+		return ed25519.PublicKey(x), nil
+	case "oct":
+		secret, err := base64.RawURLEncoding.DecodeString(k.K)
+		if err != nil {
+			return nil, err
+		}
+
+		return secret, nil
+	}
+
+	return nil, fmt.Errorf("unsupported kty %v", k.Kty)
+}
+
+func algHash(alg string) (crypto.Hash, func() hash.Hash) {
+	switch alg[2:] {
+	case "384":
+		return crypto.SHA384, sha512.New384
+	case "512":
+		return crypto.SHA512, sha512.New
+	}
+
+	return crypto.SHA256, sha256.New
+}
+
+// keyMatchesAlg the key type must fit the algorithm, so a public key can't be used as a HMAC secret.
+func keyMatchesAlg(key interface{}, alg string) bool {
+	switch key.(type) {
+	case []byte:
+		return strings.HasPrefix(alg, "HS")
+	case *rsa.PublicKey:
+		return strings.HasPrefix(alg, "RS") || strings.HasPrefix(alg, "PS")
+	case *ecdsa.PublicKey:
+		return strings.HasPrefix(alg, "ES")
+	case ed25519.PublicKey:
+		return alg == AlgEdDSA
+	}
+
+	return false
+}
+
+func verifySignature(alg string, key interface{}, signingInput, sig []byte) error {
+	if alg == AlgEdDSA {
+		if !ed25519.Verify(key.(ed25519.PublicKey), signingInput, sig) { // nolint: forcetypeassert
+			return ErrInvalidSignature
+		}
+
+		return nil
+	}
+
+	cryptoHash, newHash := algHash(alg)
+
+	if strings.HasPrefix(alg, "HS") {
+		mac := hmac.New(newHash, key.([]byte)) // nolint: forcetypeassert
+		mac.Write(signingInput)
+
+		if !hmac.Equal(sig, mac.Sum(nil)) {
+			return ErrInvalidSignature
+		}
+
+		return nil
+	}
+
+	h := newHash()
+	h.Write(signingInput)
+	digest := h.Sum(nil)
+
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		var err error
+
+		if strings.HasPrefix(alg, "PS") {
+			err = rsa.VerifyPSS(key, cryptoHash, digest, sig, nil)
+		} else {
+			err = rsa.VerifyPKCS1v15(key, cryptoHash, digest, sig)
+		}
+
+		if err != nil {
+			return ErrInvalidSignature
+		}
+	case *ecdsa.PublicKey:
+		size := (key.Curve.Params().BitSize + 7) / 8
+		if len(sig) != 2*size {
+			return ErrInvalidSignature
+		}
+
+		r, s := new(big.Int).SetBytes(sig[:size]), new(big.Int).SetBytes(sig[size:])
+		if !ecdsa.Verify(key, digest, r, s) {
+			return ErrInvalidSignature
+		}
+	default:
+		return ErrUnknownKey
+	}
+
+	return nil
+}
+
+// parseJWT verifies the signature with the keys of ks, the claims are not validated.
+func parseJWT(token string, ks *KeySet, algorithms map[string]bool) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidToken
+	}
+
+	d, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	var header jwtHeader
+
+	if err = json.Unmarshal(d, &header); err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	if !algorithms[header.Alg] {
+		return nil, fmt.Errorf("%w: algorithm %v is not allowed", ErrInvalidToken, header.Alg)
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	signingInput := []byte(parts[0] + "." + parts[1])
+
+	err = ErrUnknownKey
+
+	for _, key := range ks.keys {
+		if (header.Kid != "" && key.Kid != header.Kid) || (key.Alg != "" && key.Alg != header.Alg) ||
+			!keyMatchesAlg(key.Key, header.Alg) {
+			continue
+		}
+
+		if err = verifySignature(header.Alg, key.Key, signingInput, sig); err == nil {
+			break
+		}
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	d, err = base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	return parseClaims(d)
+}
+
+// SignJWT signs the claims, key is the []byte secret for HS*, or the *rsa.PrivateKey, *ecdsa.PrivateKey or
+// ed25519.PrivateKey of the algorithm.
+func SignJWT(alg, kid string, key interface{}, claims map[string]interface{}) (string, error) {
+	if !supportedAlgorithms[alg] {
+		return "", commerr.ErrInvalidArgument
+	}
+
+	header, err := json.Marshal(&jwtHeader{Alg: alg, Kid: kid, Typ: "JWT"})
+	if err != nil {
+		return "", err
+	}
+
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+
+	var sig []byte
+
+	switch key := key.(type) {
+	case []byte:
+		if !strings.HasPrefix(alg, "HS") {
+			return "", commerr.ErrInvalidArgument
+		}
+
+		_, newHash := algHash(alg)
+		mac := hmac.New(newHash, key)
+		mac.Write([]byte(signingInput))
+		sig = mac.Sum(nil)
+	case *rsa.PrivateKey:
+		cryptoHash, newHash := algHash(alg)
+		h := newHash()
+		h.Write([]byte(signingInput))
+
+		switch {
+		case strings.HasPrefix(alg, "RS"):
+			sig, err = rsa.SignPKCS1v15(rand.Reader, key, cryptoHash, h.Sum(nil))
+		case strings.HasPrefix(alg, "PS"):
+			sig, err = rsa.SignPSS(rand.Reader, key, cryptoHash, h.Sum(nil), nil)
+		default:
+			return "", commerr.ErrInvalidArgument
+		}
+	case *ecdsa.PrivateKey:
+		if !strings.HasPrefix(alg, "ES") {
+			return "", commerr.ErrInvalidArgument
+		}
+
+		_, newHash := algHash(alg)
+		h := newHash()
+		h.Write([]byte(signingInput))
+
+		var r, s *big.Int
+
+		r, s, err = ecdsa.Sign(rand.Reader, key, h.Sum(nil))
+		if err == nil {
+			size := (key.Curve.Params().BitSize + 7) / 8
+			sig = make([]byte, 2*size)
+			r.FillBytes(sig[:size])
+			s.FillBytes(sig[size:])
+		}
+	case ed25519.PrivateKey:
+		if alg != AlgEdDSA {
+			return "", commerr.ErrInvalidArgument
+		}
+
+		sig = ed25519.Sign(key, []byte(signingInput))
+	default:
+		return "", commerr.ErrInvalidArgument
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
@@ -0,0 +1,301 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sgostarter/i/l"
+	"github.com/sgostarter/libeasygo/cuserror"
+	"github.com/sgostarter/libservicetoolset/grpce"
+	"github.com/sgostarter/libservicetoolset/grpce/utils"
+	"go.uber.org/atomic"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// NoClockSkew set JWTConfig.ClockSkew to it to check exp and nbf without skew.
+const NoClockSkew time.Duration = -1
+
+const (
+	defaultJWTClockSkew          = time.Minute
+	defaultJWKSFileWatchInterval = 30 * time.Second
+)
+
+type JWTConfig struct {
+	// Issuers the iss must be one of them if not empty
+	Issuers []string `yaml:"issuers" json:"issuers"`
+	// Audiences the aud must contain one of them if not empty
+	Audiences []string `yaml:"audiences" json:"audiences"`
+	// Algorithms the allowed algorithms, all the supported ones if empty
+	Algorithms []string `yaml:"algorithms" json:"algorithms"`
+	// ClockSkew tolerated on exp and nbf, 1m if 0, NoClockSkew (-1) for none
+	ClockSkew time.Duration `yaml:"clock_skew" json:"clock_skew"`
+	// RequireExpiry rejects the tokens without exp
+	RequireExpiry bool `yaml:"require_expiry" json:"require_expiry"`
+	// JWKSFile the verifying keys, reloaded when it changes
+	JWKSFile          string        `yaml:"jwks_file" json:"jwks_file"`
+	JWKSWatchInterval time.Duration `yaml:"jwks_watch_interval" json:"jwks_watch_interval"`
+	// CookieName the token is read from the cookie (or the metadata) of the name if there is no authorization
+	// metadata, see grpce.GetStringFromContext
+	CookieName string `yaml:"cookie_name" json:"cookie_name"`
+	// PublicMethods the method patterns skipping the authentication, see utils.MethodMatcher
+	PublicMethods []string `yaml:"public_methods" json:"public_methods"`
+	// OptionalMethods the method patterns where the token is verified only if present
+	OptionalMethods []string `yaml:"optional_methods" json:"optional_methods"`
+}
+
+func (cfg *JWTConfig) Validate() error {
+	var errs []error
+
+	for _, alg := range cfg.Algorithms {
+		if !supportedAlgorithms[alg] {
+			errs = append(errs, cuserror.NewWithErrorMsg(fmt.Sprintf("algorithms: unsupported algorithm %v", alg)))
+		}
+	}
+
+	if (cfg.ClockSkew < 0 && cfg.ClockSkew != NoClockSkew) || cfg.JWKSWatchInterval < 0 {
+		errs = append(errs, cuserror.NewWithErrorMsg("clock_skew and jwks_watch_interval should not be negative"))
+	}
+
+	if _, err := utils.NewMethodMatcher(cfg.PublicMethods); err != nil {
+		errs = append(errs, cuserror.NewWithErrorMsg(fmt.Sprintf("public_methods: %v", err)))
+	}
+
+	if _, err := utils.NewMethodMatcher(cfg.OptionalMethods); err != nil {
+		errs = append(errs, cuserror.NewWithErrorMsg(fmt.Sprintf("optional_methods: %v", err)))
+	}
+
+	return errors.Join(errs...)
+}
+
+// JWTAuthenticator verifies the bearer tokens, the claims of the verified tokens are stored in the context.
+type JWTAuthenticator struct {
+	cfg             JWTConfig
+	algorithms      map[string]bool
+	publicMethods   *utils.MethodMatcher
+	optionalMethods *utils.MethodMatcher
+	keySet          atomic.Pointer[KeySet]
+	logger          l.Wrapper
+}
+
+// NewJWTAuthenticator the keys are loaded from cfg.JWKSFile, or set by SetKeySet.
+func NewJWTAuthenticator(cfg JWTConfig, logger l.Wrapper) (*JWTAuthenticator, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	if logger == nil {
+		logger = l.NewNopLoggerWrapper()
+	}
+
+	switch cfg.ClockSkew {
+	case 0:
+		cfg.ClockSkew = defaultJWTClockSkew
+	case NoClockSkew:
+		cfg.ClockSkew = 0
+	}
+
+	a := &JWTAuthenticator{
+		cfg:        cfg,
+		algorithms: make(map[string]bool),
+		logger:     logger.WithFields(l.StringField(l.ClsKey, "JWTAuthenticator")),
+	}
+
+	algorithms := cfg.Algorithms
+	if len(algorithms) == 0 {
+		for alg := range supportedAlgorithms {
+			algorithms = append(algorithms, alg)
+		}
+	}
+
+	for _, alg := range algorithms {
+		a.algorithms[alg] = true
+	}
+
+	a.publicMethods, _ = utils.NewMethodMatcher(cfg.PublicMethods)
+	a.optionalMethods, _ = utils.NewMethodMatcher(cfg.OptionalMethods)
+
+	a.keySet.Store(NewKeySet())
+
+	if cfg.JWKSFile != "" {
+		ks, err := LoadJWKSFile(cfg.JWKSFile)
+		if err != nil {
+			return nil, err
+		}
+
+		a.keySet.Store(ks)
+	}
+
+	return a, nil
+}
+
+// SetKeySet replaces the verifying keys.
+func (a *JWTAuthenticator) SetKeySet(ks *KeySet) {
+	if ks != nil {
+		a.keySet.Store(ks)
+	}
+}
+
+// WatchJWKSFile reloads cfg.JWKSFile when its modification time changes, until ctx is done. The current keys
+// are kept if the file is invalid.
+func (a *JWTAuthenticator) WatchJWKSFile(ctx context.Context) {
+	if a.cfg.JWKSFile == "" {
+		return
+	}
+
+	interval := a.cfg.JWKSWatchInterval
+	if interval <= 0 {
+		interval = defaultJWKSFileWatchInterval
+	}
+
+	utils.WatchFile(ctx, a.cfg.JWKSFile, interval, func() error {
+		ks, err := LoadJWKSFile(a.cfg.JWKSFile)
+		if err != nil {
+			return err
+		}
+
+		a.keySet.Store(ks)
+
+		a.logger.WithFields(l.StringField("file", a.cfg.JWKSFile), l.IntField("keys", len(ks.keys))).Info("jwksReloaded")
+
+		return nil
+	}, a.logger)
+}
+
+// Verify verifies the signature and validates the claims.
+func (a *JWTAuthenticator) Verify(token string) (*Claims, error) {
+	claims, err := parseJWT(token, a.keySet.Load(), a.algorithms)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+
+	if claims.ExpiresAt.IsZero() {
+		if a.cfg.RequireExpiry {
+			return nil, fmt.Errorf("%w: no exp", ErrInvalidToken)
+		}
+	} else if now.After(claims.ExpiresAt.Add(a.cfg.ClockSkew)) {
+		return nil, ErrTokenExpired
+	}
+
+	if !claims.NotBefore.IsZero() && now.Add(a.cfg.ClockSkew).Before(claims.NotBefore) {
+		return nil, ErrTokenNotValidYet
+	}
+
+	if len(a.cfg.Issuers) > 0 && !containsString(a.cfg.Issuers, claims.Issuer) {
+		return nil, fmt.Errorf("%w: issuer %v", ErrInvalidToken, claims.Issuer)
+	}
+
+	if len(a.cfg.Audiences) > 0 {
+		matched := false
+
+		for _, aud := range claims.Audience {
+			if containsString(a.cfg.Audiences, aud) {
+				matched = true
+
+				break
+			}
+		}
+
+		if !matched {
+			return nil, fmt.Errorf("%w: audience %v", ErrInvalidToken, claims.Audience)
+		}
+	}
+
+	return claims, nil
+}
+
+// TokenFromContext returns the bearer token of the authorization metadata, or the cookie of cfg.CookieName.
+func (a *JWTAuthenticator) TokenFromContext(ctx context.Context) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	for _, value := range md.Get("authorization") {
+		if len(value) > 7 && strings.EqualFold(value[:7], "bearer ") {
+			return strings.TrimSpace(value[7:])
+		}
+	}
+
+	if a.cfg.CookieName != "" {
+		return grpce.GetStringFromContext(ctx, a.cfg.CookieName)
+	}
+
+	return ""
+}
+
+// Authenticate returns the context with the claims, or an Unauthenticated error. The verification errors are
+// logged only, not returned to the clients.
+func (a *JWTAuthenticator) Authenticate(ctx context.Context, fullMethod string) (context.Context, error) {
+	if a.publicMethods.Match(fullMethod) {
+		return ctx, nil
+	}
+
+	token := a.TokenFromContext(ctx)
+	if token == "" {
+		if a.optionalMethods.Match(fullMethod) {
+			return ctx, nil
+		}
+
+		return nil, status.Error(codes.Unauthenticated, "no bearer token")
+	}
+
+	claims, err := a.Verify(token)
+	if err != nil {
+		a.logger.WithFields(l.StringField("method", fullMethod), l.ErrorField(err)).Warn("verifyTokenFailed")
+
+		return nil, status.Error(codes.Unauthenticated, "invalid bearer token")
+	}
+
+	return WithClaims(ctx, claims), nil
+}
+
+func (a *JWTAuthenticator) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (
+		interface{}, error) {
+		ctx, err := a.Authenticate(ctx, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+func (a *JWTAuthenticator) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := a.Authenticate(ss.Context(), info.FullMethod)
+		if err != nil {
+			return err
+		}
+
+		return handler(srv, utils.NewServerStreamWrapper(ctx, ss))
+	}
+}
+
+type claimsKey struct{}
+
+func WithClaims(ctx context.Context, claims *Claims) context.Context {
+	return context.WithValue(ctx, claimsKey{}, claims)
+}
+
+// ClaimsFromContext returns the claims of the verified token.
+func ClaimsFromContext(ctx context.Context) (*Claims, bool) {
+	claims, ok := ctx.Value(claimsKey{}).(*Claims)
+
+	return claims, ok
+}
+
+func containsString(ss []string, s string) bool {
+	for _, item := range ss {
+		if item == s {
+			return true
+		}
+	}
+
+	return false
+}
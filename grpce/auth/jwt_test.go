@@ -0,0 +1,233 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func b64(d []byte) string {
+	return base64.RawURLEncoding.EncodeToString(d)
+}
+
+type testJWTKeys struct {
+	hs  []byte
+	rsa *rsa.PrivateKey
+	ec  *ecdsa.PrivateKey
+	ed  ed25519.PrivateKey
+}
+
+func newTestJWTKeys(t *testing.T) (*testJWTKeys, []byte) {
+	keys := &testJWTKeys{hs: []byte("0123456789abcdef0123456789abcdef")}
+
+	var err error
+
+	keys.rsa, err = rsa.GenerateKey(rand.Reader, 2048)
+	assert.Nil(t, err)
+
+	keys.ec, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+
+	_, keys.ed, err = ed25519.GenerateKey(rand.Reader)
+	assert.Nil(t, err)
+
+	jwks, err := json.Marshal(map[string]interface{}{
+		"keys": []map[string]string{
+			{"kty": "oct", "kid": "hs", "k": b64(keys.hs)},
+			{"kty": "RSA", "kid": "rsa", "n": b64(keys.rsa.N.Bytes()), "e": "AQAB"},
+			{"kty": "EC", "kid": "ec", "crv": "P-256", "x": b64(keys.ec.X.Bytes()), "y": b64(keys.ec.Y.Bytes())},
+			{"kty": "OKP", "kid": "ed", "crv": "Ed25519", "x": b64(keys.ed.Public().(ed25519.PublicKey))},
+			{"kty": "RSA", "kid": "enc", "use": "enc", "n": "AQAB", "e": "AQAB"},
+		},
+	})
+	assert.Nil(t, err)
+
+	return keys, jwks
+}
+
+func TestJWTAuthenticatorVerify(t *testing.T) {
+	keys, jwks := newTestJWTKeys(t)
+
+	file := filepath.Join(t.TempDir(), "jwks.json")
+	assert.Nil(t, os.WriteFile(file, jwks, 0600))
+
+	a, err := NewJWTAuthenticator(JWTConfig{
+		Issuers:   []string{"iss"},
+		Audiences: []string{"svc"},
+		ClockSkew: time.Second,
+		JWKSFile:  file,
+	}, nil)
+	assert.Nil(t, err)
+
+	claims := map[string]interface{}{
+		"iss":   "iss",
+		"sub":   "u1",
+		"aud":   []string{"other", "svc"},
+		"exp":   time.Now().Add(time.Minute).Unix(),
+		"scope": "read write",
+	}
+
+	for _, c := range []struct {
+		alg, kid string
+		key      interface{}
+	}{
+		{AlgHS256, "hs", keys.hs},
+		{AlgHS512, "", keys.hs},
+		{AlgRS256, "rsa", keys.rsa},
+		{AlgPS384, "rsa", keys.rsa},
+		{AlgES256, "ec", keys.ec},
+		{AlgEdDSA, "ed", keys.ed},
+	} {
+		token, err := SignJWT(c.alg, c.kid, c.key, claims)
+		assert.Nil(t, err, c.alg)
+
+		verified, err := a.Verify(token)
+		assert.Nil(t, err, c.alg)
+		assert.Equal(t, "u1", verified.Subject, c.alg)
+		assert.Equal(t, []string{"read", "write"}, verified.Strings("scope"), c.alg)
+
+		_, err = a.Verify(token[:len(token)-4] + "AAAA")
+		assert.NotNil(t, err, c.alg)
+	}
+
+	// the public key can't be used as the HS secret
+	token, err := SignJWT(AlgHS256, "rsa", keys.hs, claims)
+	assert.Nil(t, err)
+
+	_, err = a.Verify(token)
+	assert.ErrorIs(t, err, ErrUnknownKey)
+
+	claims["exp"] = time.Now().Add(-time.Minute).Unix()
+	token, err = SignJWT(AlgES256, "ec", keys.ec, claims)
+	assert.Nil(t, err)
+
+	_, err = a.Verify(token)
+	assert.ErrorIs(t, err, ErrTokenExpired)
+
+	claims["exp"] = time.Now().Add(time.Minute).Unix()
+	claims["aud"] = "other"
+	token, err = SignJWT(AlgES256, "ec", keys.ec, claims)
+	assert.Nil(t, err)
+
+	_, err = a.Verify(token)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	_, err = a.Verify("eyJhbGciOiJub25lIn0.e30.")
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	_, err = NewJWTAuthenticator(JWTConfig{Algorithms: []string{"none"}}, nil)
+	assert.NotNil(t, err)
+
+	_, err = NewJWTAuthenticator(JWTConfig{ClockSkew: -time.Second}, nil)
+	assert.NotNil(t, err)
+}
+
+func TestJWTAuthenticatorClockSkew(t *testing.T) {
+	keys, jwks := newTestJWTKeys(t)
+
+	ks, err := ParseJWKS(jwks)
+	assert.Nil(t, err)
+
+	token, err := SignJWT(AlgEdDSA, "ed", keys.ed, map[string]interface{}{
+		"sub": "u1",
+		"exp": time.Now().Add(-2 * time.Second).Unix(),
+	})
+	assert.Nil(t, err)
+
+	a, err := NewJWTAuthenticator(JWTConfig{}, nil)
+	assert.Nil(t, err)
+	a.SetKeySet(ks)
+
+	_, err = a.Verify(token)
+	assert.Nil(t, err)
+
+	a, err = NewJWTAuthenticator(JWTConfig{ClockSkew: NoClockSkew}, nil)
+	assert.Nil(t, err)
+	a.SetKeySet(ks)
+
+	_, err = a.Verify(token)
+	assert.ErrorIs(t, err, ErrTokenExpired)
+}
+
+func TestJWTAuthenticatorInterceptor(t *testing.T) {
+	keys, jwks := newTestJWTKeys(t)
+
+	ks, err := ParseJWKS(jwks)
+	assert.Nil(t, err)
+
+	a, err := NewJWTAuthenticator(JWTConfig{
+		CookieName:      "token",
+		PublicMethods:   []string{"/pkg.Public/*"},
+		OptionalMethods: []string{"/pkg.Svc/Optional"},
+	}, nil)
+	assert.Nil(t, err)
+
+	a.SetKeySet(ks)
+
+	token, err := SignJWT(AlgEdDSA, "ed", keys.ed, map[string]interface{}{"sub": "u1"})
+	assert.Nil(t, err)
+
+	interceptor := a.UnaryServerInterceptor()
+
+	fnCall := func(ctx context.Context, method string) (string, codes.Code) {
+		resp, err := interceptor(ctx, nil, &grpc.UnaryServerInfo{FullMethod: method},
+			func(ctx context.Context, _ interface{}) (interface{}, error) {
+				claims, ok := ClaimsFromContext(ctx)
+				if !ok {
+					return "", nil
+				}
+
+				return claims.Subject, nil
+			})
+
+		s, _ := resp.(string)
+
+		return s, status.Code(err)
+	}
+
+	ctx := context.Background()
+
+	_, code := fnCall(ctx, "/pkg.Svc/A")
+	assert.Equal(t, codes.Unauthenticated, code)
+
+	_, code = fnCall(ctx, "/pkg.Public/A")
+	assert.Equal(t, codes.OK, code)
+
+	_, code = fnCall(ctx, "/pkg.Svc/Optional")
+	assert.Equal(t, codes.OK, code)
+
+	sub, code := fnCall(metadata.NewIncomingContext(ctx, metadata.Pairs("authorization", "Bearer "+token)), "/pkg.Svc/A")
+	assert.Equal(t, codes.OK, code)
+	assert.Equal(t, "u1", sub)
+
+	sub, code = fnCall(metadata.NewIncomingContext(ctx, metadata.Pairs("cookie", "token="+token)), "/pkg.Svc/A")
+	assert.Equal(t, codes.OK, code)
+	assert.Equal(t, "u1", sub)
+
+	_, code = fnCall(metadata.NewIncomingContext(ctx, metadata.Pairs("authorization", "Bearer x")), "/pkg.Svc/Optional")
+	assert.Equal(t, codes.Unauthenticated, code)
+
+	// the verification details aren't returned
+	_, err = interceptor(metadata.NewIncomingContext(ctx, metadata.Pairs("authorization", "Bearer "+token+"x")), nil,
+		&grpc.UnaryServerInfo{FullMethod: "/pkg.Svc/A"}, nil)
+	assert.Equal(t, "invalid bearer token", status.Convert(err).Message())
+
+	md, err := NewStaticJWTCredentials(token, true).GetRequestMetadata(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, "Bearer "+token, md["authorization"])
+}
@@ -14,6 +14,8 @@ import (
 )
 
 // SetHTTPCookie .
+//
+// Deprecated: the domain is derived from the Origin header, use SetHTTPCookieWithOptions.
 func SetHTTPCookie(ctx context.Context, key, val string, maxAge int) error {
 	domain := strutils.StringTrim(domainFromContext(ctx))
 	if domain == "" {
@@ -33,6 +35,8 @@ func SetHTTPCookie(ctx context.Context, key, val string, maxAge int) error {
 }
 
 // UnsetHTTPCookie .
+//
+// Deprecated: use UnsetHTTPCookieWithOptions.
 func UnsetHTTPCookie(ctx context.Context, key string) error {
 	domain := strutils.StringTrim(domainFromContext(ctx))
 	if domain == "" {
@@ -0,0 +1,254 @@
+package grpce
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sgostarter/libeasygo/cuserror"
+)
+
+const (
+	cookieCodecVersion = "v1"
+
+	minCookieHashKeyLength = 16
+	maxCookieLength        = 4096
+)
+
+var (
+	ErrCookieNotFound = errors.New("cookie not found")
+	// ErrCookieTampered the value is malformed, signed by an unknown key, or the signature mismatches
+	ErrCookieTampered = errors.New("cookie tampered")
+	ErrCookieExpired  = errors.New("cookie expired")
+	ErrCookieTooLong  = errors.New("cookie too long")
+)
+
+// CookieKey HashKey signs the values by HMAC-SHA256, the values are encrypted by AES-GCM with BlockKey
+// if it's not empty. The ID is embedded in the values so the keys can be rotated.
+type CookieKey struct {
+	ID       string
+	HashKey  []byte
+	BlockKey []byte
+}
+
+type cookieKey struct {
+	id      string
+	hashKey []byte
+	aead    cipher.AEAD
+}
+
+func newCookieKey(key CookieKey) (*cookieKey, error) {
+	if key.ID == "" || strings.Contains(key.ID, ".") {
+		return nil, cuserror.NewWithErrorMsg(fmt.Sprintf("invalid cookie key id %q", key.ID))
+	}
+
+	if len(key.HashKey) < minCookieHashKeyLength {
+		return nil, cuserror.NewWithErrorMsg(fmt.Sprintf("hash key of %v is shorter than %d bytes", key.ID,
+			minCookieHashKeyLength))
+	}
+
+	k := &cookieKey{
+		id:      key.ID,
+		hashKey: key.HashKey,
+	}
+
+	if len(key.BlockKey) > 0 {
+		block, err := aes.NewCipher(key.BlockKey)
+		if err != nil {
+			return nil, err
+		}
+
+		k.aead, err = cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return k, nil
+}
+
+func (k *cookieKey) mac(name, payload string) []byte {
+	h := hmac.New(sha256.New, k.hashKey)
+	h.Write([]byte(name + "|" + k.id + "|" + payload))
+
+	return h.Sum(nil)
+}
+
+// CookieKeyring encodes the cookie values with the sign key, and decodes them with any of the keys. To rotate,
+// add the new key, make it the sign key once all the instances know it, and remove the old one after the cookies
+// signed by it expired.
+type CookieKeyring struct {
+	lock    sync.RWMutex
+	signKey *cookieKey
+	keys    map[string]*cookieKey
+}
+
+func NewCookieKeyring(signKeyID string, keys ...CookieKey) (*CookieKeyring, error) {
+	kr := &CookieKeyring{}
+
+	if err := kr.SetKeys(signKeyID, keys...); err != nil {
+		return nil, err
+	}
+
+	return kr, nil
+}
+
+// SetKeys replaces the keys, it's safe to call it while encoding and decoding.
+func (kr *CookieKeyring) SetKeys(signKeyID string, keys ...CookieKey) error {
+	m := make(map[string]*cookieKey, len(keys))
+
+	for _, key := range keys {
+		k, err := newCookieKey(key)
+		if err != nil {
+			return err
+		}
+
+		if _, ok := m[k.id]; ok {
+			return cuserror.NewWithErrorMsg(fmt.Sprintf("duplicated cookie key id %v", k.id))
+		}
+
+		m[k.id] = k
+	}
+
+	signKey, ok := m[signKeyID]
+	if !ok {
+		return cuserror.NewWithErrorMsg(fmt.Sprintf("no sign key %v", signKeyID))
+	}
+
+	kr.lock.Lock()
+	defer kr.lock.Unlock()
+
+	kr.signKey = signKey
+	kr.keys = m
+
+	return nil
+}
+
+// Encode the value never expires.
+func (kr *CookieKeyring) Encode(name string, value []byte) (string, error) {
+	return kr.EncodeWithExpiry(name, value, time.Time{})
+}
+
+// EncodeWithExpiry the name is bound into the signature so the value of one cookie can't be replayed as another,
+// Decode returns ErrCookieExpired after expiresAt, it never expires if expiresAt is zero.
+func (kr *CookieKeyring) EncodeWithExpiry(name string, value []byte, expiresAt time.Time) (string, error) {
+	kr.lock.RLock()
+	k := kr.signKey
+	kr.lock.RUnlock()
+
+	plain := make([]byte, 8, 8+len(value))
+
+	if !expiresAt.IsZero() {
+		binary.BigEndian.PutUint64(plain, uint64(expiresAt.Unix()))
+	}
+
+	plain = append(plain, value...)
+
+	if k.aead != nil {
+		nonce := make([]byte, k.aead.NonceSize())
+		if _, err := rand.Read(nonce); err != nil {
+			return "", err
+		}
+
+		plain = k.aead.Seal(nonce, nonce, plain, []byte(name+"|"+k.id))
+	}
+
+	payload := base64.RawURLEncoding.EncodeToString(plain)
+	encoded := strings.Join([]string{cookieCodecVersion, k.id, payload,
+		base64.RawURLEncoding.EncodeToString(k.mac(name, payload))}, ".")
+
+	if len(name)+1+len(encoded) > maxCookieLength {
+		return "", ErrCookieTooLong
+	}
+
+	return encoded, nil
+}
+
+// Decode returns ErrCookieTampered or ErrCookieExpired if the value can't be trusted.
+func (kr *CookieKeyring) Decode(name string, encoded string) ([]byte, error) {
+	parts := strings.Split(encoded, ".")
+	if len(parts) != 4 || parts[0] != cookieCodecVersion {
+		return nil, ErrCookieTampered
+	}
+
+	kr.lock.RLock()
+	k, ok := kr.keys[parts[1]]
+	kr.lock.RUnlock()
+
+	if !ok {
+		return nil, ErrCookieTampered
+	}
+
+	mac, err := base64.RawURLEncoding.DecodeString(parts[3])
+	if err != nil || !hmac.Equal(mac, k.mac(name, parts[2])) {
+		return nil, ErrCookieTampered
+	}
+
+	plain, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrCookieTampered
+	}
+
+	if k.aead != nil {
+		if len(plain) < k.aead.NonceSize() {
+			return nil, ErrCookieTampered
+		}
+
+		plain, err = k.aead.Open(nil, plain[:k.aead.NonceSize()], plain[k.aead.NonceSize():], []byte(name+"|"+k.id))
+		if err != nil {
+			return nil, ErrCookieTampered
+		}
+	}
+
+	if len(plain) < 8 {
+		return nil, ErrCookieTampered
+	}
+
+	if expiresAt := int64(binary.BigEndian.Uint64(plain)); expiresAt != 0 && time.Now().Unix() >= expiresAt {
+		return nil, ErrCookieExpired
+	}
+
+	return plain[8:], nil
+}
+
+// SetSecureHTTPCookie likes SetHTTPCookieWithOptions, the value is encoded by kr and expires with the cookie.
+func SetSecureHTTPCookie(ctx context.Context, kr *CookieKeyring, opts CookieOptions, name, value string, maxAge int) error {
+	var expiresAt time.Time
+
+	if maxAge > 0 {
+		expiresAt = time.Now().Add(time.Duration(maxAge) * time.Second)
+	}
+
+	encoded, err := kr.EncodeWithExpiry(opts.Name(name), []byte(value), expiresAt)
+	if err != nil {
+		return err
+	}
+
+	return SetHTTPCookieWithOptions(ctx, opts, name, encoded, maxAge)
+}
+
+// GetSecureStringFromContext likes GetStringFromContext, returns ErrCookieNotFound, ErrCookieTampered
+// or ErrCookieExpired if there is no trusted value.
+func GetSecureStringFromContext(ctx context.Context, kr *CookieKeyring, opts CookieOptions, name string) (string, error) {
+	encoded := GetStringFromContext(ctx, opts.Name(name))
+	if encoded == "" {
+		return "", ErrCookieNotFound
+	}
+
+	value, err := kr.Decode(opts.Name(name), encoded)
+	if err != nil {
+		return "", err
+	}
+
+	return string(value), nil
+}
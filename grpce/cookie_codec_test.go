@@ -0,0 +1,93 @@
+package grpce
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/metadata"
+)
+
+var (
+	testCookieKey1 = CookieKey{ID: "k1", HashKey: []byte("0123456789abcdef-1"), BlockKey: []byte("0123456789abcdef")}
+	testCookieKey2 = CookieKey{ID: "k2", HashKey: []byte("0123456789abcdef-2")}
+)
+
+func TestCookieKeyring(t *testing.T) {
+	kr, err := NewCookieKeyring("k1", testCookieKey1)
+	assert.Nil(t, err)
+
+	encoded, err := kr.Encode("a", []byte("v"))
+	assert.Nil(t, err)
+	assert.NotContains(t, encoded, "v.")
+
+	d, err := kr.Decode("a", encoded)
+	assert.Nil(t, err)
+	assert.Equal(t, "v", string(d))
+
+	_, err = kr.Decode("b", encoded)
+	assert.ErrorIs(t, err, ErrCookieTampered)
+
+	_, err = kr.Decode("a", encoded[:len(encoded)-2]+"AA")
+	assert.ErrorIs(t, err, ErrCookieTampered)
+
+	_, err = kr.Decode("a", "x")
+	assert.ErrorIs(t, err, ErrCookieTampered)
+
+	expired, err := kr.EncodeWithExpiry("a", []byte("v"), time.Now().Add(-time.Second))
+	assert.Nil(t, err)
+
+	_, err = kr.Decode("a", expired)
+	assert.ErrorIs(t, err, ErrCookieExpired)
+
+	// rotate: the old values are still verified by k1
+	assert.Nil(t, kr.SetKeys("k2", testCookieKey1, testCookieKey2))
+
+	encoded2, err := kr.Encode("a", []byte("v2"))
+	assert.Nil(t, err)
+
+	d, err = kr.Decode("a", encoded)
+	assert.Nil(t, err)
+	assert.Equal(t, "v", string(d))
+
+	// k1 is retired
+	assert.Nil(t, kr.SetKeys("k2", testCookieKey2))
+
+	_, err = kr.Decode("a", encoded)
+	assert.ErrorIs(t, err, ErrCookieTampered)
+
+	d, err = kr.Decode("a", encoded2)
+	assert.Nil(t, err)
+	assert.Equal(t, "v2", string(d))
+
+	assert.NotNil(t, kr.SetKeys("k3", testCookieKey2))
+	assert.NotNil(t, kr.SetKeys("k2", testCookieKey2, testCookieKey2))
+
+	_, err = NewCookieKeyring("k", CookieKey{ID: "k", HashKey: []byte("short")})
+	assert.NotNil(t, err)
+}
+
+func TestGetSecureStringFromContext(t *testing.T) {
+	kr, err := NewCookieKeyring("k2", testCookieKey2)
+	assert.Nil(t, err)
+
+	opts := CookieOptions{Prefix: CookiePrefixHost}
+
+	_, err = GetSecureStringFromContext(context.Background(), kr, opts, "token")
+	assert.ErrorIs(t, err, ErrCookieNotFound)
+
+	encoded, err := kr.Encode("__Host-token", []byte("t"))
+	assert.Nil(t, err)
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("cookie", "a=1; __Host-token="+encoded))
+
+	value, err := GetSecureStringFromContext(ctx, kr, opts, "token")
+	assert.Nil(t, err)
+	assert.Equal(t, "t", value)
+
+	ctx = metadata.NewIncomingContext(context.Background(), metadata.Pairs("cookie", "__Host-token=x"+encoded))
+
+	_, err = GetSecureStringFromContext(ctx, kr, opts, "token")
+	assert.ErrorIs(t, err, ErrCookieTampered)
+}
@@ -0,0 +1,240 @@
+package grpce
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/sgostarter/i/commerr"
+	"github.com/sgostarter/libeasygo/cuserror"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	CookieSameSiteDefault = ""
+	CookieSameSiteLax     = "lax"
+	CookieSameSiteStrict  = "strict"
+	CookieSameSiteNone    = "none"
+
+	// CookiePrefixHost the cookie is Secure, host only and for the path /
+	CookiePrefixHost = "__Host-"
+	// CookiePrefixSecure the cookie is Secure
+	CookiePrefixSecure = "__Secure-"
+)
+
+// CookieOptions the attributes of the cookies set by SetHTTPCookieWithOptions and WriteHTTPCookie.
+type CookieOptions struct {
+	// Path / if empty
+	Path string `yaml:"path" json:"path"`
+	// Domain the cookie is for Domain and its sub domains, it's host only if both Domain and AllowedDomains are empty
+	Domain string `yaml:"domain" json:"domain"`
+	// AllowedDomains the matched domain is used if the host of the Origin is it or its sub domain,
+	// the cookie is host only if nothing matches
+	AllowedDomains []string `yaml:"allowed_domains" json:"allowed_domains"`
+	// SameSite lax, strict or none, not set if empty
+	SameSite        string `yaml:"same_site" json:"same_site"`
+	Secure          bool   `yaml:"secure" json:"secure"`
+	DisableHTTPOnly bool   `yaml:"disable_http_only" json:"disable_http_only"`
+	// Partitioned the cookie is kept in the partitioned storage (CHIPS) of the top level site, requires Secure
+	Partitioned bool `yaml:"partitioned" json:"partitioned"`
+	// Prefix __Host- or __Secure-, it's prepended to the cookie names
+	Prefix string `yaml:"prefix" json:"prefix"`
+}
+
+// Validate the options which browsers would reject.
+func (opts *CookieOptions) Validate() error {
+	var errs []error
+
+	switch strings.ToLower(opts.SameSite) {
+	case CookieSameSiteDefault, CookieSameSiteLax, CookieSameSiteStrict:
+	case CookieSameSiteNone:
+		if !opts.secure() {
+			errs = append(errs, cuserror.NewWithErrorMsg("same_site none requires secure"))
+		}
+	default:
+		errs = append(errs, cuserror.NewWithErrorMsg(fmt.Sprintf("invalid same_site %v", opts.SameSite)))
+	}
+
+	if opts.Partitioned && !opts.secure() {
+		errs = append(errs, cuserror.NewWithErrorMsg("partitioned requires secure"))
+	}
+
+	switch opts.Prefix {
+	case "", CookiePrefixSecure:
+	case CookiePrefixHost:
+		if opts.Domain != "" || len(opts.AllowedDomains) > 0 {
+			errs = append(errs, cuserror.NewWithErrorMsg("__Host- cookies can't have a domain"))
+		}
+
+		if opts.Path != "" && opts.Path != "/" {
+			errs = append(errs, cuserror.NewWithErrorMsg("the path of __Host- cookies must be /"))
+		}
+	default:
+		errs = append(errs, cuserror.NewWithErrorMsg(fmt.Sprintf("invalid prefix %v", opts.Prefix)))
+	}
+
+	for _, domain := range opts.AllowedDomains {
+		if normalizeCookieDomain(domain) == "" {
+			errs = append(errs, cuserror.NewWithErrorMsg("empty domain in allowed_domains"))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// secure the prefixed cookies are always Secure.
+func (opts *CookieOptions) secure() bool {
+	return opts.Secure || opts.Prefix != ""
+}
+
+// Name returns the cookie name with the prefix.
+func (opts *CookieOptions) Name(name string) string {
+	return opts.Prefix + name
+}
+
+func (opts *CookieOptions) domain(origin string) string {
+	if opts.Prefix == CookiePrefixHost {
+		return ""
+	}
+
+	if opts.Domain != "" {
+		return opts.Domain
+	}
+
+	host := strings.ToLower(hostOfOrigin(origin))
+	if host == "" {
+		return ""
+	}
+
+	for _, allowed := range opts.AllowedDomains {
+		domain := normalizeCookieDomain(allowed)
+		if domain != "" && (host == domain || strings.HasSuffix(host, "."+domain)) {
+			return domain
+		}
+	}
+
+	return ""
+}
+
+// NewHTTPCookie returns the Set-Cookie header value, origin is the Origin header of the request,
+// the cookie is deleted if maxAge < 0.
+func NewHTTPCookie(opts CookieOptions, origin, name, value string, maxAge int) (string, error) {
+	if name == "" {
+		return "", commerr.ErrInvalidArgument
+	}
+
+	if err := opts.Validate(); err != nil {
+		return "", err
+	}
+
+	cookie := http.Cookie{
+		Name:     opts.Name(name),
+		Value:    value,
+		Path:     opts.Path,
+		Domain:   opts.domain(origin),
+		MaxAge:   maxAge,
+		Secure:   opts.secure(),
+		HttpOnly: !opts.DisableHTTPOnly,
+	}
+
+	if cookie.Path == "" || opts.Prefix == CookiePrefixHost {
+		cookie.Path = "/"
+	}
+
+	switch strings.ToLower(opts.SameSite) {
+	case CookieSameSiteLax:
+		cookie.SameSite = http.SameSiteLaxMode
+	case CookieSameSiteStrict:
+		cookie.SameSite = http.SameSiteStrictMode
+	case CookieSameSiteNone:
+		cookie.SameSite = http.SameSiteNoneMode
+	}
+
+	s := cookie.String()
+	if s == "" {
+		return "", cuserror.NewWithErrorMsg(fmt.Sprintf("invalid cookie name %v", name))
+	}
+
+	if opts.Partitioned {
+		s += "; Partitioned"
+	}
+
+	return s, nil
+}
+
+// SetHTTPCookieWithOptions sends the cookie with the grpc response headers, the gateways (grpc-web, grpc-gateway)
+// pass it to the browser.
+func SetHTTPCookieWithOptions(ctx context.Context, opts CookieOptions, name, value string, maxAge int) error {
+	cookie, err := NewHTTPCookie(opts, OriginFromContext(ctx), name, value, maxAge)
+	if err != nil {
+		return err
+	}
+
+	return grpc.SendHeader(ctx, metadata.Pairs("Set-Cookie", cookie))
+}
+
+// UnsetHTTPCookieWithOptions the options must be the same as the ones setting the cookie.
+func UnsetHTTPCookieWithOptions(ctx context.Context, opts CookieOptions, name string) error {
+	return SetHTTPCookieWithOptions(ctx, opts, name, "", -1)
+}
+
+// WriteHTTPCookie adds the cookie to the response of the http handlers.
+func WriteHTTPCookie(w http.ResponseWriter, r *http.Request, opts CookieOptions, name, value string, maxAge int) error {
+	cookie, err := NewHTTPCookie(opts, r.Header.Get("Origin"), name, value, maxAge)
+	if err != nil {
+		return err
+	}
+
+	w.Header().Add("Set-Cookie", cookie)
+
+	return nil
+}
+
+// GetCookieStringWithOptions reads the cookie set with opts.
+func GetCookieStringWithOptions(ctx context.Context, opts CookieOptions, name string) string {
+	return GetCookieStringFromContext(ctx, opts.Name(name))
+}
+
+// OriginFromContext the Origin header passed by the gateways.
+func OriginFromContext(ctx context.Context) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+
+	values := md.Get("origin")
+	if len(values) == 0 {
+		return ""
+	}
+
+	return values[0]
+}
+
+func hostOfOrigin(origin string) string {
+	if idx := strings.Index(origin, "://"); idx != -1 {
+		origin = origin[idx+3:]
+	}
+
+	if idx := strings.IndexAny(origin, "/?#"); idx != -1 {
+		origin = origin[:idx]
+	}
+
+	if strings.HasPrefix(origin, "[") {
+		if idx := strings.Index(origin, "]"); idx != -1 {
+			return origin[1:idx]
+		}
+	}
+
+	if idx := strings.LastIndex(origin, ":"); idx != -1 {
+		origin = origin[:idx]
+	}
+
+	return origin
+}
+
+func normalizeCookieDomain(domain string) string {
+	return strings.ToLower(strings.TrimPrefix(strings.TrimSpace(domain), "."))
+}
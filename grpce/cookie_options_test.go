@@ -0,0 +1,67 @@
+package grpce
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewHTTPCookie(t *testing.T) {
+	cookie, err := NewHTTPCookie(CookieOptions{}, "https://a.com", "k", "v", 10)
+	assert.Nil(t, err)
+	assert.Equal(t, "k=v; Path=/; Max-Age=10; HttpOnly", cookie)
+
+	opts := CookieOptions{
+		AllowedDomains: []string{".a.com", "b.com"},
+		SameSite:       CookieSameSiteNone,
+		Secure:         true,
+		Partitioned:    true,
+	}
+
+	cookie, err = NewHTTPCookie(opts, "https://x.a.com:8443", "k", "v", 10)
+	assert.Nil(t, err)
+	assert.Contains(t, cookie, "Domain=a.com")
+	assert.Contains(t, cookie, "SameSite=None")
+	assert.Contains(t, cookie, "Secure")
+	assert.True(t, strings.HasSuffix(cookie, "; Partitioned"))
+
+	cookie, err = NewHTTPCookie(opts, "https://evil-a.com", "k", "v", 10)
+	assert.Nil(t, err)
+	assert.NotContains(t, cookie, "Domain=")
+
+	cookie, err = NewHTTPCookie(CookieOptions{Prefix: CookiePrefixHost}, "https://a.com", "k", "v", -1)
+	assert.Nil(t, err)
+	assert.Equal(t, "__Host-k=v; Path=/; Max-Age=0; HttpOnly; Secure", cookie)
+
+	_, err = NewHTTPCookie(CookieOptions{SameSite: CookieSameSiteNone}, "", "k", "v", 10)
+	assert.NotNil(t, err)
+
+	_, err = NewHTTPCookie(CookieOptions{Partitioned: true}, "", "k", "v", 10)
+	assert.NotNil(t, err)
+
+	_, err = NewHTTPCookie(CookieOptions{Prefix: CookiePrefixHost, Domain: "a.com"}, "", "k", "v", 10)
+	assert.NotNil(t, err)
+
+	_, err = NewHTTPCookie(CookieOptions{SameSite: "x"}, "", "k", "v", 10)
+	assert.NotNil(t, err)
+}
+
+func TestWriteHTTPCookie(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Origin", "https://a.com")
+
+	w := httptest.NewRecorder()
+
+	err := WriteHTTPCookie(w, r, CookieOptions{Domain: "a.com", Prefix: CookiePrefixSecure}, "k", "v", 10)
+	assert.Nil(t, err)
+	assert.Equal(t, "__Secure-k=v; Path=/; Domain=a.com; Max-Age=10; HttpOnly; Secure", w.Header().Get("Set-Cookie"))
+}
+
+func TestHostOfOrigin(t *testing.T) {
+	assert.Equal(t, "a.com", hostOfOrigin("https://a.com:80"))
+	assert.Equal(t, "::1", hostOfOrigin("http://[::1]:80"))
+	assert.Equal(t, "a.com", hostOfOrigin("a.com"))
+}
@@ -0,0 +1,384 @@
+package interceptors
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/sgostarter/i/l"
+	"github.com/sgostarter/libeasygo/cuserror"
+	"github.com/sgostarter/libservicetoolset/grpce/apikey"
+	"github.com/sgostarter/libservicetoolset/grpce/auth"
+	"github.com/sgostarter/libservicetoolset/grpce/spiffe"
+	"github.com/sgostarter/libservicetoolset/grpce/utils"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	AuthzEffectAllow = "allow"
+	AuthzEffectDeny  = "deny"
+
+	defaultRolesClaim  = "roles"
+	defaultScopesClaim = "scope"
+)
+
+// AuthzPolicy applies to the methods matching any of Methods (see utils.MethodMatcher), and to the callers matching
+// all the non-empty conditions: any of Roles, all of Scopes, any of SPIFFEIDs and any of CommonNames.
+// A policy without conditions matches every caller.
+type AuthzPolicy struct {
+	Name    string   `yaml:"name" json:"name"`
+	Methods []string `yaml:"methods" json:"methods"`
+	// Effect allow or deny, allow if empty
+	Effect string   `yaml:"effect" json:"effect"`
+	Roles  []string `yaml:"roles" json:"roles"`
+	Scopes []string `yaml:"scopes" json:"scopes"`
+	// SPIFFEIDs the ids, or the prefixes ending with /* (spiffe://example.org/ns/prod/*)
+	SPIFFEIDs   []string `yaml:"spiffe_ids" json:"spiffe_ids"`
+	CommonNames []string `yaml:"common_names" json:"common_names"`
+}
+
+// AuthzConfig the policies are evaluated with deny-overrides: a call is denied if any deny policy matches it,
+// else allowed if any allow policy matches it, else denied if any policy applies to the method, else
+// DefaultEffect decides.
+type AuthzConfig struct {
+	Policies []AuthzPolicy `yaml:"policies" json:"policies"`
+	// DefaultEffect of the methods without policies, allow if empty
+	DefaultEffect string `yaml:"default_effect" json:"default_effect"`
+	// DryRun logs the decisions without enforcing them
+	DryRun bool `yaml:"dry_run" json:"dry_run"`
+	// RolesClaim and ScopesClaim the jwt claims of the roles and the scopes, roles and scope if empty
+	RolesClaim  string `yaml:"roles_claim" json:"roles_claim"`
+	ScopesClaim string `yaml:"scopes_claim" json:"scopes_claim"`
+}
+
+func validAuthzEffect(effect string) bool {
+	return effect == "" || effect == AuthzEffectAllow || effect == AuthzEffectDeny
+}
+
+func (cfg *AuthzConfig) Validate() error {
+	var errs []error
+
+	if !validAuthzEffect(cfg.DefaultEffect) {
+		errs = append(errs, cuserror.NewWithErrorMsg(fmt.Sprintf("default_effect: invalid effect %q", cfg.DefaultEffect)))
+	}
+
+	for idx, policy := range cfg.Policies {
+		if len(policy.Methods) == 0 {
+			errs = append(errs, cuserror.NewWithErrorMsg(fmt.Sprintf("policies[%v].methods: empty", idx)))
+		}
+
+		if _, err := utils.NewMethodMatcher(policy.Methods); err != nil {
+			errs = append(errs, cuserror.NewWithErrorMsg(fmt.Sprintf("policies[%v].methods: %v", idx, err)))
+		}
+
+		if !validAuthzEffect(policy.Effect) {
+			errs = append(errs, cuserror.NewWithErrorMsg(fmt.Sprintf("policies[%v].effect: invalid effect %q",
+				idx, policy.Effect)))
+		}
+
+		for _, id := range policy.SPIFFEIDs {
+			if !strings.HasPrefix(id, "spiffe://") {
+				errs = append(errs, cuserror.NewWithErrorMsg(fmt.Sprintf("policies[%v].spiffe_ids: invalid spiffe id %q",
+					idx, id)))
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// LoadAuthzConfigFile loads the yaml (or json, which is yaml too) policy file.
+func LoadAuthzConfigFile(file string) (*AuthzConfig, error) {
+	d, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &AuthzConfig{}
+
+	if err = yaml.Unmarshal(d, cfg); err != nil {
+		return nil, cuserror.NewWithErrorMsg(fmt.Sprintf("parse authz file %v failed: %v", file, err))
+	}
+
+	return cfg, nil
+}
+
+// Principal the identity of the caller the policies are evaluated against.
+type Principal struct {
+	Subject     string
+	Roles       []string
+	Scopes      []string
+	SPIFFEID    string
+	CommonNames []string
+}
+
+func (p *Principal) authenticated() bool {
+	return p.Subject != "" || p.SPIFFEID != "" || len(p.CommonNames) > 0
+}
+
+// PrincipalResolver returns the principal of the call.
+type PrincipalResolver func(ctx context.Context) *Principal
+
+// NewDefaultPrincipalResolver reads the subject, the roles and the scopes from auth.ClaimsFromContext, or the name
+// and the roles from apikey.PrincipalFromContext, the spiffe id from spiffe.PeerIDFromContext, and the common names
+// (and the spiffe id if not set) from the verified client certificates.
+func NewDefaultPrincipalResolver(rolesClaim, scopesClaim string) PrincipalResolver {
+	if rolesClaim == "" {
+		rolesClaim = defaultRolesClaim
+	}
+
+	if scopesClaim == "" {
+		scopesClaim = defaultScopesClaim
+	}
+
+	return func(ctx context.Context) *Principal {
+		principal := &Principal{}
+
+		if claims, ok := auth.ClaimsFromContext(ctx); ok {
+			principal.Subject = claims.Subject
+			principal.Roles = claims.Strings(rolesClaim)
+			principal.Scopes = claims.Strings(scopesClaim)
+		} else if p, ok := apikey.PrincipalFromContext(ctx); ok {
+			principal.Subject = p.Name
+			principal.Roles = p.Roles
+		}
+
+		if id, ok := spiffe.PeerIDFromContext(ctx); ok {
+			principal.SPIFFEID = id.String()
+		}
+
+		clientPeer, ok := peer.FromContext(ctx)
+		if !ok {
+			return principal
+		}
+
+		tlsInfo, ok := clientPeer.AuthInfo.(credentials.TLSInfo)
+		if !ok || len(tlsInfo.State.VerifiedChains) == 0 || len(tlsInfo.State.PeerCertificates) == 0 {
+			return principal
+		}
+
+		leaf := tlsInfo.State.PeerCertificates[0]
+
+		if leaf.Subject.CommonName != "" {
+			principal.CommonNames = append(principal.CommonNames, leaf.Subject.CommonName)
+		}
+
+		if principal.SPIFFEID == "" && tlsInfo.SPIFFEID != nil {
+			principal.SPIFFEID = tlsInfo.SPIFFEID.String()
+		}
+
+		return principal
+	}
+}
+
+type authzPolicy struct {
+	AuthzPolicy
+	methods *utils.MethodMatcher
+}
+
+func (policy *authzPolicy) matchPrincipal(p *Principal) bool {
+	if len(policy.Roles) > 0 && !containsAny(policy.Roles, p.Roles) {
+		return false
+	}
+
+	for _, scope := range policy.Scopes {
+		if !containsAny(p.Scopes, []string{scope}) {
+			return false
+		}
+	}
+
+	if len(policy.SPIFFEIDs) > 0 && !matchSPIFFEID(policy.SPIFFEIDs, p.SPIFFEID) {
+		return false
+	}
+
+	if len(policy.CommonNames) > 0 && !containsAny(policy.CommonNames, p.CommonNames) {
+		return false
+	}
+
+	return true
+}
+
+func containsAny(ss, candidates []string) bool {
+	for _, s := range ss {
+		for _, candidate := range candidates {
+			if s == candidate {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func matchSPIFFEID(patterns []string, id string) bool {
+	if id == "" {
+		return false
+	}
+
+	for _, pattern := range patterns {
+		if strings.HasSuffix(pattern, "/*") {
+			if strings.HasPrefix(id, pattern[:len(pattern)-1]) {
+				return true
+			}
+		} else if pattern == id {
+			return true
+		}
+	}
+
+	return false
+}
+
+// AuthzDecision the result of Authorizer.Decide.
+type AuthzDecision struct {
+	Allowed bool
+	// Policy the name (or the index) of the deciding policy, empty if DefaultEffect decided
+	Policy string
+	Reason string
+}
+
+// Authorizer evaluates the AuthzConfig policies after the authentication interceptors.
+type Authorizer struct {
+	cfg      AuthzConfig
+	policies []*authzPolicy
+	resolver PrincipalResolver
+	logger   l.Wrapper
+}
+
+// NewAuthorizer resolver is NewDefaultPrincipalResolver if nil.
+func NewAuthorizer(cfg AuthzConfig, resolver PrincipalResolver, logger l.Wrapper) (*Authorizer, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	if logger == nil {
+		logger = l.NewNopLoggerWrapper()
+	}
+
+	if resolver == nil {
+		resolver = NewDefaultPrincipalResolver(cfg.RolesClaim, cfg.ScopesClaim)
+	}
+
+	a := &Authorizer{
+		cfg:      cfg,
+		resolver: resolver,
+		logger:   logger.WithFields(l.StringField(l.ClsKey, "Authorizer")),
+	}
+
+	for idx, policy := range cfg.Policies {
+		if policy.Name == "" {
+			policy.Name = fmt.Sprintf("policies[%v]", idx)
+		}
+
+		methods, _ := utils.NewMethodMatcher(policy.Methods)
+
+		a.policies = append(a.policies, &authzPolicy{
+			AuthzPolicy: policy,
+			methods:     methods,
+		})
+	}
+
+	return a, nil
+}
+
+// Decide evaluates the policies of fullMethod for p.
+func (a *Authorizer) Decide(fullMethod string, p *Principal) AuthzDecision {
+	var (
+		applied bool
+		allowed *authzPolicy
+	)
+
+	for _, policy := range a.policies {
+		if !policy.methods.Match(fullMethod) {
+			continue
+		}
+
+		applied = true
+
+		if !policy.matchPrincipal(p) {
+			continue
+		}
+
+		if policy.Effect == AuthzEffectDeny {
+			return AuthzDecision{Policy: policy.Name, Reason: "denied by policy"}
+		}
+
+		if allowed == nil {
+			allowed = policy
+		}
+	}
+
+	if allowed != nil {
+		return AuthzDecision{Allowed: true, Policy: allowed.Name, Reason: "allowed by policy"}
+	}
+
+	if applied {
+		return AuthzDecision{Reason: "no policy allows"}
+	}
+
+	if a.cfg.DefaultEffect == AuthzEffectDeny {
+		return AuthzDecision{Reason: "denied by default"}
+	}
+
+	return AuthzDecision{Allowed: true, Reason: "allowed by default"}
+}
+
+// Authorize returns PERMISSION_DENIED (UNAUTHENTICATED for the anonymous callers) if the call is denied and
+// not in the dry run mode.
+func (a *Authorizer) Authorize(ctx context.Context, fullMethod string) error {
+	p := a.resolver(ctx)
+	if p == nil {
+		p = &Principal{}
+	}
+
+	decision := a.Decide(fullMethod, p)
+
+	if a.cfg.DryRun {
+		a.logger.WithFields(l.StringField("method", fullMethod), l.StringField("subject", p.Subject),
+			l.StringField("spiffeID", p.SPIFFEID), l.StringField("policy", decision.Policy),
+			l.StringField("reason", decision.Reason), l.BoolField("allowed", decision.Allowed)).Info("authzDryRunDecision")
+
+		return nil
+	}
+
+	if decision.Allowed {
+		return nil
+	}
+
+	a.logger.WithFields(l.StringField("method", fullMethod), l.StringField("subject", p.Subject),
+		l.StringField("spiffeID", p.SPIFFEID), l.StringField("policy", decision.Policy),
+		l.StringField("reason", decision.Reason)).Warn("authzDenied")
+
+	if !p.authenticated() {
+		return status.Errorf(codes.Unauthenticated, "%v requires authentication", fullMethod)
+	}
+
+	return status.Errorf(codes.PermissionDenied, "not allowed to call %v", fullMethod)
+}
+
+func (a *Authorizer) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (
+		interface{}, error) {
+		if err := a.Authorize(ctx, info.FullMethod); err != nil {
+			return nil, err
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+func (a *Authorizer) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := a.Authorize(ss.Context(), info.FullMethod); err != nil {
+			return err
+		}
+
+		return handler(srv, ss)
+	}
+}
@@ -0,0 +1,107 @@
+package interceptors
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sgostarter/libservicetoolset/grpce/auth"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const testAuthzYAML = `
+default_effect: deny
+policies:
+  - name: public
+    methods: [/pkg.Public/*]
+  - name: readers
+    methods: [/pkg.Svc/Get, /pkg.Svc/List]
+    roles: [reader, admin]
+  - name: writers
+    methods: [/pkg.Svc/Put]
+    roles: [admin]
+    scopes: [write]
+  - name: workloads
+    methods: [/pkg.Svc/*]
+    spiffe_ids: [spiffe://example.org/ns/prod/*]
+  - name: banned
+    effect: deny
+    methods: ["*"]
+    roles: [banned]
+`
+
+func TestAuthorizerDecide(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "authz.yaml")
+	assert.Nil(t, os.WriteFile(file, []byte(testAuthzYAML), 0600))
+
+	cfg, err := LoadAuthzConfigFile(file)
+	assert.Nil(t, err)
+
+	a, err := NewAuthorizer(*cfg, nil, nil)
+	assert.Nil(t, err)
+
+	for _, c := range []struct {
+		method  string
+		p       Principal
+		allowed bool
+		policy  string
+	}{
+		{"/pkg.Public/A", Principal{}, true, "public"},
+		{"/pkg.Svc/Get", Principal{Subject: "u", Roles: []string{"reader"}}, true, "readers"},
+		{"/pkg.Svc/Get", Principal{Subject: "u"}, false, ""},
+		{"/pkg.Svc/Put", Principal{Subject: "u", Roles: []string{"admin"}}, false, ""},
+		{"/pkg.Svc/Put", Principal{Subject: "u", Roles: []string{"admin"}, Scopes: []string{"read", "write"}}, true, "writers"},
+		{"/pkg.Svc/Put", Principal{SPIFFEID: "spiffe://example.org/ns/prod/sa/api"}, true, "workloads"},
+		{"/pkg.Svc/Put", Principal{SPIFFEID: "spiffe://example.org/ns/dev/sa/api"}, false, ""},
+		{"/pkg.Svc/Get", Principal{Subject: "u", Roles: []string{"reader", "banned"}}, false, "banned"},
+		{"/pkg.Public/A", Principal{Subject: "u", Roles: []string{"banned"}}, false, "banned"},
+		{"/pkg.Other/A", Principal{Subject: "u", Roles: []string{"admin"}}, false, ""},
+	} {
+		decision := a.Decide(c.method, &c.p)
+		assert.Equal(t, c.allowed, decision.Allowed, "%v %+v", c.method, c.p)
+		assert.Equal(t, c.policy, decision.Policy, "%v %+v", c.method, c.p)
+	}
+
+	_, err = NewAuthorizer(AuthzConfig{Policies: []AuthzPolicy{{Methods: []string{"pkg"}, Effect: "maybe"}}}, nil, nil)
+	assert.NotNil(t, err)
+}
+
+func TestAuthorizerInterceptor(t *testing.T) {
+	cfg := AuthzConfig{
+		Policies: []AuthzPolicy{
+			{Methods: []string{"/pkg.Svc/Put"}, Roles: []string{"admin"}},
+		},
+	}
+
+	handler := func(context.Context, interface{}) (interface{}, error) {
+		return "ok", nil
+	}
+
+	fnCall := func(a *Authorizer, ctx context.Context, method string) codes.Code {
+		_, err := a.UnaryServerInterceptor()(ctx, nil, &grpc.UnaryServerInfo{FullMethod: method}, handler)
+
+		return status.Code(err)
+	}
+
+	a, err := NewAuthorizer(cfg, nil, nil)
+	assert.Nil(t, err)
+
+	ctx := context.Background()
+	userCtx := auth.WithClaims(ctx, &auth.Claims{Subject: "u", Raw: map[string]interface{}{"roles": []interface{}{"user"}}})
+	adminCtx := auth.WithClaims(ctx, &auth.Claims{Subject: "u", Raw: map[string]interface{}{"roles": "admin"}})
+
+	assert.Equal(t, codes.OK, fnCall(a, ctx, "/pkg.Svc/Get"))
+	assert.Equal(t, codes.Unauthenticated, fnCall(a, ctx, "/pkg.Svc/Put"))
+	assert.Equal(t, codes.PermissionDenied, fnCall(a, userCtx, "/pkg.Svc/Put"))
+	assert.Equal(t, codes.OK, fnCall(a, adminCtx, "/pkg.Svc/Put"))
+
+	cfg.DryRun = true
+	a, err = NewAuthorizer(cfg, nil, nil)
+	assert.Nil(t, err)
+
+	assert.Equal(t, codes.OK, fnCall(a, userCtx, "/pkg.Svc/Put"))
+}
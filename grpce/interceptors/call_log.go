@@ -0,0 +1,439 @@
+package interceptors
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/sgostarter/i/l"
+	"github.com/sgostarter/libeasygo/cuserror"
+	"github.com/sgostarter/libservicetoolset/grpce"
+	"github.com/sgostarter/libservicetoolset/grpce/meta"
+	"github.com/sgostarter/libservicetoolset/grpce/utils"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+const (
+	CallLogLevelNone  = "none"
+	CallLogLevelDebug = "debug"
+	CallLogLevelInfo  = "info"
+	CallLogLevelWarn  = "warn"
+	CallLogLevelError = "error"
+
+	RedactedValue = "[REDACTED]"
+
+	defaultMaxPayloadSize = 4096
+)
+
+// DefaultRedactFields the field names redacted if CallLogConfig.RedactFields is nil.
+var DefaultRedactFields = []string{"password", "passwd", "secret", "token", "access_token", "refresh_token",
+	"authorization", "api_key", "apikey", "cookie"}
+
+var callLogLevels = map[string]int{
+	CallLogLevelNone:  0,
+	CallLogLevelDebug: 1,
+	CallLogLevelInfo:  2,
+	CallLogLevelWarn:  3,
+	CallLogLevelError: 4,
+}
+
+// RedactFunc reports whether the field of the payload of fullMethod should be redacted, path is the dotted
+// path of the field names, e.g. user.password.
+type RedactFunc func(fullMethod, path string, fd protoreflect.FieldDescriptor) bool
+
+// CallLogConfig the calls are logged as structured fields: method, peer, requestID, duration, code and sizes.
+// The failed calls and the slow calls are always logged, at least at the warn level.
+type CallLogConfig struct {
+	// Level none, debug, info, warn or error, info if empty
+	Level string `yaml:"level" json:"level"`
+	// MethodLevels overrides Level by method pattern, the most specific one is applied
+	MethodLevels map[string]string `yaml:"method_levels" json:"method_levels"`
+	// SampleRate the fraction of the successful calls logged, all of them if 0
+	SampleRate float64 `yaml:"sample_rate" json:"sample_rate"`
+	// SlowThreshold the calls taking longer are always logged, disabled if 0
+	SlowThreshold time.Duration `yaml:"slow_threshold" json:"slow_threshold"`
+	// LogPayload logs the redacted requests and responses
+	LogPayload bool `yaml:"log_payload" json:"log_payload"`
+	// MaxPayloadSize the payloads are truncated to the bytes, 4096 if 0
+	MaxPayloadSize int `yaml:"max_payload_size" json:"max_payload_size"`
+	// RedactFields the field names (case-insensitive) redacted in any message, DefaultRedactFields if nil.
+	// The fields with the debug_redact option are always redacted.
+	RedactFields []string `yaml:"redact_fields" json:"redact_fields"`
+	// RedactFunc redacts more fields
+	RedactFunc RedactFunc `yaml:"-" json:"-"`
+	// LogStreamMessages logs every message of the streams at the debug level, unless the method level is none
+	LogStreamMessages bool `yaml:"log_stream_messages" json:"log_stream_messages"`
+	// StreamStatsFunc receives the accounting of every stream when it ends, e.g. for the metrics
+	StreamStatsFunc func(ctx context.Context, stats *StreamStats) `yaml:"-" json:"-"`
+}
+
+func (cfg *CallLogConfig) Validate() error {
+	var errs []error
+
+	if _, ok := callLogLevels[cfg.Level]; !ok && cfg.Level != "" {
+		errs = append(errs, cuserror.NewWithErrorMsg(fmt.Sprintf("level: unknown level %q", cfg.Level)))
+	}
+
+	for pattern, level := range cfg.MethodLevels {
+		if !utils.ValidMethodPattern(pattern) {
+			errs = append(errs, cuserror.NewWithErrorMsg(fmt.Sprintf("method_levels.%v: invalid method pattern", pattern)))
+		}
+
+		if _, ok := callLogLevels[level]; !ok {
+			errs = append(errs, cuserror.NewWithErrorMsg(fmt.Sprintf("method_levels.%v: unknown level %q", pattern, level)))
+		}
+	}
+
+	if cfg.SampleRate < 0 || cfg.SampleRate > 1 {
+		errs = append(errs, cuserror.NewWithErrorMsg("sample_rate: should be in [0, 1]"))
+	}
+
+	if cfg.SlowThreshold < 0 || cfg.MaxPayloadSize < 0 {
+		errs = append(errs, cuserror.NewWithErrorMsg("slow_threshold and max_payload_size should not be negative"))
+	}
+
+	return errors.Join(errs...)
+}
+
+// CallLogger logs the calls with the structured fields instead of the payload dumps of ServerLogInterceptor.
+type CallLogger struct {
+	cfg          CallLogConfig
+	redactFields map[string]bool
+	logger       l.Wrapper
+}
+
+func NewCallLogger(cfg CallLogConfig, logger l.Wrapper) (*CallLogger, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	if logger == nil {
+		logger = l.NewNopLoggerWrapper()
+	}
+
+	if cfg.Level == "" {
+		cfg.Level = CallLogLevelInfo
+	}
+
+	if cfg.MaxPayloadSize == 0 {
+		cfg.MaxPayloadSize = defaultMaxPayloadSize
+	}
+
+	if cfg.RedactFields == nil {
+		cfg.RedactFields = DefaultRedactFields
+	}
+
+	cl := &CallLogger{
+		cfg:          cfg,
+		redactFields: make(map[string]bool, len(cfg.RedactFields)),
+		logger:       logger.WithFields(l.StringField(l.ClsKey, "CallLogger")),
+	}
+
+	for _, name := range cfg.RedactFields {
+		cl.redactFields[strings.ToLower(name)] = true
+	}
+
+	return cl, nil
+}
+
+func (cl *CallLogger) level(fullMethod string) string {
+	level, priority := cl.cfg.Level, 0
+
+	for pattern, methodLevel := range cl.cfg.MethodLevels {
+		if p := utils.MatchMethodPattern(pattern, fullMethod); p > priority {
+			level, priority = methodLevel, p
+		}
+	}
+
+	return level
+}
+
+func (cl *CallLogger) shouldRedact(fullMethod, path string, fd protoreflect.FieldDescriptor) bool {
+	if cl.redactFields[strings.ToLower(string(fd.Name()))] || cl.redactFields[strings.ToLower(fd.JSONName())] {
+		return true
+	}
+
+	if opts, ok := fd.Options().(*descriptorpb.FieldOptions); ok && opts.GetDebugRedact() {
+		return true
+	}
+
+	return cl.cfg.RedactFunc != nil && cl.cfg.RedactFunc(fullMethod, path, fd)
+}
+
+func (cl *CallLogger) redactMessage(fullMethod, prefix string, m protoreflect.Message) {
+	m.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		path := string(fd.Name())
+		if prefix != "" {
+			path = prefix + "." + path
+		}
+
+		if cl.shouldRedact(fullMethod, path, fd) {
+			if fd.Kind() == protoreflect.StringKind && !fd.IsList() && !fd.IsMap() {
+				m.Set(fd, protoreflect.ValueOfString(RedactedValue))
+			} else {
+				m.Clear(fd)
+			}
+
+			return true
+		}
+
+		switch {
+		case fd.IsMap():
+			if fd.MapValue().Kind() == protoreflect.MessageKind {
+				v.Map().Range(func(_ protoreflect.MapKey, mv protoreflect.Value) bool {
+					cl.redactMessage(fullMethod, path, mv.Message())
+
+					return true
+				})
+			}
+		case fd.IsList():
+			if fd.Kind() == protoreflect.MessageKind || fd.Kind() == protoreflect.GroupKind {
+				for idx := 0; idx < v.List().Len(); idx++ {
+					cl.redactMessage(fullMethod, path, v.List().Get(idx).Message())
+				}
+			}
+		case fd.Kind() == protoreflect.MessageKind || fd.Kind() == protoreflect.GroupKind:
+			cl.redactMessage(fullMethod, path, v.Message())
+		}
+
+		return true
+	})
+}
+
+func (cl *CallLogger) redactValue(v interface{}) interface{} {
+	switch value := v.(type) {
+	case map[string]interface{}:
+		for k, item := range value {
+			if cl.redactFields[strings.ToLower(k)] {
+				value[k] = RedactedValue
+			} else {
+				value[k] = cl.redactValue(item)
+			}
+		}
+	case []interface{}:
+		for idx, item := range value {
+			value[idx] = cl.redactValue(item)
+		}
+	}
+
+	return v
+}
+
+// Payload returns the redacted and truncated json of the payload.
+func (cl *CallLogger) Payload(fullMethod string, payload interface{}) string {
+	if payload == nil {
+		return ""
+	}
+
+	var (
+		d   []byte
+		err error
+	)
+
+	if m, ok := payload.(proto.Message); ok {
+		if !m.ProtoReflect().IsValid() {
+			return ""
+		}
+
+		m = proto.Clone(m)
+		cl.redactMessage(fullMethod, "", m.ProtoReflect())
+
+		d, err = protojson.Marshal(m)
+	} else if d, err = json.Marshal(payload); err == nil {
+		var v interface{}
+
+		if err = json.Unmarshal(d, &v); err == nil {
+			d, err = json.Marshal(cl.redactValue(v))
+		}
+	}
+
+	if err != nil {
+		return fmt.Sprintf("<marshal failed: %v>", err)
+	}
+
+	if len(d) > cl.cfg.MaxPayloadSize {
+		return fmt.Sprintf("%s...(%d bytes truncated)", d[:cl.cfg.MaxPayloadSize], len(d)-cl.cfg.MaxPayloadSize)
+	}
+
+	return string(d)
+}
+
+func payloadSize(payload interface{}) int {
+	if m, ok := payload.(proto.Message); ok {
+		return proto.Size(m)
+	}
+
+	return -1
+}
+
+func errorCodeLevel(code codes.Code) string {
+	switch code {
+	case codes.Unknown, codes.Internal, codes.DataLoss, codes.Unavailable, codes.DeadlineExceeded:
+		return CallLogLevelError
+	}
+
+	return CallLogLevelWarn
+}
+
+// statusError converts the context errors returned by the handlers to their status like the grpc server does.
+func statusError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+
+	return status.FromContextError(err).Err()
+}
+
+type callLogEntry struct {
+	event  string
+	method string
+	peer   string
+	st     time.Time
+	req    interface{}
+	resp   interface{}
+	err    error
+	stats  *StreamStats
+}
+
+func (cl *CallLogger) log(ctx context.Context, entry *callLogEntry) {
+	duration := time.Since(entry.st)
+	code := status.Code(statusError(entry.err))
+	level := cl.level(entry.method)
+
+	switch {
+	case entry.err != nil:
+		if errLevel := errorCodeLevel(code); callLogLevels[level] < callLogLevels[errLevel] {
+			level = errLevel
+		}
+	case cl.cfg.SlowThreshold > 0 && duration >= cl.cfg.SlowThreshold:
+		if callLogLevels[level] < callLogLevels[CallLogLevelWarn] {
+			level = CallLogLevelWarn
+		}
+	case level == CallLogLevelNone:
+		return
+	case cl.cfg.SampleRate > 0 && rand.Float64() >= cl.cfg.SampleRate: // nolint: gosec
+		return
+	}
+
+	fields := []l.Field{
+		l.StringField("method", entry.method),
+		l.StringField("peer", entry.peer),
+		l.StringField("requestID", meta.RequestIDFromContext(ctx)),
+		l.DurationField("duration", duration),
+		l.StringField("code", code.String()),
+	}
+
+	if entry.req != nil {
+		fields = append(fields, l.IntField("reqSize", payloadSize(entry.req)))
+	}
+
+	if entry.resp != nil {
+		fields = append(fields, l.IntField("respSize", payloadSize(entry.resp)))
+	}
+
+	if entry.stats != nil {
+		fields = append(fields, streamStatsFields(entry.stats)...)
+	}
+
+	if entry.err != nil {
+		fields = append(fields, l.StringField("error", status.Convert(entry.err).Message()))
+	}
+
+	if cl.cfg.LogPayload {
+		fields = append(fields, l.StringField("request", cl.Payload(entry.method, entry.req)),
+			l.StringField("response", cl.Payload(entry.method, entry.resp)))
+	}
+
+	logger := cl.logger.WithFields(fields...)
+
+	switch level {
+	case CallLogLevelDebug:
+		logger.Debug(entry.event)
+	case CallLogLevelInfo:
+		logger.Info(entry.event)
+	case CallLogLevelWarn:
+		logger.Warn(entry.event)
+	default:
+		logger.Error(entry.event)
+	}
+}
+
+func (cl *CallLogger) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (
+		interface{}, error) {
+		st := time.Now()
+
+		resp, err := handler(ctx, req)
+
+		cl.log(ctx, &callLogEntry{
+			event:  "serverCall",
+			method: info.FullMethod,
+			peer:   grpce.GrpcGetRealIP(ctx),
+			st:     st,
+			req:    req,
+			resp:   resp,
+			err:    err,
+		})
+
+		return resp, err
+	}
+}
+
+// StreamServerInterceptor counts the messages of the stream and logs the summary when the handler returns.
+func (cl *CallLogger) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx := ss.Context()
+		accounting := newStreamAccounting(info.FullMethod, time.Now())
+
+		err := handler(srv, &accountingServerStream{
+			ServerStream: ss,
+			cl:           cl,
+			method:       info.FullMethod,
+			accounting:   accounting,
+		})
+
+		cl.finishStream(ctx, "serverStream", grpce.GrpcGetRealIP(ctx), accounting, err)
+
+		return err
+	}
+}
+
+func (cl *CallLogger) UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn,
+		invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		st := time.Now()
+
+		err := invoker(ctx, method, req, reply, cc, opts...)
+
+		entry := &callLogEntry{
+			event:  "clientCall",
+			method: method,
+			peer:   cc.Target(),
+			st:     st,
+			req:    req,
+			err:    err,
+		}
+
+		if err == nil {
+			entry.resp = reply
+		}
+
+		cl.log(ctx, entry)
+
+		return err
+	}
+}
@@ -0,0 +1,203 @@
+package interceptors
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sgostarter/i/l"
+	"github.com/sgostarter/libservicetoolset/grpce/meta"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/known/typepb"
+)
+
+type testLogRecord struct {
+	level  l.Level
+	msg    string
+	fields map[string]interface{}
+}
+
+type testLogger struct {
+	lock    *sync.Mutex
+	records *[]testLogRecord
+	fields  []l.Field
+}
+
+func newTestLogger() *testLogger {
+	return &testLogger{
+		lock:    &sync.Mutex{},
+		records: &[]testLogRecord{},
+	}
+}
+
+func (logger *testLogger) SetLevel(l.Level) {}
+
+func (logger *testLogger) WithFields(fields ...l.Field) l.Logger {
+	return &testLogger{
+		lock:    logger.lock,
+		records: logger.records,
+		fields:  append(append([]l.Field{}, logger.fields...), fields...),
+	}
+}
+
+func (logger *testLogger) Log(level l.Level, a ...interface{}) {
+	logger.lock.Lock()
+	defer logger.lock.Unlock()
+
+	record := testLogRecord{
+		level:  level,
+		msg:    fmt.Sprint(a...),
+		fields: make(map[string]interface{}),
+	}
+
+	for _, field := range logger.fields {
+		record.fields[field.K] = field.V
+	}
+
+	*logger.records = append(*logger.records, record)
+}
+
+func (logger *testLogger) Logf(level l.Level, format string, a ...interface{}) {
+	logger.Log(level, fmt.Sprintf(format, a...))
+}
+
+func (logger *testLogger) take() []testLogRecord {
+	logger.lock.Lock()
+	defer logger.lock.Unlock()
+
+	records := *logger.records
+	*logger.records = nil
+
+	return records
+}
+
+func TestCallLoggerPayload(t *testing.T) {
+	cl, err := NewCallLogger(CallLogConfig{
+		RedactFields:   []string{"default_value", "oneofs"},
+		MaxPayloadSize: 1024,
+		RedactFunc: func(_, path string, _ protoreflect.FieldDescriptor) bool {
+			return path == "fields.json_name"
+		},
+	}, nil)
+	assert.Nil(t, err)
+
+	msg := &typepb.Type{
+		Name:   "t",
+		Oneofs: []string{"o1"},
+		Fields: []*typepb.Field{
+			{Name: "f1", JsonName: "f1json", DefaultValue: "secret1"},
+		},
+	}
+
+	payload := cl.Payload("/pkg.Svc/M", msg)
+	assert.Contains(t, payload, `"name":"t"`)
+	assert.Contains(t, payload, `"defaultValue":"[REDACTED]"`)
+	assert.Contains(t, payload, `"jsonName":"[REDACTED]"`)
+	assert.NotContains(t, payload, "secret1")
+	assert.NotContains(t, payload, "o1")
+	assert.NotContains(t, payload, "f1json")
+	// the message itself is untouched
+	assert.Equal(t, "secret1", msg.Fields[0].DefaultValue)
+
+	cl, err = NewCallLogger(CallLogConfig{}, nil)
+	assert.Nil(t, err)
+
+	payload = cl.Payload("/pkg.Svc/M", map[string]interface{}{
+		"user": map[string]interface{}{"Password": "p", "name": "n"},
+	})
+	assert.Equal(t, `{"user":{"Password":"[REDACTED]","name":"n"}}`, payload)
+
+	cl, err = NewCallLogger(CallLogConfig{MaxPayloadSize: 10}, nil)
+	assert.Nil(t, err)
+
+	payload = cl.Payload("/pkg.Svc/M", map[string]string{"k": strings.Repeat("v", 100)})
+	assert.True(t, strings.HasPrefix(payload, `{"k":"vvvv...(`))
+
+	var nilMsg *typepb.Type
+
+	assert.Equal(t, "", cl.Payload("/pkg.Svc/M", nilMsg))
+
+	_, err = NewCallLogger(CallLogConfig{Level: "loud", MethodLevels: map[string]string{"pkg": "info"}}, nil)
+	assert.NotNil(t, err)
+}
+
+func TestCallLoggerInterceptor(t *testing.T) {
+	logger := newTestLogger()
+
+	cl, err := NewCallLogger(CallLogConfig{
+		MethodLevels: map[string]string{
+			"/pkg.Health/*": CallLogLevelNone,
+			"/pkg.Svc/Get":  CallLogLevelDebug,
+		},
+		SlowThreshold: 20 * time.Millisecond,
+		LogPayload:    true,
+	}, l.NewWrapper(logger))
+	assert.Nil(t, err)
+
+	fnCall := func(method string, sleep time.Duration, retErr error) []testLogRecord {
+		_, _ = cl.UnaryServerInterceptor()(context.Background(), &typepb.Type{Name: "req"},
+			&grpc.UnaryServerInfo{FullMethod: method}, func(context.Context, interface{}) (interface{}, error) {
+				time.Sleep(sleep)
+
+				if retErr != nil {
+					return nil, retErr
+				}
+
+				return &typepb.Type{Name: "resp"}, nil
+			})
+
+		return logger.take()
+	}
+
+	records := fnCall("/pkg.Svc/Put", 0, nil)
+	assert.Len(t, records, 1)
+	assert.Equal(t, l.LevelInfo, records[0].level)
+	assert.Equal(t, "serverCall", records[0].msg)
+	assert.Equal(t, "/pkg.Svc/Put", records[0].fields["method"])
+	assert.Equal(t, "OK", records[0].fields["code"])
+	assert.Equal(t, `{"name":"resp"}`, records[0].fields["response"])
+
+	records = fnCall("/pkg.Svc/Get", 0, nil)
+	assert.Len(t, records, 1)
+	assert.Equal(t, l.LevelDebug, records[0].level)
+
+	// the request id of the caller is logged
+	_, _ = cl.UnaryServerInterceptor()(metadata.NewIncomingContext(context.Background(),
+		metadata.Pairs(meta.RequestIDOnMetaData, "r1")), nil, &grpc.UnaryServerInfo{FullMethod: "/pkg.Svc/Put"},
+		func(context.Context, interface{}) (interface{}, error) {
+			return nil, nil
+		})
+
+	records = logger.take()
+	assert.Len(t, records, 1)
+	assert.Equal(t, "r1", records[0].fields["requestID"])
+
+	assert.Len(t, fnCall("/pkg.Health/Check", 0, nil), 0)
+
+	records = fnCall("/pkg.Health/Check", 0, status.Error(codes.Internal, "boom"))
+	assert.Len(t, records, 1)
+	assert.Equal(t, l.LevelError, records[0].level)
+	assert.Equal(t, "Internal", records[0].fields["code"])
+	assert.Equal(t, "boom", records[0].fields["error"])
+
+	records = fnCall("/pkg.Health/Check", 0, status.Error(codes.NotFound, "no"))
+	assert.Len(t, records, 1)
+	assert.Equal(t, l.LevelWarn, records[0].level)
+
+	records = fnCall("/pkg.Health/Check", 30*time.Millisecond, nil)
+	assert.Len(t, records, 1)
+	assert.Equal(t, l.LevelWarn, records[0].level)
+
+	cl.cfg.SampleRate = 0.000001
+
+	assert.Len(t, fnCall("/pkg.Svc/Put", 0, nil), 0)
+	assert.Len(t, fnCall("/pkg.Svc/Put", 0, status.Error(codes.NotFound, "no")), 1)
+}
@@ -2,37 +2,106 @@ package interceptors
 
 import (
 	"context"
+	"fmt"
 
+	"github.com/sgostarter/libeasygo/cuserror"
 	"github.com/sgostarter/libservicetoolset/grpce/meta"
 	"github.com/sgostarter/libservicetoolset/grpce/utils"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
 )
 
-func ServerIDInterceptor(transKeys []string) grpc.UnaryServerInterceptor {
+// RequestInfoConfig the config of ServerRequestInfoInterceptor.
+type RequestInfoConfig struct {
+	// Generator random (default), uuidv7 or snowflake
+	Generator     string `yaml:"generator" json:"generator"`
+	SnowflakeNode int64  `yaml:"snowflake_node" json:"snowflake_node"`
+	// Echo sends the request id back in the response header
+	Echo bool `yaml:"echo" json:"echo"`
+}
+
+func (cfg *RequestInfoConfig) Validate() error {
+	if _, err := cfg.NewIDGenerator(); err != nil {
+		return cuserror.NewWithErrorMsg(fmt.Sprintf("generator: %v", err))
+	}
+
+	return nil
+}
+
+func (cfg *RequestInfoConfig) NewIDGenerator() (meta.IDGenerator, error) {
+	return meta.NewIDGenerator(cfg.Generator, cfg.SnowflakeNode)
+}
+
+// ServerRequestInfoInterceptor stores the request info of the caller (see meta.ServerRequestInfo) in the context
+// of the handler, the request id is sent back in the response header if echo is true.
+func ServerRequestInfoInterceptor(gen meta.IDGenerator, service string, echo bool) grpc.UnaryServerInterceptor {
 	return func(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (
 		resp interface{}, err error) {
-		return handler(meta.TransferContextMeta(ctx, transKeys), req)
+		info := meta.ServerRequestInfo(ctx, gen, service)
+
+		if echo {
+			_ = grpc.SetHeader(ctx, metadata.Pairs(meta.RequestIDOnMetaData, info.ID))
+		}
+
+		return handler(meta.WithRequestInfo(ctx, info), req)
 	}
 }
 
+func ServerStreamRequestInfoInterceptor(gen meta.IDGenerator, service string, echo bool) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		info := meta.ServerRequestInfo(ss.Context(), gen, service)
+
+		if echo {
+			_ = ss.SetHeader(metadata.Pairs(meta.RequestIDOnMetaData, info.ID))
+		}
+
+		return handler(srv, utils.NewServerStreamWrapper(meta.WithRequestInfo(ss.Context(), info), ss))
+	}
+}
+
+func ServerIDInterceptor(transKeys []string) grpc.UnaryServerInterceptor {
+	return ServerPropagationInterceptor(meta.KeysPropagationPolicy(transKeys))
+}
+
 func ServerStreamIDInterceptor(transKeys []string) grpc.StreamServerInterceptor {
+	return ServerStreamPropagationInterceptor(meta.KeysPropagationPolicy(transKeys))
+}
+
+func ClientIDInterceptor(transKeys []string) grpc.UnaryClientInterceptor {
+	return ClientPropagationInterceptor(meta.KeysPropagationPolicy(transKeys))
+}
+
+func ClientStreamIDInterceptor(transKeys []string) grpc.StreamClientInterceptor {
+	return ClientStreamPropagationInterceptor(meta.KeysPropagationPolicy(transKeys))
+}
+
+// ServerPropagationInterceptor sets the outgoing metadata of the handler context by
+// meta.TransferContextMetaWithPolicy, so the calls of the handler carry the propagated metadata.
+func ServerPropagationInterceptor(policy *meta.PropagationPolicy) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (
+		resp interface{}, err error) {
+		return handler(meta.TransferContextMetaWithPolicy(ctx, policy), req)
+	}
+}
+
+func ServerStreamPropagationInterceptor(policy *meta.PropagationPolicy) grpc.StreamServerInterceptor {
 	return func(srv interface{}, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
-		wrapper := utils.NewServerStreamWrapper(meta.TransferContextMeta(ss.Context(), transKeys), ss)
+		wrapper := utils.NewServerStreamWrapper(meta.TransferContextMetaWithPolicy(ss.Context(), policy), ss)
 
 		return handler(srv, wrapper)
 	}
 }
 
-func ClientIDInterceptor(transKeys []string) grpc.UnaryClientInterceptor {
+func ClientPropagationInterceptor(policy *meta.PropagationPolicy) grpc.UnaryClientInterceptor {
 	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn,
 		invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
-		return invoker(meta.TransferContextMeta(ctx, transKeys), method, req, reply, cc, opts...)
+		return invoker(meta.TransferContextMetaWithPolicy(ctx, policy), method, req, reply, cc, opts...)
 	}
 }
 
-func ClientStreamIDInterceptor(transKeys []string) grpc.StreamClientInterceptor {
+func ClientStreamPropagationInterceptor(policy *meta.PropagationPolicy) grpc.StreamClientInterceptor {
 	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string,
 		streamer grpc.Streamer, opts ...grpc.CallOption) (stream grpc.ClientStream, err error) {
-		return streamer(meta.TransferContextMeta(ctx, transKeys), desc, cc, method, opts...)
+		return streamer(meta.TransferContextMetaWithPolicy(ctx, policy), desc, cc, method, opts...)
 	}
 }
@@ -7,16 +7,20 @@ import (
 	"github.com/sgostarter/i/l"
 	"github.com/sgostarter/libeasygo/fmtutils"
 	"github.com/sgostarter/libservicetoolset/grpce/meta"
+	"github.com/sgostarter/libservicetoolset/grpce/utils"
 	"google.golang.org/grpc"
 )
 
+// ServerLogInterceptor dumps the whole payloads.
+//
+// Deprecated: use CallLogger, which logs the structured fields and redacts the payloads.
 func ServerLogInterceptor(logger l.Wrapper) grpc.UnaryServerInterceptor {
 	if logger == nil {
 		logger = l.NewNopLoggerWrapper()
 	}
 
 	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
-		id := meta.IDFromOutgoingContext(ctx)
+		id := meta.RequestIDFromContext(ctx)
 
 		logger.Infof("[SRV][REQ] id:%v method:%v req:\n%v",
 			id, info.FullMethod, fmtutils.Marshal(req))
@@ -32,13 +36,16 @@ func ServerLogInterceptor(logger l.Wrapper) grpc.UnaryServerInterceptor {
 	}
 }
 
+// ServerStreamLogInterceptor dumps the whole payloads.
+//
+// Deprecated: use CallLogger, which logs the structured fields and redacts the payloads.
 func ServerStreamLogInterceptor(logger l.Wrapper) grpc.StreamServerInterceptor {
 	if logger == nil {
 		logger = l.NewNopLoggerWrapper()
 	}
 
 	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
-		id := meta.IDFromOutgoingContext(ss.Context())
+		id := meta.RequestIDFromContext(ss.Context())
 
 		logger.Infof("[SRV][REQ][STREAM] id:%v method:%v connected", id, info.FullMethod)
 
@@ -52,13 +59,16 @@ func ServerStreamLogInterceptor(logger l.Wrapper) grpc.StreamServerInterceptor {
 	}
 }
 
+// ClientLogInterceptor dumps the whole payloads.
+//
+// Deprecated: use CallLogger, which logs the structured fields and redacts the payloads.
 func ClientLogInterceptor(logger l.Wrapper) grpc.UnaryClientInterceptor {
 	if logger == nil {
 		logger = l.NewNopLoggerWrapper()
 	}
 
 	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
-		id := meta.IDFromOutgoingContext(ctx)
+		id := meta.RequestIDFromContext(ctx)
 
 		logger.Infof("[CLI][REQ] id:%v method:%v target:%v req:\n%v",
 			id, method, cc.Target(), fmtutils.Marshal(req))
@@ -74,6 +84,9 @@ func ClientLogInterceptor(logger l.Wrapper) grpc.UnaryClientInterceptor {
 	}
 }
 
+// ClientStreamLogInterceptor dumps the whole payloads.
+//
+// Deprecated: use CallLogger, which logs the structured fields and redacts the payloads.
 func ClientStreamLogInterceptor(logger l.Wrapper) grpc.StreamClientInterceptor {
 	if logger == nil {
 		logger = l.NewNopLoggerWrapper()
@@ -81,10 +94,21 @@ func ClientStreamLogInterceptor(logger l.Wrapper) grpc.StreamClientInterceptor {
 
 	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer,
 		opts ...grpc.CallOption) (stream grpc.ClientStream, err error) {
-		id := meta.IDFromOutgoingContext(ctx)
+		id := meta.RequestIDFromContext(ctx)
 
 		logger.Infof("[CLI][STREAM] id:%v method:%v connected", id, method)
 
-		return streamer(ctx, desc, cc, method, opts...)
+		st := time.Now()
+
+		stream, err = streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			logger.Infof("[CLI][STREAM] id:%v method:%v closed. cost:%v err:%v", id, method, time.Since(st), err)
+
+			return
+		}
+
+		return utils.NewClientStreamWrapper(stream, desc, func(err error) {
+			logger.Infof("[CLI][STREAM] id:%v method:%v closed. cost:%v err:%v", id, method, time.Since(st), err)
+		}), nil
 	}
 }
@@ -0,0 +1,101 @@
+package interceptors
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/sgostarter/libservicetoolset/grpce/meta"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestPropagationPolicy(t *testing.T) {
+	md := metadata.Pairs("authorization", "Bearer x", "cookie", "a=b", "connection", "close", "x-tenant", "t1",
+		"x-internal-debug", "1", "ymi-baggage-user", "u1", meta.RequestIDOnMetaData, "id")
+
+	// all but the credentials
+	out := meta.KeysPropagationPolicy(nil).Filter(md)
+	assert.Equal(t, metadata.Pairs("x-tenant", "t1", "x-internal-debug", "1", "ymi-baggage-user", "u1"), out)
+
+	// the listed keys and the baggage, the credentials allowed by name
+	out = meta.KeysPropagationPolicy([]string{"X-Tenant", "authorization"}).Filter(md)
+	assert.Equal(t, metadata.Pairs("x-tenant", "t1", "authorization", "Bearer x", "ymi-baggage-user", "u1"), out)
+
+	// deny wins
+	policy := &meta.PropagationPolicy{Allow: []string{"x-*"}, Deny: []string{"x-internal-*", "ymi-baggage-*"}}
+	assert.Nil(t, policy.Validate())
+	assert.Equal(t, metadata.Pairs("x-tenant", "t1"), policy.Filter(md))
+
+	assert.NotNil(t, (&meta.PropagationPolicy{Allow: []string{"x-*-y"}}).Validate())
+	assert.NotNil(t, (&meta.PropagationPolicy{Deny: []string{""}}).Validate())
+	assert.NotNil(t, (&meta.PropagationPolicy{MaxKeySize: -1}).Validate())
+
+	// the client address headers are allowed by name only
+	md = metadata.Pairs("x-forwarded-for", "10.0.0.1", "x-real-ip", "10.0.0.1", "forwarded", "for=10.0.0.1",
+		"host", "h")
+	assert.Empty(t, meta.KeysPropagationPolicy(nil).Filter(md))
+	assert.Equal(t, metadata.Pairs("x-forwarded-for", "10.0.0.1"),
+		meta.KeysPropagationPolicy([]string{"x-forwarded-for"}).Filter(md))
+}
+
+func TestPropagationPolicyLimits(t *testing.T) {
+	md := metadata.Pairs("a", "1234", "b", "12345678", "c", "12")
+
+	// the key and its values are counted
+	policy := &meta.PropagationPolicy{Allow: []string{"*"}, MaxKeySize: 5}
+	assert.Equal(t, metadata.Pairs("a", "1234", "c", "12"), policy.Filter(md))
+
+	// a is taken first, b would be over the total
+	policy = &meta.PropagationPolicy{Allow: []string{"*"}, MaxTotalSize: 10}
+	assert.Equal(t, metadata.Pairs("a", "1234", "c", "12"), policy.Filter(md))
+
+	// the default limits
+	out := meta.KeysPropagationPolicy(nil).Filter(metadata.Pairs("big", strings.Repeat("x", meta.DefaultPropagationMaxKeySize)))
+	assert.Empty(t, out)
+}
+
+func TestBaggage(t *testing.T) {
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("ymi-baggage-user", "u1",
+		"ymi-baggage-count", "x", "authorization", "Bearer x"))
+
+	v, ok := meta.Baggage(ctx, "User")
+	assert.True(t, ok)
+	assert.Equal(t, "u1", v)
+
+	_, ok = meta.BaggageInt(ctx, "count")
+	assert.False(t, ok)
+
+	ctx = meta.WithBaggageInt(ctx, "count", 3)
+	ctx = meta.WithBaggageBool(ctx, "canary", true)
+
+	n, ok := meta.BaggageInt(ctx, "count")
+	assert.True(t, ok)
+	assert.Equal(t, 3, n)
+
+	b, ok := meta.BaggageBool(ctx, "canary")
+	assert.True(t, ok)
+	assert.True(t, b)
+
+	_, ok = meta.Baggage(ctx, "missing")
+	assert.False(t, ok)
+
+	// the denied baggage isn't sent
+	md, _ := metadata.FromOutgoingContext(meta.TransferContextMetaWithPolicy(ctx, &meta.PropagationPolicy{
+		Deny: []string{"ymi-baggage-canary"},
+	}))
+	assert.Equal(t, []string{"u1"}, md.Get("ymi-baggage-user"))
+	assert.Empty(t, md.Get("ymi-baggage-canary"))
+
+	ctx = meta.TransferContextMeta(ctx, nil)
+
+	md, _ = metadata.FromOutgoingContext(ctx)
+	assert.Equal(t, []string{"u1"}, md.Get("ymi-baggage-user"))
+	assert.Equal(t, []string{"3"}, md.Get("ymi-baggage-count"))
+	assert.Equal(t, []string{"true"}, md.Get("ymi-baggage-canary"))
+	assert.Empty(t, md.Get("authorization"))
+
+	// the later baggage replaces the transferred one
+	md, _ = metadata.FromOutgoingContext(meta.TransferContextMeta(meta.WithBaggage(ctx, "user", "u2"), nil))
+	assert.Equal(t, []string{"u2"}, md.Get("ymi-baggage-user"))
+}
@@ -0,0 +1,25 @@
+package interceptors
+
+import (
+	"context"
+
+	"github.com/sgostarter/libservicetoolset/grpce"
+	"github.com/sgostarter/libservicetoolset/grpce/utils"
+	"google.golang.org/grpc"
+)
+
+// ServerRealIPInterceptor stores the ip resolved by resolver in the context, see grpce.GrpcGetRealIP.
+func ServerRealIPInterceptor(resolver *grpce.RealIPResolver) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (
+		resp interface{}, err error) {
+		return handler(grpce.WithRealIP(ctx, resolver.ResolveGRPC(ctx)), req)
+	}
+}
+
+func ServerStreamRealIPInterceptor(resolver *grpce.RealIPResolver) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx := ss.Context()
+
+		return handler(srv, utils.NewServerStreamWrapper(grpce.WithRealIP(ctx, resolver.ResolveGRPC(ctx)), ss))
+	}
+}
@@ -0,0 +1,156 @@
+package interceptors
+
+import (
+	"context"
+	"net"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/sgostarter/libservicetoolset/grpce/meta"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/examples/features/proto/echo"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func TestTransferContextMetaRequestID(t *testing.T) {
+	// the id of the caller wins over the outgoing one
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(meta.RequestIDOnMetaData, "in",
+		meta.RequestHopsOnMetaData, "2", meta.RequestOriginOnMetaData, "gateway", "x-trans", "v"))
+	ctx = metadata.AppendToOutgoingContext(ctx, meta.RequestIDOnMetaData, "out")
+
+	md, _ := metadata.FromOutgoingContext(meta.TransferContextMeta(ctx, nil))
+	assert.Equal(t, []string{"in"}, md.Get(meta.RequestIDOnMetaData))
+	assert.Equal(t, []string{"3"}, md.Get(meta.RequestHopsOnMetaData))
+	assert.Equal(t, []string{"gateway"}, md.Get(meta.RequestOriginOnMetaData))
+	assert.Equal(t, []string{"v"}, md.Get("x-trans"))
+
+	// transferring twice doesn't increase the hops again
+	md, _ = metadata.FromOutgoingContext(meta.TransferContextMeta(meta.TransferContextMeta(ctx, nil), nil))
+	assert.Equal(t, []string{"3"}, md.Get(meta.RequestHopsOnMetaData))
+
+	// the outgoing id is kept without the incoming one
+	md, _ = metadata.FromOutgoingContext(meta.TransferContextMeta(
+		metadata.AppendToOutgoingContext(context.Background(), meta.RequestIDOnMetaData, "out"), nil))
+	assert.Equal(t, []string{"out"}, md.Get(meta.RequestIDOnMetaData))
+
+	// the request info wins over the metadata
+	info := meta.RequestInfo{ID: "info", ParentID: "parent", Origin: "svc", Hops: 1}
+	md, _ = metadata.FromOutgoingContext(meta.TransferContextMeta(meta.WithRequestInfo(ctx, info), nil))
+	assert.Equal(t, []string{"info"}, md.Get(meta.RequestIDOnMetaData))
+	assert.Equal(t, []string{"parent"}, md.Get(meta.RequestParentIDOnMetaData))
+	assert.Equal(t, []string{"svc"}, md.Get(meta.RequestOriginOnMetaData))
+	assert.Equal(t, []string{"2"}, md.Get(meta.RequestHopsOnMetaData))
+
+	// a new id
+	md, _ = metadata.FromOutgoingContext(meta.TransferContextMeta(context.Background(), nil))
+	assert.NotEmpty(t, meta.GetRequestIDFromMD(md))
+	assert.Equal(t, []string{"1"}, md.Get(meta.RequestHopsOnMetaData))
+}
+
+func TestForkRequestInfo(t *testing.T) {
+	ctx := meta.WithRequestInfo(context.Background(), meta.RequestInfo{ID: "req", Origin: "gateway", Hops: 3})
+
+	info := meta.ForkRequestInfo(ctx, meta.IDGeneratorFunc(func() string {
+		return "job"
+	}), "worker")
+	assert.Equal(t, meta.RequestInfo{ID: "job", ParentID: "req", Origin: "worker"}, info)
+}
+
+func TestIDGenerators(t *testing.T) {
+	id := meta.UUIDv7Generator.NewID()
+	assert.Regexp(t, regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-7[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`), id)
+
+	ms, err := strconv.ParseInt(id[0:8]+id[9:13], 16, 64)
+	assert.Nil(t, err)
+	assert.InDelta(t, time.Now().UnixMilli(), ms, 1000)
+
+	_, err = meta.NewSnowflakeIDGenerator(1024)
+	assert.NotNil(t, err)
+
+	_, err = meta.NewIDGenerator("unknown", 0)
+	assert.NotNil(t, err)
+
+	gen, err := meta.NewIDGenerator(meta.IDGeneratorSnowflake, 7)
+	assert.Nil(t, err)
+
+	var last int64
+
+	for idx := 0; idx < 10000; idx++ {
+		n, err := strconv.ParseInt(gen.NewID(), 10, 64)
+		assert.Nil(t, err)
+		assert.Greater(t, n, last)
+		assert.EqualValues(t, 7, n>>12&1023)
+
+		last = n
+	}
+}
+
+type testRequestInfoServer struct {
+	echo.UnimplementedEchoServer
+	infos chan meta.RequestInfo
+}
+
+func (s *testRequestInfoServer) UnaryEcho(ctx context.Context, req *echo.EchoRequest) (*echo.EchoResponse, error) {
+	info, _ := meta.RequestInfoFromContext(ctx)
+	s.infos <- info
+
+	return &echo.EchoResponse{Message: req.GetMessage()}, nil
+}
+
+func TestServerRequestInfoInterceptor(t *testing.T) {
+	lis := bufconn.Listen(1024 * 1024)
+
+	svr := &testRequestInfoServer{infos: make(chan meta.RequestInfo, 1)}
+
+	s := grpc.NewServer(grpc.UnaryInterceptor(ServerRequestInfoInterceptor(meta.IDGeneratorFunc(func() string {
+		return "new"
+	}), "echo", true)))
+	echo.RegisterEchoServer(s, svr)
+
+	go func() {
+		_ = s.Serve(lis)
+	}()
+
+	defer s.Stop()
+
+	conn, err := grpc.NewClient("passthrough:///bufnet", grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+		return lis.DialContext(ctx)
+	}), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	assert.Nil(t, err)
+
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	cli := echo.NewEchoClient(conn)
+
+	// started by the server
+	var header metadata.MD
+
+	_, err = cli.UnaryEcho(context.Background(), &echo.EchoRequest{Message: "a"}, grpc.Header(&header))
+	assert.Nil(t, err)
+	assert.Equal(t, meta.RequestInfo{ID: "new", Origin: "echo"}, <-svr.infos)
+	assert.Equal(t, []string{"new"}, header.Get(meta.RequestIDOnMetaData))
+
+	// propagated by the caller
+	ctx := meta.TransferContextMeta(meta.WithRequestInfo(context.Background(),
+		meta.RequestInfo{ID: "req", ParentID: "parent", Origin: "gateway"}), nil)
+
+	_, err = cli.UnaryEcho(ctx, &echo.EchoRequest{Message: "b"}, grpc.Header(&header))
+	assert.Nil(t, err)
+	assert.Equal(t, meta.RequestInfo{ID: "req", ParentID: "parent", Origin: "gateway", Hops: 1}, <-svr.infos)
+	assert.Equal(t, []string{"req"}, header.Get(meta.RequestIDOnMetaData))
+
+	// the unsafe ids are replaced
+	ctx = metadata.AppendToOutgoingContext(context.Background(), meta.RequestIDOnMetaData, "req<script>")
+
+	_, err = cli.UnaryEcho(ctx, &echo.EchoRequest{Message: "c"}, grpc.Header(&header))
+	assert.Nil(t, err)
+	assert.Equal(t, meta.RequestInfo{ID: "new", Origin: "echo"}, <-svr.infos)
+	assert.Equal(t, []string{"new"}, header.Get(meta.RequestIDOnMetaData))
+}
@@ -0,0 +1,216 @@
+package interceptors
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/sgostarter/i/l"
+	"github.com/sgostarter/libservicetoolset/grpce/meta"
+	"github.com/sgostarter/libservicetoolset/grpce/utils"
+	"google.golang.org/grpc"
+)
+
+// StreamStats the accounting of a stream, the sizes are the proto sizes of the messages.
+type StreamStats struct {
+	Method        string
+	SentMsgs      int
+	ReceivedMsgs  int
+	SentBytes     int64
+	ReceivedBytes int64
+	// FirstSendLatency and FirstReceiveLatency the time from the start of the stream to the first message, 0 if
+	// there is no message
+	FirstSendLatency    time.Duration
+	FirstReceiveLatency time.Duration
+	Duration            time.Duration
+	Err                 error
+}
+
+type streamAccounting struct {
+	lock  sync.Mutex
+	st    time.Time
+	stats StreamStats
+}
+
+func newStreamAccounting(method string, st time.Time) *streamAccounting {
+	return &streamAccounting{
+		st: st,
+		stats: StreamStats{
+			Method: method,
+		},
+	}
+}
+
+func (a *streamAccounting) sent(size int) int {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	if a.stats.SentMsgs == 0 {
+		a.stats.FirstSendLatency = time.Since(a.st)
+	}
+
+	a.stats.SentMsgs++
+
+	if size > 0 {
+		a.stats.SentBytes += int64(size)
+	}
+
+	return a.stats.SentMsgs
+}
+
+func (a *streamAccounting) received(size int) int {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	if a.stats.ReceivedMsgs == 0 {
+		a.stats.FirstReceiveLatency = time.Since(a.st)
+	}
+
+	a.stats.ReceivedMsgs++
+
+	if size > 0 {
+		a.stats.ReceivedBytes += int64(size)
+	}
+
+	return a.stats.ReceivedMsgs
+}
+
+func (a *streamAccounting) finish(err error) *StreamStats {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	stats := a.stats
+	stats.Duration = time.Since(a.st)
+	stats.Err = err
+
+	return &stats
+}
+
+func streamStatsFields(stats *StreamStats) []l.Field {
+	return []l.Field{
+		l.IntField("sentMsgs", stats.SentMsgs),
+		l.IntField("receivedMsgs", stats.ReceivedMsgs),
+		l.AnyField("sentBytes", stats.SentBytes),
+		l.AnyField("receivedBytes", stats.ReceivedBytes),
+		l.DurationField("firstSendLatency", stats.FirstSendLatency),
+		l.DurationField("firstReceiveLatency", stats.FirstReceiveLatency),
+	}
+}
+
+func (cl *CallLogger) logMessage(ctx context.Context, event, method string, seq int, m interface{}) {
+	if !cl.cfg.LogStreamMessages || cl.level(method) == CallLogLevelNone {
+		return
+	}
+
+	fields := []l.Field{
+		l.StringField("method", method),
+		l.StringField("requestID", meta.RequestIDFromContext(ctx)),
+		l.IntField("seq", seq),
+		l.IntField("size", payloadSize(m)),
+	}
+
+	if cl.cfg.LogPayload {
+		fields = append(fields, l.StringField("payload", cl.Payload(method, m)))
+	}
+
+	cl.logger.WithFields(fields...).Debug(event)
+}
+
+func (cl *CallLogger) finishStream(ctx context.Context, event, peer string, a *streamAccounting, err error) {
+	err = statusError(err)
+	stats := a.finish(err)
+
+	cl.log(ctx, &callLogEntry{
+		event:  event,
+		method: stats.Method,
+		peer:   peer,
+		st:     a.st,
+		err:    err,
+		stats:  stats,
+	})
+
+	if cl.cfg.StreamStatsFunc != nil {
+		cl.cfg.StreamStatsFunc(ctx, stats)
+	}
+}
+
+type accountingServerStream struct {
+	grpc.ServerStream
+	cl         *CallLogger
+	method     string
+	accounting *streamAccounting
+}
+
+func (s *accountingServerStream) SendMsg(m interface{}) error {
+	err := s.ServerStream.SendMsg(m)
+	if err == nil {
+		seq := s.accounting.sent(payloadSize(m))
+		s.cl.logMessage(s.Context(), "streamMsgSent", s.method, seq, m)
+	}
+
+	return err
+}
+
+func (s *accountingServerStream) RecvMsg(m interface{}) error {
+	err := s.ServerStream.RecvMsg(m)
+	if err == nil {
+		seq := s.accounting.received(payloadSize(m))
+		s.cl.logMessage(s.Context(), "streamMsgReceived", s.method, seq, m)
+	}
+
+	return err
+}
+
+type accountingClientStream struct {
+	grpc.ClientStream
+	ctx        context.Context
+	cl         *CallLogger
+	method     string
+	accounting *streamAccounting
+}
+
+func (cs *accountingClientStream) SendMsg(m interface{}) error {
+	err := cs.ClientStream.SendMsg(m)
+	if err == nil {
+		seq := cs.accounting.sent(payloadSize(m))
+		cs.cl.logMessage(cs.ctx, "streamMsgSent", cs.method, seq, m)
+	}
+
+	return err
+}
+
+func (cs *accountingClientStream) RecvMsg(m interface{}) error {
+	err := cs.ClientStream.RecvMsg(m)
+	if err == nil {
+		seq := cs.accounting.received(payloadSize(m))
+		cs.cl.logMessage(cs.ctx, "streamMsgReceived", cs.method, seq, m)
+	}
+
+	return err
+}
+
+// StreamClientInterceptor counts the messages of the stream and logs the summary once the stream ends: the
+// last message is received, an error is returned or ctx is done, see utils.NewClientStreamWrapperWithContext.
+func (cl *CallLogger) StreamClientInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string,
+		streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		accounting := newStreamAccounting(method, time.Now())
+
+		cs, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			cl.finishStream(ctx, "clientStream", cc.Target(), accounting, err)
+
+			return nil, err
+		}
+
+		return utils.NewClientStreamWrapperWithContext(ctx, &accountingClientStream{
+			ClientStream: cs,
+			ctx:          ctx,
+			cl:           cl,
+			method:       method,
+			accounting:   accounting,
+		}, desc, func(err error) {
+			cl.finishStream(ctx, "clientStream", cc.Target(), accounting, err)
+		}), nil
+	}
+}
@@ -0,0 +1,211 @@
+package interceptors
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/sgostarter/i/l"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/examples/features/proto/echo"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/proto"
+)
+
+type testEchoServer struct {
+	echo.UnimplementedEchoServer
+}
+
+func (s *testEchoServer) ServerStreamingEcho(req *echo.EchoRequest, stream echo.Echo_ServerStreamingEchoServer) error {
+	for idx := 0; idx < 3; idx++ {
+		if err := stream.Send(&echo.EchoResponse{Message: req.GetMessage()}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *testEchoServer) BidirectionalStreamingEcho(stream echo.Echo_BidirectionalStreamingEchoServer) error {
+	for {
+		req, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if req.GetMessage() == "fail" {
+			return status.Error(codes.InvalidArgument, "fail")
+		}
+
+		if req.GetMessage() == "block" {
+			<-stream.Context().Done()
+
+			return stream.Context().Err()
+		}
+
+		if err = stream.Send(&echo.EchoResponse{Message: req.GetMessage()}); err != nil {
+			return err
+		}
+	}
+}
+
+func newTestEchoClient(t *testing.T, server, client *CallLogger) echo.EchoClient {
+	lis := bufconn.Listen(1024 * 1024)
+
+	s := grpc.NewServer(grpc.StreamInterceptor(server.StreamServerInterceptor()))
+	echo.RegisterEchoServer(s, &testEchoServer{})
+
+	go func() {
+		_ = s.Serve(lis)
+	}()
+
+	t.Cleanup(s.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet", grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+		return lis.DialContext(ctx)
+	}), grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithStreamInterceptor(client.StreamClientInterceptor()))
+	assert.Nil(t, err)
+
+	t.Cleanup(func() {
+		_ = conn.Close()
+	})
+
+	return echo.NewEchoClient(conn)
+}
+
+func TestStreamAccounting(t *testing.T) {
+	serverStats := make(chan *StreamStats, 10)
+	clientStats := make(chan *StreamStats, 10)
+
+	serverLogger := newTestLogger()
+	clientLogger := newTestLogger()
+
+	server, err := NewCallLogger(CallLogConfig{
+		Level:             CallLogLevelDebug,
+		LogStreamMessages: true,
+		StreamStatsFunc: func(_ context.Context, stats *StreamStats) {
+			serverStats <- stats
+		},
+	}, l.NewWrapper(serverLogger))
+	assert.Nil(t, err)
+
+	client, err := NewCallLogger(CallLogConfig{
+		StreamStatsFunc: func(_ context.Context, stats *StreamStats) {
+			clientStats <- stats
+		},
+	}, l.NewWrapper(clientLogger))
+	assert.Nil(t, err)
+
+	cli := newTestEchoClient(t, server, client)
+
+	fnWait := func(ch chan *StreamStats) *StreamStats {
+		select {
+		case stats := <-ch:
+			return stats
+		case <-time.After(5 * time.Second):
+			assert.FailNow(t, "no stream stats")
+		}
+
+		return nil
+	}
+
+	req := &echo.EchoRequest{Message: "hello"}
+	size := int64(proto.Size(req))
+
+	// server streaming, read to the end
+	stream, err := cli.ServerStreamingEcho(context.Background(), req)
+	assert.Nil(t, err)
+
+	for {
+		if _, err = stream.Recv(); err != nil {
+			break
+		}
+	}
+
+	assert.ErrorIs(t, err, io.EOF)
+
+	stats := fnWait(serverStats)
+	assert.Equal(t, "/grpc.examples.echo.Echo/ServerStreamingEcho", stats.Method)
+	assert.Equal(t, 1, stats.ReceivedMsgs)
+	assert.Equal(t, 3, stats.SentMsgs)
+	assert.Equal(t, size, stats.ReceivedBytes)
+	assert.Equal(t, 3*size, stats.SentBytes)
+	assert.True(t, stats.FirstSendLatency > 0)
+	assert.Nil(t, stats.Err)
+
+	stats = fnWait(clientStats)
+	assert.Equal(t, 1, stats.SentMsgs)
+	assert.Equal(t, 3, stats.ReceivedMsgs)
+	assert.Equal(t, 3*size, stats.ReceivedBytes)
+	assert.Nil(t, stats.Err)
+
+	records := serverLogger.take()
+	assert.Len(t, records, 5)
+	assert.Equal(t, "streamMsgReceived", records[0].msg)
+	assert.Equal(t, "streamMsgSent", records[1].msg)
+	assert.Equal(t, 3, records[3].fields["seq"])
+	assert.Equal(t, "serverStream", records[4].msg)
+	assert.Equal(t, 3, records[4].fields["sentMsgs"])
+
+	records = clientLogger.take()
+	assert.Len(t, records, 1)
+	assert.Equal(t, "clientStream", records[0].msg)
+	assert.Equal(t, "OK", records[0].fields["code"])
+
+	// bidi with an error status
+	bidi, err := cli.BidirectionalStreamingEcho(context.Background())
+	assert.Nil(t, err)
+	assert.Nil(t, bidi.Send(req))
+
+	_, err = bidi.Recv()
+	assert.Nil(t, err)
+
+	assert.Nil(t, bidi.Send(&echo.EchoRequest{Message: "fail"}))
+
+	_, err = bidi.Recv()
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	stats = fnWait(clientStats)
+	assert.Equal(t, 2, stats.SentMsgs)
+	assert.Equal(t, 1, stats.ReceivedMsgs)
+	assert.Equal(t, codes.InvalidArgument, status.Code(stats.Err))
+
+	stats = fnWait(serverStats)
+	assert.Equal(t, codes.InvalidArgument, status.Code(stats.Err))
+
+	// the client cancels the stream and never calls Recv again
+	ctx, cancel := context.WithCancel(context.Background())
+
+	bidi, err = cli.BidirectionalStreamingEcho(ctx)
+	assert.Nil(t, err)
+	assert.Nil(t, bidi.Send(&echo.EchoRequest{Message: "block"}))
+
+	cancel()
+
+	stats = fnWait(clientStats)
+	assert.Equal(t, codes.Canceled, status.Code(stats.Err))
+
+	_, err = bidi.Recv()
+	assert.Equal(t, codes.Canceled, status.Code(err))
+
+	stats = fnWait(serverStats)
+	assert.Equal(t, codes.Canceled, status.Code(stats.Err))
+
+	select {
+	case <-clientStats:
+		assert.Fail(t, "the summary is emitted twice")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
@@ -3,6 +3,7 @@ package grpce
 import (
 	"context"
 	"net"
+	"net/http"
 	"strings"
 
 	"github.com/grpc-ecosystem/go-grpc-middleware/util/metautils"
@@ -10,7 +11,19 @@ import (
 	"google.golang.org/grpc/peer"
 )
 
+// GrpcGetRealIP returns the ip resolved by the real ip interceptors if there is one, otherwise the peer address.
+// The headers are trusted only by RealIPResolver, or explicitly by GrpcGetRealIPFromHeaders.
 func GrpcGetRealIP(ctx context.Context) string {
+	if ip, ok := RealIPFromContext(ctx); ok {
+		return ip
+	}
+
+	return regularIP(grpcPeerAddress(ctx))
+}
+
+// GrpcGetRealIPFromHeaders trusts the first X-Forwarded-For entry or X-Real-Ip, the clients can spoof them unless
+// the server is reachable only by a proxy overwriting them. Use RealIPResolver otherwise.
+func GrpcGetRealIPFromHeaders(ctx context.Context) string {
 	clientIP := metautils.ExtractIncoming(ctx).Get("X-Forwarded-For")
 	clientIP = strings.TrimSpace(strings.Split(clientIP, ",")[0])
 
@@ -19,16 +32,51 @@ func GrpcGetRealIP(ctx context.Context) string {
 	}
 
 	if clientIP == "" {
-		client, ok := peer.FromContext(ctx)
-		if ok && client.Addr != net.Addr(nil) {
-			addSlice := strings.Split(client.Addr.String(), ":")
-			if addSlice[0] == "[" {
-				return "127.0.0.1"
-			}
+		clientIP = grpcPeerAddress(ctx)
+	}
+
+	return regularIP(clientIP)
+}
+
+func grpcPeerAddress(ctx context.Context) string {
+	client, ok := peer.FromContext(ctx)
+	if !ok || client.Addr == net.Addr(nil) {
+		return ""
+	}
+
+	return client.Addr.String()
+}
+
+// HTTPGetRealIP the http version of GrpcGetRealIP, the remote address of the request.
+func HTTPGetRealIP(r *http.Request) string {
+	return regularIP(r.RemoteAddr)
+}
+
+// HTTPGetRealIPFromHeaders the http version of GrpcGetRealIPFromHeaders, the headers are checked in the same order.
+func HTTPGetRealIPFromHeaders(r *http.Request) string {
+	clientIP := strings.TrimSpace(strings.Split(r.Header.Get("X-Forwarded-For"), ",")[0])
+
+	if clientIP == "" {
+		clientIP = strings.TrimSpace(r.Header.Get("X-Real-Ip"))
+	}
+
+	if clientIP == "" {
+		clientIP = r.RemoteAddr
+	}
+
+	return regularIP(clientIP)
+}
+
+// regularIP strips the port, the IPv6 addresses are kept.
+func regularIP(s string) string {
+	addr, ok := parseIPAddr(s)
+	if !ok {
+		return iputils.RegularIPV4(s)
+	}
 
-			clientIP = addSlice[0]
-		}
+	if addr.Is4() {
+		return iputils.RegularIPV4(addr.String())
 	}
 
-	return iputils.RegularIPV4(clientIP)
+	return addr.String()
 }
@@ -0,0 +1,98 @@
+package meta
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	// BaggagePrefixOnMetaData the namespace of the baggage, it's propagated by all the policies
+	BaggagePrefixOnMetaData = "ymi-baggage-"
+)
+
+type baggageKey struct{}
+
+func baggageFromValue(ctx context.Context) map[string]string {
+	baggage, _ := ctx.Value(baggageKey{}).(map[string]string)
+
+	return baggage
+}
+
+// WithBaggage sets the baggage item, it's propagated to the next services by TransferContextMeta.
+func WithBaggage(ctx context.Context, key, value string) context.Context {
+	old := baggageFromValue(ctx)
+
+	baggage := make(map[string]string, len(old)+1)
+	for k, v := range old {
+		baggage[k] = v
+	}
+
+	baggage[strings.ToLower(key)] = value
+
+	return context.WithValue(ctx, baggageKey{}, baggage)
+}
+
+func WithBaggageInt(ctx context.Context, key string, value int) context.Context {
+	return WithBaggage(ctx, key, strconv.Itoa(value))
+}
+
+func WithBaggageBool(ctx context.Context, key string, value bool) context.Context {
+	return WithBaggage(ctx, key, strconv.FormatBool(value))
+}
+
+// Baggage returns the baggage set by WithBaggage, or received from the caller (the incoming metadata, or the
+// outgoing metadata for the http requests, see HTTPPropagationMiddleware).
+func Baggage(ctx context.Context, key string) (string, bool) {
+	key = strings.ToLower(key)
+
+	if v, ok := baggageFromValue(ctx)[key]; ok {
+		return v, true
+	}
+
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if vs := md.Get(BaggagePrefixOnMetaData + key); len(vs) > 0 {
+			return vs[0], true
+		}
+	}
+
+	if md, ok := metadata.FromOutgoingContext(ctx); ok {
+		if vs := md.Get(BaggagePrefixOnMetaData + key); len(vs) > 0 {
+			return vs[0], true
+		}
+	}
+
+	return "", false
+}
+
+// BaggageInt ok is false if the item is missing or isn't an int.
+func BaggageInt(ctx context.Context, key string) (int, bool) {
+	v, ok := Baggage(ctx, key)
+	if !ok {
+		return 0, false
+	}
+
+	n, err := strconv.Atoi(v)
+
+	return n, err == nil
+}
+
+// BaggageBool ok is false if the item is missing or isn't a bool.
+func BaggageBool(ctx context.Context, key string) (bool, bool) {
+	v, ok := Baggage(ctx, key)
+	if !ok {
+		return false, false
+	}
+
+	b, err := strconv.ParseBool(v)
+
+	return b, err == nil
+}
+
+func setBaggageToMD(ctx context.Context, md metadata.MD) {
+	for k, v := range baggageFromValue(ctx) {
+		md.Set(BaggagePrefixOnMetaData+k, v)
+	}
+}
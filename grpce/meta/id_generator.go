@@ -0,0 +1,153 @@
+package meta
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.uber.org/atomic"
+)
+
+const (
+	IDGeneratorRandom    = "random"
+	IDGeneratorUUIDv7    = "uuidv7"
+	IDGeneratorSnowflake = "snowflake"
+)
+
+// IDGenerator generates the request ids.
+type IDGenerator interface {
+	NewID() string
+}
+
+// IDGeneratorFunc adapts a func to IDGenerator.
+type IDGeneratorFunc func() string
+
+func (fn IDGeneratorFunc) NewID() string {
+	return fn()
+}
+
+// RandomIDGenerator the hex of a random 63 bits number, the format of the ids before the generators were pluggable.
+var RandomIDGenerator IDGenerator = IDGeneratorFunc(getRandomID)
+
+// UUIDv7Generator the RFC 9562 version 7 uuids, they are ordered by the creation time.
+var UUIDv7Generator IDGenerator = IDGeneratorFunc(newUUIDv7)
+
+func newUUIDv7() string {
+	var u [16]byte
+
+	_, _ = rand.Read(u[6:])
+
+	ms := uint64(time.Now().UnixMilli())
+	u[0] = byte(ms >> 40)
+	u[1] = byte(ms >> 32)
+	u[2] = byte(ms >> 24)
+	u[3] = byte(ms >> 16)
+	u[4] = byte(ms >> 8)
+	u[5] = byte(ms)
+
+	u[6] = (u[6] & 0x0f) | 0x70
+	u[8] = (u[8] & 0x3f) | 0x80
+
+	var s [36]byte
+
+	hex.Encode(s[0:8], u[0:4])
+	s[8] = '-'
+	hex.Encode(s[9:13], u[4:6])
+	s[13] = '-'
+	hex.Encode(s[14:18], u[6:8])
+	s[18] = '-'
+	hex.Encode(s[19:23], u[8:10])
+	s[23] = '-'
+	hex.Encode(s[24:], u[10:])
+
+	return string(s[:])
+}
+
+const (
+	snowflakeEpoch    = 1577836800000 // 2020-01-01 UTC in ms
+	snowflakeNodeBits = 10
+	snowflakeSeqBits  = 12
+	snowflakeMaxNode  = 1<<snowflakeNodeBits - 1
+	snowflakeMaxSeq   = 1<<snowflakeSeqBits - 1
+)
+
+// SnowflakeIDGenerator the decimal of 41 bits ms timestamp, 10 bits node and 12 bits sequence.
+type SnowflakeIDGenerator struct {
+	lock sync.Mutex
+	node int64
+	ms   int64
+	seq  int64
+}
+
+// NewSnowflakeIDGenerator node should be unique in the services sharing the ids, in [0, 1023].
+func NewSnowflakeIDGenerator(node int64) (*SnowflakeIDGenerator, error) {
+	if node < 0 || node > snowflakeMaxNode {
+		return nil, fmt.Errorf("snowflake node %v out of [0, %v]", node, snowflakeMaxNode)
+	}
+
+	return &SnowflakeIDGenerator{
+		node: node,
+	}, nil
+}
+
+func (g *SnowflakeIDGenerator) NewID() string {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	ms := time.Now().UnixMilli()
+	if ms < g.ms {
+		// the clock went back, keep the ids increasing
+		ms = g.ms
+	}
+
+	if ms == g.ms {
+		g.seq = (g.seq + 1) & snowflakeMaxSeq
+		if g.seq == 0 {
+			// the sequence is used up, borrow the next ms
+			ms++
+		}
+	} else {
+		g.seq = 0
+	}
+
+	g.ms = ms
+
+	id := (ms-snowflakeEpoch)<<(snowflakeNodeBits+snowflakeSeqBits) | g.node<<snowflakeSeqBits | g.seq
+
+	return strconv.FormatInt(id, 10)
+}
+
+// NewIDGenerator returns the generator by name: random, uuidv7 or snowflake (with node).
+func NewIDGenerator(name string, node int64) (IDGenerator, error) {
+	switch name {
+	case "", IDGeneratorRandom:
+		return RandomIDGenerator, nil
+	case IDGeneratorUUIDv7:
+		return UUIDv7Generator, nil
+	case IDGeneratorSnowflake:
+		return NewSnowflakeIDGenerator(node)
+	}
+
+	return nil, fmt.Errorf("unknown id generator %q", name)
+}
+
+type idGeneratorHolder struct {
+	IDGenerator
+}
+
+var defaultIDGenerator atomic.Pointer[idGeneratorHolder]
+
+func init() {
+	defaultIDGenerator.Store(&idGeneratorHolder{RandomIDGenerator})
+}
+
+// SetDefaultIDGenerator replaces the generator of NewRequestID and TransferContextMeta, RandomIDGenerator
+// by default.
+func SetDefaultIDGenerator(gen IDGenerator) {
+	if gen != nil {
+		defaultIDGenerator.Store(&idGeneratorHolder{gen})
+	}
+}
@@ -5,7 +5,6 @@ import (
 	"fmt"
 	"math/rand"
 	"strconv"
-	"strings"
 
 	"github.com/sgostarter/libeasygo/cuserror"
 	"google.golang.org/grpc/metadata"
@@ -60,35 +59,35 @@ func IDFromOutgoingContext(ctx context.Context) string {
 	return ""
 }
 
-// nolint: gocognit
+// TransferContextMeta is TransferContextMetaWithPolicy with KeysPropagationPolicy(keys).
 func TransferContextMeta(ctx context.Context, keys []string) context.Context {
-	var idInIncomingContext, idInOutgoingContext string
+	return TransferContextMetaWithPolicy(ctx, KeysPropagationPolicy(keys))
+}
+
+// TransferContextMetaWithPolicy returns the context with the outgoing metadata for the next service: the outgoing
+// metadata of ctx, the incoming metadata and the baggage (see WithBaggage) allowed by policy, and the request info.
+// policy is KeysPropagationPolicy(nil) if nil.
+//
+// The request info is RequestInfoFromContext, or the one of the incoming metadata (the id of the caller), or a
+// new one with the id of the outgoing metadata (or a new id), with the hops increased.
+func TransferContextMetaWithPolicy(ctx context.Context, policy *PropagationPolicy) context.Context {
+	if policy == nil {
+		policy = KeysPropagationPolicy(nil)
+	}
 
 	mdIn, ok := metadata.FromIncomingContext(ctx)
 	if !ok {
 		mdIn = metadata.New(nil)
 	}
 
-	for _, v := range mdIn.Get(RequestIDOnMetaData) {
-		if v != "" {
-			idInOutgoingContext = v
-
-			break
-		}
-	}
+	var idInOutgoingContext string
 
 	mdOut := metadata.New(nil)
 
 	if md, ok := metadata.FromOutgoingContext(ctx); ok {
 		for key, vs := range md {
 			if key == RequestIDOnMetaData {
-				for _, v := range vs {
-					if v != "" {
-						idInOutgoingContext = v
-
-						break
-					}
-				}
+				idInOutgoingContext = firstMDValue(md, key)
 
 				continue
 			}
@@ -97,47 +96,36 @@ func TransferContextMeta(ctx context.Context, keys []string) context.Context {
 		}
 	}
 
-	if keys == nil {
-		keys = make([]string, 0, mdIn.Len())
-
-		for key := range mdIn {
-			if key == RequestIDOnMetaData {
-				continue
-			}
-
-			keys = append(keys, key)
+	info, ok := RequestInfoFromContext(ctx)
+	if !ok || info.ID == "" {
+		info, ok = RequestInfoFromMD(mdIn)
+		if !ok {
+			info = RequestInfo{ID: idInOutgoingContext}
 		}
 	}
 
-	if idInIncomingContext == "" {
-		idInIncomingContext = idInOutgoingContext
+	if info.ID == "" {
+		info.ID = NewRequestID()
 	}
 
-	if idInIncomingContext == "" {
-		idInIncomingContext = getRandomID()
-	}
-
-	for _, key := range keys {
-		if key == RequestIDOnMetaData {
-			continue
-		}
-
-		if len(mdIn[key]) == 0 {
-			continue
-		}
+	baggage := metadata.New(nil)
+	setBaggageToMD(ctx, baggage)
 
-		if len(mdOut[key]) > 0 {
-			continue
-		}
+	mdTrans := metadata.Join(mdIn)
+	for key, vs := range baggage {
+		mdTrans[key] = vs
+	}
 
-		if strings.EqualFold(key, "connection") {
+	for key, vs := range policy.Filter(mdTrans) {
+		// the baggage of ctx replaces the older one of the outgoing metadata
+		if len(mdOut[key]) > 0 && len(baggage[key]) == 0 {
 			continue
 		}
 
-		mdOut.Set(key, mdIn[key]...)
+		mdOut.Set(key, vs...)
 	}
 
-	mdOut.Set(RequestIDOnMetaData, idInIncomingContext)
+	info.SetToMD(mdOut)
 
 	return metadata.NewOutgoingContext(ctx, mdOut)
 }
@@ -171,3 +159,29 @@ func GetIntFromMeta(ctx context.Context, key string) (int64, error) {
 
 	return vv, nil
 }
+
+// NewRequestID generates a request id with the default generator, see SetDefaultIDGenerator.
+func NewRequestID() string {
+	return defaultIDGenerator.Load().NewID()
+}
+
+const maxRequestIDLength = 128
+
+// ValidRequestID reports whether id is safe to be accepted from the clients: 1 to 128 letters, digits, or '-',
+// '_', '.', ':'. The others should be replaced by NewRequestID, since the ids are echoed and propagated.
+func ValidRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-', c == '_', c == '.', c == ':':
+		default:
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,216 @@
+package meta
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/sgostarter/libeasygo/cuserror"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	DefaultPropagationMaxKeySize   = 4096
+	DefaultPropagationMaxTotalSize = 16384
+)
+
+// DefaultDenyKeys the credentials and the client address headers, which are not propagated unless they are
+// allowed by name. The address headers are set by the proxies of each hop, forwarding the ones sent by the
+// clients lets them spoof their address to the next services.
+var DefaultDenyKeys = []string{
+	"authorization",
+	"proxy-authorization",
+	"cookie",
+	"set-cookie",
+	"x-api-key",
+	"forwarded",
+	"x-forwarded-*",
+	"x-real-ip",
+	"x-client-ip",
+	"true-client-ip",
+	"host",
+	"via",
+}
+
+// the keys which are never propagated: the hop-by-hop headers and the ones owned by grpc
+var reservedKeyPatterns = []string{
+	":*",
+	"grpc-*",
+	"connection",
+	"keep-alive",
+	"proxy-connection",
+	"te",
+	"trailer",
+	"transfer-encoding",
+	"upgrade",
+	"http2-settings",
+	"content-type",
+	"content-length",
+}
+
+// PropagationPolicy decides which incoming metadata is propagated to the next service.
+//
+// The patterns are keys or key prefixes ended with *, case-insensitive. A key is propagated if it's in the baggage
+// namespace (BaggagePrefixOnMetaData) or matches Allow, and it doesn't match Deny or DefaultDenyKeys; the
+// DefaultDenyKeys allowed by their names are propagated. The request info keys are handled by TransferContextMeta.
+type PropagationPolicy struct {
+	Allow []string `yaml:"allow" json:"allow"`
+	Deny  []string `yaml:"deny" json:"deny"`
+	// MaxKeySize the size of a key and its values, the bigger keys are dropped, DefaultPropagationMaxKeySize if 0
+	MaxKeySize int `yaml:"max_key_size" json:"max_key_size"`
+	// MaxTotalSize the size of all the propagated keys, the keys are taken in the sorted order and the ones which
+	// would be over it are skipped, the later smaller keys can still be taken. DefaultPropagationMaxTotalSize if 0
+	MaxTotalSize int `yaml:"max_total_size" json:"max_total_size"`
+}
+
+// KeysPropagationPolicy the policy of the trans keys: all the keys if keys is nil, otherwise the listed keys.
+func KeysPropagationPolicy(keys []string) *PropagationPolicy {
+	if keys == nil {
+		return &PropagationPolicy{
+			Allow: []string{"*"},
+		}
+	}
+
+	return &PropagationPolicy{
+		Allow: append([]string{}, keys...),
+	}
+}
+
+func validKeyPattern(pattern string) bool {
+	return pattern != "" && !strings.Contains(strings.TrimSuffix(pattern, "*"), "*")
+}
+
+func (p *PropagationPolicy) Validate() error {
+	var errs []error
+
+	for idx, pattern := range p.Allow {
+		if !validKeyPattern(pattern) {
+			errs = append(errs, cuserror.NewWithErrorMsg(fmt.Sprintf("allow[%v]: invalid key pattern %q", idx, pattern)))
+		}
+	}
+
+	for idx, pattern := range p.Deny {
+		if !validKeyPattern(pattern) {
+			errs = append(errs, cuserror.NewWithErrorMsg(fmt.Sprintf("deny[%v]: invalid key pattern %q", idx, pattern)))
+		}
+	}
+
+	if p.MaxKeySize < 0 || p.MaxTotalSize < 0 {
+		errs = append(errs, cuserror.NewWithErrorMsg("max_key_size and max_total_size should not be negative"))
+	}
+
+	return errors.Join(errs...)
+}
+
+func (p *PropagationPolicy) Clone() *PropagationPolicy {
+	n := *p
+
+	if p.Allow != nil {
+		n.Allow = append([]string{}, p.Allow...)
+	}
+
+	if p.Deny != nil {
+		n.Deny = append([]string{}, p.Deny...)
+	}
+
+	return &n
+}
+
+func matchKeyPattern(pattern, key string) bool {
+	pattern = strings.ToLower(pattern)
+
+	if strings.HasSuffix(pattern, "*") {
+		return strings.HasPrefix(key, pattern[:len(pattern)-1])
+	}
+
+	return pattern == key
+}
+
+func matchKeyPatterns(patterns []string, key string) bool {
+	for _, pattern := range patterns {
+		if matchKeyPattern(pattern, key) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Allowed reports whether the key is propagated, regardless of the size limits.
+func (p *PropagationPolicy) Allowed(key string) bool {
+	key = strings.ToLower(key)
+
+	if isRequestInfoKey(key) || matchKeyPatterns(reservedKeyPatterns, key) || matchKeyPatterns(p.Deny, key) {
+		return false
+	}
+
+	if matchKeyPatterns(DefaultDenyKeys, key) {
+		for _, pattern := range p.Allow {
+			if strings.EqualFold(pattern, key) {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	return strings.HasPrefix(key, BaggagePrefixOnMetaData) || matchKeyPatterns(p.Allow, key)
+}
+
+func (p *PropagationPolicy) maxKeySize() int {
+	if p.MaxKeySize > 0 {
+		return p.MaxKeySize
+	}
+
+	return DefaultPropagationMaxKeySize
+}
+
+func (p *PropagationPolicy) maxTotalSize() int {
+	if p.MaxTotalSize > 0 {
+		return p.MaxTotalSize
+	}
+
+	return DefaultPropagationMaxTotalSize
+}
+
+func mdKeySize(key string, vs []string) int {
+	size := len(key)
+
+	for _, v := range vs {
+		size += len(v)
+	}
+
+	return size
+}
+
+// Filter returns the allowed keys of md within the size limits, the keys are taken in the sorted order and the
+// ones over the limits are skipped.
+func (p *PropagationPolicy) Filter(md metadata.MD) metadata.MD {
+	keys := make([]string, 0, len(md))
+
+	for key, vs := range md {
+		if len(vs) > 0 && p.Allowed(key) {
+			keys = append(keys, key)
+		}
+	}
+
+	sort.Strings(keys)
+
+	var total int
+
+	out := metadata.New(nil)
+
+	for _, key := range keys {
+		size := mdKeySize(key, md[key])
+		if size > p.maxKeySize() || total+size > p.maxTotalSize() {
+			continue
+		}
+
+		total += size
+
+		out.Set(key, md[key]...)
+	}
+
+	return out
+}
@@ -0,0 +1,152 @@
+package meta
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	// RequestParentIDOnMetaData the id of the request which forked the request, see ForkRequestInfo
+	RequestParentIDOnMetaData = "ymi-micro-srv-req-parent-id"
+	// RequestOriginOnMetaData the service which started the request
+	RequestOriginOnMetaData = "ymi-micro-srv-req-origin"
+	// RequestHopsOnMetaData the number of the services the request passed before the receiver
+	RequestHopsOnMetaData = "ymi-micro-srv-req-hops"
+)
+
+func isRequestInfoKey(key string) bool {
+	switch key {
+	case RequestIDOnMetaData, RequestParentIDOnMetaData, RequestOriginOnMetaData, RequestHopsOnMetaData:
+		return true
+	}
+
+	return false
+}
+
+// RequestInfo the request context shared by the whole call chain.
+type RequestInfo struct {
+	// ID the request id, it's kept across the services
+	ID string
+	// ParentID the id of the request which forked this one, empty for the requests started by the clients
+	ParentID string
+	// Origin the service which started the request, empty if unknown
+	Origin string
+	// Hops the number of the services the request passed before the current one
+	Hops int
+}
+
+type requestInfoKey struct{}
+
+// WithRequestInfo stores the request info, the client interceptors propagate it by TransferContextMeta.
+func WithRequestInfo(ctx context.Context, info RequestInfo) context.Context {
+	return context.WithValue(ctx, requestInfoKey{}, info)
+}
+
+// RequestInfoFromContext returns the request info stored by WithRequestInfo.
+func RequestInfoFromContext(ctx context.Context) (RequestInfo, bool) {
+	info, ok := ctx.Value(requestInfoKey{}).(RequestInfo)
+
+	return info, ok
+}
+
+// RequestIDFromContext returns the id of RequestInfoFromContext, or the id of the incoming or the outgoing metadata.
+func RequestIDFromContext(ctx context.Context) string {
+	if info, ok := RequestInfoFromContext(ctx); ok && info.ID != "" {
+		return info.ID
+	}
+
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if id := GetRequestIDFromMD(md); id != "" {
+			return id
+		}
+	}
+
+	return IDFromOutgoingContext(ctx)
+}
+
+func firstMDValue(md metadata.MD, key string) string {
+	for _, v := range md.Get(key) {
+		if v = strings.TrimSpace(v); v != "" {
+			return v
+		}
+	}
+
+	return ""
+}
+
+// RequestInfoFromMD reads the request info sent by the caller, ok is false if there is no valid request id (see
+// ValidRequestID). The invalid parent id and origin are dropped.
+func RequestInfoFromMD(md metadata.MD) (info RequestInfo, ok bool) {
+	info.ID = firstMDValue(md, RequestIDOnMetaData)
+	if !ValidRequestID(info.ID) {
+		return RequestInfo{}, false
+	}
+
+	if parentID := firstMDValue(md, RequestParentIDOnMetaData); ValidRequestID(parentID) {
+		info.ParentID = parentID
+	}
+
+	if origin := firstMDValue(md, RequestOriginOnMetaData); ValidRequestID(origin) {
+		info.Origin = origin
+	}
+
+	if hops, err := strconv.Atoi(firstMDValue(md, RequestHopsOnMetaData)); err == nil && hops >= 0 {
+		info.Hops = hops
+	}
+
+	return info, true
+}
+
+// NewRequestInfo starts a request in the service, gen is the default generator (see SetDefaultIDGenerator) if nil.
+func NewRequestInfo(gen IDGenerator, service string) RequestInfo {
+	if gen == nil {
+		gen = defaultIDGenerator.Load()
+	}
+
+	return RequestInfo{
+		ID:     gen.NewID(),
+		Origin: service,
+	}
+}
+
+// ServerRequestInfo returns the request info of the incoming metadata, or starts a request in the service if
+// there is no request id.
+func ServerRequestInfo(ctx context.Context, gen IDGenerator, service string) RequestInfo {
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	if info, ok := RequestInfoFromMD(md); ok {
+		return info
+	}
+
+	return NewRequestInfo(gen, service)
+}
+
+// ForkRequestInfo starts a request in the service for the work derived from ctx but done out of its call chain,
+// e.g. the background jobs, the parent id is the request id of ctx.
+func ForkRequestInfo(ctx context.Context, gen IDGenerator, service string) RequestInfo {
+	info := NewRequestInfo(gen, service)
+	info.ParentID = RequestIDFromContext(ctx)
+
+	return info
+}
+
+// SetToMD sets the request info for the next service, the hops are increased.
+func (info RequestInfo) SetToMD(md metadata.MD) {
+	md.Set(RequestIDOnMetaData, info.ID)
+
+	md.Delete(RequestParentIDOnMetaData)
+	md.Delete(RequestOriginOnMetaData)
+
+	if info.ParentID != "" {
+		md.Set(RequestParentIDOnMetaData, info.ParentID)
+	}
+
+	if info.Origin != "" {
+		md.Set(RequestOriginOnMetaData, info.Origin)
+	}
+
+	md.Set(RequestHopsOnMetaData, strconv.Itoa(info.Hops+1))
+}
@@ -0,0 +1,420 @@
+package grpce
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sgostarter/libeasygo/cuserror"
+	"google.golang.org/grpc/peer"
+)
+
+const (
+	ProxyProtocolTLVTypeALPN      byte = 0x01
+	ProxyProtocolTLVTypeAuthority byte = 0x02
+	ProxyProtocolTLVTypeCRC32C    byte = 0x03
+	ProxyProtocolTLVTypeNoop      byte = 0x04
+	ProxyProtocolTLVTypeUniqueID  byte = 0x05
+	ProxyProtocolTLVTypeSSL       byte = 0x20
+	ProxyProtocolTLVTypeNetNS     byte = 0x30
+
+	defaultProxyProtocolReadHeaderTimeout = 10 * time.Second
+
+	proxyProtocolV1MaxLength = 107
+)
+
+var (
+	proxyProtocolV1Prefix   = []byte("PROXY ")
+	proxyProtocolV2Magic    = []byte("\r\n\r\n\x00\r\nQUIT\n")
+	ErrNoProxyProtocol      = errors.New("no proxy protocol header")
+	ErrInvalidProxyProtocol = errors.New("invalid proxy protocol header")
+)
+
+type ProxyProtocolConfig struct {
+	// TrustedProxies the CIDRs or ips of the load balancers, the headers from the other sources are not parsed
+	TrustedProxies []string `yaml:"trusted_proxies" json:"trusted_proxies"`
+	// Optional accepts the connections of the trusted proxies without the header
+	Optional bool `yaml:"optional" json:"optional"`
+	// ReadHeaderTimeout 10s if 0
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout" json:"read_header_timeout"`
+}
+
+// Validate .
+func (cfg *ProxyProtocolConfig) Validate() error {
+	if len(cfg.TrustedProxies) == 0 {
+		return cuserror.NewWithErrorMsg("trusted_proxies is required")
+	}
+
+	if cfg.ReadHeaderTimeout < 0 {
+		return cuserror.NewWithErrorMsg("read_header_timeout: should not be negative")
+	}
+
+	_, err := NewRealIPResolver(&RealIPResolverConfig{TrustedProxies: cfg.TrustedProxies})
+
+	return err
+}
+
+type ProxyProtocolTLV struct {
+	Type  byte
+	Value []byte
+}
+
+// ProxyProtocolInfo the header sent by the proxy, Source and Destination are nil for the LOCAL command and
+// the UNKNOWN protocol.
+type ProxyProtocolInfo struct {
+	Version     int
+	Source      net.Addr
+	Destination net.Addr
+	TLVs        []ProxyProtocolTLV
+}
+
+// TLV returns the value of the first TLV of the type.
+func (info *ProxyProtocolInfo) TLV(t byte) ([]byte, bool) {
+	for _, tlv := range info.TLVs {
+		if tlv.Type == t {
+			return tlv.Value, true
+		}
+	}
+
+	return nil, false
+}
+
+// ProxyProtocolAddr is the RemoteAddr of the connections with the proxy protocol header, it's the source address
+// reported by the proxy, so peer.FromContext, http.Request.RemoteAddr and GrpcGetRealIP see the real client.
+type ProxyProtocolAddr struct {
+	net.Addr
+
+	Proxy net.Addr
+	Info  *ProxyProtocolInfo
+}
+
+// ProxyProtocolListener parses the PROXY protocol v1 and v2 headers of the connections from the trusted proxies.
+// The header is read on the first Read or RemoteAddr of the connection, not in Accept, so slow clients don't block
+// the others. Wrap it with tls.NewListener for tls.
+type ProxyProtocolListener struct {
+	net.Listener
+
+	trusted           *RealIPResolver
+	optional          bool
+	readHeaderTimeout time.Duration
+}
+
+func NewProxyProtocolListener(listener net.Listener, cfg *ProxyProtocolConfig) (*ProxyProtocolListener, error) {
+	if listener == nil || cfg == nil {
+		return nil, cuserror.NewWithErrorMsg("listener and config are required")
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	trusted, _ := NewRealIPResolver(&RealIPResolverConfig{TrustedProxies: cfg.TrustedProxies})
+
+	readHeaderTimeout := cfg.ReadHeaderTimeout
+	if readHeaderTimeout <= 0 {
+		readHeaderTimeout = defaultProxyProtocolReadHeaderTimeout
+	}
+
+	return &ProxyProtocolListener{
+		Listener:          listener,
+		trusted:           trusted,
+		optional:          cfg.Optional,
+		readHeaderTimeout: readHeaderTimeout,
+	}, nil
+}
+
+func (listener *ProxyProtocolListener) Accept() (net.Conn, error) {
+	conn, err := listener.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+
+	addr, ok := parseIPAddr(conn.RemoteAddr().String())
+	if !ok || !listener.trusted.isTrusted(addr) {
+		return conn, nil
+	}
+
+	return &proxyProtocolConn{
+		Conn:     conn,
+		reader:   bufio.NewReaderSize(conn, 256),
+		listener: listener,
+	}, nil
+}
+
+type proxyProtocolConn struct {
+	net.Conn
+
+	reader   *bufio.Reader
+	listener *ProxyProtocolListener
+
+	once sync.Once
+	info *ProxyProtocolInfo
+	err  error
+}
+
+func (conn *proxyProtocolConn) readHeader() {
+	conn.once.Do(func() {
+		_ = conn.Conn.SetReadDeadline(time.Now().Add(conn.listener.readHeaderTimeout))
+
+		conn.info, conn.err = readProxyProtocolHeader(conn.reader)
+		if errors.Is(conn.err, ErrNoProxyProtocol) && conn.listener.optional {
+			conn.err = nil
+		}
+
+		_ = conn.Conn.SetReadDeadline(time.Time{})
+
+		if conn.err != nil {
+			_ = conn.Conn.Close()
+		}
+	})
+}
+
+func (conn *proxyProtocolConn) Read(b []byte) (int, error) {
+	conn.readHeader()
+
+	if conn.err != nil {
+		return 0, conn.err
+	}
+
+	return conn.reader.Read(b)
+}
+
+func (conn *proxyProtocolConn) RemoteAddr() net.Addr {
+	conn.readHeader()
+
+	if conn.info == nil || conn.info.Source == nil {
+		return conn.Conn.RemoteAddr()
+	}
+
+	return &ProxyProtocolAddr{
+		Addr:  conn.info.Source,
+		Proxy: conn.Conn.RemoteAddr(),
+		Info:  conn.info,
+	}
+}
+
+func (conn *proxyProtocolConn) LocalAddr() net.Addr {
+	conn.readHeader()
+
+	if conn.info == nil || conn.info.Destination == nil {
+		return conn.Conn.LocalAddr()
+	}
+
+	return conn.info.Destination
+}
+
+func readProxyProtocolHeader(reader *bufio.Reader) (*ProxyProtocolInfo, error) {
+	d, err := reader.Peek(len(proxyProtocolV1Prefix))
+	if err != nil {
+		return nil, err
+	}
+
+	if bytes.Equal(d, proxyProtocolV1Prefix) {
+		return readProxyProtocolV1(reader)
+	}
+
+	if !bytes.HasPrefix(proxyProtocolV2Magic, d) {
+		return nil, ErrNoProxyProtocol
+	}
+
+	d, err = reader.Peek(len(proxyProtocolV2Magic))
+	if err != nil {
+		return nil, err
+	}
+
+	if !bytes.Equal(d, proxyProtocolV2Magic) {
+		return nil, ErrNoProxyProtocol
+	}
+
+	return readProxyProtocolV2(reader)
+}
+
+func invalidProxyProtocol(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", ErrInvalidProxyProtocol, fmt.Sprintf(format, args...))
+}
+
+func readProxyProtocolV1(reader *bufio.Reader) (*ProxyProtocolInfo, error) {
+	var line []byte
+
+	for len(line) < proxyProtocolV1MaxLength {
+		b, err := reader.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+
+		line = append(line, b)
+
+		if b == '\n' {
+			break
+		}
+	}
+
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, invalidProxyProtocol("v1 header too long")
+	}
+
+	fields := strings.Fields(string(line[:len(line)-2]))
+	if len(fields) < 2 {
+		return nil, invalidProxyProtocol("v1 header %q", line)
+	}
+
+	info := &ProxyProtocolInfo{Version: 1}
+
+	switch fields[1] {
+	case "UNKNOWN":
+		return info, nil
+	case "TCP4", "TCP6":
+	default:
+		return nil, invalidProxyProtocol("v1 protocol %v", fields[1])
+	}
+
+	if len(fields) != 6 {
+		return nil, invalidProxyProtocol("v1 header %q", line)
+	}
+
+	src, err := parseProxyProtocolV1Addr(fields[2], fields[4], fields[1] == "TCP4")
+	if err != nil {
+		return nil, err
+	}
+
+	dst, err := parseProxyProtocolV1Addr(fields[3], fields[5], fields[1] == "TCP4")
+	if err != nil {
+		return nil, err
+	}
+
+	info.Source, info.Destination = src, dst
+
+	return info, nil
+}
+
+func parseProxyProtocolV1Addr(ip, port string, v4 bool) (net.Addr, error) {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil || addr.Is4() != v4 {
+		return nil, invalidProxyProtocol("v1 address %v", ip)
+	}
+
+	p, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return nil, invalidProxyProtocol("v1 port %v", port)
+	}
+
+	return net.TCPAddrFromAddrPort(netip.AddrPortFrom(addr, uint16(p))), nil
+}
+
+func readProxyProtocolV2(reader *bufio.Reader) (*ProxyProtocolInfo, error) {
+	header := make([]byte, 16)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		return nil, err
+	}
+
+	if header[12]>>4 != 2 {
+		return nil, invalidProxyProtocol("v2 version %d", header[12]>>4)
+	}
+
+	payload := make([]byte, binary.BigEndian.Uint16(header[14:]))
+	if _, err := io.ReadFull(reader, payload); err != nil {
+		return nil, err
+	}
+
+	info := &ProxyProtocolInfo{Version: 2}
+
+	command := header[12] & 0x0f
+
+	switch command {
+	case 0x00: // LOCAL, e.g. the health checks of the proxy
+		return info, nil
+	case 0x01: // PROXY
+	default:
+		return nil, invalidProxyProtocol("v2 command %d", command)
+	}
+
+	var addrLen int
+
+	family, transport := header[13]>>4, header[13]&0x0f
+
+	switch family {
+	case 0x00: // UNSPEC
+	case 0x01: // INET
+		addrLen = 12
+	case 0x02: // INET6
+		addrLen = 36
+	case 0x03: // UNIX
+		addrLen = 216
+	default:
+		return nil, invalidProxyProtocol("v2 family %d", family)
+	}
+
+	if len(payload) < addrLen {
+		return nil, invalidProxyProtocol("v2 address length %d", len(payload))
+	}
+
+	switch family {
+	case 0x01, 0x02:
+		ipLen := (addrLen - 4) / 2
+		srcIP, _ := netip.AddrFromSlice(payload[:ipLen])
+		dstIP, _ := netip.AddrFromSlice(payload[ipLen : 2*ipLen])
+		src := netip.AddrPortFrom(srcIP, binary.BigEndian.Uint16(payload[2*ipLen:]))
+		dst := netip.AddrPortFrom(dstIP, binary.BigEndian.Uint16(payload[2*ipLen+2:]))
+
+		if transport == 0x02 {
+			info.Source, info.Destination = net.UDPAddrFromAddrPort(src), net.UDPAddrFromAddrPort(dst)
+		} else {
+			info.Source, info.Destination = net.TCPAddrFromAddrPort(src), net.TCPAddrFromAddrPort(dst)
+		}
+	case 0x03:
+		info.Source = &net.UnixAddr{Name: string(bytes.TrimRight(payload[:108], "\x00")), Net: "unix"}
+		info.Destination = &net.UnixAddr{Name: string(bytes.TrimRight(payload[108:216], "\x00")), Net: "unix"}
+	}
+
+	for tlvs := payload[addrLen:]; len(tlvs) > 0; {
+		if len(tlvs) < 3 {
+			return nil, invalidProxyProtocol("v2 tlv")
+		}
+
+		l := int(binary.BigEndian.Uint16(tlvs[1:]))
+		if len(tlvs) < 3+l {
+			return nil, invalidProxyProtocol("v2 tlv length %d", l)
+		}
+
+		info.TLVs = append(info.TLVs, ProxyProtocolTLV{Type: tlvs[0], Value: tlvs[3 : 3+l]})
+		tlvs = tlvs[3+l:]
+	}
+
+	return info, nil
+}
+
+type proxyProtocolConnKey struct{}
+
+// ProxyProtocolConnContext is for http.Server.ConnContext, it keeps the connection for ProxyProtocolAddrFromContext.
+// It's called in the accept loop, so the header is not read here but by the first use of the address.
+func ProxyProtocolConnContext(ctx context.Context, c net.Conn) context.Context {
+	return context.WithValue(ctx, proxyProtocolConnKey{}, c)
+}
+
+// ProxyProtocolAddrFromContext returns the proxy address and the header of the connection of the grpc or
+// http request.
+func ProxyProtocolAddrFromContext(ctx context.Context) (*ProxyProtocolAddr, bool) {
+	if c, ok := ctx.Value(proxyProtocolConnKey{}).(net.Conn); ok {
+		if addr, ok := c.RemoteAddr().(*ProxyProtocolAddr); ok {
+			return addr, true
+		}
+	}
+
+	if p, ok := peer.FromContext(ctx); ok {
+		if addr, ok := p.Addr.(*ProxyProtocolAddr); ok {
+			return addr, true
+		}
+	}
+
+	return nil, false
+}
@@ -0,0 +1,209 @@
+package grpce
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestProxyProtocolListener(t *testing.T, cfg *ProxyProtocolConfig) *ProxyProtocolListener {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+
+	ppListener, err := NewProxyProtocolListener(listener, cfg)
+	assert.Nil(t, err)
+
+	t.Cleanup(func() {
+		_ = ppListener.Close()
+	})
+
+	return ppListener
+}
+
+// acceptWith sends d on a new connection and returns the accepted one.
+func acceptWith(t *testing.T, listener net.Listener, d []byte) net.Conn {
+	go func() {
+		conn, err := net.Dial("tcp", listener.Addr().String())
+		if err != nil {
+			return
+		}
+
+		_, _ = conn.Write(d)
+
+		t.Cleanup(func() {
+			_ = conn.Close()
+		})
+	}()
+
+	conn, err := listener.Accept()
+	assert.Nil(t, err)
+
+	t.Cleanup(func() {
+		_ = conn.Close()
+	})
+
+	return conn
+}
+
+func TestProxyProtocolV1(t *testing.T) {
+	listener := newTestProxyProtocolListener(t, &ProxyProtocolConfig{TrustedProxies: []string{"127.0.0.1"}})
+
+	conn := acceptWith(t, listener, []byte("PROXY TCP6 2001:db8::1 2001:db8::2 1234 443\r\nhello"))
+
+	assert.Equal(t, "[2001:db8::1]:1234", conn.RemoteAddr().String())
+	assert.Equal(t, "[2001:db8::2]:443", conn.LocalAddr().String())
+
+	addr, ok := conn.RemoteAddr().(*ProxyProtocolAddr)
+	assert.True(t, ok)
+	assert.Equal(t, 1, addr.Info.Version)
+	assert.Contains(t, addr.Proxy.String(), "127.0.0.1:")
+
+	d := make([]byte, 5)
+	_, err := io.ReadFull(conn, d)
+	assert.Nil(t, err)
+	assert.Equal(t, "hello", string(d))
+}
+
+func TestProxyProtocolV2(t *testing.T) {
+	listener := newTestProxyProtocolListener(t, &ProxyProtocolConfig{TrustedProxies: []string{"127.0.0.0/8"}})
+
+	var payload bytes.Buffer
+
+	payload.Write([]byte{1, 2, 3, 4, 5, 6, 7, 8})
+	_ = binary.Write(&payload, binary.BigEndian, uint16(1234))
+	_ = binary.Write(&payload, binary.BigEndian, uint16(443))
+	payload.Write([]byte{ProxyProtocolTLVTypeAuthority, 0, 5})
+	payload.WriteString("a.com")
+
+	var header bytes.Buffer
+
+	header.Write(proxyProtocolV2Magic)
+	header.Write([]byte{0x21, 0x11})
+	_ = binary.Write(&header, binary.BigEndian, uint16(payload.Len()))
+	header.Write(payload.Bytes())
+	header.WriteString("hello")
+
+	conn := acceptWith(t, listener, header.Bytes())
+
+	assert.Equal(t, "1.2.3.4:1234", conn.RemoteAddr().String())
+
+	addr, ok := conn.RemoteAddr().(*ProxyProtocolAddr)
+	assert.True(t, ok)
+
+	authority, ok := addr.Info.TLV(ProxyProtocolTLVTypeAuthority)
+	assert.True(t, ok)
+	assert.Equal(t, "a.com", string(authority))
+
+	d := make([]byte, 5)
+	_, err := io.ReadFull(conn, d)
+	assert.Nil(t, err)
+	assert.Equal(t, "hello", string(d))
+}
+
+func TestProxyProtocolUntrustedAndMissing(t *testing.T) {
+	listener := newTestProxyProtocolListener(t, &ProxyProtocolConfig{TrustedProxies: []string{"10.0.0.0/8"}})
+
+	conn := acceptWith(t, listener, []byte("PROXY TCP4 1.1.1.1 2.2.2.2 1 2\r\n"))
+	assert.Contains(t, conn.RemoteAddr().String(), "127.0.0.1:", "the header of untrusted sources is not parsed")
+
+	listener = newTestProxyProtocolListener(t, &ProxyProtocolConfig{TrustedProxies: []string{"127.0.0.1"}})
+
+	conn = acceptWith(t, listener, []byte("GET / HTTP/1.1\r\n"))
+
+	_, err := conn.Read(make([]byte, 1))
+	assert.True(t, errors.Is(err, ErrNoProxyProtocol))
+
+	listener = newTestProxyProtocolListener(t, &ProxyProtocolConfig{TrustedProxies: []string{"127.0.0.1"}, Optional: true})
+
+	conn = acceptWith(t, listener, []byte("GET / HTTP/1.1\r\n"))
+
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	assert.Nil(t, err)
+	assert.Equal(t, "GET / HTTP/1.1\r\n", line)
+
+	listener = newTestProxyProtocolListener(t, &ProxyProtocolConfig{TrustedProxies: []string{"127.0.0.1"}})
+
+	conn = acceptWith(t, listener, []byte("PROXY TCP4 1.1.1.1 2.2.2.2 1\r\n"))
+
+	_, err = conn.Read(make([]byte, 1))
+	assert.True(t, errors.Is(err, ErrInvalidProxyProtocol))
+
+	_, err = NewProxyProtocolListener(listener, &ProxyProtocolConfig{})
+	assert.NotNil(t, err)
+}
+
+func TestProxyProtocolHTTP(t *testing.T) {
+	listener := newTestProxyProtocolListener(t, &ProxyProtocolConfig{TrustedProxies: []string{"127.0.0.1"}})
+
+	chAddr := make(chan string, 1)
+
+	server := &http.Server{ // nolint: gosec
+		Handler: http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+			addr, ok := ProxyProtocolAddrFromContext(r.Context())
+			assert.True(t, ok)
+			assert.Equal(t, r.RemoteAddr, addr.String())
+
+			chAddr <- HTTPGetRealIP(r)
+		}),
+		ConnContext: ProxyProtocolConnContext,
+	}
+
+	go func() {
+		_ = server.Serve(listener)
+	}()
+
+	defer server.Close()
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	assert.Nil(t, err)
+
+	defer conn.Close()
+
+	_, err = conn.Write([]byte("PROXY TCP4 1.1.1.1 2.2.2.2 1234 80\r\nGET / HTTP/1.1\r\nHost: a\r\n\r\n"))
+	assert.Nil(t, err)
+
+	assert.Equal(t, "1.1.1.1", <-chAddr)
+}
+
+func TestProxyProtocolHTTPStalledClient(t *testing.T) {
+	listener := newTestProxyProtocolListener(t, &ProxyProtocolConfig{TrustedProxies: []string{"127.0.0.1"}})
+
+	server := &http.Server{ // nolint: gosec
+		Handler:     http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {}),
+		ConnContext: ProxyProtocolConnContext,
+	}
+
+	go func() {
+		_ = server.Serve(listener)
+	}()
+
+	defer server.Close()
+
+	// sends nothing, its header is read until the 10s timeout
+	stalled, err := net.Dial("tcp", listener.Addr().String())
+	assert.Nil(t, err)
+
+	defer stalled.Close()
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	assert.Nil(t, err)
+
+	defer conn.Close()
+
+	_ = conn.SetDeadline(time.Now().Add(time.Second * 3))
+
+	_, err = conn.Write([]byte("PROXY TCP4 1.1.1.1 2.2.2.2 1234 80\r\nGET / HTTP/1.1\r\nHost: a\r\n\r\n"))
+	assert.Nil(t, err)
+
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	assert.Nil(t, err)
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n", line)
+}
@@ -0,0 +1,266 @@
+package grpce
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"github.com/sgostarter/libeasygo/cuserror"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+const (
+	RealIPHeaderForwarded     = "forwarded"
+	RealIPHeaderXForwardedFor = "x-forwarded-for"
+	RealIPHeaderXRealIP       = "x-real-ip"
+
+	// TrustedProxiesPrivate the loopback, link local and private networks
+	TrustedProxiesPrivate = "private"
+)
+
+var defaultRealIPHeaders = []string{RealIPHeaderForwarded, RealIPHeaderXForwardedFor}
+
+var privatePrefixes = []netip.Prefix{
+	netip.MustParsePrefix("127.0.0.0/8"),
+	netip.MustParsePrefix("10.0.0.0/8"),
+	netip.MustParsePrefix("172.16.0.0/12"),
+	netip.MustParsePrefix("192.168.0.0/16"),
+	netip.MustParsePrefix("169.254.0.0/16"),
+	netip.MustParsePrefix("::1/128"),
+	netip.MustParsePrefix("fc00::/7"),
+	netip.MustParsePrefix("fe80::/10"),
+}
+
+type RealIPResolverConfig struct {
+	// TrustedProxies the CIDRs or ips of the proxies whose headers are trusted, "private" for the private networks.
+	// The peer address is the real ip if it's not trusted.
+	TrustedProxies []string `yaml:"trusted_proxies" json:"trusted_proxies"`
+	// Headers checked in order, forwarded, x-forwarded-for and x-real-ip are supported,
+	// forwarded and x-forwarded-for if empty
+	Headers []string `yaml:"headers" json:"headers"`
+}
+
+// Validate .
+func (cfg *RealIPResolverConfig) Validate() error {
+	_, err := NewRealIPResolver(cfg)
+
+	return err
+}
+
+// RealIPResolver resolves the client ip of the requests passing the trusted proxies. The list headers are walked
+// from the right, the first untrusted address is the client. With the PROXY protocol listener the peer address
+// is already the one the proxy reports, and the peer needs to be trusted only for the headers.
+type RealIPResolver struct {
+	trusted []netip.Prefix
+	headers []string
+}
+
+func NewRealIPResolver(cfg *RealIPResolverConfig) (*RealIPResolver, error) {
+	if cfg == nil {
+		cfg = &RealIPResolverConfig{}
+	}
+
+	resolver := &RealIPResolver{}
+
+	var errs []error
+
+	for _, s := range cfg.TrustedProxies {
+		s = strings.TrimSpace(s)
+
+		if strings.EqualFold(s, TrustedProxiesPrivate) {
+			resolver.trusted = append(resolver.trusted, privatePrefixes...)
+
+			continue
+		}
+
+		if strings.Contains(s, "/") {
+			prefix, err := netip.ParsePrefix(s)
+			if err != nil {
+				errs = append(errs, cuserror.NewWithErrorMsg(fmt.Sprintf("trusted_proxies: %v", err)))
+
+				continue
+			}
+
+			resolver.trusted = append(resolver.trusted, prefix.Masked())
+
+			continue
+		}
+
+		addr, err := netip.ParseAddr(s)
+		if err != nil {
+			errs = append(errs, cuserror.NewWithErrorMsg(fmt.Sprintf("trusted_proxies: %v", err)))
+
+			continue
+		}
+
+		addr = addr.Unmap()
+		resolver.trusted = append(resolver.trusted, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+
+	for _, header := range cfg.Headers {
+		header = strings.ToLower(strings.TrimSpace(header))
+
+		switch header {
+		case RealIPHeaderForwarded, RealIPHeaderXForwardedFor, RealIPHeaderXRealIP:
+			resolver.headers = append(resolver.headers, header)
+		default:
+			errs = append(errs, cuserror.NewWithErrorMsg(fmt.Sprintf("headers: unsupported header %v", header)))
+		}
+	}
+
+	if len(resolver.headers) == 0 {
+		resolver.headers = defaultRealIPHeaders
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+
+	return resolver, nil
+}
+
+func (resolver *RealIPResolver) isTrusted(addr netip.Addr) bool {
+	for _, prefix := range resolver.trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Resolve remoteAddr is the address of the peer, host:port or host, header returns the values of the header.
+func (resolver *RealIPResolver) Resolve(remoteAddr string, header func(key string) []string) string {
+	remote, ok := parseIPAddr(remoteAddr)
+	if !ok {
+		return ""
+	}
+
+	if !resolver.isTrusted(remote) {
+		return remote.String()
+	}
+
+	for _, key := range resolver.headers {
+		var hops []string
+
+		values := header(key)
+
+		switch key {
+		case RealIPHeaderForwarded:
+			hops = forwardedForHops(values)
+		case RealIPHeaderXForwardedFor:
+			for _, value := range values {
+				hops = append(hops, strings.Split(value, ",")...)
+			}
+		case RealIPHeaderXRealIP:
+			if len(values) > 0 {
+				hops = values[len(values)-1:]
+			}
+		}
+
+		if len(hops) == 0 {
+			continue
+		}
+
+		client := remote
+
+		for idx := len(hops) - 1; idx >= 0; idx-- {
+			addr, ok := parseIPAddr(hops[idx])
+			if !ok {
+				// the hops left of it are untrustworthy
+				break
+			}
+
+			client = addr
+
+			if !resolver.isTrusted(addr) {
+				break
+			}
+		}
+
+		return client.String()
+	}
+
+	return remote.String()
+}
+
+// ResolveGRPC resolves with the peer and the incoming metadata.
+func (resolver *RealIPResolver) ResolveGRPC(ctx context.Context) string {
+	client, ok := peer.FromContext(ctx)
+	if !ok || client.Addr == nil {
+		return ""
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	return resolver.Resolve(client.Addr.String(), md.Get)
+}
+
+// ResolveHTTP resolves with the RemoteAddr and the headers.
+func (resolver *RealIPResolver) ResolveHTTP(r *http.Request) string {
+	return resolver.Resolve(r.RemoteAddr, r.Header.Values)
+}
+
+// forwardedForHops the for parameters of the RFC 7239 Forwarded header, obfuscated identifiers and unknown
+// are kept so the walk stops at them.
+func forwardedForHops(values []string) []string {
+	var hops []string
+
+	for _, value := range values {
+		for _, element := range strings.Split(value, ",") {
+			for _, pair := range strings.Split(element, ";") {
+				k, v, ok := strings.Cut(strings.TrimSpace(pair), "=")
+				if !ok || !strings.EqualFold(k, "for") {
+					continue
+				}
+
+				hops = append(hops, strings.Trim(strings.TrimSpace(v), `"`))
+			}
+		}
+	}
+
+	return hops
+}
+
+// parseIPAddr accepts ip, ip:port, [ipv6] and [ipv6]:port, the IPv4-mapped addresses are unmapped.
+func parseIPAddr(s string) (netip.Addr, bool) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return netip.Addr{}, false
+	}
+
+	if addr, err := netip.ParseAddr(s); err == nil {
+		return addr.Unmap().WithZone(""), true
+	}
+
+	host, _, err := net.SplitHostPort(s)
+	if err != nil {
+		host = strings.TrimSuffix(strings.TrimPrefix(s, "["), "]")
+	}
+
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+
+	return addr.Unmap().WithZone(""), true
+}
+
+type realIPKey struct{}
+
+// WithRealIP the real ip is returned by GrpcGetRealIP afterwards.
+func WithRealIP(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, realIPKey{}, ip)
+}
+
+// RealIPFromContext returns the ip stored by WithRealIP.
+func RealIPFromContext(ctx context.Context) (string, bool) {
+	ip, ok := ctx.Value(realIPKey{}).(string)
+
+	return ip, ok
+}
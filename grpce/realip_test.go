@@ -0,0 +1,101 @@
+package grpce
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+func TestRealIPResolverXForwardedFor(t *testing.T) {
+	resolver, err := NewRealIPResolver(&RealIPResolverConfig{TrustedProxies: []string{"10.0.0.0/8", "2001:db8::1"}})
+	assert.Nil(t, err)
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = "10.0.0.1:1234"
+	r.Header.Add("X-Forwarded-For", "1.1.1.1, 2.2.2.2")
+	r.Header.Add("X-Forwarded-For", "10.0.0.2")
+
+	// the spoofed 1.1.1.1 is skipped
+	assert.Equal(t, "2.2.2.2", resolver.ResolveHTTP(r))
+
+	r.RemoteAddr = "3.3.3.3:1234"
+	assert.Equal(t, "3.3.3.3", resolver.ResolveHTTP(r), "untrusted peer")
+
+	r.RemoteAddr = "[2001:db8::1]:443"
+	r.Header.Set("X-Forwarded-For", "2001:db8::2, 10.0.0.3")
+	assert.Equal(t, "2001:db8::2", resolver.ResolveHTTP(r))
+
+	r.Header.Set("X-Forwarded-For", "garbage, 10.0.0.3")
+	assert.Equal(t, "10.0.0.3", resolver.ResolveHTTP(r))
+
+	r.Header.Del("X-Forwarded-For")
+	assert.Equal(t, "2001:db8::1", resolver.ResolveHTTP(r))
+}
+
+func TestRealIPResolverForwarded(t *testing.T) {
+	resolver, err := NewRealIPResolver(&RealIPResolverConfig{
+		TrustedProxies: []string{TrustedProxiesPrivate},
+		Headers:        []string{"Forwarded", "X-Real-Ip"},
+	})
+	assert.Nil(t, err)
+
+	assert.Equal(t, "2001:db8::5", resolver.Resolve("127.0.0.1:80", func(key string) []string {
+		if key == RealIPHeaderForwarded {
+			return []string{`for=1.1.1.1;proto=https, for="[2001:db8::5]:4711"`, "for=192.168.0.1"}
+		}
+
+		return nil
+	}))
+
+	assert.Equal(t, "192.168.0.1", resolver.Resolve("[::1]:80", func(key string) []string {
+		if key == RealIPHeaderForwarded {
+			return []string{"for=_hidden, for=192.168.0.1"}
+		}
+
+		return nil
+	}))
+
+	assert.Equal(t, "4.4.4.4", resolver.Resolve("[::ffff:127.0.0.1]:80", func(key string) []string {
+		if key == RealIPHeaderXRealIP {
+			return []string{"4.4.4.4"}
+		}
+
+		return nil
+	}))
+
+	_, err = NewRealIPResolver(&RealIPResolverConfig{TrustedProxies: []string{"x"}})
+	assert.NotNil(t, err)
+
+	_, err = NewRealIPResolver(&RealIPResolverConfig{Headers: []string{"x"}})
+	assert.NotNil(t, err)
+}
+
+func TestGrpcGetRealIP(t *testing.T) {
+	ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 80}})
+	assert.Equal(t, "2001:db8::1", GrpcGetRealIP(ctx))
+
+	resolver, err := NewRealIPResolver(&RealIPResolverConfig{TrustedProxies: []string{"2001:db8::/32"}})
+	assert.Nil(t, err)
+
+	ctx = metadata.NewIncomingContext(ctx, metadata.Pairs("x-forwarded-for", "5.5.5.5"))
+	assert.Equal(t, "5.5.5.5", resolver.ResolveGRPC(ctx))
+
+	assert.Equal(t, "6.6.6.6", GrpcGetRealIP(WithRealIP(ctx, "6.6.6.6")))
+
+	// the headers are trusted only on demand
+	assert.Equal(t, "2001:db8::1", GrpcGetRealIP(ctx))
+	assert.Equal(t, "5.5.5.5", GrpcGetRealIPFromHeaders(ctx))
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("X-Forwarded-For", "5.5.5.5")
+	r.Header.Set("X-Real-Ip", "6.6.6.6")
+
+	assert.Equal(t, "192.0.2.1", HTTPGetRealIP(r))
+	assert.Equal(t, "5.5.5.5", HTTPGetRealIPFromHeaders(r))
+}
@@ -0,0 +1,93 @@
+package session
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/sgostarter/i/commerr"
+	"github.com/sgostarter/libservicetoolset/grpce"
+)
+
+const (
+	// MaxCookieValueLength the browsers limit a cookie to about 4096 bytes
+	MaxCookieValueLength = 4096
+
+	secureCookieKeyID = "default"
+)
+
+var (
+	ErrInvalidCookieValue = grpce.ErrCookieTampered
+	ErrCookieValueTooLong = grpce.ErrCookieTooLong
+)
+
+// Codec signs, and optionally encrypts, the values kept by the clients. The name is bound into the signature so
+// the value of one cookie can't be replayed as another. *grpce.CookieKeyring implements it with key rotation.
+type Codec interface {
+	Encode(name string, value []byte) (string, error)
+	Decode(name string, encoded string) ([]byte, error)
+}
+
+var _ Codec = (*grpce.CookieKeyring)(nil)
+
+// NewSecureCookieCodec a grpce.CookieKeyring of a single key, hashKey should be at least 16 bytes, blockKey
+// encrypts the values if it's not empty and must be 16, 24 or 32 bytes. Use grpce.NewCookieKeyring to rotate
+// the keys.
+func NewSecureCookieCodec(hashKey, blockKey []byte) (Codec, error) {
+	return grpce.NewCookieKeyring(secureCookieKeyID, grpce.CookieKey{
+		ID:       secureCookieKeyID,
+		HashKey:  hashKey,
+		BlockKey: blockKey,
+	})
+}
+
+// CookieStore is stateless, the whole record is kept by the client in the cookie. Destroyed sessions can't be
+// revoked until they expire, keep the values small and the max age short.
+type CookieStore struct {
+	name  string
+	codec Codec
+}
+
+// NewCookieStore name should be the cookie name of the manager.
+func NewCookieStore(name string, codec Codec) (*CookieStore, error) {
+	if name == "" || codec == nil {
+		return nil, commerr.ErrInvalidArgument
+	}
+
+	return &CookieStore{
+		name:  name,
+		codec: codec,
+	}, nil
+}
+
+func (store *CookieStore) Load(_ context.Context, value string) (*Record, error) {
+	d, err := store.codec.Decode(store.name, value)
+	if err != nil {
+		return nil, ErrNotFound
+	}
+
+	record := &Record{}
+
+	if err = json.Unmarshal(d, record); err != nil {
+		return nil, ErrNotFound
+	}
+
+	if !record.ExpiresAt.IsZero() && time.Now().After(record.ExpiresAt) {
+		return nil, ErrNotFound
+	}
+
+	return record, nil
+}
+
+func (store *CookieStore) Save(_ context.Context, record *Record) (string, error) {
+	d, err := json.Marshal(record)
+	if err != nil {
+		return "", err
+	}
+
+	return store.codec.Encode(store.name, d)
+}
+
+func (store *CookieStore) Delete(_ context.Context, _ string) error {
+	return nil
+}
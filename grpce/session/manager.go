@@ -0,0 +1,284 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/sgostarter/i/commerr"
+	"github.com/sgostarter/i/l"
+	"github.com/sgostarter/libservicetoolset/grpce"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	DefaultCookieName = "session"
+	DefaultMaxAge     = 24 * time.Hour
+)
+
+type Config struct {
+	// CookieName DefaultCookieName if empty
+	CookieName string `yaml:"cookie_name" json:"cookie_name"`
+	// MaxAge the session expires if it's not changed in MaxAge, DefaultMaxAge if 0
+	MaxAge time.Duration `yaml:"max_age" json:"max_age"`
+	// Cookie the attributes of the session cookie, the prefix is prepended to CookieName
+	Cookie grpce.CookieOptions `yaml:"cookie" json:"cookie"`
+
+	// Deprecated: use Cookie.Path, it's used if Cookie.Path is empty
+	Path string `yaml:"path" json:"path"`
+	// Deprecated: use Cookie.Domain, it's used if Cookie.Domain is empty
+	Domain string `yaml:"domain" json:"domain"`
+	// Deprecated: use Cookie.Secure
+	Secure bool `yaml:"secure" json:"secure"`
+	// Deprecated: use Cookie.DisableHTTPOnly
+	DisableHTTPOnly bool `yaml:"disable_http_only" json:"disable_http_only"`
+}
+
+// cookieOptions Cookie with the deprecated fields applied.
+func (cfg *Config) cookieOptions() grpce.CookieOptions {
+	opts := cfg.Cookie
+
+	if opts.Path == "" {
+		opts.Path = cfg.Path
+	}
+
+	if opts.Domain == "" {
+		opts.Domain = cfg.Domain
+	}
+
+	opts.Secure = opts.Secure || cfg.Secure
+	opts.DisableHTTPOnly = opts.DisableHTTPOnly || cfg.DisableHTTPOnly
+
+	return opts
+}
+
+// Manager loads the sessions into the context by the interceptors, the changes are saved to the store and
+// the Set-Cookie headers are sent with the response headers.
+type Manager struct {
+	cfg    Config
+	store  Store
+	logger l.Wrapper
+}
+
+func NewManager(cfg Config, store Store, logger l.Wrapper) (*Manager, error) {
+	if store == nil {
+		return nil, commerr.ErrInvalidArgument
+	}
+
+	if logger == nil {
+		logger = l.NewNopLoggerWrapper()
+	}
+
+	if cfg.CookieName == "" {
+		cfg.CookieName = DefaultCookieName
+	}
+
+	if cfg.MaxAge <= 0 {
+		cfg.MaxAge = DefaultMaxAge
+	}
+
+	cfg.Cookie = cfg.cookieOptions()
+
+	if err := cfg.Cookie.Validate(); err != nil {
+		return nil, err
+	}
+
+	return &Manager{
+		cfg:    cfg,
+		store:  store,
+		logger: logger.WithFields(l.StringField(l.ClsKey, "SessionManager")),
+	}, nil
+}
+
+// Load returns the session of the request, a new one if the client has none or it's expired.
+func (m *Manager) Load(ctx context.Context) (*Session, error) {
+	value := grpce.GetStringFromContext(ctx, m.cfg.Cookie.Name(m.cfg.CookieName))
+	if value == "" {
+		return newSession(), nil
+	}
+
+	record, err := m.store.Load(ctx, value)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return newSession(), nil
+		}
+
+		m.logger.WithFields(l.ErrorField(err)).Error("loadSessionFailed")
+
+		return nil, status.Error(codes.Unavailable, "session store unavailable")
+	}
+
+	return newSessionFromRecord(record), nil
+}
+
+// Flush saves the changes of the session and returns the Set-Cookie headers, it's called by the interceptors.
+func (m *Manager) Flush(ctx context.Context, s *Session) ([]string, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	var errs []error
+
+	for _, id := range s.obsoleteIDs {
+		if err := m.store.Delete(ctx, id); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	s.obsoleteIDs = nil
+
+	var cookies []string
+
+	if s.dirty {
+		s.record.ExpiresAt = time.Now().Add(m.cfg.MaxAge)
+
+		value, err := m.store.Save(ctx, &s.record)
+		if err != nil {
+			return nil, errors.Join(append(errs, err)...)
+		}
+
+		s.dirty = false
+		s.persisted = true
+
+		cookie, err := grpce.NewHTTPCookie(m.cfg.Cookie, grpce.OriginFromContext(ctx), m.cfg.CookieName, value,
+			int(m.cfg.MaxAge/time.Second))
+		if err != nil {
+			return nil, errors.Join(append(errs, err)...)
+		}
+
+		cookies = append(cookies, cookie)
+	} else if s.clearCookie {
+		s.clearCookie = false
+
+		cookie, err := grpce.NewHTTPCookie(m.cfg.Cookie, grpce.OriginFromContext(ctx), m.cfg.CookieName, "", -1)
+		if err != nil {
+			return nil, errors.Join(append(errs, err)...)
+		}
+
+		cookies = append(cookies, cookie)
+	}
+
+	return cookies, errors.Join(errs...)
+}
+
+func (m *Manager) flushMD(ctx context.Context, s *Session) metadata.MD {
+	cookies, err := m.Flush(ctx, s)
+	if err != nil {
+		m.logger.WithFields(l.ErrorField(err)).Error("flushSessionFailed")
+	}
+
+	if len(cookies) == 0 {
+		return nil
+	}
+
+	return metadata.MD{"set-cookie": cookies}
+}
+
+// flushToHeader the changes after the headers are sent can't reach the client.
+func (m *Manager) flushToHeader(ctx context.Context, s *Session) {
+	md := m.flushMD(ctx, s)
+	if md == nil {
+		return
+	}
+
+	if err := grpc.SetHeader(ctx, md); err != nil {
+		m.logger.WithFields(l.ErrorField(err)).Warn("sessionChangedAfterHeaderSent")
+	}
+}
+
+func (m *Manager) prepare(ctx context.Context) (context.Context, *Session, error) {
+	s, err := m.Load(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ctx = withSession(ctx, s)
+
+	if sts := grpc.ServerTransportStreamFromContext(ctx); sts != nil {
+		ctx = grpc.NewContextWithServerTransportStream(ctx, &flushingTransportStream{
+			ServerTransportStream: sts,
+			ctx:                   ctx,
+			m:                     m,
+			s:                     s,
+		})
+	}
+
+	return ctx, s, nil
+}
+
+func (m *Manager) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, s, err := m.prepare(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := handler(ctx, req)
+
+		m.flushToHeader(ctx, s)
+
+		return resp, err
+	}
+}
+
+func (m *Manager) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, s, err := m.prepare(ss.Context())
+		if err != nil {
+			return err
+		}
+
+		err = handler(srv, &flushingServerStream{
+			ServerStream: ss,
+			ctx:          ctx,
+			m:            m,
+			s:            s,
+		})
+
+		m.flushToHeader(ctx, s)
+
+		return err
+	}
+}
+
+// flushingTransportStream flushes the session before grpc.SendHeader.
+type flushingTransportStream struct {
+	grpc.ServerTransportStream
+
+	ctx context.Context
+	m   *Manager
+	s   *Session
+}
+
+func (sts *flushingTransportStream) SendHeader(md metadata.MD) error {
+	return sts.ServerTransportStream.SendHeader(metadata.Join(md, sts.m.flushMD(sts.ctx, sts.s)))
+}
+
+// flushingServerStream flushes the session before the headers are sent with the first message.
+type flushingServerStream struct {
+	grpc.ServerStream
+
+	ctx context.Context
+	m   *Manager
+	s   *Session
+}
+
+func (ss *flushingServerStream) Context() context.Context {
+	return ss.ctx
+}
+
+func (ss *flushingServerStream) SendHeader(md metadata.MD) error {
+	return ss.ServerStream.SendHeader(metadata.Join(md, ss.m.flushMD(ss.ctx, ss.s)))
+}
+
+func (ss *flushingServerStream) SendMsg(msg interface{}) error {
+	if md := ss.m.flushMD(ss.ctx, ss.s); md != nil {
+		if err := ss.ServerStream.SetHeader(md); err != nil {
+			ss.m.logger.WithFields(l.ErrorField(err)).Warn("sessionChangedAfterHeaderSent")
+		}
+	}
+
+	return ss.ServerStream.SendMsg(msg)
+}
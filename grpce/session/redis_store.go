@@ -0,0 +1,103 @@
+package session
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/sgostarter/i/commerr"
+	"github.com/sgostarter/libservicetoolset/dbtoolset"
+)
+
+const (
+	DefaultRedisKeyPrefix = "session:"
+)
+
+// RedisStore keeps the sessions as json with the ttl of the records, DefaultMaxAge for the records without
+// ExpiresAt. Saving an expired record deletes it and returns ErrExpired.
+type RedisStore struct {
+	cli       redis.UniversalClient
+	keyPrefix string
+}
+
+// NewRedisStore keyPrefix is DefaultRedisKeyPrefix if empty.
+func NewRedisStore(cli redis.UniversalClient, keyPrefix string) (*RedisStore, error) {
+	if cli == nil {
+		return nil, commerr.ErrInvalidArgument
+	}
+
+	if keyPrefix == "" {
+		keyPrefix = DefaultRedisKeyPrefix
+	}
+
+	return &RedisStore{
+		cli:       cli,
+		keyPrefix: keyPrefix,
+	}, nil
+}
+
+// NewRedisStoreFromToolset uses the redis named name of toolset, see dbtoolset.Toolset.GetRedisByName.
+func NewRedisStoreFromToolset(toolset *dbtoolset.Toolset, name, keyPrefix string) (*RedisStore, error) {
+	if toolset == nil {
+		return nil, commerr.ErrInvalidArgument
+	}
+
+	cli := toolset.GetRedisByName(name)
+	if cli == nil {
+		return nil, fmt.Errorf("redis %v is not available", name)
+	}
+
+	return NewRedisStore(cli, keyPrefix)
+}
+
+func (store *RedisStore) Load(ctx context.Context, value string) (*Record, error) {
+	d, err := store.cli.Get(ctx, store.keyPrefix+value).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, ErrNotFound
+		}
+
+		return nil, err
+	}
+
+	record := &Record{}
+
+	if err = json.Unmarshal(d, record); err != nil {
+		return nil, err
+	}
+
+	return record, nil
+}
+
+func (store *RedisStore) Save(ctx context.Context, record *Record) (string, error) {
+	d, err := json.Marshal(record)
+	if err != nil {
+		return "", err
+	}
+
+	ttl := DefaultMaxAge
+
+	if !record.ExpiresAt.IsZero() {
+		ttl = time.Until(record.ExpiresAt)
+		if ttl <= 0 {
+			if err = store.Delete(ctx, record.ID); err != nil {
+				return "", err
+			}
+
+			return "", ErrExpired
+		}
+	}
+
+	if err = store.cli.Set(ctx, store.keyPrefix+record.ID, d, ttl).Err(); err != nil {
+		return "", err
+	}
+
+	return record.ID, nil
+}
+
+func (store *RedisStore) Delete(ctx context.Context, id string) error {
+	return store.cli.Del(ctx, store.keyPrefix+id).Err()
+}
@@ -0,0 +1,182 @@
+package session
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrNotFound the session doesn't exist or is expired
+	ErrNotFound = errors.New("session not found")
+	// ErrExpired the record saved is expired
+	ErrExpired = errors.New("session expired")
+)
+
+// Record is what the stores persist.
+type Record struct {
+	ID        string            `json:"id"`
+	Values    map[string]string `json:"values"`
+	CreatedAt time.Time         `json:"created_at"`
+	ExpiresAt time.Time         `json:"expires_at"`
+}
+
+// Session is loaded into the context by the interceptors of Manager, the changes are flushed when
+// the response headers are sent.
+type Session struct {
+	lock sync.Mutex
+
+	record Record
+	isNew  bool
+	// persisted the record is in the store
+	persisted bool
+	dirty     bool
+	// clearCookie the session is destroyed and not changed afterwards
+	clearCookie bool
+	// obsoleteIDs the ids of the rotated and destroyed sessions which are deleted on flushing
+	obsoleteIDs []string
+}
+
+func newSession() *Session {
+	return &Session{
+		record: Record{
+			ID:        NewID(),
+			Values:    make(map[string]string),
+			CreatedAt: time.Now(),
+		},
+		isNew: true,
+	}
+}
+
+func newSessionFromRecord(record *Record) *Session {
+	if record.Values == nil {
+		record.Values = make(map[string]string)
+	}
+
+	return &Session{
+		record:    *record,
+		persisted: true,
+	}
+}
+
+// NewID generates a random session id.
+func NewID() string {
+	d := make([]byte, 32)
+	_, _ = rand.Read(d)
+
+	return base64.RawURLEncoding.EncodeToString(d)
+}
+
+func (s *Session) ID() string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.record.ID
+}
+
+// IsNew the session is created by this request.
+func (s *Session) IsNew() bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.isNew
+}
+
+func (s *Session) CreatedAt() time.Time {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.record.CreatedAt
+}
+
+func (s *Session) Get(key string) (string, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	v, ok := s.record.Values[key]
+
+	return v, ok
+}
+
+// Values returns a copy of the values.
+func (s *Session) Values() map[string]string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	values := make(map[string]string, len(s.record.Values))
+	for k, v := range s.record.Values {
+		values[k] = v
+	}
+
+	return values
+}
+
+func (s *Session) Set(key, value string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.record.Values[key] = value
+	s.dirty = true
+	s.clearCookie = false
+}
+
+func (s *Session) Delete(key string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if _, ok := s.record.Values[key]; ok {
+		delete(s.record.Values, key)
+		s.dirty = true
+	}
+}
+
+// RotateID changes the session id and keeps the values, call it after the privilege changes, e.g. logging in,
+// to prevent session fixation.
+func (s *Session) RotateID() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.persisted {
+		s.obsoleteIDs = append(s.obsoleteIDs, s.record.ID)
+		s.persisted = false
+	}
+
+	s.record.ID = NewID()
+	s.dirty = true
+}
+
+// Destroy deletes the session from the store and the cookie from the client. The session is empty afterwards,
+// it's saved as a new one if it's changed again.
+func (s *Session) Destroy() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.persisted {
+		s.obsoleteIDs = append(s.obsoleteIDs, s.record.ID)
+		s.persisted = false
+	}
+
+	s.record = Record{
+		ID:        NewID(),
+		Values:    make(map[string]string),
+		CreatedAt: time.Now(),
+	}
+	s.dirty = false
+	s.clearCookie = true
+}
+
+type sessionKey struct{}
+
+func withSession(ctx context.Context, s *Session) context.Context {
+	return context.WithValue(ctx, sessionKey{}, s)
+}
+
+// FromContext returns the session loaded by the interceptors of Manager, nil if there is none.
+func FromContext(ctx context.Context) *Session {
+	s, _ := ctx.Value(sessionKey{}).(*Session)
+
+	return s
+}
@@ -0,0 +1,190 @@
+package session
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/sgostarter/libservicetoolset/grpce"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/examples/helloworld/helloworld"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+type testGreeterServer struct {
+	helloworld.UnimplementedGreeterServer
+}
+
+func (s *testGreeterServer) SayHello(ctx context.Context, req *helloworld.HelloRequest) (*helloworld.HelloReply, error) {
+	sess := FromContext(ctx)
+
+	switch req.GetName() {
+	case "login":
+		sess.Set("user", "u1")
+		sess.RotateID()
+	case "logout":
+		sess.Destroy()
+	}
+
+	user, _ := sess.Get("user")
+
+	return &helloworld.HelloReply{Message: user}, nil
+}
+
+func newTestGreeterClient(t *testing.T, m *Manager) helloworld.GreeterClient {
+	lis := bufconn.Listen(1024 * 1024)
+
+	s := grpc.NewServer(grpc.UnaryInterceptor(m.UnaryServerInterceptor()))
+	helloworld.RegisterGreeterServer(s, &testGreeterServer{})
+
+	go func() {
+		_ = s.Serve(lis)
+	}()
+
+	t.Cleanup(s.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet", grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+		return lis.DialContext(ctx)
+	}), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	assert.Nil(t, err)
+
+	t.Cleanup(func() {
+		_ = conn.Close()
+	})
+
+	return helloworld.NewGreeterClient(conn)
+}
+
+func sayHello(t *testing.T, cli helloworld.GreeterClient, name, cookie string) (string, *http.Cookie) {
+	ctx := context.Background()
+	if cookie != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, "cookie", DefaultCookieName+"="+cookie)
+	}
+
+	var header metadata.MD
+
+	reply, err := cli.SayHello(ctx, &helloworld.HelloRequest{Name: name}, grpc.Header(&header))
+	assert.Nil(t, err)
+
+	values := header.Get("set-cookie")
+	if len(values) == 0 {
+		return reply.GetMessage(), nil
+	}
+
+	cookies := (&http.Response{Header: http.Header{"Set-Cookie": values}}).Cookies()
+	assert.Len(t, cookies, 1)
+
+	return reply.GetMessage(), cookies[0]
+}
+
+func testManager(t *testing.T, store Store) {
+	m, err := NewManager(Config{Cookie: grpce.CookieOptions{Secure: true, SameSite: grpce.CookieSameSiteLax}}, store, nil)
+	assert.Nil(t, err)
+
+	cli := newTestGreeterClient(t, m)
+
+	user, cookie := sayHello(t, cli, "anonymous", "")
+	assert.Empty(t, user)
+	assert.Nil(t, cookie)
+
+	user, cookie = sayHello(t, cli, "login", "")
+	assert.Equal(t, "u1", user)
+	assert.NotNil(t, cookie)
+	assert.True(t, cookie.HttpOnly)
+	assert.True(t, cookie.Secure)
+	assert.Equal(t, http.SameSiteLaxMode, cookie.SameSite)
+	assert.Equal(t, int(DefaultMaxAge/time.Second), cookie.MaxAge)
+
+	value := cookie.Value
+
+	user, cookie = sayHello(t, cli, "x", value)
+	assert.Equal(t, "u1", user)
+	assert.Nil(t, cookie)
+
+	user, cookie = sayHello(t, cli, "login", value)
+	assert.Equal(t, "u1", user)
+	assert.NotNil(t, cookie)
+	assert.NotEqual(t, value, cookie.Value)
+
+	if _, ok := store.(*CookieStore); !ok {
+		user, _ = sayHello(t, cli, "x", value)
+		assert.Empty(t, user, "the rotated id is deleted")
+	}
+
+	value = cookie.Value
+
+	user, cookie = sayHello(t, cli, "logout", value)
+	assert.Empty(t, user)
+	assert.NotNil(t, cookie)
+	assert.Empty(t, cookie.Value)
+	assert.True(t, cookie.MaxAge < 0)
+
+	if _, ok := store.(*CookieStore); !ok {
+		user, _ = sayHello(t, cli, "x", value)
+		assert.Empty(t, user)
+	}
+}
+
+func TestManagerMemoryStore(t *testing.T) {
+	testManager(t, NewMemoryStore())
+}
+
+func TestManagerCookieStore(t *testing.T) {
+	codec, err := NewSecureCookieCodec([]byte("0123456789abcdef-hash-key"), []byte("0123456789abcdef"))
+	assert.Nil(t, err)
+
+	store, err := NewCookieStore(DefaultCookieName, codec)
+	assert.Nil(t, err)
+
+	testManager(t, store)
+}
+
+func TestSecureCookieCodec(t *testing.T) {
+	codec, err := NewSecureCookieCodec([]byte("0123456789abcdef-hash-key"), nil)
+	assert.Nil(t, err)
+
+	encoded, err := codec.Encode("a", []byte("v"))
+	assert.Nil(t, err)
+
+	d, err := codec.Decode("a", encoded)
+	assert.Nil(t, err)
+	assert.Equal(t, "v", string(d))
+
+	_, err = codec.Decode("b", encoded)
+	assert.ErrorIs(t, err, ErrInvalidCookieValue)
+
+	_, err = codec.Decode("a", "x"+encoded)
+	assert.ErrorIs(t, err, ErrInvalidCookieValue)
+
+	_, err = codec.Encode("a", make([]byte, MaxCookieValueLength))
+	assert.ErrorIs(t, err, ErrCookieValueTooLong)
+
+	_, err = NewSecureCookieCodec([]byte("hash-key"), nil)
+	assert.NotNil(t, err)
+}
+
+func TestMemoryStoreExpiry(t *testing.T) {
+	store := NewMemoryStore()
+
+	_, err := store.Save(context.Background(), &Record{ID: "a", ExpiresAt: time.Now().Add(-time.Second)})
+	assert.Nil(t, err)
+
+	_, err = store.Load(context.Background(), "a")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestManagerDeprecatedCookieFields(t *testing.T) {
+	m, err := NewManager(Config{Path: "/app", Domain: "a.com", Secure: true, DisableHTTPOnly: true}, NewMemoryStore(), nil)
+	assert.Nil(t, err)
+	assert.Equal(t, grpce.CookieOptions{Path: "/app", Domain: "a.com", Secure: true, DisableHTTPOnly: true}, m.cfg.Cookie)
+
+	// Cookie wins
+	m, err = NewManager(Config{Path: "/app", Cookie: grpce.CookieOptions{Path: "/"}}, NewMemoryStore(), nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "/", m.cfg.Cookie.Path)
+}
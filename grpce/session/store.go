@@ -0,0 +1,96 @@
+package session
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Store persists the sessions. The value is what the client keeps in the cookie: the session id for the server
+// side stores, or the whole encoded record for the stateless stores.
+type Store interface {
+	// Load returns ErrNotFound if the session doesn't exist or is expired
+	Load(ctx context.Context, value string) (*Record, error)
+	// Save the record is kept until record.ExpiresAt
+	Save(ctx context.Context, record *Record) (value string, err error)
+	Delete(ctx context.Context, id string) error
+}
+
+const (
+	memoryStoreSweepEvery = 1024
+)
+
+// MemoryStore keeps the sessions in the process, for tests and single instance services.
+type MemoryStore struct {
+	lock    sync.Mutex
+	records map[string]Record
+	saves   int
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		records: make(map[string]Record),
+	}
+}
+
+func (store *MemoryStore) Load(_ context.Context, value string) (*Record, error) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	record, ok := store.records[value]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	if !record.ExpiresAt.IsZero() && time.Now().After(record.ExpiresAt) {
+		delete(store.records, value)
+
+		return nil, ErrNotFound
+	}
+
+	return cloneRecord(&record), nil
+}
+
+func (store *MemoryStore) Save(_ context.Context, record *Record) (string, error) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	store.records[record.ID] = *cloneRecord(record)
+
+	store.saves++
+	if store.saves%memoryStoreSweepEvery == 0 {
+		store.sweep()
+	}
+
+	return record.ID, nil
+}
+
+func (store *MemoryStore) Delete(_ context.Context, id string) error {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	delete(store.records, id)
+
+	return nil
+}
+
+func (store *MemoryStore) sweep() {
+	now := time.Now()
+
+	for id, record := range store.records {
+		if !record.ExpiresAt.IsZero() && now.After(record.ExpiresAt) {
+			delete(store.records, id)
+		}
+	}
+}
+
+func cloneRecord(record *Record) *Record {
+	cloned := *record
+
+	cloned.Values = make(map[string]string, len(record.Values))
+	for k, v := range record.Values {
+		cloned.Values[k] = v
+	}
+
+	return &cloned
+}
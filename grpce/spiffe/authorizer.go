@@ -0,0 +1,249 @@
+package spiffe
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sgostarter/i/commerr"
+	"github.com/sgostarter/i/l"
+	"github.com/sgostarter/libeasygo/cuserror"
+	"github.com/sgostarter/libservicetoolset/grpce/utils"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// AuthorizerRule the peers calling the methods matching Method must have one of the Allow ids.
+type AuthorizerRule struct {
+	// Method a full method (/pkg.Service/Method), all the methods of a service (/pkg.Service/*) or all the methods (*)
+	Method string `yaml:"method" json:"method"`
+	// Allow the id patterns, see MatchID
+	Allow []string `yaml:"allow" json:"allow"`
+}
+
+// AuthorizerConfig only the most specific rule matching the method is applied.
+type AuthorizerConfig struct {
+	Rules []AuthorizerRule `yaml:"rules" json:"rules"`
+	// AllowUnmatched allows any verified peer to call the methods without rules, they are denied by default
+	AllowUnmatched bool `yaml:"allow_unmatched" json:"allow_unmatched"`
+}
+
+func (cfg *AuthorizerConfig) Validate() error {
+	var errs []error
+
+	for idx, rule := range cfg.Rules {
+		if !utils.ValidMethodPattern(rule.Method) {
+			errs = append(errs, cuserror.NewWithErrorMsg(fmt.Sprintf("rules[%v].method: invalid method pattern %q",
+				idx, rule.Method)))
+		}
+
+		for _, pattern := range rule.Allow {
+			if err := validIDPattern(pattern); err != nil {
+				errs = append(errs, cuserror.NewWithErrorMsg(fmt.Sprintf("rules[%v].allow: %v", idx, err)))
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+type peerIDKey struct{}
+
+// WithPeerID stores the verified id of the peer.
+func WithPeerID(ctx context.Context, id ID) context.Context {
+	return context.WithValue(ctx, peerIDKey{}, id)
+}
+
+// PeerIDFromContext returns the id stored by the server interceptors, or the one received by the client
+// interceptors, see WithPeerIDReceiver.
+func PeerIDFromContext(ctx context.Context) (ID, bool) {
+	if id, ok := ctx.Value(peerIDKey{}).(ID); ok {
+		return id, true
+	}
+
+	if receiver, ok := ctx.Value(peerIDReceiverKey{}).(*PeerIDReceiver); ok && !receiver.ID.IsZero() {
+		return receiver.ID, true
+	}
+
+	return ID{}, false
+}
+
+// PeerCertificates returns the certificates presented by the peer of the server side ctx.
+func PeerCertificates(ctx context.Context) []*x509.Certificate {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return nil
+	}
+
+	return peerCertificates(p)
+}
+
+func peerCertificates(p *peer.Peer) []*x509.Certificate {
+	if p == nil {
+		return nil
+	}
+
+	tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok {
+		return nil
+	}
+
+	return tlsInfo.State.PeerCertificates
+}
+
+const authorizerCacheSize = 4096
+
+type verifiedPeer struct {
+	id       ID
+	gen      uint64
+	notAfter time.Time
+}
+
+// Authorizer verifies the X509-SVIDs of the callers and checks their ids per method. The chain is verified once
+// per connection, the result is kept until the bundle or the chain expires.
+type Authorizer struct {
+	cfg    AuthorizerConfig
+	bundle *TrustBundle
+	logger l.Wrapper
+
+	lock sync.Mutex
+	// verified by the leaf certificate of the connections, it's reset when it's full
+	verified map[*x509.Certificate]verifiedPeer
+}
+
+func NewAuthorizer(cfg AuthorizerConfig, bundle *TrustBundle, logger l.Wrapper) (*Authorizer, error) {
+	if bundle == nil {
+		return nil, commerr.ErrInvalidArgument
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	if logger == nil {
+		logger = l.NewNopLoggerWrapper()
+	}
+
+	return &Authorizer{
+		cfg:      cfg,
+		bundle:   bundle,
+		logger:   logger.WithFields(l.StringField(l.ClsKey, "SPIFFEAuthorizer")),
+		verified: make(map[*x509.Certificate]verifiedPeer),
+	}, nil
+}
+
+// verify the certificates of a connection share the leaf pointer, so the chain is verified once per connection.
+func (a *Authorizer) verify(certs []*x509.Certificate) (ID, error) {
+	if len(certs) == 0 {
+		return ID{}, ErrNoPeerCertificate
+	}
+
+	gen := a.bundle.generation()
+	now := time.Now()
+
+	a.lock.Lock()
+	v, ok := a.verified[certs[0]]
+	a.lock.Unlock()
+
+	if ok && v.gen == gen && now.Before(v.notAfter) {
+		return v.id, nil
+	}
+
+	id, err := a.bundle.Verify(certs)
+	if err != nil {
+		return ID{}, err
+	}
+
+	v = verifiedPeer{
+		id:       id,
+		gen:      gen,
+		notAfter: certs[0].NotAfter,
+	}
+
+	for _, cert := range certs[1:] {
+		if cert.NotAfter.Before(v.notAfter) {
+			v.notAfter = cert.NotAfter
+		}
+	}
+
+	a.lock.Lock()
+
+	if len(a.verified) >= authorizerCacheSize {
+		a.verified = make(map[*x509.Certificate]verifiedPeer)
+	}
+
+	a.verified[certs[0]] = v
+
+	a.lock.Unlock()
+
+	return id, nil
+}
+
+func (a *Authorizer) rule(fullMethod string) *AuthorizerRule {
+	var (
+		matched  *AuthorizerRule
+		priority int
+	)
+
+	for idx := range a.cfg.Rules {
+		if p := utils.MatchMethodPattern(a.cfg.Rules[idx].Method, fullMethod); p > priority {
+			matched, priority = &a.cfg.Rules[idx], p
+		}
+	}
+
+	return matched
+}
+
+// Authorize returns the context with the peer id, or an UNAUTHENTICATED or PERMISSION_DENIED error.
+func (a *Authorizer) Authorize(ctx context.Context, fullMethod string) (context.Context, error) {
+	id, err := a.verify(PeerCertificates(ctx))
+	if err != nil {
+		a.logger.WithFields(l.StringField("method", fullMethod), l.ErrorField(err)).Warn("verifyPeerFailed")
+
+		return nil, status.Errorf(codes.Unauthenticated, "verify spiffe id failed: %v", err)
+	}
+
+	rule := a.rule(fullMethod)
+
+	allowed := a.cfg.AllowUnmatched
+	if rule != nil {
+		allowed = MatchID(rule.Allow, id)
+	}
+
+	if !allowed {
+		a.logger.WithFields(l.StringField("method", fullMethod), l.StringField("peer", id.String())).Warn("peerDenied")
+
+		return nil, status.Errorf(codes.PermissionDenied, "%v is not allowed to call %v", id, fullMethod)
+	}
+
+	return WithPeerID(ctx, id), nil
+}
+
+func (a *Authorizer) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (
+		interface{}, error) {
+		ctx, err := a.Authorize(ctx, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+func (a *Authorizer) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := a.Authorize(ss.Context(), info.FullMethod)
+		if err != nil {
+			return err
+		}
+
+		return handler(srv, utils.NewServerStreamWrapper(ctx, ss))
+	}
+}
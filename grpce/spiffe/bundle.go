@@ -0,0 +1,235 @@
+package spiffe
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/sgostarter/libeasygo/cuserror"
+)
+
+var (
+	ErrUnknownTrustDomain = errors.New("unknown trust domain")
+	ErrNoPeerCertificate  = errors.New("no peer certificate")
+)
+
+// TrustBundleConfig the pem files of the CA certificates by trust domain.
+type TrustBundleConfig struct {
+	TrustDomains map[string]string `yaml:"trust_domains" json:"trust_domains"`
+}
+
+func (cfg *TrustBundleConfig) Validate() error {
+	var errs []error
+
+	if len(cfg.TrustDomains) == 0 {
+		errs = append(errs, cuserror.NewWithErrorMsg("trust_domains: empty"))
+	}
+
+	for trustDomain := range cfg.TrustDomains {
+		if _, err := ParseID(scheme + trustDomain); err != nil {
+			errs = append(errs, cuserror.NewWithErrorMsg(fmt.Sprintf("trust_domains.%v: invalid trust domain", trustDomain)))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// TrustBundle verifies the X509-SVIDs with the CA certificates of their trust domains, the certificates can be
+// replaced while it's in use.
+type TrustBundle struct {
+	lock  sync.RWMutex
+	pools map[string]*x509.CertPool
+	// gen is changed with the certificates, the cached verifications of the older gens are dropped
+	gen uint64
+}
+
+func NewTrustBundle() *TrustBundle {
+	return &TrustBundle{
+		pools: make(map[string]*x509.CertPool),
+	}
+}
+
+// NewTrustBundleFromConfig loads the pem files of cfg, call it again to rotate the bundles.
+func NewTrustBundleFromConfig(cfg *TrustBundleConfig) (*TrustBundle, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	bundle := NewTrustBundle()
+
+	for trustDomain, file := range cfg.TrustDomains {
+		if err := bundle.LoadPEMFile(trustDomain, file); err != nil {
+			return nil, err
+		}
+	}
+
+	return bundle, nil
+}
+
+// SetCertificates replaces the CA certificates of the trust domain, no certificates removes the trust domain.
+func (b *TrustBundle) SetCertificates(trustDomain string, certs ...*x509.Certificate) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.gen++
+
+	if len(certs) == 0 {
+		delete(b.pools, trustDomain)
+
+		return
+	}
+
+	pool := x509.NewCertPool()
+
+	for _, cert := range certs {
+		pool.AddCert(cert)
+	}
+
+	b.pools[trustDomain] = pool
+}
+
+// LoadPEMFile replaces the CA certificates of the trust domain with the ones of the pem file.
+func (b *TrustBundle) LoadPEMFile(trustDomain, file string) error {
+	d, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+
+	var certs []*x509.Certificate
+
+	for block, rest := pem.Decode(d); block != nil; block, rest = pem.Decode(rest) {
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return fmt.Errorf("parse %v failed: %w", file, err)
+		}
+
+		certs = append(certs, cert)
+	}
+
+	if len(certs) == 0 {
+		return cuserror.NewWithErrorMsg(fmt.Sprintf("no certificate in %v", file))
+	}
+
+	b.SetCertificates(trustDomain, certs...)
+
+	return nil
+}
+
+func (b *TrustBundle) generation() uint64 {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+
+	return b.gen
+}
+
+func (b *TrustBundle) pool(trustDomain string) *x509.CertPool {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+
+	return b.pools[trustDomain]
+}
+
+// Verify verifies the chain, the leaf first, with the bundle of the trust domain of the leaf.
+func (b *TrustBundle) Verify(certs []*x509.Certificate) (ID, error) {
+	if len(certs) == 0 {
+		return ID{}, ErrNoPeerCertificate
+	}
+
+	leaf := certs[0]
+
+	if leaf.IsCA {
+		return ID{}, fmt.Errorf("%w: the leaf is a ca", ErrInvalidID)
+	}
+
+	id, err := IDFromCert(leaf)
+	if err != nil {
+		return ID{}, err
+	}
+
+	pool := b.pool(id.TrustDomain)
+	if pool == nil {
+		return ID{}, fmt.Errorf("%w: %v", ErrUnknownTrustDomain, id.TrustDomain)
+	}
+
+	intermediates := x509.NewCertPool()
+
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+
+	_, err = leaf.Verify(x509.VerifyOptions{
+		Roots:         pool,
+		Intermediates: intermediates,
+		CurrentTime:   time.Now(),
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	if err != nil {
+		return ID{}, err
+	}
+
+	return id, nil
+}
+
+// VerifyRaw verifies the raw certificates of tls.Config.VerifyPeerCertificate.
+func (b *TrustBundle) VerifyRaw(rawCerts [][]byte) (ID, error) {
+	certs := make([]*x509.Certificate, 0, len(rawCerts))
+
+	for _, raw := range rawCerts {
+		cert, err := x509.ParseCertificate(raw)
+		if err != nil {
+			return ID{}, err
+		}
+
+		certs = append(certs, cert)
+	}
+
+	return b.Verify(certs)
+}
+
+// verifyConnection is used instead of VerifyPeerCertificate, which isn't called on the resumed sessions.
+func (b *TrustBundle) verifyConnection(allowed []string) func(tls.ConnectionState) error {
+	return func(cs tls.ConnectionState) error {
+		id, err := b.Verify(cs.PeerCertificates)
+		if err != nil {
+			return err
+		}
+
+		if len(allowed) > 0 && !MatchID(allowed, id) {
+			return fmt.Errorf("spiffe id %v is not allowed", id)
+		}
+
+		return nil
+	}
+}
+
+// ServerTLSConfig requires the clients to present the X509-SVIDs of the trust domains of the bundle, the ids are
+// checked per method by Authorizer. The resumed sessions are verified against the current bundle too.
+func (b *TrustBundle) ServerTLSConfig(certificates []tls.Certificate) *tls.Config {
+	return &tls.Config{
+		Certificates:     certificates,
+		ClientAuth:       tls.RequireAnyClientCert,
+		VerifyConnection: b.verifyConnection(nil),
+		MinVersion:       tls.VersionTLS12,
+	}
+}
+
+// ClientTLSConfig verifies the server by its X509-SVID instead of the host name, allowedServerIDs are the id
+// patterns of the servers (see MatchID), any id of the bundle if empty.
+func (b *TrustBundle) ClientTLSConfig(certificates []tls.Certificate, allowedServerIDs ...string) *tls.Config {
+	return &tls.Config{
+		Certificates: certificates,
+		// the standard host name verification is replaced by VerifyConnection
+		InsecureSkipVerify: true, // nolint: gosec
+		VerifyConnection:   b.verifyConnection(allowedServerIDs),
+		MinVersion:         tls.VersionTLS12,
+	}
+}
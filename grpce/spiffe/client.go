@@ -0,0 +1,67 @@
+package spiffe
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/peer"
+)
+
+// PeerIDReceiver receives the id of the server of the calls made with its context, see WithPeerIDReceiver.
+type PeerIDReceiver struct {
+	ID ID
+}
+
+type peerIDReceiverKey struct{}
+
+// WithPeerIDReceiver the client interceptors fill the receiver with the id of the server after the call, it's
+// read by PeerIDFromContext with the returned context too.
+func WithPeerIDReceiver(ctx context.Context) (context.Context, *PeerIDReceiver) {
+	receiver := &PeerIDReceiver{}
+
+	return context.WithValue(ctx, peerIDReceiverKey{}, receiver), receiver
+}
+
+func receivePeerID(ctx context.Context, p *peer.Peer) {
+	receiver, ok := ctx.Value(peerIDReceiverKey{}).(*PeerIDReceiver)
+	if !ok {
+		return
+	}
+
+	if certs := peerCertificates(p); len(certs) > 0 {
+		// the chain is verified during the handshake, see TrustBundle.ClientTLSConfig
+		receiver.ID, _ = IDFromCert(certs[0])
+	}
+}
+
+// UnaryClientInterceptor fills the PeerIDReceiver of the context.
+func UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn,
+		invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		p := &peer.Peer{}
+
+		err := invoker(ctx, method, req, reply, cc, append(opts, grpc.Peer(p))...)
+
+		receivePeerID(ctx, p)
+
+		return err
+	}
+}
+
+// StreamClientInterceptor fills the PeerIDReceiver of the context once the stream is created, which commits
+// the stream so it isn't retried transparently.
+func StreamClientInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string,
+		streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		cs, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			return nil, err
+		}
+
+		if p, ok := peer.FromContext(cs.Context()); ok {
+			receivePeerID(ctx, p)
+		}
+
+		return cs, nil
+	}
+}
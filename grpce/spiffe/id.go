@@ -0,0 +1,141 @@
+package spiffe
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	scheme      = "spiffe://"
+	maxIDLength = 2048
+)
+
+var (
+	ErrInvalidID = errors.New("invalid spiffe id")
+	ErrNoID      = errors.New("no spiffe id")
+)
+
+// ID a SPIFFE ID, spiffe://<trust domain><path>.
+type ID struct {
+	TrustDomain string
+	Path        string
+}
+
+func (id ID) String() string {
+	if id.TrustDomain == "" {
+		return ""
+	}
+
+	return scheme + id.TrustDomain + id.Path
+}
+
+func (id ID) IsZero() bool {
+	return id.TrustDomain == ""
+}
+
+// MemberOf reports whether the id belongs to the trust domain.
+func (id ID) MemberOf(trustDomain string) bool {
+	return id.TrustDomain != "" && id.TrustDomain == trustDomain
+}
+
+func validTrustDomainChar(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') || c == '.' || c == '-' || c == '_'
+}
+
+func validPathChar(c byte) bool {
+	return validTrustDomainChar(c) || (c >= 'A' && c <= 'Z')
+}
+
+// ParseID parses the id as the SPIFFE ID spec: lowercase scheme and trust domain, no port, user info, query or
+// fragment, and the path segments are not empty, . or ..
+func ParseID(s string) (ID, error) {
+	if len(s) > maxIDLength {
+		return ID{}, fmt.Errorf("%w: too long", ErrInvalidID)
+	}
+
+	if !strings.HasPrefix(s, scheme) {
+		return ID{}, fmt.Errorf("%w: %q should start with %v", ErrInvalidID, s, scheme)
+	}
+
+	trustDomain, path, _ := strings.Cut(s[len(scheme):], "/")
+	if trustDomain == "" {
+		return ID{}, fmt.Errorf("%w: %q has no trust domain", ErrInvalidID, s)
+	}
+
+	for idx := 0; idx < len(trustDomain); idx++ {
+		if !validTrustDomainChar(trustDomain[idx]) {
+			return ID{}, fmt.Errorf("%w: %q has invalid trust domain character %q", ErrInvalidID, s, trustDomain[idx])
+		}
+	}
+
+	id := ID{
+		TrustDomain: trustDomain,
+	}
+
+	if len(s) == len(scheme)+len(trustDomain) {
+		return id, nil
+	}
+
+	for _, segment := range strings.Split(path, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return ID{}, fmt.Errorf("%w: %q has invalid path segment %q", ErrInvalidID, s, segment)
+		}
+
+		for idx := 0; idx < len(segment); idx++ {
+			if !validPathChar(segment[idx]) {
+				return ID{}, fmt.Errorf("%w: %q has invalid path character %q", ErrInvalidID, s, segment[idx])
+			}
+		}
+	}
+
+	id.Path = "/" + path
+
+	return id, nil
+}
+
+// IDFromCert returns the SPIFFE ID of the X509-SVID, which has exactly one URI SAN.
+func IDFromCert(cert *x509.Certificate) (ID, error) {
+	if cert == nil {
+		return ID{}, ErrNoID
+	}
+
+	switch len(cert.URIs) {
+	case 0:
+		return ID{}, ErrNoID
+	case 1:
+	default:
+		return ID{}, fmt.Errorf("%w: %v uri sans", ErrInvalidID, len(cert.URIs))
+	}
+
+	return ParseID(cert.URIs[0].String())
+}
+
+// MatchID matches the id by the patterns: an id, or the ids under a path ending with /*
+// (spiffe://example.org/ns/prod/*, spiffe://example.org/* matches the whole trust domain).
+func MatchID(patterns []string, id ID) bool {
+	if id.IsZero() {
+		return false
+	}
+
+	s := id.String()
+
+	for _, pattern := range patterns {
+		if strings.HasSuffix(pattern, "/*") {
+			if strings.HasPrefix(s, pattern[:len(pattern)-1]) {
+				return true
+			}
+		} else if pattern == s {
+			return true
+		}
+	}
+
+	return false
+}
+
+func validIDPattern(pattern string) error {
+	_, err := ParseID(strings.TrimSuffix(pattern, "/*"))
+
+	return err
+}
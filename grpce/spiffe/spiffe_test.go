@@ -0,0 +1,305 @@
+package spiffe
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/examples/helloworld/helloworld"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestCA(t *testing.T, trustDomain string) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+
+	tpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: trustDomain},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+
+	d, err := x509.CreateCertificate(rand.Reader, tpl, tpl, &key.PublicKey, key)
+	assert.Nil(t, err)
+
+	cert, err := x509.ParseCertificate(d)
+	assert.Nil(t, err)
+
+	return &testCA{cert: cert, key: key}
+}
+
+func (ca *testCA) issue(t *testing.T, ids ...string) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+
+	tpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+
+	for _, id := range ids {
+		u, err := url.Parse(id)
+		assert.Nil(t, err)
+
+		tpl.URIs = append(tpl.URIs, u)
+	}
+
+	d, err := x509.CreateCertificate(rand.Reader, tpl, ca.cert, &key.PublicKey, ca.key)
+	assert.Nil(t, err)
+
+	return tls.Certificate{Certificate: [][]byte{d}, PrivateKey: key}
+}
+
+func TestParseID(t *testing.T) {
+	id, err := ParseID("spiffe://example.org/ns/prod/sa/api")
+	assert.Nil(t, err)
+	assert.Equal(t, ID{TrustDomain: "example.org", Path: "/ns/prod/sa/api"}, id)
+	assert.Equal(t, "spiffe://example.org/ns/prod/sa/api", id.String())
+	assert.True(t, id.MemberOf("example.org"))
+
+	id, err = ParseID("spiffe://example.org")
+	assert.Nil(t, err)
+	assert.Equal(t, "", id.Path)
+
+	for _, s := range []string{
+		"https://example.org/a", "spiffe://", "spiffe://Example.org/a", "spiffe://example.org:8080/a",
+		"spiffe://user@example.org/a", "spiffe://example.org/", "spiffe://example.org/a//b",
+		"spiffe://example.org/a/../b", "spiffe://example.org/a?q=1", "spiffe://example.org/a#f",
+	} {
+		_, err = ParseID(s)
+		assert.ErrorIs(t, err, ErrInvalidID, s)
+	}
+
+	id, _ = ParseID("spiffe://example.org/ns/prod/sa/api")
+	assert.True(t, MatchID([]string{"spiffe://example.org/ns/prod/*"}, id))
+	assert.True(t, MatchID([]string{"spiffe://example.org/*"}, id))
+	assert.False(t, MatchID([]string{"spiffe://example.org/ns/dev/*"}, id))
+	assert.False(t, MatchID([]string{"spiffe://example.org/ns/prod/sa/ap"}, id))
+}
+
+type testGreeterServer struct {
+	helloworld.UnimplementedGreeterServer
+}
+
+func (s *testGreeterServer) SayHello(ctx context.Context, _ *helloworld.HelloRequest) (*helloworld.HelloReply, error) {
+	id, _ := PeerIDFromContext(ctx)
+
+	return &helloworld.HelloReply{Message: id.String()}, nil
+}
+
+func TestAuthorizer(t *testing.T) {
+	ca := newTestCA(t, "example.org")
+	otherCA := newTestCA(t, "other.org")
+
+	bundle := NewTrustBundle()
+	bundle.SetCertificates("example.org", ca.cert)
+
+	a, err := NewAuthorizer(AuthorizerConfig{
+		Rules: []AuthorizerRule{
+			{Method: "*", Allow: []string{"spiffe://example.org/ns/prod/*"}},
+			{Method: "/helloworld.Greeter/*", Allow: []string{"spiffe://example.org/ns/prod/sa/web"}},
+		},
+	}, bundle, nil)
+	assert.Nil(t, err)
+
+	lis := bufconn.Listen(1024 * 1024)
+
+	s := grpc.NewServer(grpc.Creds(credentials.NewTLS(bundle.ServerTLSConfig(
+		[]tls.Certificate{ca.issue(t, "spiffe://example.org/ns/prod/sa/greeter")}))),
+		grpc.UnaryInterceptor(a.UnaryServerInterceptor()))
+	helloworld.RegisterGreeterServer(s, &testGreeterServer{})
+
+	go func() {
+		_ = s.Serve(lis)
+	}()
+
+	defer s.Stop()
+
+	fnCall := func(cert tls.Certificate, allowedServerIDs ...string) (string, ID, codes.Code) {
+		conn, err := grpc.NewClient("passthrough:///bufnet", grpc.WithContextDialer(
+			func(ctx context.Context, _ string) (net.Conn, error) {
+				return lis.DialContext(ctx)
+			}), grpc.WithTransportCredentials(credentials.NewTLS(bundle.ClientTLSConfig(
+			[]tls.Certificate{cert}, allowedServerIDs...))),
+			grpc.WithUnaryInterceptor(UnaryClientInterceptor()))
+		assert.Nil(t, err)
+
+		defer conn.Close()
+
+		ctx, receiver := WithPeerIDReceiver(context.Background())
+
+		reply, err := helloworld.NewGreeterClient(conn).SayHello(ctx, &helloworld.HelloRequest{})
+		if err != nil {
+			return "", receiver.ID, status.Code(err)
+		}
+
+		serverID, ok := PeerIDFromContext(ctx)
+		assert.True(t, ok)
+
+		return reply.GetMessage(), serverID, codes.OK
+	}
+
+	clientID, serverID, code := fnCall(ca.issue(t, "spiffe://example.org/ns/prod/sa/web"))
+	assert.Equal(t, codes.OK, code)
+	assert.Equal(t, "spiffe://example.org/ns/prod/sa/web", clientID)
+	assert.Equal(t, "spiffe://example.org/ns/prod/sa/greeter", serverID.String())
+
+	_, _, code = fnCall(ca.issue(t, "spiffe://example.org/ns/prod/sa/batch"))
+	assert.Equal(t, codes.PermissionDenied, code)
+
+	_, _, code = fnCall(otherCA.issue(t, "spiffe://other.org/ns/prod/sa/web"))
+	assert.Equal(t, codes.Unavailable, code)
+
+	_, _, code = fnCall(ca.issue(t, "spiffe://example.org/ns/prod/sa/web", "spiffe://example.org/ns/prod/sa/x"))
+	assert.Equal(t, codes.Unavailable, code)
+
+	// the server isn't the expected one
+	_, _, code = fnCall(ca.issue(t, "spiffe://example.org/ns/prod/sa/web"), "spiffe://example.org/ns/prod/sa/other")
+	assert.Equal(t, codes.Unavailable, code)
+
+	// the trust domain is rotated out
+	bundle.SetCertificates("example.org")
+
+	_, err = bundle.Verify([]*x509.Certificate{ca.cert})
+	assert.NotNil(t, err)
+}
+
+func TestAuthorizerBundleRotation(t *testing.T) {
+	ca := newTestCA(t, "example.org")
+	clientCA := newTestCA(t, "client.org")
+
+	bundle := NewTrustBundle()
+	bundle.SetCertificates("example.org", ca.cert)
+	bundle.SetCertificates("client.org", clientCA.cert)
+
+	a, err := NewAuthorizer(AuthorizerConfig{AllowUnmatched: true}, bundle, nil)
+	assert.Nil(t, err)
+
+	lis := bufconn.Listen(1024 * 1024)
+
+	s := grpc.NewServer(grpc.Creds(credentials.NewTLS(bundle.ServerTLSConfig(
+		[]tls.Certificate{ca.issue(t, "spiffe://example.org/sa/greeter")}))),
+		grpc.UnaryInterceptor(a.UnaryServerInterceptor()))
+	helloworld.RegisterGreeterServer(s, &testGreeterServer{})
+
+	go func() {
+		_ = s.Serve(lis)
+	}()
+
+	defer s.Stop()
+
+	conn, err := grpc.NewClient("passthrough:///bufnet", grpc.WithContextDialer(
+		func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}), grpc.WithTransportCredentials(credentials.NewTLS(bundle.ClientTLSConfig(
+		[]tls.Certificate{clientCA.issue(t, "spiffe://client.org/sa/web")}))))
+	assert.Nil(t, err)
+
+	defer conn.Close()
+
+	client := helloworld.NewGreeterClient(conn)
+
+	for idx := 0; idx < 2; idx++ {
+		_, err = client.SayHello(context.Background(), &helloworld.HelloRequest{})
+		assert.Nil(t, err)
+	}
+
+	assert.Len(t, a.verified, 1)
+
+	// the verified connection is checked again against the rotated bundle
+	bundle.SetCertificates("client.org", newTestCA(t, "client.org").cert)
+
+	_, err = client.SayHello(context.Background(), &helloworld.HelloRequest{})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
+
+func TestTrustBundleResumedSession(t *testing.T) {
+	ca := newTestCA(t, "example.org")
+	clientCA := newTestCA(t, "client.org")
+
+	bundle := NewTrustBundle()
+	bundle.SetCertificates("example.org", ca.cert)
+	bundle.SetCertificates("client.org", clientCA.cert)
+
+	lis, err := tls.Listen("tcp", "127.0.0.1:0", bundle.ServerTLSConfig(
+		[]tls.Certificate{ca.issue(t, "spiffe://example.org/sa/greeter")}))
+	assert.Nil(t, err)
+
+	defer lis.Close()
+
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+
+			go func() {
+				defer conn.Close()
+
+				if conn.(*tls.Conn).Handshake() == nil {
+					// the session ticket is sent with the data
+					_, _ = conn.Write([]byte("x"))
+				}
+			}()
+		}
+	}()
+
+	clientConfig := bundle.ClientTLSConfig([]tls.Certificate{clientCA.issue(t, "spiffe://client.org/sa/web")})
+	clientConfig.ClientSessionCache = tls.NewLRUClientSessionCache(1)
+
+	fnDial := func() (resumed bool, err error) {
+		conn, err := tls.Dial("tcp", lis.Addr().String(), clientConfig)
+		if err != nil {
+			return false, err
+		}
+
+		defer conn.Close()
+
+		if _, err = conn.Read(make([]byte, 1)); err != nil {
+			return false, err
+		}
+
+		return conn.ConnectionState().DidResume, nil
+	}
+
+	resumed, err := fnDial()
+	assert.Nil(t, err)
+	assert.False(t, resumed)
+
+	resumed, err = fnDial()
+	assert.Nil(t, err)
+	assert.True(t, resumed)
+
+	// the resumed session of the removed trust domain is refused
+	bundle.SetCertificates("client.org")
+
+	_, err = fnDial()
+	assert.NotNil(t, err)
+}
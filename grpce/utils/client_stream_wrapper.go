@@ -1,19 +1,27 @@
 package utils
 
 import (
+	"context"
 	"errors"
 	"io"
+	"sync"
 
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 )
 
 type clientStreamWrapper struct {
 	grpc.ClientStream
 	desc       *grpc.StreamDesc
+	finishOnce sync.Once
 	finishFunc func(error)
+	stopCtx    func() bool
 }
 
+// NewClientStreamWrapper finishFunc is called once, with the first error of the stream or nil after the last
+// message is received. A canceled stream is finished by the error of the next RecvMsg, the streams abandoned
+// without reading to the end are not finished, see NewClientStreamWrapperWithContext.
 func NewClientStreamWrapper(s grpc.ClientStream, desc *grpc.StreamDesc, finishFunc func(error)) grpc.ClientStream {
 	return &clientStreamWrapper{
 		ClientStream: s,
@@ -22,10 +30,40 @@ func NewClientStreamWrapper(s grpc.ClientStream, desc *grpc.StreamDesc, finishFu
 	}
 }
 
+// NewClientStreamWrapperWithContext is NewClientStreamWrapper which also finishes the stream with the status of
+// ctx.Err() once ctx, the context the stream is created with, is done before the stream ends.
+func NewClientStreamWrapperWithContext(ctx context.Context, s grpc.ClientStream, desc *grpc.StreamDesc,
+	finishFunc func(error)) grpc.ClientStream {
+	cs := &clientStreamWrapper{
+		ClientStream: s,
+		desc:         desc,
+		finishFunc:   finishFunc,
+	}
+
+	// the callback runs in its own goroutine only when ctx is done
+	cs.stopCtx = context.AfterFunc(ctx, func() {
+		cs.finish(status.FromContextError(ctx.Err()).Err())
+	})
+
+	return cs
+}
+
+func (cs *clientStreamWrapper) finish(err error) {
+	cs.finishOnce.Do(func() {
+		if cs.stopCtx != nil {
+			cs.stopCtx()
+		}
+
+		if cs.finishFunc != nil {
+			cs.finishFunc(err)
+		}
+	})
+}
+
 func (cs *clientStreamWrapper) Header() (metadata.MD, error) {
 	md, err := cs.ClientStream.Header()
 	if err != nil {
-		cs.finishFunc(err)
+		cs.finish(err)
 	}
 
 	return md, err
@@ -33,8 +71,8 @@ func (cs *clientStreamWrapper) Header() (metadata.MD, error) {
 
 func (cs *clientStreamWrapper) SendMsg(m interface{}) error {
 	err := cs.ClientStream.SendMsg(m)
-	if err != nil {
-		cs.finishFunc(err)
+	if err != nil && !errors.Is(err, io.EOF) {
+		cs.finish(err)
 	}
 
 	return err
@@ -43,19 +81,19 @@ func (cs *clientStreamWrapper) SendMsg(m interface{}) error {
 func (cs *clientStreamWrapper) RecvMsg(m interface{}) error {
 	err := cs.ClientStream.RecvMsg(m)
 	if errors.Is(err, io.EOF) {
-		cs.finishFunc(nil)
+		cs.finish(nil)
 
 		return err
 	}
 
 	if err != nil {
-		cs.finishFunc(err)
+		cs.finish(err)
 
 		return err
 	}
 
 	if !cs.desc.ServerStreams {
-		cs.finishFunc(nil)
+		cs.finish(nil)
 	}
 
 	return err
@@ -64,7 +102,7 @@ func (cs *clientStreamWrapper) RecvMsg(m interface{}) error {
 func (cs *clientStreamWrapper) CloseSend() error {
 	err := cs.ClientStream.CloseSend()
 	if err != nil {
-		cs.finishFunc(err)
+		cs.finish(err)
 	}
 
 	return err
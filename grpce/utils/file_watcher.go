@@ -0,0 +1,54 @@
+package utils
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/sgostarter/i/l"
+)
+
+// WatchFile calls reload when the modification time of file changes, until ctx is done. The file is expected
+// to be loaded already, so reload isn't called for the current one. The errors are logged, and reload is
+// retried on the next change.
+func WatchFile(ctx context.Context, file string, interval time.Duration, reload func() error, logger l.Wrapper) {
+	if logger == nil {
+		logger = l.NewNopLoggerWrapper()
+	}
+
+	logger = logger.WithFields(l.StringField("file", file))
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var modTime time.Time
+
+	if fi, err := os.Stat(file); err == nil {
+		modTime = fi.ModTime()
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		fi, err := os.Stat(file)
+		if err != nil {
+			logger.WithFields(l.ErrorField(err)).Error("statWatchedFileFailed")
+
+			continue
+		}
+
+		if fi.ModTime().Equal(modTime) {
+			continue
+		}
+
+		modTime = fi.ModTime()
+
+		if err = reload(); err != nil {
+			logger.WithFields(l.ErrorField(err)).Error("reloadWatchedFileFailed")
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/atomic"
+)
+
+func TestWatchFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "watched")
+	assert.Nil(t, os.WriteFile(file, []byte("1"), 0600))
+
+	var reloads atomic.Int32
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		WatchFile(ctx, file, 10*time.Millisecond, func() error {
+			if reloads.Inc() == 1 {
+				return errors.New("invalid")
+			}
+
+			return nil
+		}, nil)
+	}()
+
+	// the current file isn't reloaded
+	time.Sleep(50 * time.Millisecond)
+	assert.EqualValues(t, 0, reloads.Load())
+
+	assert.Nil(t, os.Chtimes(file, time.Now(), time.Now().Add(time.Second)))
+	assert.Eventually(t, func() bool { return reloads.Load() == 1 }, time.Second, 10*time.Millisecond)
+
+	// a failed reload is retried on the next change
+	assert.Nil(t, os.Chtimes(file, time.Now(), time.Now().Add(2*time.Second)))
+	assert.Eventually(t, func() bool { return reloads.Load() == 2 }, time.Second, 10*time.Millisecond)
+
+	cancel()
+	<-done
+}
@@ -0,0 +1,74 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ValidMethodPattern a method pattern is a full method (/pkg.Service/Method), all the methods of a service
+// (/pkg.Service/*) or all the methods (*).
+func ValidMethodPattern(pattern string) bool {
+	if pattern == "*" {
+		return true
+	}
+
+	return strings.HasPrefix(pattern, "/") && strings.Count(pattern, "/") == 2
+}
+
+// MatchMethodPattern returns the priority of the match of a method pattern: 3 for the full method, 2 for the
+// service and 1 for *, 0 means not matched and -1 means the pattern is invalid.
+func MatchMethodPattern(pattern, fullMethod string) int {
+	switch {
+	case pattern == "*":
+		return 1
+	case !ValidMethodPattern(pattern):
+		return -1
+	case pattern == fullMethod:
+		return 3
+	case strings.HasSuffix(pattern, "/*") && strings.HasPrefix(fullMethod, pattern[:len(pattern)-1]):
+		return 2
+	}
+
+	return 0
+}
+
+// MethodMatcher matches the full methods by the method patterns, see ValidMethodPattern.
+type MethodMatcher struct {
+	all      bool
+	methods  map[string]bool
+	services map[string]bool
+}
+
+func NewMethodMatcher(patterns []string) (*MethodMatcher, error) {
+	m := &MethodMatcher{
+		methods:  make(map[string]bool),
+		services: make(map[string]bool),
+	}
+
+	for _, pattern := range patterns {
+		switch {
+		case pattern == "*":
+			m.all = true
+		case !ValidMethodPattern(pattern):
+			return nil, fmt.Errorf("invalid method pattern %q", pattern)
+		case strings.HasSuffix(pattern, "/*"):
+			m.services[pattern[:len(pattern)-1]] = true
+		default:
+			m.methods[pattern] = true
+		}
+	}
+
+	return m, nil
+}
+
+func (m *MethodMatcher) Match(fullMethod string) bool {
+	if m.all || m.methods[fullMethod] {
+		return true
+	}
+
+	if idx := strings.LastIndex(fullMethod, "/"); idx > 0 {
+		return m.services[fullMethod[:idx+1]]
+	}
+
+	return false
+}
@@ -0,0 +1,29 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMethodMatcher(t *testing.T) {
+	m, err := NewMethodMatcher([]string{"/a.S/M", "/b.S/*"})
+	assert.Nil(t, err)
+
+	assert.True(t, m.Match("/a.S/M"))
+	assert.False(t, m.Match("/a.S/N"))
+	assert.True(t, m.Match("/b.S/N"))
+	assert.False(t, m.Match("/b.SS/N"))
+
+	_, err = NewMethodMatcher([]string{"a.S"})
+	assert.NotNil(t, err)
+}
+
+func TestMatchMethodPattern(t *testing.T) {
+	assert.Equal(t, 3, MatchMethodPattern("/a.S/M", "/a.S/M"))
+	assert.Equal(t, 2, MatchMethodPattern("/a.S/*", "/a.S/M"))
+	assert.Equal(t, 1, MatchMethodPattern("*", "/a.S/M"))
+	assert.Equal(t, 0, MatchMethodPattern("/a.S/N", "/a.S/M"))
+	assert.Equal(t, 0, MatchMethodPattern("/a.SS/*", "/a.S/M"))
+	assert.Equal(t, -1, MatchMethodPattern("a.S/M", "a.S/M"))
+}
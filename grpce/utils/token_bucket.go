@@ -0,0 +1,52 @@
+package utils
+
+import (
+	"sync"
+	"time"
+)
+
+// TokenBucket refills qps tokens per second up to burst, every allowed call takes one.
+type TokenBucket struct {
+	lock   sync.Mutex
+	qps    float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// NewTokenBucket the bucket starts full, burst is at least 1.
+func NewTokenBucket(qps float64, burst int) *TokenBucket {
+	b := float64(burst)
+	if b < 1 {
+		b = 1
+	}
+
+	return &TokenBucket{
+		qps:    qps,
+		burst:  b,
+		tokens: b,
+		last:   time.Now(),
+	}
+}
+
+func (b *TokenBucket) Allow() bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	now := time.Now()
+
+	b.tokens += now.Sub(b.last).Seconds() * b.qps
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+
+	b.last = now
+
+	if b.tokens < 1 {
+		return false
+	}
+
+	b.tokens--
+
+	return true
+}
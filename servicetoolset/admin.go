@@ -0,0 +1,387 @@
+package servicetoolset
+
+import (
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"reflect"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/sgostarter/i/commerr"
+	"github.com/sgostarter/i/l"
+	"github.com/sgostarter/libeasygo/cuserror"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"google.golang.org/grpc"
+	channelzservice "google.golang.org/grpc/channelz/service"
+	"google.golang.org/grpc/reflection"
+)
+
+const (
+	redactedValue = "[REDACTED]"
+
+	adminShutdownTimeout = 5 * time.Second
+)
+
+// AdminConfig the admin endpoint serves pprof, channelz (gRPC) and runtime info (HTTP) on a separate listener.
+// It must be protected by a token (Authorization: Bearer <token>) or mTLS, or both.
+type AdminConfig struct {
+	Address       string                   `yaml:"address" json:"address"`
+	Token         string                   `yaml:"token" json:"token" redact:"true"`
+	TLSConfig     *GRPCServerTLSConfig     `yaml:"tls_config" json:"tls_config"`
+	TLSFileConfig *GRPCServerTLSFileConfig `yaml:"tls_file_config" json:"tls_file_config"`
+}
+
+// GetTLSConfig returns TLSConfig, or the one loaded from TLSFileConfig if TLSConfig is nil.
+func (cfg *AdminConfig) GetTLSConfig() (*GRPCServerTLSConfig, error) {
+	if cfg.TLSConfig != nil || cfg.TLSFileConfig == nil {
+		return cfg.TLSConfig, nil
+	}
+
+	return GRPCServerTLSConfigMap(cfg.TLSFileConfig)
+}
+
+func (cfg *AdminConfig) validate(path string) error {
+	var errs []error
+
+	errs = append(errs, ValidateConfigAddress(path+".address", cfg.Address, true))
+
+	var (
+		hasKey     bool
+		clientAuth ClientAuthType
+	)
+
+	if cfg.TLSConfig != nil {
+		errs = append(errs, validateServerTLSConfig(path+".tls_config", cfg.TLSConfig))
+		hasKey, clientAuth = len(cfg.TLSConfig.Key) > 0, cfg.TLSConfig.ClientAuth
+	} else if cfg.TLSFileConfig != nil {
+		errs = append(errs, validateServerTLSFileConfig(path+".tls_file_config", cfg.TLSFileConfig))
+		hasKey, clientAuth = cfg.TLSFileConfig.Key != "", cfg.TLSFileConfig.ClientAuth
+	}
+
+	// only verified client certs count, RequireAnyClientCert accepts any self-signed one
+	mTLS := hasKey && clientAuth == RequireAndVerifyClientCert
+	if cfg.Token == "" && !mTLS {
+		errs = append(errs, cuserror.NewWithErrorMsg(fmt.Sprintf("%v: token or mTLS is required", path)))
+	}
+
+	// the token would be sent in plaintext
+	if cfg.Token != "" && !hasKey && !loopbackAddress(cfg.Address) {
+		errs = append(errs, cuserror.NewWithErrorMsg(fmt.Sprintf("%v: token requires tls unless the address is loopback", path)))
+	}
+
+	return errors.Join(errs...)
+}
+
+func loopbackAddress(address string) bool {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return false
+	}
+
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+
+	ip := net.ParseIP(host)
+
+	return ip != nil && ip.IsLoopback()
+}
+
+type adminServer struct {
+	cfg        *AdminConfig
+	gRPCServer GRPCServer
+	effective  interface{}
+	logger     l.Wrapper
+}
+
+// NewAdminServer gRPCServer is the main server which the runtime info is collected from, effectiveConfig is
+// reported with the fields tagged `redact:"true"` redacted.
+func NewAdminServer(cfg *AdminConfig, gRPCServer GRPCServer, effectiveConfig interface{}, logger l.Wrapper) (AbstractServer, error) {
+	if gRPCServer == nil {
+		return nil, commerr.ErrInvalidArgument
+	}
+
+	impl, err := newAdminServer(cfg, effectiveConfig, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	impl.gRPCServer = gRPCServer
+
+	return impl, nil
+}
+
+// newAdminServer the gRPCServer is set by the caller, so the config can be checked before the main server is created.
+func newAdminServer(cfg *AdminConfig, effectiveConfig interface{}, logger l.Wrapper) (*adminServer, error) {
+	if cfg == nil {
+		return nil, commerr.ErrInvalidArgument
+	}
+
+	if logger == nil {
+		logger = l.NewNopLoggerWrapper()
+	}
+
+	if err := cfg.validate("admin"); err != nil {
+		return nil, err
+	}
+
+	tlsConfig, err := cfg.GetTLSConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	resolved := *cfg
+	resolved.TLSConfig = tlsConfig
+
+	return &adminServer{
+		cfg:       &resolved,
+		effective: effectiveConfig,
+		logger:    logger.WithFields(l.StringField(l.ClsKey, "adminServer")),
+	}, nil
+}
+
+func (impl *adminServer) Run(ctx context.Context) (err error) {
+	s := grpc.NewServer()
+	channelzservice.RegisterChannelzServiceToServer(s)
+	RegisterRuntimeConfigAdminServer(s, impl.gRPCServer.RuntimeConfigManager())
+	reflection.Register(s)
+
+	handler := impl.authHandler(impl.grpcOrHTTPHandler(s, impl.httpMux()))
+
+	server := &http.Server{
+		ReadHeaderTimeout: time.Second * 30,
+		Handler:           handler,
+	}
+
+	listener, err := net.Listen("tcp", impl.cfg.Address)
+	if err != nil {
+		return
+	}
+
+	if impl.cfg.TLSConfig != nil && len(impl.cfg.TLSConfig.Key) > 0 {
+		var tlsConfig *tls.Config
+
+		tlsConfig, err = GenServerTLSConfig(impl.cfg.TLSConfig)
+		if err != nil {
+			_ = listener.Close()
+
+			return
+		}
+
+		tlsConfig.NextProtos = []string{http2.NextProtoTLS, "http/1.1"}
+		listener = tls.NewListener(listener, tlsConfig)
+	} else {
+		server.Handler = h2c.NewHandler(handler, &http2.Server{})
+	}
+
+	impl.logger.Infof("admin server listening on %v", impl.cfg.Address)
+
+	chServeErr := make(chan error, 1)
+
+	go func() {
+		errS := server.Serve(listener)
+		if errS != nil && !errors.Is(errS, http.ErrServerClosed) {
+			chServeErr <- errS
+		}
+
+		close(chServeErr)
+	}()
+
+	select {
+	case <-ctx.Done():
+	case err = <-chServeErr:
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), adminShutdownTimeout)
+	defer cancel()
+
+	_ = server.Shutdown(shutdownCtx)
+
+	s.Stop()
+
+	return
+}
+
+func (impl *adminServer) authHandler(next http.Handler) http.Handler {
+	if impl.cfg.Token == "" {
+		return next
+	}
+
+	expected := []byte("Bearer " + impl.cfg.Token)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), expected) != 1 {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (impl *adminServer) grpcOrHTTPHandler(s *grpc.Server, mux http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor == 2 && strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+			s.ServeHTTP(w, r)
+
+			return
+		}
+
+		mux.ServeHTTP(w, r)
+	})
+}
+
+func (impl *adminServer) httpMux() *http.ServeMux {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+
+	mux.HandleFunc("/admin/services", func(w http.ResponseWriter, _ *http.Request) {
+		writeAdminJSON(w, impl.gRPCServer.GetServiceInfo())
+	})
+	mux.HandleFunc("/admin/buildinfo", func(w http.ResponseWriter, _ *http.Request) {
+		writeAdminJSON(w, buildInfo())
+	})
+	mux.HandleFunc("/admin/config", func(w http.ResponseWriter, _ *http.Request) {
+		writeAdminJSON(w, map[string]interface{}{
+			"config":         RedactConfig(impl.effective),
+			"runtime_config": impl.gRPCServer.RuntimeConfigManager().Get(),
+		})
+	})
+	mux.HandleFunc("/admin/discovery", func(w http.ResponseWriter, _ *http.Request) {
+		writeAdminJSON(w, impl.gRPCServer.DiscoveryServiceInfos())
+	})
+
+	return mux
+}
+
+func writeAdminJSON(w http.ResponseWriter, v interface{}) {
+	d, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(d)
+}
+
+func buildInfo() map[string]interface{} {
+	info := map[string]interface{}{}
+
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+
+	settings := make(map[string]string, len(bi.Settings))
+	for _, setting := range bi.Settings {
+		settings[setting.Key] = setting.Value
+	}
+
+	info["go_version"] = bi.GoVersion
+	info["path"] = bi.Path
+	info["main"] = bi.Main.Path + "@" + bi.Main.Version
+	info["settings"] = settings
+
+	return info
+}
+
+// RedactConfig converts v to a json friendly value keyed by the json names, the non-empty fields tagged
+// with `redact:"true"` are replaced with [REDACTED].
+func RedactConfig(v interface{}) interface{} {
+	if v == nil {
+		return nil
+	}
+
+	return redactValue(reflect.ValueOf(v))
+}
+
+func redactValue(v reflect.Value) interface{} {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+
+		return redactValue(v.Elem())
+	case reflect.Struct:
+		if _, ok := v.Interface().(time.Time); ok {
+			return v.Interface()
+		}
+
+		m := make(map[string]interface{}, v.NumField())
+
+		for idx := 0; idx < v.NumField(); idx++ {
+			field := v.Type().Field(idx)
+
+			name := strings.Split(field.Tag.Get("json"), ",")[0]
+			if field.PkgPath != "" || name == "-" {
+				continue
+			}
+
+			if name == "" {
+				name = field.Name
+			}
+
+			if field.Tag.Get("redact") == "true" {
+				if !v.Field(idx).IsZero() {
+					m[name] = redactedValue
+				}
+
+				continue
+			}
+
+			m[name] = redactValue(v.Field(idx))
+		}
+
+		return m
+	case reflect.Map:
+		if v.IsNil() {
+			return nil
+		}
+
+		m := make(map[string]interface{}, v.Len())
+
+		iter := v.MapRange()
+		for iter.Next() {
+			m[fmt.Sprint(iter.Key().Interface())] = redactValue(iter.Value())
+		}
+
+		return m
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return nil
+		}
+
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return v.Interface()
+		}
+
+		items := make([]interface{}, v.Len())
+		for idx := range items {
+			items[idx] = redactValue(v.Index(idx))
+		}
+
+		return items
+	case reflect.Func, reflect.Chan:
+		return nil
+	default:
+		return v.Interface()
+	}
+}
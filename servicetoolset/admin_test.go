@@ -0,0 +1,58 @@
+package servicetoolset
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedactConfig(t *testing.T) {
+	v := RedactConfig(&GRPCServerConfig{
+		Address: ":9001",
+		TLSConfig: &GRPCServerTLSConfig{
+			Cert: []byte("cert"),
+			Key:  []byte("key"),
+		},
+		Admin: &AdminConfig{
+			Address: ":9002",
+			Token:   "token",
+		},
+	})
+
+	m, ok := v.(map[string]interface{})
+	assert.True(t, ok)
+	assert.Equal(t, ":9001", m["address"])
+	assert.Equal(t, redactedValue, m["tls_config"].(map[string]interface{})["key"])
+	assert.Equal(t, []byte("cert"), m["tls_config"].(map[string]interface{})["cert"])
+	assert.Equal(t, redactedValue, m["admin"].(map[string]interface{})["token"])
+	assert.Nil(t, m["discovery_ex_config"])
+}
+
+func TestAdminConfigValidate(t *testing.T) {
+	assert.NotNil(t, (&AdminConfig{Address: ":9002"}).validate("admin"))
+	assert.Nil(t, (&AdminConfig{Address: "127.0.0.1:9002", Token: "token"}).validate("admin"))
+	assert.Nil(t, (&AdminConfig{Address: "[::1]:9002", Token: "token"}).validate("admin"))
+	assert.Nil(t, (&AdminConfig{Address: "localhost:9002", Token: "token"}).validate("admin"))
+
+	// the token over plaintext
+	assert.ErrorContains(t, (&AdminConfig{Address: ":9002", Token: "token"}).validate("admin"), "requires tls")
+	assert.ErrorContains(t, (&AdminConfig{Address: "10.0.0.1:9002", Token: "token"}).validate("admin"), "requires tls")
+
+	// the files are not read by validate
+	assert.Nil(t, (&AdminConfig{Address: ":9002", Token: "token", TLSFileConfig: &GRPCServerTLSFileConfig{
+		Cert: "missing.crt",
+		Key:  "missing.key",
+	}}).validate("admin"))
+	assert.Nil(t, (&AdminConfig{Address: ":9002", TLSFileConfig: &GRPCServerTLSFileConfig{
+		Cert:       "missing.crt",
+		Key:        "missing.key",
+		ClientAuth: RequireAndVerifyClientCert,
+	}}).validate("admin"))
+
+	// a self-signed client cert is not authentication
+	assert.ErrorContains(t, (&AdminConfig{Address: ":9002", TLSFileConfig: &GRPCServerTLSFileConfig{
+		Cert:       "missing.crt",
+		Key:        "missing.key",
+		ClientAuth: RequireAnyClientCert,
+	}}).validate("admin"), "token or mTLS is required")
+}
@@ -0,0 +1,439 @@
+package servicetoolset
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/sgostarter/i/l"
+	"github.com/sgostarter/libeasygo/cuserror"
+	"github.com/sgostarter/librediscovery/discovery"
+	"google.golang.org/grpc"
+)
+
+type ServerToolsetConfig struct {
+	GRPCServer       *GRPCServerConfig    `yaml:"grpc_server" json:"grpc_server"`
+	HTTPServer       *HTTPServerConfig    `yaml:"http_server" json:"http_server"`
+	FailurePolicy    *FailurePolicyConfig `yaml:"failure_policy" json:"failure_policy"`
+	ShutdownDeadline time.Duration        `yaml:"shutdown_deadline" json:"shutdown_deadline"`
+}
+
+// LoadServerToolsetConfig loads the config with LoadConfig, and returns the built one, see Build.
+func LoadServerToolsetConfig(file, envPrefix string) (*ServerToolsetConfig, error) {
+	cfg := &ServerToolsetConfig{}
+
+	err := LoadConfig(file, envPrefix, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return cfg.Build()
+}
+
+// Build returns a copy of the validated cfg with the tls file configs of the grpc server loaded into its
+// TLSConfig. The tls files of the http server are only checked, they are kept for reloading. Validate doesn't
+// read the files, so the missing files are reported here.
+func (cfg *ServerToolsetConfig) Build() (*ServerToolsetConfig, error) {
+	var errs []error
+
+	n := *cfg
+
+	if cfg.GRPCServer != nil {
+		gRPCServerConfig, err := cfg.GRPCServer.build("grpc_server")
+		if err != nil {
+			errs = append(errs, err)
+		}
+
+		n.GRPCServer = gRPCServerConfig
+	}
+
+	if cfg.HTTPServer != nil {
+		errs = append(errs, cfg.HTTPServer.build("http_server"))
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+
+	return &n, nil
+}
+
+func (cfg *ServerToolsetConfig) Validate() error {
+	var errs []error
+
+	if cfg.GRPCServer != nil {
+		errs = append(errs, cfg.GRPCServer.validate("grpc_server"))
+	}
+
+	if cfg.HTTPServer != nil {
+		errs = append(errs, cfg.HTTPServer.validate("http_server"))
+	}
+
+	if cfg.FailurePolicy != nil {
+		errs = append(errs, cfg.FailurePolicy.validate("failure_policy"))
+	}
+
+	errs = append(errs, ValidateConfigDuration("shutdown_deadline", cfg.ShutdownDeadline))
+
+	return errors.Join(errs...)
+}
+
+// GetTLSConfig returns TLSConfig, or the one loaded from TLSFileConfig if TLSConfig is nil.
+func (cfg *GRPCServerConfig) GetTLSConfig() (*GRPCServerTLSConfig, error) {
+	if cfg.TLSConfig != nil || cfg.TLSFileConfig == nil {
+		return cfg.TLSConfig, nil
+	}
+
+	return GRPCServerTLSConfigMap(cfg.TLSFileConfig)
+}
+
+func (cfg *GRPCServerConfig) validate(path string) error {
+	errs := []error{
+		ValidateConfigAddress(path+".address", cfg.Address, true),
+		ValidateConfigAddress(path+".web_address", cfg.WebAddress, false),
+		ValidateConfigDuration(path+".keep_alive_duration", cfg.KeepAliveDuration),
+		ValidateConfigDuration(path+".enforcement_policy_min_time", cfg.EnforcementPolicyMinTime),
+		ValidateConfigDuration(path+".runtime_config_watch_interval", cfg.RuntimeConfigWatchInterval),
+	}
+
+	if cfg.RuntimeConfig != nil {
+		if err := cfg.RuntimeConfig.Validate(); err != nil {
+			errs = append(errs, cuserror.NewWithErrorMsg(fmt.Sprintf("%v.runtime_config.%v", path, err)))
+		}
+	}
+
+	if cfg.Admin != nil {
+		errs = append(errs, cfg.Admin.validate(path+".admin"))
+	}
+
+	if cfg.GRPCWeb != nil {
+		errs = append(errs, cfg.GRPCWeb.validate(path+".grpc_web"))
+	}
+
+	if cfg.JSONTranscoding != nil && cfg.WebAddress == "" {
+		errs = append(errs, cuserror.NewWithErrorMsg(fmt.Sprintf("%v.json_transcoding: web_address is required", path)))
+	}
+
+	if cfg.SSE != nil {
+		if cfg.WebAddress == "" {
+			errs = append(errs, cuserror.NewWithErrorMsg(fmt.Sprintf("%v.sse: web_address is required", path)))
+		}
+
+		errs = append(errs, ValidateConfigDuration(path+".sse.heartbeat_interval", cfg.SSE.HeartbeatInterval),
+			ValidateConfigDuration(path+".sse.retry_interval", cfg.SSE.RetryInterval))
+	}
+
+	if cfg.RealIP != nil {
+		if err := cfg.RealIP.Validate(); err != nil {
+			errs = append(errs, cuserror.NewWithErrorMsg(fmt.Sprintf("%v.real_ip.%v", path, err)))
+		}
+	}
+
+	if cfg.ProxyProtocol != nil {
+		if err := cfg.ProxyProtocol.Validate(); err != nil {
+			errs = append(errs, cuserror.NewWithErrorMsg(fmt.Sprintf("%v.proxy_protocol.%v", path, err)))
+		}
+	}
+
+	if cfg.IPACL != nil {
+		if err := cfg.IPACL.Validate(); err != nil {
+			errs = append(errs, cuserror.NewWithErrorMsg(fmt.Sprintf("%v.ip_acl.%v", path, err)))
+		}
+	}
+
+	if cfg.JWT != nil {
+		if err := cfg.JWT.Validate(); err != nil {
+			errs = append(errs, cuserror.NewWithErrorMsg(fmt.Sprintf("%v.jwt.%v", path, err)))
+		}
+	}
+
+	if cfg.APIKey != nil {
+		if err := cfg.APIKey.Validate(); err != nil {
+			errs = append(errs, cuserror.NewWithErrorMsg(fmt.Sprintf("%v.api_key.%v", path, err)))
+		}
+
+		if cfg.APIKeyFile == "" && cfg.APIKeyStore == nil {
+			errs = append(errs, cuserror.NewWithErrorMsg(fmt.Sprintf("%v.api_key: api_key_file is required", path)))
+		}
+	}
+
+	if cfg.Authz != nil {
+		if err := cfg.Authz.Validate(); err != nil {
+			errs = append(errs, cuserror.NewWithErrorMsg(fmt.Sprintf("%v.authz.%v", path, err)))
+		}
+	}
+
+	if cfg.CallLog != nil {
+		if err := cfg.CallLog.Validate(); err != nil {
+			errs = append(errs, cuserror.NewWithErrorMsg(fmt.Sprintf("%v.call_log.%v", path, err)))
+		}
+	}
+
+	if cfg.Propagation != nil {
+		if err := cfg.Propagation.Validate(); err != nil {
+			errs = append(errs, cuserror.NewWithErrorMsg(fmt.Sprintf("%v.propagation.%v", path, err)))
+		}
+	}
+
+	if cfg.RequestID != nil {
+		if err := cfg.RequestID.Validate(); err != nil {
+			errs = append(errs, cuserror.NewWithErrorMsg(fmt.Sprintf("%v.request_id.%v", path, err)))
+		}
+	}
+
+	if cfg.TLSConfig != nil {
+		errs = append(errs, validateServerTLSConfig(path+".tls_config", cfg.TLSConfig))
+	} else {
+		errs = append(errs, validateServerTLSFileConfig(path+".tls_file_config", cfg.TLSFileConfig))
+	}
+
+	return errors.Join(errs...)
+}
+
+func (cfg *GRPCServerConfig) build(path string) (*GRPCServerConfig, error) {
+	n := *cfg
+
+	tlsConfig, err := cfg.GetTLSConfig()
+	if err != nil {
+		return nil, cuserror.NewWithErrorMsg(fmt.Sprintf("%v.tls_file_config: %v", path, err))
+	}
+
+	n.TLSConfig = tlsConfig
+
+	return &n, nil
+}
+
+func (cfg *HTTPServerConfig) validate(path string) error {
+	errs := []error{
+		ValidateConfigAddress(path+".address", cfg.Address, true),
+		ValidateConfigDuration(path+".read_timeout", cfg.ReadTimeout),
+		ValidateConfigDuration(path+".read_header_timeout", cfg.ReadHeaderTimeout),
+		ValidateConfigDuration(path+".write_timeout", cfg.WriteTimeout),
+		ValidateConfigDuration(path+".idle_timeout", cfg.IdleTimeout),
+		ValidateConfigDuration(path+".shutdown_drain_timeout", cfg.ShutdownDrainTimeout),
+	}
+
+	if cfg.MaxHeaderBytes < 0 {
+		errs = append(errs, cuserror.NewWithErrorMsg(fmt.Sprintf("%v.max_header_bytes: should not be negative", path)))
+	}
+
+	if cfg.HTTP2 != nil {
+		errs = append(errs, ValidateConfigDuration(path+".http2.idle_timeout", cfg.HTTP2.IdleTimeout))
+	}
+
+	if cfg.Middleware != nil {
+		errs = append(errs, cfg.Middleware.validate(path+".middleware"))
+	}
+
+	if cfg.ProxyProtocol != nil {
+		if err := cfg.ProxyProtocol.Validate(); err != nil {
+			errs = append(errs, cuserror.NewWithErrorMsg(fmt.Sprintf("%v.proxy_protocol.%v", path, err)))
+		}
+	}
+
+	if cfg.TLSConfig != nil {
+		errs = append(errs, validateServerTLSConfig(path+".tls_config", cfg.TLSConfig))
+	} else {
+		errs = append(errs, validateServerTLSFileConfig(path+".tls_file_config", cfg.TLSFileConfig))
+	}
+
+	return errors.Join(errs...)
+}
+
+// build checks the tls files are loadable, they are kept for reloading.
+func (cfg *HTTPServerConfig) build(path string) error {
+	if cfg.TLSConfig != nil || cfg.TLSFileConfig == nil {
+		return nil
+	}
+
+	if _, err := GRPCServerTLSConfigMap(cfg.TLSFileConfig); err != nil {
+		return cuserror.NewWithErrorMsg(fmt.Sprintf("%v.tls_file_config: %v", path, err))
+	}
+
+	return nil
+}
+
+func (cfg *FailurePolicyConfig) validate(path string) error {
+	var errs []error
+
+	if cfg.Policy < FailurePolicyFailAll || cfg.Policy > FailurePolicyIgnore {
+		errs = append(errs, cuserror.NewWithErrorMsg(fmt.Sprintf("%v.policy: unknown policy %v", path, cfg.Policy)))
+	}
+
+	if cfg.MaxRestarts < 0 {
+		errs = append(errs, cuserror.NewWithErrorMsg(fmt.Sprintf("%v.max_restarts: should not be negative", path)))
+	}
+
+	errs = append(errs, ValidateConfigDuration(path+".restart_min_backoff", cfg.RestartMinBackoff),
+		ValidateConfigDuration(path+".restart_max_backoff", cfg.RestartMaxBackoff))
+
+	return errors.Join(errs...)
+}
+
+func validateServerTLSConfig(path string, cfg *GRPCServerTLSConfig) error {
+	if cfg == nil {
+		return nil
+	}
+
+	return validateServerTLS(path, len(cfg.Cert) > 0, len(cfg.Key) > 0, cfg.ClientAuth)
+}
+
+func validateServerTLSFileConfig(path string, cfg *GRPCServerTLSFileConfig) error {
+	if cfg == nil {
+		return nil
+	}
+
+	return validateServerTLS(path, cfg.Cert != "", cfg.Key != "", cfg.ClientAuth)
+}
+
+func validateServerTLS(path string, hasCert, hasKey bool, clientAuth ClientAuthType) error {
+	if hasCert != hasKey {
+		return cuserror.NewWithErrorMsg(fmt.Sprintf("%v: Cert and Key should be set together", path))
+	}
+
+	if clientAuth < RequireAndVerifyClientCert || clientAuth > VerifyClientCertIfGiven {
+		return cuserror.NewWithErrorMsg(fmt.Sprintf("%v.ClientAuth: unknown client auth type %v", path, clientAuth))
+	}
+
+	return nil
+}
+
+// ValidateConfigAddress checks the address is host:port, path is used for the error message.
+func ValidateConfigAddress(path, address string, required bool) error {
+	if address == "" {
+		if required {
+			return cuserror.NewWithErrorMsg(fmt.Sprintf("%v: required", path))
+		}
+
+		return nil
+	}
+
+	_, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return cuserror.NewWithErrorMsg(fmt.Sprintf("%v: invalid address %q: %v", path, address, err))
+	}
+
+	if n, err := strconv.ParseUint(port, 10, 16); err != nil || (n == 0 && port != "0") {
+		return cuserror.NewWithErrorMsg(fmt.Sprintf("%v: invalid port in address %q", path, address))
+	}
+
+	return nil
+}
+
+// ValidateConfigDuration checks the duration is not negative, path is used for the error message.
+func ValidateConfigDuration(path string, d time.Duration) error {
+	if d < 0 {
+		return cuserror.NewWithErrorMsg(fmt.Sprintf("%v: should not be negative, got %v", path, d))
+	}
+
+	return nil
+}
+
+// ServerToolsetInputParameters the parts of the servers which can't be loaded from config files.
+type ServerToolsetInputParameters struct {
+	GRPCServerOptions []grpc.ServerOption
+	BeforeServerStart BeforeServerStart
+	HTTPHandler       http.Handler
+	HTTPMiddlewares   []HTTPMiddleware
+	HTTPMetrics       HTTPMetricsObserver
+	// NewDiscoverySetter creates the discovery setter of each server, the servers own and stop them
+	NewDiscoverySetter func() (discovery.Setter, error)
+}
+
+// NewServerToolsetFromConfig validates and builds cfg, and creates a ServerToolset with the servers configured in
+// it, cfg isn't modified.
+func NewServerToolsetFromConfig(ctx context.Context, cfg *ServerToolsetConfig, parameters ServerToolsetInputParameters,
+	logger l.Wrapper) (_ *ServerToolset, err error) {
+	if cfg == nil {
+		cfg = &ServerToolsetConfig{}
+	}
+
+	if err = cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	cfg, err = cfg.Build()
+	if err != nil {
+		return nil, err
+	}
+
+	st := NewServerToolset(ctx, logger)
+
+	// the servers never run on failure, so the setters created for them and the signal subscription are released here
+	var ownSetters []discovery.Setter
+
+	defer func() {
+		if err == nil {
+			return
+		}
+
+		for _, setter := range ownSetters {
+			StopDiscoverySetter(setter)
+		}
+
+		st.serverHelper.SignalManager().Stop()
+	}()
+
+	st.SetFailurePolicy(cfg.FailurePolicy)
+	st.SetShutdownDeadline(cfg.ShutdownDeadline)
+
+	if cfg.GRPCServer != nil {
+		gRPCServerConfig := *cfg.GRPCServer
+
+		if parameters.NewDiscoverySetter != nil {
+			discoveryExConfig := DiscoveryExConfig{}
+			if gRPCServerConfig.DiscoveryExConfig != nil {
+				discoveryExConfig = *gRPCServerConfig.DiscoveryExConfig
+			}
+
+			discoveryExConfig.Setter, err = parameters.NewDiscoverySetter()
+			if err != nil {
+				return nil, err
+			}
+
+			ownSetters = append(ownSetters, discoveryExConfig.Setter)
+
+			discoveryExConfig.OwnSetter = true
+			gRPCServerConfig.DiscoveryExConfig = &discoveryExConfig
+		}
+
+		err = st.CreateGRpcServer(&gRPCServerConfig, parameters.GRPCServerOptions, parameters.BeforeServerStart)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if cfg.HTTPServer != nil {
+		httpServerConfig := *cfg.HTTPServer
+		httpServerConfig.Handler = parameters.HTTPHandler
+		httpServerConfig.Middlewares = parameters.HTTPMiddlewares
+		httpServerConfig.MetricsObserver = parameters.HTTPMetrics
+
+		if cfg.GRPCServer != nil && cfg.GRPCServer.GRPCWeb != nil && cfg.GRPCServer.GRPCWeb.ServeOnHTTPServer {
+			httpServerConfig.Middlewares = append([]HTTPMiddleware{st.gRPCServer.GRPCWebMiddleware()},
+				httpServerConfig.Middlewares...)
+		}
+
+		if parameters.NewDiscoverySetter != nil {
+			httpServerConfig.DiscoveryExConfig.Setter, err = parameters.NewDiscoverySetter()
+			if err != nil {
+				return nil, err
+			}
+
+			ownSetters = append(ownSetters, httpServerConfig.DiscoveryExConfig.Setter)
+
+			httpServerConfig.DiscoveryExConfig.OwnSetter = true
+		}
+
+		err = st.CreateHTTPServer(&httpServerConfig)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return st, nil
+}
@@ -0,0 +1,286 @@
+package servicetoolset
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sgostarter/i/commerr"
+	"github.com/sgostarter/libeasygo/cuserror"
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigValidator is called by LoadConfig after the file and the environment overrides are applied.
+type ConfigValidator interface {
+	Validate() error
+}
+
+// LoadConfig loads cfg (a pointer to struct) from a yaml (.yaml/.yml) or json (.json) file, then applies
+// the environment overrides, at last validates it if cfg implements ConfigValidator.
+//
+// The environment variable of a field is named envconfig-style: the upper-cased yaml names of the field path
+// joined with "_", prefixed with envPrefix, e.g. MYSVC_GRPC_SERVER_ADDRESS. Fields tagged with `ignored:"true"`
+// or `yaml:"-"` are skipped. Slices are comma separated, maps are "k1:v1,k2:v2", durations are like "5s".
+//
+// Durations in json files follow encoding/json, i.e. nanoseconds.
+func LoadConfig(file, envPrefix string, cfg interface{}) error {
+	v := reflect.ValueOf(cfg)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return commerr.ErrInvalidArgument
+	}
+
+	if file != "" {
+		if err := loadConfigFile(file, cfg); err != nil {
+			return err
+		}
+	}
+
+	if _, err := applyEnvOverrides(v.Elem(), strings.ToUpper(envPrefix), ""); err != nil {
+		return err
+	}
+
+	if validator, ok := cfg.(ConfigValidator); ok {
+		return validator.Validate()
+	}
+
+	return nil
+}
+
+func loadConfigFile(file string, cfg interface{}) error {
+	d, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(d, cfg)
+	case ".json":
+		err = json.Unmarshal(d, cfg)
+	default:
+		return cuserror.NewWithErrorMsg(fmt.Sprintf("unknown config file type: %v", file))
+	}
+
+	if err != nil {
+		return cuserror.NewWithErrorMsg(fmt.Sprintf("parse config file %v failed: %v", file, err))
+	}
+
+	return nil
+}
+
+func configFieldName(field *reflect.StructField) (name string, ok bool) {
+	if field.PkgPath != "" || field.Tag.Get("ignored") == "true" {
+		return
+	}
+
+	name = strings.Split(field.Tag.Get("yaml"), ",")[0]
+	if name == "-" {
+		return "", false
+	}
+
+	if name == "" {
+		name = strings.ToLower(field.Name)
+	}
+
+	return name, true
+}
+
+func joinConfigPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+
+	return path + "." + name
+}
+
+func joinEnvName(prefix, name string) string {
+	name = strings.ToUpper(name)
+
+	if prefix == "" {
+		return name
+	}
+
+	return prefix + "_" + name
+}
+
+// applyEnvOverrides returns whether any environment variable was applied, nil struct pointers are only
+// allocated when some of their fields are overridden.
+func applyEnvOverrides(v reflect.Value, envPrefix, path string) (applied bool, err error) {
+	t := v.Type()
+
+	for idx := 0; idx < t.NumField(); idx++ {
+		field := t.Field(idx)
+
+		name, ok := configFieldName(&field)
+		if !ok {
+			continue
+		}
+
+		fieldApplied, errF := applyEnvOverride(v.Field(idx), joinEnvName(envPrefix, name), joinConfigPath(path, name))
+		if errF != nil {
+			return false, errF
+		}
+
+		applied = applied || fieldApplied
+	}
+
+	return
+}
+
+func applyEnvOverride(fv reflect.Value, envName, path string) (bool, error) {
+	ft := fv.Type()
+
+	if ft.Kind() == reflect.Ptr && ft.Elem().Kind() == reflect.Struct {
+		target := fv
+		if fv.IsNil() {
+			target = reflect.New(ft.Elem())
+		}
+
+		applied, err := applyEnvOverrides(target.Elem(), envName, path)
+		if err != nil {
+			return false, err
+		}
+
+		if applied && fv.IsNil() {
+			fv.Set(target)
+		}
+
+		return applied, nil
+	}
+
+	if ft.Kind() == reflect.Struct {
+		return applyEnvOverrides(fv, envName, path)
+	}
+
+	value, ok := os.LookupEnv(envName)
+	if !ok {
+		return false, nil
+	}
+
+	if err := setConfigValue(fv, value); err != nil {
+		return false, cuserror.NewWithErrorMsg(fmt.Sprintf("%v: invalid value %q of env %v: %v", path, value, envName, err))
+	}
+
+	return true, nil
+}
+
+var errUnsupportedConfigType = errors.New("unsupported type")
+
+// nolint: gocyclo
+func setConfigValue(fv reflect.Value, value string) error {
+	ft := fv.Type()
+
+	if ft == reflect.TypeOf(time.Duration(0)) {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+
+		fv.SetInt(int64(d))
+
+		return nil
+	}
+
+	switch ft.Kind() {
+	case reflect.Ptr:
+		nv := reflect.New(ft.Elem())
+		if err := setConfigValue(nv.Elem(), value); err != nil {
+			return err
+		}
+
+		fv.Set(nv)
+	case reflect.String:
+		fv.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+
+		fv.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(value, 0, ft.Bits())
+		if err != nil {
+			return err
+		}
+
+		fv.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(value, 0, ft.Bits())
+		if err != nil {
+			return err
+		}
+
+		fv.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(value, ft.Bits())
+		if err != nil {
+			return err
+		}
+
+		fv.SetFloat(n)
+	case reflect.Slice:
+		if ft.Elem().Kind() == reflect.Uint8 {
+			fv.SetBytes([]byte(value))
+
+			return nil
+		}
+
+		vs := splitConfigList(value)
+		sl := reflect.MakeSlice(ft, len(vs), len(vs))
+
+		for idx, v := range vs {
+			if err := setConfigValue(sl.Index(idx), v); err != nil {
+				return err
+			}
+		}
+
+		fv.Set(sl)
+	case reflect.Map:
+		m := reflect.MakeMap(ft)
+
+		for _, pair := range splitConfigList(value) {
+			kv := strings.SplitN(pair, ":", 2)
+			if len(kv) != 2 {
+				return cuserror.NewWithErrorMsg(fmt.Sprintf("invalid map item %q", pair))
+			}
+
+			k := reflect.New(ft.Key()).Elem()
+			if err := setConfigValue(k, kv[0]); err != nil {
+				return err
+			}
+
+			v := reflect.New(ft.Elem()).Elem()
+			if err := setConfigValue(v, kv[1]); err != nil {
+				return err
+			}
+
+			m.SetMapIndex(k, v)
+		}
+
+		fv.Set(m)
+	default:
+		return errUnsupportedConfigType
+	}
+
+	return nil
+}
+
+func splitConfigList(value string) []string {
+	if strings.TrimSpace(value) == "" {
+		return nil
+	}
+
+	vs := strings.Split(value, ",")
+	for idx := range vs {
+		vs[idx] = strings.TrimSpace(vs[idx])
+	}
+
+	return vs
+}
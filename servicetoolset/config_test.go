@@ -0,0 +1,170 @@
+package servicetoolset
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sgostarter/librediscovery/discovery"
+	"github.com/sgostarter/libservicetoolset/grpce/apikey"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/atomic"
+)
+
+func TestLoadServerToolsetConfig(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.yaml")
+
+	err := os.WriteFile(file, []byte(`
+grpc_server:
+  address: ":9001"
+  name: "test"
+  keep_alive_duration: 10s
+failure_policy:
+  policy: 1
+shutdown_deadline: 30s
+`), 0600)
+	assert.Nil(t, err)
+
+	t.Setenv("TEST_GRPC_SERVER_ADDRESS", "127.0.0.1:9002")
+	t.Setenv("TEST_GRPC_SERVER_META_TRANS_KEYS", "a, b")
+	t.Setenv("TEST_GRPC_SERVER_DISCOVERY_EX_CONFIG_META", "k1:v1,k2:v2")
+
+	cfg, err := LoadServerToolsetConfig(file, "test")
+	assert.Nil(t, err)
+	assert.Equal(t, "127.0.0.1:9002", cfg.GRPCServer.Address)
+	assert.Equal(t, 10*time.Second, cfg.GRPCServer.KeepAliveDuration)
+	assert.Equal(t, []string{"a", "b"}, cfg.GRPCServer.MetaTransKeys)
+	assert.Equal(t, map[string]string{"k1": "v1", "k2": "v2"}, cfg.GRPCServer.DiscoveryExConfig.Meta)
+	assert.Equal(t, FailurePolicyRestart, cfg.FailurePolicy.Policy)
+	assert.Equal(t, 30*time.Second, cfg.ShutdownDeadline)
+	assert.Nil(t, cfg.HTTPServer)
+	assert.Nil(t, cfg.GRPCServer.TLSConfig)
+
+	t.Setenv("TEST_HTTP_SERVER_NAME", "web")
+
+	_, err = LoadServerToolsetConfig(file, "test")
+	assert.ErrorContains(t, err, "http_server.address: required")
+
+	t.Setenv("TEST_HTTP_SERVER_ADDRESS", ":80")
+	t.Setenv("TEST_GRPC_SERVER_KEEP_ALIVE_DURATION", "10")
+
+	_, err = LoadServerToolsetConfig(file, "test")
+	assert.ErrorContains(t, err, "grpc_server.keep_alive_duration")
+
+	t.Setenv("TEST_GRPC_SERVER_KEEP_ALIVE_DURATION", "-1s")
+
+	_, err = LoadServerToolsetConfig(file, "test")
+	assert.ErrorContains(t, err, "grpc_server.keep_alive_duration: should not be negative")
+}
+
+func TestServerToolsetConfigBuild(t *testing.T) {
+	cfg := &ServerToolsetConfig{
+		GRPCServer: &GRPCServerConfig{
+			Address: ":9001",
+			TLSFileConfig: &GRPCServerTLSFileConfig{
+				Cert: "missing.crt",
+				Key:  "missing.key",
+			},
+		},
+	}
+
+	// the files are read by Build only
+	assert.Nil(t, cfg.Validate())
+
+	_, err := cfg.Build()
+	assert.ErrorContains(t, err, "grpc_server.tls_file_config")
+	assert.Nil(t, cfg.GRPCServer.TLSConfig)
+
+	cfg.GRPCServer.TLSFileConfig.Key = ""
+	assert.ErrorContains(t, cfg.Validate(), "Cert and Key should be set together")
+}
+
+func TestGRPCServerConfigAPIKey(t *testing.T) {
+	cfg := &GRPCServerConfig{Address: ":9000", APIKey: &apikey.Config{}}
+	assert.ErrorContains(t, cfg.validate("grpc"), "api_key_file is required")
+
+	cfg.APIKeyFile = "keys.yaml"
+	assert.Nil(t, cfg.validate("grpc"))
+}
+
+type testDiscoverySetter struct {
+	started atomic.Bool
+	stopped atomic.Bool
+}
+
+func (s *testDiscoverySetter) Start(_ []*discovery.ServiceInfo) error {
+	s.started.Store(true)
+
+	return nil
+}
+
+func (s *testDiscoverySetter) Stop() {
+	s.stopped.Store(true)
+}
+
+func TestNewServerToolsetFromConfigDiscoverySetters(t *testing.T) {
+	var setters []*testDiscoverySetter
+
+	st, err := NewServerToolsetFromConfig(context.Background(), &ServerToolsetConfig{
+		GRPCServer: &GRPCServerConfig{
+			Address: "127.0.0.1:9001",
+			Name:    "svc",
+		},
+		HTTPServer: &HTTPServerConfig{
+			Address: "127.0.0.1:9002",
+			Name:    "svc",
+		},
+	}, ServerToolsetInputParameters{
+		HTTPHandler: http.NotFoundHandler(),
+		NewDiscoverySetter: func() (discovery.Setter, error) {
+			setters = append(setters, &testDiscoverySetter{})
+
+			return setters[len(setters)-1], nil
+		},
+	}, nil)
+	assert.Nil(t, err)
+	assert.Len(t, setters, 2)
+
+	gRPCServer, _ := st.gRPCServer.(*gRPCServerImpl)
+	assert.True(t, gRPCServer.ownSetter)
+	assert.Equal(t, discovery.Setter(setters[0]), gRPCServer.setter)
+
+	httpServer, _ := st.httpServer.(*httpServerImpl)
+	assert.True(t, httpServer.cfg.DiscoveryExConfig.OwnSetter)
+	assert.Equal(t, discovery.Setter(setters[1]), httpServer.cfg.DiscoveryExConfig.Setter)
+}
+
+func TestNewServerToolsetFromConfigCleanupOnFailure(t *testing.T) {
+	var setters []*testDiscoverySetter
+
+	subscribers := signalSubscribers()
+
+	// the http server fails without a handler, after the gRPC server and its setter were created
+	_, err := NewServerToolsetFromConfig(context.Background(), &ServerToolsetConfig{
+		GRPCServer: &GRPCServerConfig{
+			Address: "127.0.0.1:9001",
+			Name:    "svc",
+		},
+		HTTPServer: &HTTPServerConfig{
+			Address: "127.0.0.1:9002",
+			Name:    "svc",
+		},
+	}, ServerToolsetInputParameters{
+		NewDiscoverySetter: func() (discovery.Setter, error) {
+			setters = append(setters, &testDiscoverySetter{})
+
+			return setters[len(setters)-1], nil
+		},
+	}, nil)
+	assert.NotNil(t, err)
+	assert.Len(t, setters, 2)
+
+	for _, setter := range setters {
+		assert.True(t, setter.stopped.Load())
+	}
+
+	assert.Equal(t, subscribers, signalSubscribers())
+}
@@ -2,6 +2,7 @@ package servicetoolset
 
 import (
 	"context"
+	"errors"
 	"net"
 	"net/http"
 	"sync"
@@ -11,9 +12,15 @@ import (
 	grpc_recovery "github.com/grpc-ecosystem/go-grpc-middleware/recovery"
 	"github.com/sgostarter/i/commerr"
 	"github.com/sgostarter/i/l"
+	"github.com/sgostarter/libeasygo/cuserror"
 	"github.com/sgostarter/libeasygo/routineman"
 	"github.com/sgostarter/librediscovery/discovery"
+	"github.com/sgostarter/libservicetoolset/grpce"
+	"github.com/sgostarter/libservicetoolset/grpce/apikey"
+	"github.com/sgostarter/libservicetoolset/grpce/auth"
 	"github.com/sgostarter/libservicetoolset/grpce/interceptors"
+	"github.com/sgostarter/libservicetoolset/grpce/meta"
+	"go.uber.org/atomic"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/keepalive"
@@ -21,7 +28,10 @@ import (
 )
 
 type DiscoveryExConfig struct {
-	Setter          discovery.Setter  `json:"-" yaml:"-" ignored:"true"`
+	Setter discovery.Setter `json:"-" yaml:"-" ignored:"true"`
+	// OwnSetter the server stops Setter (if it has a Stop method) when the server stops, set it only if Setter is
+	// created for the server, the setters shared with others are left to their owners
+	OwnSetter       bool              `json:"-" yaml:"-" ignored:"true"`
 	ExternalAddress string            `yaml:"external_address" json:"external_address"`
 	Meta            map[string]string `yaml:"meta" json:"meta"`
 }
@@ -30,13 +40,60 @@ type GRPCServerConfig struct {
 	Address    string               `yaml:"address" json:"address"`
 	TLSConfig  *GRPCServerTLSConfig `yaml:"tls_config" json:"tls_config"`
 	WebAddress string               `yaml:"web_address" json:"web_address"`
+	// TLSFileConfig is used when TLSConfig is nil
+	TLSFileConfig *GRPCServerTLSFileConfig `yaml:"tls_file_config" json:"tls_file_config"`
 
-	Name              string             `yaml:"name" json:"name"`
-	MetaTransKeys     []string           `yaml:"meta_trans_keys" json:"meta_trans_keys"`
-	DiscoveryExConfig *DiscoveryExConfig `yaml:"discovery_ex_config" json:"discovery_ex_config"`
+	Name          string   `yaml:"name" json:"name"`
+	MetaTransKeys []string `yaml:"meta_trans_keys" json:"meta_trans_keys"`
+	// Propagation replaces MetaTransKeys if not nil, see meta.PropagationPolicy
+	Propagation       *meta.PropagationPolicy `yaml:"propagation" json:"propagation"`
+	DiscoveryExConfig *DiscoveryExConfig      `yaml:"discovery_ex_config" json:"discovery_ex_config"`
 
 	KeepAliveDuration        time.Duration `yaml:"keep_alive_duration" json:"keep_alive_duration"`
 	EnforcementPolicyMinTime time.Duration `yaml:"enforcement_policy_min_time" json:"enforcement_policy_min_time"`
+
+	// RuntimeConfig the initial runtime config, MetaTransKeys and Propagation are used if its ones are nil
+	RuntimeConfig *RuntimeConfig `yaml:"runtime_config" json:"runtime_config"`
+	// RuntimeConfigFile is watched and applied on RuntimeConfig
+	RuntimeConfigFile          string        `yaml:"runtime_config_file" json:"runtime_config_file"`
+	RuntimeConfigWatchInterval time.Duration `yaml:"runtime_config_watch_interval" json:"runtime_config_watch_interval"`
+
+	// Admin the opt-in admin endpoint, managed by ServerToolset
+	Admin *AdminConfig `yaml:"admin" json:"admin"`
+
+	// GRPCWeb the grpc-web options, the defaults are used if nil
+	GRPCWeb *GRPCWebConfig `yaml:"grpc_web" json:"grpc_web"`
+	// JSONTranscoding serves the services as JSON on WebAddress besides grpc-web
+	JSONTranscoding *JSONTranscodingConfig `yaml:"json_transcoding" json:"json_transcoding"`
+	// SSE serves the server streaming methods as server-sent events on WebAddress, for the requests accepting
+	// text/event-stream or under SSE.PathPrefix
+	SSE *SSEConfig `yaml:"sse" json:"sse"`
+	// RealIP resolves the client ip with the trusted proxies for grpce.GrpcGetRealIP
+	RealIP *grpce.RealIPResolverConfig `yaml:"real_ip" json:"real_ip"`
+	// ProxyProtocol parses the PROXY protocol headers on Address and WebAddress
+	ProxyProtocol *grpce.ProxyProtocolConfig `yaml:"proxy_protocol" json:"proxy_protocol"`
+	// IPACL the initial ip allow and deny rules
+	IPACL *IPACLConfig `yaml:"ip_acl" json:"ip_acl"`
+	// IPACLFile replaces IPACL, it's watched like RuntimeConfigFile
+	IPACLFile string `yaml:"ip_acl_file" json:"ip_acl_file"`
+	// JWT authenticates the calls with the bearer tokens, the claims are read by auth.ClaimsFromContext
+	JWT *auth.JWTConfig `yaml:"jwt" json:"jwt"`
+	// APIKey authenticates the calls with the api keys of APIKeyFile or APIKeyStore, the principal is read by
+	// apikey.PrincipalFromContext. Both JWT and APIKey are checked if both are set
+	APIKey *apikey.Config `yaml:"api_key" json:"api_key"`
+	// APIKeyFile the keys of APIKey, see apikey.FileStore, it's watched like RuntimeConfigFile
+	APIKeyFile string `yaml:"api_key_file" json:"api_key_file"`
+	// APIKeyStore replaces APIKeyFile, e.g. an apikey.RedisStore
+	APIKeyStore apikey.KeyStore `json:"-" yaml:"-" ignored:"true"`
+	// Authz the method authorization policies, evaluated after the authentication
+	Authz *interceptors.AuthzConfig `yaml:"authz" json:"authz"`
+	// AuthzFile replaces Authz, the policies are loaded when the server is created
+	AuthzFile string `yaml:"authz_file" json:"authz_file"`
+	// CallLog logs the calls with the structured and redacted fields, the denied calls included
+	CallLog *interceptors.CallLogConfig `yaml:"call_log" json:"call_log"`
+	// RequestID stores the request info in the handler context (see meta.RequestInfoFromContext), Name is the
+	// origin of the requests started by the server
+	RequestID *interceptors.RequestInfoConfig `yaml:"request_id" json:"request_id"`
 }
 
 type BeforeServerStart func(server *grpc.Server) error
@@ -47,23 +104,39 @@ type GRPCServer interface {
 	StopAndWait()
 
 	Run(ctx context.Context) (err error)
+
+	RuntimeConfigManager() *RuntimeConfigManager
+	// IPACLManager returns nil if neither IPACL nor IPACLFile is configured
+	IPACLManager() *IPACLManager
+	// GetServiceInfo returns nil before the server started
+	GetServiceInfo() map[string]grpc.ServiceInfo
+	DiscoveryServiceInfos() []*discovery.ServiceInfo
+	// GRPCWebMiddleware serves grpc-web with the running server, the requests are passed to the next handler
+	// if they are not grpc-web or the server isn't running
+	GRPCWebMiddleware() HTTPMiddleware
 }
 
 func NewGRPCServer(routineMan routineman.RoutineMan, cfg *GRPCServerConfig, opts []grpc.ServerOption,
 	defInit BeforeServerStart, logger l.Wrapper, extraInterceptors ...interface{}) (GRPCServer, error) {
-	if routineMan == nil {
-		routineMan = routineman.NewRoutineMan(context.Background(), logger)
-	}
-
 	if logger == nil {
 		logger = l.NewNopLoggerWrapper()
 	}
 
+	routineManOwned := routineMan == nil
+	if routineManOwned {
+		routineMan = routineman.NewRoutineMan(context.Background(), logger)
+	}
+
 	serverOptions := make([]grpc.ServerOption, 0, len(opts)+1)
 	serverOptions = append(serverOptions, opts...)
 
-	if cfg.TLSConfig != nil && len(cfg.TLSConfig.Key) > 0 {
-		tlsConfig, err := GenServerTLSConfig(cfg.TLSConfig)
+	serverTLSConfig, err := cfg.GetTLSConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	if serverTLSConfig != nil && len(serverTLSConfig.Key) > 0 {
+		tlsConfig, err := GenServerTLSConfig(serverTLSConfig)
 		if err != nil {
 			return nil, err
 		}
@@ -71,22 +144,146 @@ func NewGRPCServer(routineMan routineman.RoutineMan, cfg *GRPCServerConfig, opts
 		serverOptions = append(serverOptions, grpc.Creds(credentials.NewTLS(tlsConfig)))
 	}
 
+	runtimeConfig := &RuntimeConfig{}
+	if cfg.RuntimeConfig != nil {
+		runtimeConfig = cfg.RuntimeConfig.clone()
+	}
+
+	if runtimeConfig.MetaTransKeys == nil {
+		runtimeConfig.MetaTransKeys = cfg.MetaTransKeys
+	}
+
+	if runtimeConfig.Propagation == nil && cfg.Propagation != nil {
+		runtimeConfig.Propagation = cfg.Propagation.Clone()
+	}
+
+	if err = runtimeConfig.Validate(); err != nil {
+		return nil, err
+	}
+
+	var realIPResolver *grpce.RealIPResolver
+
+	if cfg.RealIP != nil {
+		realIPResolver, err = grpce.NewRealIPResolver(cfg.RealIP)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var ipACLManager *IPACLManager
+
+	if cfg.IPACL != nil || cfg.IPACLFile != "" {
+		ipACLManager, err = NewIPACLManager(cfg.IPACL, logger)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var jwtAuthenticator *auth.JWTAuthenticator
+
+	if cfg.JWT != nil {
+		jwtAuthenticator, err = auth.NewJWTAuthenticator(*cfg.JWT, logger)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var (
+		apiKeyAuthenticator *apikey.Authenticator
+		apiKeyFileStore     *apikey.FileStore
+	)
+
+	if cfg.APIKey != nil {
+		apiKeyStore := cfg.APIKeyStore
+		if apiKeyStore == nil {
+			if cfg.APIKeyFile == "" {
+				return nil, cuserror.NewWithErrorMsg("api key: api_key_file or the key store is required")
+			}
+
+			apiKeyFileStore, err = apikey.NewFileStore(cfg.APIKeyFile, logger)
+			if err != nil {
+				return nil, err
+			}
+
+			apiKeyStore = apiKeyFileStore
+		}
+
+		apiKeyAuthenticator, err = apikey.NewAuthenticator(*cfg.APIKey, apiKeyStore, logger)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var authorizer *interceptors.Authorizer
+
+	authzConfig := cfg.Authz
+	if cfg.AuthzFile != "" {
+		authzConfig, err = interceptors.LoadAuthzConfigFile(cfg.AuthzFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if authzConfig != nil {
+		authorizer, err = interceptors.NewAuthorizer(*authzConfig, nil, logger)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var callLogger *interceptors.CallLogger
+
+	if cfg.CallLog != nil {
+		callLogger, err = interceptors.NewCallLogger(*cfg.CallLog, logger)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var requestIDGenerator meta.IDGenerator
+
+	if cfg.RequestID != nil {
+		requestIDGenerator, err = cfg.RequestID.NewIDGenerator()
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	impl := &gRPCServerImpl{
-		routineMan:               routineMan,
-		address:                  cfg.Address,
-		webAddress:               cfg.WebAddress,
-		serverName:               cfg.Name,
-		metaTransKeys:            cfg.MetaTransKeys,
-		keepaliveDuration:        cfg.KeepAliveDuration,
-		EnforcementPolicyMinTime: cfg.EnforcementPolicyMinTime,
-		extraInterceptors:        extraInterceptors,
-		defInit:                  defInit,
-		logger:                   logger.WithFields(l.StringField(l.ClsKey, "gRPCServerImpl")),
-		serverOptions:            serverOptions,
+		routineMan:                 routineMan,
+		routineManOwned:            routineManOwned,
+		address:                    cfg.Address,
+		webAddress:                 cfg.WebAddress,
+		serverName:                 cfg.Name,
+		runtimeConfigManager:       NewRuntimeConfigManager(runtimeConfig, logger),
+		runtimeConfigFile:          cfg.RuntimeConfigFile,
+		runtimeConfigWatchInterval: cfg.RuntimeConfigWatchInterval,
+		gRPCWeb:                    cfg.GRPCWeb,
+		jsonTranscoding:            cfg.JSONTranscoding,
+		sse:                        cfg.SSE,
+		realIPResolver:             realIPResolver,
+		proxyProtocol:              cfg.ProxyProtocol,
+		ipACLManager:               ipACLManager,
+		ipACLFile:                  cfg.IPACLFile,
+		jwtAuthenticator:           jwtAuthenticator,
+		apiKeyAuthenticator:        apiKeyAuthenticator,
+		apiKeyFileStore:            apiKeyFileStore,
+		authorizer:                 authorizer,
+		callLogger:                 callLogger,
+		requestID:                  cfg.RequestID,
+		requestIDGenerator:         requestIDGenerator,
+		keepaliveDuration:          cfg.KeepAliveDuration,
+		EnforcementPolicyMinTime:   cfg.EnforcementPolicyMinTime,
+		extraInterceptors:          extraInterceptors,
+		defInit:                    defInit,
+		logger:                     logger.WithFields(l.StringField(l.ClsKey, "gRPCServerImpl")),
+		serverOptions:              serverOptions,
+		chServeErr:                 make(chan error, 2),
 	}
 
 	if cfg.DiscoveryExConfig != nil && cfg.DiscoveryExConfig.Setter != nil {
 		impl.setter = cfg.DiscoveryExConfig.Setter
+		impl.ownSetter = cfg.DiscoveryExConfig.OwnSetter
 		impl.externalAddress = cfg.DiscoveryExConfig.ExternalAddress
 		impl.meta = cfg.DiscoveryExConfig.Meta
 	}
@@ -97,25 +294,49 @@ func NewGRPCServer(routineMan routineman.RoutineMan, cfg *GRPCServerConfig, opts
 type gRPCServerImpl struct {
 	lock sync.Mutex
 
-	routineMan               routineman.RoutineMan
-	address                  string
-	webAddress               string
-	serverName               string
-	metaTransKeys            []string
-	extraInterceptors        []interface{}
-	keepaliveDuration        time.Duration
-	EnforcementPolicyMinTime time.Duration
-	serverOptions            []grpc.ServerOption
-	defInit                  BeforeServerStart
-	logger                   l.Wrapper
+	routineMan                 routineman.RoutineMan
+	routineManOwned            bool
+	address                    string
+	webAddress                 string
+	serverName                 string
+	runtimeConfigManager       *RuntimeConfigManager
+	runtimeConfigFile          string
+	runtimeConfigWatchInterval time.Duration
+	gRPCWeb                    *GRPCWebConfig
+	jsonTranscoding            *JSONTranscodingConfig
+	sse                        *SSEConfig
+	realIPResolver             *grpce.RealIPResolver
+	proxyProtocol              *grpce.ProxyProtocolConfig
+	ipACLManager               *IPACLManager
+	ipACLFile                  string
+	jwtAuthenticator           *auth.JWTAuthenticator
+	apiKeyAuthenticator        *apikey.Authenticator
+	apiKeyFileStore            *apikey.FileStore
+	authorizer                 *interceptors.Authorizer
+	callLogger                 *interceptors.CallLogger
+	requestID                  *interceptors.RequestInfoConfig
+	requestIDGenerator         meta.IDGenerator
+	extraInterceptors          []interface{}
+	keepaliveDuration          time.Duration
+	EnforcementPolicyMinTime   time.Duration
+	serverOptions              []grpc.ServerOption
+	defInit                    BeforeServerStart
+	logger                     l.Wrapper
 
 	gRPCListen    net.Listener
 	gRPCWebListen net.Listener
 	s             *grpc.Server
+	webServer     *http.Server
+	webHandler    atomic.Pointer[gRPCWebHandler]
+
+	stopping   atomic.Bool
+	chServeErr chan error
 
 	setter          discovery.Setter
+	ownSetter       bool
 	externalAddress string
 	meta            map[string]string
+	serviceInfos    []*discovery.ServiceInfo
 }
 
 func (impl *gRPCServerImpl) Run(ctx context.Context) (err error) {
@@ -124,7 +345,10 @@ func (impl *gRPCServerImpl) Run(ctx context.Context) (err error) {
 		return
 	}
 
-	<-ctx.Done()
+	select {
+	case <-ctx.Done():
+	case err = <-impl.chServeErr:
+	}
 
 	impl.StopAndWait()
 
@@ -151,6 +375,24 @@ func (impl *gRPCServerImpl) Start(init BeforeServerStart) (err error) {
 		return
 	}
 
+	if impl.stopping.Load() {
+		if !impl.routineManOwned {
+			// the external routine man was stopped with the server, the routines would exit at once
+			err = cuserror.NewWithErrorMsg("can't restart the server with an external routine man")
+
+			return
+		}
+
+		// restarted after stopped
+		impl.routineMan = routineman.NewRoutineMan(context.Background(), impl.logger)
+	}
+
+	impl.stopping.Store(false)
+
+	for len(impl.chServeErr) > 0 {
+		<-impl.chServeErr
+	}
+
 	fnCleanOnFailed := func() {
 		if impl.gRPCListen != nil {
 			_ = impl.gRPCListen.Close()
@@ -163,7 +405,7 @@ func (impl *gRPCServerImpl) Start(init BeforeServerStart) (err error) {
 		}
 	}
 
-	impl.gRPCListen, err = net.Listen("tcp", impl.address)
+	impl.gRPCListen, err = listenTCP(impl.address, impl.proxyProtocol)
 	if err != nil {
 		impl.logger.WithFields(l.StringField("gRPCListen", impl.address), l.ErrorField(err)).Error("listenFailed")
 
@@ -171,7 +413,7 @@ func (impl *gRPCServerImpl) Start(init BeforeServerStart) (err error) {
 	}
 
 	if impl.webAddress != "" {
-		impl.gRPCWebListen, err = net.Listen("tcp", impl.webAddress)
+		impl.gRPCWebListen, err = listenTCP(impl.webAddress, impl.proxyProtocol)
 		if err != nil {
 			impl.logger.WithFields(l.ErrorField(err)).Error("listen4WebFailed")
 			fnCleanOnFailed()
@@ -186,56 +428,192 @@ func (impl *gRPCServerImpl) Start(init BeforeServerStart) (err error) {
 	if err != nil {
 		impl.logger.WithFields(l.StringField("gRPCListen", impl.address), l.ErrorField(err)).Error("initFailed")
 		fnCleanOnFailed()
+		impl.s = nil
 
 		return
 	}
 
+	if impl.runtimeConfigFile != "" {
+		err = impl.runtimeConfigManager.LoadFile(impl.runtimeConfigFile)
+		if err != nil {
+			impl.logger.WithFields(l.StringField("file", impl.runtimeConfigFile), l.ErrorField(err)).Error("loadRuntimeConfigFailed")
+			fnCleanOnFailed()
+			impl.s = nil
+
+			return
+		}
+	}
+
+	if impl.ipACLFile != "" {
+		err = impl.ipACLManager.LoadFile(impl.ipACLFile)
+		if err != nil {
+			impl.logger.WithFields(l.StringField("file", impl.ipACLFile), l.ErrorField(err)).Error("loadIPACLFailed")
+			fnCleanOnFailed()
+			impl.s = nil
+
+			return
+		}
+	}
+
 	reflection.Register(impl.s)
 
+	gRPCWebConfig := impl.gRPCWeb
+	if gRPCWebConfig == nil {
+		gRPCWebConfig = &GRPCWebConfig{}
+	}
+
+	webHandler, err := newGRPCWebHandler(gRPCWebConfig.inputParameters(impl.s, impl.logger))
+	if err != nil {
+		impl.logger.WithFields(l.ErrorField(err)).Error("newGRPCWebHandler")
+		fnCleanOnFailed()
+		impl.s = nil
+
+		return
+	}
+
+	impl.webHandler.Store(webHandler)
+
 	err = impl.startDiscovery(impl.s)
 	if err != nil {
 		impl.logger.WithFields(l.ErrorField(err)).Error("startDiscovery")
 		fnCleanOnFailed()
+		impl.s = nil
 
 		return
 	}
 
-	impl.routineMan.StartRoutine(impl.mainRoutine, "mainRoutine")
+	s, gRPCListen, gRPCWebListen := impl.s, impl.gRPCListen, impl.gRPCWebListen
 
-	if impl.gRPCWebListen != nil {
-		impl.routineMan.StartRoutine(impl.webRoutine, "webRoutine")
+	impl.routineMan.StartRoutine(func(_ context.Context, _ func() bool) {
+		impl.mainRoutine(s, gRPCListen)
+	}, "mainRoutine")
+
+	if gRPCWebListen != nil {
+		impl.routineMan.StartRoutine(func(_ context.Context, _ func() bool) {
+			impl.webRoutine(s, gRPCWebListen)
+		}, "webRoutine")
+	}
+
+	if impl.runtimeConfigFile != "" {
+		impl.routineMan.StartRoutine(func(ctx context.Context, _ func() bool) {
+			impl.runtimeConfigManager.WatchFile(ctx, impl.runtimeConfigFile, impl.runtimeConfigWatchInterval)
+		}, "runtimeConfigWatchRoutine")
+	}
+
+	if impl.ipACLFile != "" {
+		impl.routineMan.StartRoutine(func(ctx context.Context, _ func() bool) {
+			impl.ipACLManager.WatchFile(ctx, impl.ipACLFile, impl.runtimeConfigWatchInterval)
+		}, "ipACLWatchRoutine")
+	}
+
+	if impl.jwtAuthenticator != nil {
+		impl.routineMan.StartRoutine(func(ctx context.Context, _ func() bool) {
+			impl.jwtAuthenticator.WatchJWKSFile(ctx)
+		}, "jwksWatchRoutine")
+	}
+
+	if impl.apiKeyFileStore != nil {
+		impl.routineMan.StartRoutine(func(ctx context.Context, _ func() bool) {
+			impl.apiKeyFileStore.WatchFile(ctx, impl.runtimeConfigWatchInterval)
+		}, "apiKeyWatchRoutine")
 	}
 
 	return
 }
 
-func (impl *gRPCServerImpl) webRoutine(_ context.Context, _ func() bool) {
-	h, err := NewGRPCWebHandler(GRPCWebHandlerInputParameters{
-		GRPCServer:          impl.s,
-		GRPCWebUseWebsocket: false,
-		GRPCWebPingInterval: 0,
-	})
-	if err != nil {
-		impl.logger.WithFields(l.ErrorField(err)).Fatal("NewGRPCWebHandler")
+func (impl *gRPCServerImpl) webRoutine(s *grpc.Server, gRPCWebListen net.Listener) {
+	webHandler := impl.webHandler.Load()
+	if webHandler == nil {
+		// stopped
+		return
+	}
+
+	var h http.Handler = http.NotFoundHandler()
+
+	if impl.jsonTranscoding != nil {
+		th, errT := NewJSONTranscodingHandler(JSONTranscodingHandlerInputParameters{
+			GRPCServer: s,
+			Config:     *impl.jsonTranscoding,
+			Logger:     impl.logger,
+		})
+		if errT != nil {
+			impl.logger.WithFields(l.ErrorField(errT)).Error("NewJSONTranscodingHandler")
+			impl.serveFailed(errT)
+
+			return
+		}
+
+		defer func() {
+			_ = th.Close()
+		}()
+
+		h = th
+	}
+
+	if impl.sse != nil {
+		sh, errS := NewSSEHandler(SSEHandlerInputParameters{
+			GRPCServer: s,
+			Config:     *impl.sse,
+			Logger:     impl.logger,
+		})
+		if errS != nil {
+			impl.logger.WithFields(l.ErrorField(errS)).Error("NewSSEHandler")
+			impl.serveFailed(errS)
+
+			return
+		}
+
+		defer func() {
+			_ = sh.Close()
+		}()
+
+		h = sseOrNextHandler(sh, impl.sse.PathPrefix, h)
 	}
 
-	impl.logger.Info("grpc web server gRPCListen on:", impl.gRPCWebListen.Addr())
+	h = webHandler.middleware(h)
+
+	impl.logger.Info("grpc web server gRPCListen on:", gRPCWebListen.Addr())
 
-	httpServer := &http.Server{
+	webServer := &http.Server{
 		ReadHeaderTimeout: time.Second * 30,
 		Handler:           h,
+		ConnContext:       grpce.ProxyProtocolConnContext,
 	}
-	err = httpServer.Serve(impl.gRPCWebListen)
 
-	if err != nil {
-		impl.logger.WithFields(l.ErrorField(err)).Fatal("webServe")
+	impl.lock.Lock()
+	if impl.stopping.Load() {
+		impl.lock.Unlock()
+
+		return
+	}
+
+	impl.webServer = webServer
+	impl.lock.Unlock()
+
+	err := webServer.Serve(gRPCWebListen)
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		impl.logger.WithFields(l.ErrorField(err)).Error("webServe")
+		impl.serveFailed(err)
 	}
 }
 
-func (impl *gRPCServerImpl) mainRoutine(_ context.Context, _ func() bool) {
-	err := impl.s.Serve(impl.gRPCListen)
+func (impl *gRPCServerImpl) mainRoutine(s *grpc.Server, gRPCListen net.Listener) {
+	err := s.Serve(gRPCListen)
 	if err != nil {
 		impl.logger.WithFields(l.ErrorField(err)).Error("GRPCServe")
+		impl.serveFailed(err)
+	}
+}
+
+// serveFailed reports the errors which are not caused by stopping to Run.
+func (impl *gRPCServerImpl) serveFailed(err error) {
+	if impl.stopping.Load() {
+		return
+	}
+
+	select {
+	case impl.chServeErr <- err:
+	default:
 	}
 }
 
@@ -244,17 +622,42 @@ func (impl *gRPCServerImpl) Wait() {
 }
 
 func (impl *gRPCServerImpl) Stop() {
+	impl.lock.Lock()
+	defer impl.lock.Unlock()
+
+	if impl.s == nil {
+		return
+	}
+
+	impl.stopping.Store(true)
+
+	if impl.ownSetter && len(impl.serviceInfos) > 0 {
+		StopDiscoverySetter(impl.setter)
+	}
+
+	impl.serviceInfos = nil
+
 	if impl.gRPCListen != nil {
 		_ = impl.gRPCListen.Close()
+		impl.gRPCListen = nil
+	}
+
+	if impl.webServer != nil {
+		_ = impl.webServer.Close()
+		impl.webServer = nil
 	}
 
 	if impl.gRPCWebListen != nil {
 		_ = impl.gRPCWebListen.Close()
+		impl.gRPCWebListen = nil
 	}
 
+	impl.webHandler.Store(nil)
+
 	impl.routineMan.TriggerStop()
 	// impl.s.GracefulStop()
 	impl.s.Stop()
+	impl.s = nil
 }
 
 func (impl *gRPCServerImpl) StopAndWait() {
@@ -262,12 +665,96 @@ func (impl *gRPCServerImpl) StopAndWait() {
 	impl.routineMan.StopAndWait()
 }
 
+func (impl *gRPCServerImpl) RuntimeConfigManager() *RuntimeConfigManager {
+	return impl.runtimeConfigManager
+}
+
+func (impl *gRPCServerImpl) IPACLManager() *IPACLManager {
+	return impl.ipACLManager
+}
+
+func (impl *gRPCServerImpl) GetServiceInfo() map[string]grpc.ServiceInfo {
+	impl.lock.Lock()
+	defer impl.lock.Unlock()
+
+	if impl.s == nil {
+		return nil
+	}
+
+	return impl.s.GetServiceInfo()
+}
+
+func (impl *gRPCServerImpl) DiscoveryServiceInfos() []*discovery.ServiceInfo {
+	impl.lock.Lock()
+	defer impl.lock.Unlock()
+
+	serviceInfos := make([]*discovery.ServiceInfo, 0, len(impl.serviceInfos))
+
+	for _, serviceInfo := range impl.serviceInfos {
+		n := *serviceInfo
+
+		if serviceInfo.Meta != nil {
+			n.Meta = make(map[string]string, len(serviceInfo.Meta))
+			for k, v := range serviceInfo.Meta {
+				n.Meta[k] = v
+			}
+		}
+
+		serviceInfos = append(serviceInfos, &n)
+	}
+
+	return serviceInfos
+}
+
 func (impl *gRPCServerImpl) getInterceptors() []grpc.ServerOption {
-	unaryInterceptors := []grpc.UnaryServerInterceptor{
-		interceptors.ServerIDInterceptor(impl.metaTransKeys),
+	var unaryInterceptors []grpc.UnaryServerInterceptor
+
+	var streamInterceptors []grpc.StreamServerInterceptor
+
+	if impl.requestID != nil {
+		unaryInterceptors = append(unaryInterceptors, interceptors.ServerRequestInfoInterceptor(
+			impl.requestIDGenerator, impl.serverName, impl.requestID.Echo))
+		streamInterceptors = append(streamInterceptors, interceptors.ServerStreamRequestInfoInterceptor(
+			impl.requestIDGenerator, impl.serverName, impl.requestID.Echo))
+	}
+
+	// the panics of the interceptors below are recovered here, the ones of the handlers are recovered after the
+	// authorization, so they are logged by the call logger
+	unaryInterceptors = append(unaryInterceptors, grpc_recovery.UnaryServerInterceptor())
+	streamInterceptors = append(streamInterceptors, grpc_recovery.StreamServerInterceptor())
+
+	// the real ip is resolved before the rate limits and the ip acl
+	if impl.realIPResolver != nil {
+		unaryInterceptors = append(unaryInterceptors, interceptors.ServerRealIPInterceptor(impl.realIPResolver))
+		streamInterceptors = append(streamInterceptors, interceptors.ServerStreamRealIPInterceptor(impl.realIPResolver))
+	}
+
+	unaryInterceptors = append(unaryInterceptors, impl.runtimeConfigManager.UnaryServerInterceptor())
+	streamInterceptors = append(streamInterceptors, impl.runtimeConfigManager.StreamServerInterceptor())
+
+	if impl.callLogger != nil {
+		unaryInterceptors = append(unaryInterceptors, impl.callLogger.UnaryServerInterceptor())
+		streamInterceptors = append(streamInterceptors, impl.callLogger.StreamServerInterceptor())
+	}
+
+	if impl.ipACLManager != nil {
+		unaryInterceptors = append(unaryInterceptors, impl.ipACLManager.UnaryServerInterceptor())
+		streamInterceptors = append(streamInterceptors, impl.ipACLManager.StreamServerInterceptor())
+	}
+
+	if impl.jwtAuthenticator != nil {
+		unaryInterceptors = append(unaryInterceptors, impl.jwtAuthenticator.UnaryServerInterceptor())
+		streamInterceptors = append(streamInterceptors, impl.jwtAuthenticator.StreamServerInterceptor())
 	}
-	streamInterceptors := []grpc.StreamServerInterceptor{
-		interceptors.ServerStreamIDInterceptor(impl.metaTransKeys),
+
+	if impl.apiKeyAuthenticator != nil {
+		unaryInterceptors = append(unaryInterceptors, impl.apiKeyAuthenticator.UnaryServerInterceptor())
+		streamInterceptors = append(streamInterceptors, impl.apiKeyAuthenticator.StreamServerInterceptor())
+	}
+
+	if impl.authorizer != nil {
+		unaryInterceptors = append(unaryInterceptors, impl.authorizer.UnaryServerInterceptor())
+		streamInterceptors = append(streamInterceptors, impl.authorizer.StreamServerInterceptor())
 	}
 
 	unaryInterceptors = append(unaryInterceptors, grpc_recovery.UnaryServerInterceptor())
@@ -365,5 +852,27 @@ func (impl *gRPCServerImpl) startDiscovery(server *grpc.Server) error {
 		}
 	}
 
-	return impl.setter.Start(serviceInfos)
+	err = impl.setter.Start(serviceInfos)
+	if err != nil {
+		return err
+	}
+
+	impl.serviceInfos = serviceInfos
+
+	return nil
+}
+
+func (impl *gRPCServerImpl) GRPCWebMiddleware() HTTPMiddleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			webHandler := impl.webHandler.Load()
+			if webHandler == nil {
+				next.ServeHTTP(w, r)
+
+				return
+			}
+
+			webHandler.middleware(next).ServeHTTP(w, r)
+		})
+	}
 }
@@ -0,0 +1,63 @@
+package servicetoolset
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/sgostarter/libservicetoolset/grpce/interceptors"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/examples/helloworld/helloworld"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+func TestGRPCServerInterceptorsRecovery(t *testing.T) {
+	gs, err := NewGRPCServer(nil, &GRPCServerConfig{
+		Address: ":0",
+		CallLog: &interceptors.CallLogConfig{
+			LogPayload: true,
+			RedactFunc: func(_, path string, _ protoreflect.FieldDescriptor) bool {
+				if path == "message" {
+					panic("call logger")
+				}
+
+				return false
+			},
+		},
+	}, nil, nil, nil)
+	assert.Nil(t, err)
+
+	lis := bufconn.Listen(1024 * 1024)
+
+	s := grpc.NewServer(gs.(*gRPCServerImpl).getServerOptions()...)
+	helloworld.RegisterGreeterServer(s, &testGreeterServer{})
+
+	go func() {
+		_ = s.Serve(lis)
+	}()
+
+	defer s.Stop()
+
+	conn, err := grpc.NewClient("passthrough:///bufnet", grpc.WithContextDialer(
+		func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	assert.Nil(t, err)
+
+	defer conn.Close()
+
+	client := helloworld.NewGreeterClient(conn)
+
+	// the panic of the handler
+	_, err = client.SayHello(context.Background(), &helloworld.HelloRequest{Name: "panic"})
+	assert.Equal(t, codes.Internal, status.Code(err))
+
+	// the panic of the call logger, which runs after the handler
+	_, err = client.SayHello(context.Background(), &helloworld.HelloRequest{Name: "x"})
+	assert.Equal(t, codes.Internal, status.Code(err))
+}
@@ -1,56 +1,249 @@
 package servicetoolset
 
 import (
+	"fmt"
 	"net/http"
+	"net/url"
+	"strings"
 	"time"
 
 	"github.com/improbable-eng/grpc-web/go/grpcweb"
+	"github.com/sgostarter/i/l"
+	"github.com/sgostarter/libeasygo/cuserror"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
 
+type GRPCWebConfig struct {
+	UseWebsocket          bool          `yaml:"use_websocket" json:"use_websocket"`
+	WebsocketPingInterval time.Duration `yaml:"websocket_ping_interval" json:"websocket_ping_interval"`
+	// AllowedOrigins exact, wildcard or regex patterns, see OriginMatcher, all the origins are allowed if empty.
+	// If all the origins are allowed, the credentials are not allowed and the websockets are same-origin only
+	AllowedOrigins []string `yaml:"allowed_origins" json:"allowed_origins"`
+	// AllowedHeaders the request headers allowed by CORS besides the grpc-web ones, all the headers are allowed if empty
+	AllowedHeaders []string `yaml:"allowed_headers" json:"allowed_headers"`
+	// DisableCredentials don't send Access-Control-Allow-Credentials, the cookies and the authorization headers
+	// won't be sent by the browsers
+	DisableCredentials bool `yaml:"disable_credentials" json:"disable_credentials"`
+	// Deprecated: LegacyAllOrigins keeps the behavior before AllowedOrigins existed for the deployments relying on
+	// it: if all the origins are allowed, the credentials are allowed and the websockets accept any origin. It's
+	// insecure, a warning is logged, and it will be removed
+	LegacyAllOrigins bool `yaml:"legacy_all_origins" json:"legacy_all_origins"`
+	// AllowNonRootResource serves /prefix/package.Service/Method, for serving on a mux under a prefix
+	AllowNonRootResource bool `yaml:"allow_non_root_resource" json:"allow_non_root_resource"`
+	// ServeOnHTTPServer serves grpc-web on the HTTP server of the ServerToolset too
+	ServeOnHTTPServer bool `yaml:"serve_on_http_server" json:"serve_on_http_server"`
+}
+
+func (cfg *GRPCWebConfig) validate(path string) error {
+	if _, err := NewOriginMatcher(cfg.AllowedOrigins); err != nil {
+		return cuserror.NewWithErrorMsg(fmt.Sprintf("%v.allowed_origins: %v", path, err))
+	}
+
+	return ValidateConfigDuration(path+".websocket_ping_interval", cfg.WebsocketPingInterval)
+}
+
+func (cfg *GRPCWebConfig) inputParameters(s *grpc.Server, logger l.Wrapper) GRPCWebHandlerInputParameters {
+	return GRPCWebHandlerInputParameters{
+		GRPCServer:           s,
+		GRPCWebUseWebsocket:  cfg.UseWebsocket,
+		GRPCWebPingInterval:  cfg.WebsocketPingInterval,
+		AllowedOrigins:       cfg.AllowedOrigins,
+		AllowedHeaders:       cfg.AllowedHeaders,
+		DisableCredentials:   cfg.DisableCredentials,
+		LegacyAllOrigins:     cfg.LegacyAllOrigins,
+		AllowNonRootResource: cfg.AllowNonRootResource,
+		Logger:               logger,
+	}
+}
+
 type gRPCWebHandler struct {
-	gRPCServer          *grpc.Server
-	gRPCWebUseWebsocket bool
-	gRPCWebPingInterval time.Duration
+	wrapped            *grpcweb.WrappedGrpcServer
+	disableCredentials bool
 }
 
 type GRPCWebHandlerInputParameters struct {
 	GRPCServer          *grpc.Server
 	GRPCWebUseWebsocket bool
 	GRPCWebPingInterval time.Duration
+
+	// AllowedOrigins see GRPCWebConfig
+	AllowedOrigins     []string
+	AllowedHeaders     []string
+	DisableCredentials bool
+	// Deprecated: LegacyAllOrigins see GRPCWebConfig
+	LegacyAllOrigins     bool
+	AllowNonRootResource bool
+
+	Logger l.Wrapper
 }
 
+// NewGRPCWebHandler the requests which are not grpc-web are responded with 404, use GRPCWebMiddleware to serve
+// grpc-web besides other handlers.
 func NewGRPCWebHandler(parameters GRPCWebHandlerInputParameters) (http.Handler, error) {
+	return newGRPCWebHandler(parameters)
+}
+
+// GRPCWebMiddleware serves the grpc-web requests, the others are passed to the next handler.
+func GRPCWebMiddleware(parameters GRPCWebHandlerInputParameters) (HTTPMiddleware, error) {
+	h, err := newGRPCWebHandler(parameters)
+	if err != nil {
+		return nil, err
+	}
+
+	return h.middleware, nil
+}
+
+func newGRPCWebHandler(parameters GRPCWebHandlerInputParameters) (*gRPCWebHandler, error) {
 	if parameters.GRPCServer == nil {
 		return nil, status.Error(codes.InvalidArgument, "")
 	}
 
-	return &gRPCWebHandler{
-		gRPCServer:          parameters.GRPCServer,
-		gRPCWebUseWebsocket: parameters.GRPCWebUseWebsocket,
-		gRPCWebPingInterval: parameters.GRPCWebPingInterval,
-	}, nil
-}
+	origins, err := NewOriginMatcher(parameters.AllowedOrigins)
+	if err != nil {
+		return nil, err
+	}
+
+	allowAll := len(parameters.AllowedOrigins) == 0 || origins.AllowAll()
+	legacy := allowAll && parameters.LegacyAllOrigins
+
+	if legacy {
+		logger := parameters.Logger
+		if logger == nil {
+			logger = l.NewNopLoggerWrapper()
+		}
+
+		logger.WithFields(l.StringField(l.ClsKey, "gRPCWebHandler")).Warn("legacyAllOriginsDeprecated")
+	}
+
+	originFunc := origins.Match
+	if allowAll {
+		originFunc = func(_ string) bool { return true }
+	}
+
+	// the browsers send the cookies with the websocket requests regardless of CORS
+	websocketOriginFunc := func(r *http.Request) bool {
+		origin := r.Header.Get("Origin")
+
+		return origin == "" || originFunc(origin)
+	}
+
+	if allowAll && !legacy {
+		websocketOriginFunc = sameOriginRequest
+	}
 
-func (s *gRPCWebHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	options := []grpcweb.Option{
 		grpcweb.WithCorsForRegisteredEndpointsOnly(false),
-		grpcweb.WithOriginFunc(func(_ string) bool { return true }),
+		grpcweb.WithOriginFunc(originFunc),
+		grpcweb.WithAllowNonRootResource(parameters.AllowNonRootResource),
+	}
+
+	if len(parameters.AllowedHeaders) > 0 {
+		options = append(options, grpcweb.WithAllowedRequestHeaders(append([]string{"x-grpc-web", "content-type",
+			"x-user-agent", "grpc-timeout"}, parameters.AllowedHeaders...)))
 	}
-	if s.gRPCWebUseWebsocket {
+
+	if parameters.GRPCWebUseWebsocket {
 		options = append(
 			options,
 			grpcweb.WithWebsockets(true),
-			grpcweb.WithWebsocketOriginFunc(func(_ *http.Request) bool { return true }),
+			grpcweb.WithWebsocketOriginFunc(websocketOriginFunc),
 		)
 
-		if s.gRPCWebPingInterval > 0 {
-			options = append(options, grpcweb.WithWebsocketPingInterval(s.gRPCWebPingInterval))
+		if parameters.GRPCWebPingInterval > 0 {
+			options = append(options, grpcweb.WithWebsocketPingInterval(parameters.GRPCWebPingInterval))
+		}
+	}
+
+	return &gRPCWebHandler{
+		wrapped:            grpcweb.WrapServer(parameters.GRPCServer, options...),
+		disableCredentials: parameters.DisableCredentials || (allowAll && !legacy),
+	}, nil
+}
+
+func sameOriginRequest(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+
+	u, err := url.Parse(origin)
+
+	return err == nil && strings.EqualFold(u.Host, r.Host)
+}
+
+// IsGRPCWebRequest checks the grpc-web requests, including the websocket and the CORS preflight ones.
+func (s *gRPCWebHandler) IsGRPCWebRequest(r *http.Request) bool {
+	return s.wrapped.IsGrpcWebRequest(r) || s.wrapped.IsAcceptableGrpcCorsRequest(r) ||
+		s.wrapped.IsGrpcWebSocketRequest(r)
+}
+
+func (s *gRPCWebHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !s.IsGRPCWebRequest(r) {
+		http.NotFound(w, r)
+
+		return
+	}
+
+	s.serveGRPCWeb(w, r)
+}
+
+func (s *gRPCWebHandler) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !s.IsGRPCWebRequest(r) {
+			next.ServeHTTP(w, r)
+
+			return
 		}
+
+		s.serveGRPCWeb(w, r)
+	})
+}
+
+func (s *gRPCWebHandler) serveGRPCWeb(w http.ResponseWriter, r *http.Request) {
+	if s.disableCredentials && !s.wrapped.IsGrpcWebSocketRequest(r) {
+		// grpcweb always allows credentials
+		w = &noCredentialsResponseWriter{ResponseWriter: w}
+	}
+
+	s.wrapped.ServeHTTP(w, r)
+}
+
+type noCredentialsResponseWriter struct {
+	http.ResponseWriter
+
+	wroteHeader bool
+}
+
+func (w *noCredentialsResponseWriter) WriteHeader(statusCode int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+
+		w.Header().Del("Access-Control-Allow-Credentials")
+	}
+
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *noCredentialsResponseWriter) Write(p []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *noCredentialsResponseWriter) Flush() {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
 	}
 
-	wrappedGrpc := grpcweb.WrapServer(s.gRPCServer, options...)
-	wrappedGrpc.ServeHTTP(w, r)
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (w *noCredentialsResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
 }
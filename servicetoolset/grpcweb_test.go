@@ -0,0 +1,125 @@
+package servicetoolset
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+)
+
+func TestOriginMatcher(t *testing.T) {
+	m, err := NewOriginMatcher([]string{"https://a.com", "https://*.b.com", `regex:^https://c[0-9]+\.com$`})
+	assert.Nil(t, err)
+
+	assert.True(t, m.Match("https://a.com"))
+	assert.True(t, m.Match("HTTPS://A.COM"))
+	assert.False(t, m.Match("https://a.com.evil.com"))
+	assert.True(t, m.Match("https://x.b.com"))
+	assert.True(t, m.Match("https://x.y.b.com"))
+	assert.False(t, m.Match("https://b.com"))
+	assert.False(t, m.Match("https://evil.com/.b.com"))
+	assert.True(t, m.Match("https://c12.com"))
+	assert.False(t, m.Match("https://c.com"))
+
+	m, err = NewOriginMatcher([]string{"*"})
+	assert.Nil(t, err)
+	assert.True(t, m.AllowAll())
+	assert.True(t, m.Match("https://any.com"))
+
+	_, err = NewOriginMatcher([]string{"regex:("})
+	assert.NotNil(t, err)
+}
+
+func grpcWebPreflightRequest(origin string) *http.Request {
+	r := httptest.NewRequest(http.MethodOptions, "/helloworld.Greeter/SayHello", nil)
+	r.Header.Set("Origin", origin)
+	r.Header.Set("Access-Control-Request-Method", http.MethodPost)
+	r.Header.Set("Access-Control-Request-Headers", "x-grpc-web,content-type")
+
+	return r
+}
+
+func TestGRPCWebMiddleware(t *testing.T) {
+	s := grpc.NewServer()
+	defer s.Stop()
+
+	middleware, err := GRPCWebMiddleware(GRPCWebHandlerInputParameters{
+		GRPCServer:         s,
+		AllowedOrigins:     []string{"https://*.a.com"},
+		DisableCredentials: true,
+	})
+	assert.Nil(t, err)
+
+	nextCalled := false
+
+	h := middleware(http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {
+		nextCalled = true
+	}))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, grpcWebPreflightRequest("https://x.a.com"))
+
+	assert.False(t, nextCalled)
+	assert.Equal(t, "https://x.a.com", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Empty(t, w.Header().Get("Access-Control-Allow-Credentials"))
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, grpcWebPreflightRequest("https://evil.com"))
+
+	assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"))
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/index.html", nil))
+
+	assert.True(t, nextCalled)
+}
+
+func TestGRPCWebHandlerAllOrigins(t *testing.T) {
+	s := grpc.NewServer()
+	defer s.Stop()
+
+	h, err := NewGRPCWebHandler(GRPCWebHandlerInputParameters{
+		GRPCServer: s,
+	})
+	assert.Nil(t, err)
+
+	// the credentials are never allowed for all the origins
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, grpcWebPreflightRequest("https://evil.com"))
+
+	assert.Equal(t, "https://evil.com", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Empty(t, w.Header().Get("Access-Control-Allow-Credentials"))
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/index.html", nil))
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	r := httptest.NewRequest(http.MethodGet, "http://a.com/helloworld.Greeter/SayHello", nil)
+	assert.True(t, sameOriginRequest(r))
+
+	r.Header.Set("Origin", "https://a.com")
+	assert.True(t, sameOriginRequest(r))
+
+	r.Header.Set("Origin", "https://evil.com")
+	assert.False(t, sameOriginRequest(r))
+}
+
+func TestGRPCWebHandlerLegacyAllOrigins(t *testing.T) {
+	s := grpc.NewServer()
+	defer s.Stop()
+
+	h, err := NewGRPCWebHandler(GRPCWebHandlerInputParameters{
+		GRPCServer:       s,
+		LegacyAllOrigins: true,
+	})
+	assert.Nil(t, err)
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, grpcWebPreflightRequest("https://a.com"))
+
+	assert.Equal(t, "https://a.com", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "true", w.Header().Get("Access-Control-Allow-Credentials"))
+}
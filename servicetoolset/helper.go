@@ -4,6 +4,7 @@ import (
 	"crypto/tls"
 	"crypto/x509"
 	"fmt"
+	"net"
 	"os"
 	"strconv"
 	"strings"
@@ -11,7 +12,9 @@ import (
 	"github.com/sgostarter/i/commerr"
 	"github.com/sgostarter/libeasygo/cuserror"
 	"github.com/sgostarter/libeasygo/iputils"
+	"github.com/sgostarter/librediscovery/discovery"
 	"github.com/sgostarter/libservicetoolset/certpool"
+	"github.com/sgostarter/libservicetoolset/grpce"
 	"golang.org/x/net/http2"
 )
 
@@ -50,7 +53,7 @@ type GRPCServerTLSConfig struct {
 
 	RootCAs [][]byte `yaml:"RootCAs" json:"root_cas" `
 	Cert    []byte   `yaml:"Cert" json:"cert"`
-	Key     []byte   `yaml:"Key" json:"key"`
+	Key     []byte   `yaml:"Key" json:"key" redact:"true"`
 }
 
 type GRPCClientTLSConfig struct {
@@ -60,7 +63,7 @@ type GRPCClientTLSConfig struct {
 
 	RootCAs [][]byte `yaml:"RootCAs" json:"root_cas" `
 	Cert    []byte   `yaml:"Cert" json:"cert"`
-	Key     []byte   `yaml:"Key" json:"key"`
+	Key     []byte   `yaml:"Key" json:"key" redact:"true"`
 }
 
 type GRPCServerTLSFileConfig struct {
@@ -242,6 +245,23 @@ func GenClientTLSConfig(cfg *GRPCClientTLSConfig) (tlsConfig *tls.Config, err er
 	return
 }
 
+// DiscoveryServiceRemover a shared discovery setter implementing it has the services of a server removed when the
+// server shuts down, before the in-flight requests are drained.
+type DiscoveryServiceRemover interface {
+	Remove(services []*discovery.ServiceInfo) error
+}
+
+// StopDiscoverySetter deregisters the services if the setter supports stopping, the servers call it only for the
+// setters they own (see DiscoveryExConfig.OwnSetter).
+func StopDiscoverySetter(setter discovery.Setter) {
+	switch s := setter.(type) {
+	case interface{ Stop() error }:
+		_ = s.Stop()
+	case interface{ Stop() }:
+		s.Stop()
+	}
+}
+
 func GetDiscoveryHostAndPort(externalAddress, listeningAddress string) (host string, port int, err error) {
 	fnParse := func(address string) (host string, port int, err error) {
 		if address == "" {
@@ -313,3 +333,24 @@ func GetDiscoveryHostAndPort(externalAddress, listeningAddress string) (host str
 
 	return
 }
+
+// listenTCP the connections are wrapped by grpce.ProxyProtocolListener if proxyProtocol is not nil.
+func listenTCP(address string, proxyProtocol *grpce.ProxyProtocolConfig) (net.Listener, error) {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	if proxyProtocol == nil {
+		return listener, nil
+	}
+
+	ppListener, err := grpce.NewProxyProtocolListener(listener, proxyProtocol)
+	if err != nil {
+		_ = listener.Close()
+
+		return nil, err
+	}
+
+	return ppListener, nil
+}
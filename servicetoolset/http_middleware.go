@@ -0,0 +1,705 @@
+package servicetoolset
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sgostarter/i/l"
+	"github.com/sgostarter/libeasygo/cuserror"
+	"github.com/sgostarter/libservicetoolset/grpce"
+	"github.com/sgostarter/libservicetoolset/grpce/meta"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	defaultHTTPGzipMinLength = 1024
+)
+
+// HTTPMiddleware the http counterpart of the grpc interceptors.
+type HTTPMiddleware func(next http.Handler) http.Handler
+
+// HTTPMetricsObserver is called once for every finished request, r.URL.Path may be of high cardinality,
+// map it to a route before using it as a metric label.
+type HTTPMetricsObserver func(r *http.Request, statusCode int, size int64, cost time.Duration)
+
+type HTTPCORSConfig struct {
+	// AllowedOrigins exact, wildcard or regex patterns, see OriginMatcher
+	AllowedOrigins   []string      `yaml:"allowed_origins" json:"allowed_origins"`
+	AllowedMethods   []string      `yaml:"allowed_methods" json:"allowed_methods"`
+	AllowedHeaders   []string      `yaml:"allowed_headers" json:"allowed_headers"`
+	ExposedHeaders   []string      `yaml:"exposed_headers" json:"exposed_headers"`
+	AllowCredentials bool          `yaml:"allow_credentials" json:"allow_credentials"`
+	MaxAge           time.Duration `yaml:"max_age" json:"max_age"`
+}
+
+type HTTPGzipConfig struct {
+	// Level gzip.DefaultCompression if 0
+	Level int `yaml:"level" json:"level"`
+	// MinLength the responses shorter than it are not compressed, 1024 if 0
+	MinLength int `yaml:"min_length" json:"min_length"`
+}
+
+type HTTPMiddlewareConfig struct {
+	// RequestID reads the request id from the meta.RequestIDOnMetaData header or generates one, the id is
+	// echoed in the response header and put into the outgoing grpc metadata of the request context
+	RequestID bool `yaml:"request_id" json:"request_id"`
+	// Propagation puts the request headers allowed by it into the outgoing grpc metadata of the request context
+	Propagation *meta.PropagationPolicy `yaml:"propagation" json:"propagation"`
+	// RealIP puts the client ip into the request context, see HTTPRealIPFromContext
+	RealIP bool `yaml:"real_ip" json:"real_ip"`
+	// RealIPResolver the headers are trusted from the configured proxies, the remote address is used if it's nil
+	RealIPResolver *grpce.RealIPResolverConfig `yaml:"real_ip_resolver" json:"real_ip_resolver"`
+	AccessLog      bool                        `yaml:"access_log" json:"access_log"`
+	Recovery       bool                        `yaml:"recovery" json:"recovery"`
+	CORS           *HTTPCORSConfig             `yaml:"cors" json:"cors"`
+	Gzip           *HTTPGzipConfig             `yaml:"gzip" json:"gzip"`
+}
+
+func (cfg *HTTPMiddlewareConfig) validate(path string) error {
+	var errs []error
+
+	if cfg.CORS != nil {
+		errs = append(errs, ValidateConfigDuration(path+".cors.max_age", cfg.CORS.MaxAge))
+
+		if origins, err := NewOriginMatcher(cfg.CORS.AllowedOrigins); err != nil {
+			errs = append(errs, cuserror.NewWithErrorMsg(fmt.Sprintf("%v.cors.allowed_origins: %v", path, err)))
+		} else if origins.AllowAll() && cfg.CORS.AllowCredentials {
+			errs = append(errs, cuserror.NewWithErrorMsg(fmt.Sprintf(
+				"%v.cors: allow_credentials can't be used with the allowed origin *", path)))
+		}
+	}
+
+	if cfg.RealIPResolver != nil {
+		if err := cfg.RealIPResolver.Validate(); err != nil {
+			errs = append(errs, cuserror.NewWithErrorMsg(fmt.Sprintf("%v.real_ip_resolver.%v", path, err)))
+		}
+	}
+
+	if cfg.Propagation != nil {
+		if err := cfg.Propagation.Validate(); err != nil {
+			errs = append(errs, cuserror.NewWithErrorMsg(fmt.Sprintf("%v.propagation.%v", path, err)))
+		}
+	}
+
+	if cfg.Gzip != nil {
+		if cfg.Gzip.Level < gzip.HuffmanOnly || cfg.Gzip.Level > gzip.BestCompression {
+			errs = append(errs, cuserror.NewWithErrorMsg(fmt.Sprintf("%v.gzip.level: invalid level %v", path, cfg.Gzip.Level)))
+		}
+
+		if cfg.Gzip.MinLength < 0 {
+			errs = append(errs, cuserror.NewWithErrorMsg(fmt.Sprintf("%v.gzip.min_length: should not be negative", path)))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// NewHTTPMiddlewares builds the middlewares configured in cfg, outermost first:
+// request id, propagation, real ip, access log and metrics, recovery, cors, gzip.
+func NewHTTPMiddlewares(cfg *HTTPMiddlewareConfig, observer HTTPMetricsObserver, logger l.Wrapper) ([]HTTPMiddleware, error) {
+	if logger == nil {
+		logger = l.NewNopLoggerWrapper()
+	}
+
+	logger = logger.WithFields(l.StringField(l.ClsKey, "httpMiddleware"))
+
+	if cfg == nil {
+		cfg = &HTTPMiddlewareConfig{}
+	}
+
+	var middlewares []HTTPMiddleware
+
+	if cfg.RequestID {
+		middlewares = append(middlewares, HTTPRequestIDMiddleware())
+	}
+
+	if cfg.Propagation != nil {
+		middlewares = append(middlewares, HTTPPropagationMiddleware(cfg.Propagation))
+	}
+
+	if cfg.RealIP {
+		if cfg.RealIPResolver != nil {
+			resolver, err := grpce.NewRealIPResolver(cfg.RealIPResolver)
+			if err != nil {
+				return nil, err
+			}
+
+			middlewares = append(middlewares, HTTPRealIPResolverMiddleware(resolver))
+		} else {
+			middlewares = append(middlewares, HTTPRealIPMiddleware())
+		}
+	}
+
+	if cfg.AccessLog || observer != nil {
+		var accessLogger l.Wrapper
+		if cfg.AccessLog {
+			accessLogger = logger
+		}
+
+		middlewares = append(middlewares, HTTPAccessLogMiddleware(accessLogger, observer))
+	}
+
+	if cfg.Recovery {
+		middlewares = append(middlewares, HTTPRecoveryMiddleware(logger))
+	}
+
+	if cfg.CORS != nil {
+		middlewares = append(middlewares, HTTPCORSMiddleware(cfg.CORS))
+	}
+
+	if cfg.Gzip != nil {
+		middlewares = append(middlewares, HTTPGzipMiddleware(cfg.Gzip))
+	}
+
+	return middlewares, nil
+}
+
+// ChainHTTPMiddlewares the first middleware is the outermost one.
+func ChainHTTPMiddlewares(handler http.Handler, middlewares ...HTTPMiddleware) http.Handler {
+	for idx := len(middlewares) - 1; idx >= 0; idx-- {
+		handler = middlewares[idx](handler)
+	}
+
+	return handler
+}
+
+//
+// request id
+//
+
+func HTTPRequestIDMiddleware() HTTPMiddleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id := strings.TrimSpace(r.Header.Get(meta.RequestIDOnMetaData))
+			if !meta.ValidRequestID(id) {
+				id = meta.NewRequestID()
+			}
+
+			w.Header().Set(meta.RequestIDOnMetaData, id)
+
+			ctx := r.Context()
+
+			md, ok := metadata.FromOutgoingContext(ctx)
+			if ok {
+				md = md.Copy()
+			} else {
+				md = metadata.New(nil)
+			}
+
+			md.Set(meta.RequestIDOnMetaData, id)
+
+			next.ServeHTTP(w, r.WithContext(metadata.NewOutgoingContext(ctx, md)))
+		})
+	}
+}
+
+// HTTPRequestID returns the request id set by HTTPRequestIDMiddleware.
+func HTTPRequestID(r *http.Request) string {
+	return meta.RequestIDFromContext(r.Context())
+}
+
+//
+// propagation
+//
+
+// HTTPPropagationMiddleware sets the request headers allowed by policy to the outgoing metadata, so the grpc calls
+// of the handler propagate them like the grpc servers do, see meta.TransferContextMetaWithPolicy. policy is
+// meta.KeysPropagationPolicy(nil) if nil. The binary (-bin) headers are not propagated, neither are the client
+// address headers (x-forwarded-for, x-real-ip, forwarded, host...) unless policy allows them by name, see
+// meta.DefaultDenyKeys.
+func HTTPPropagationMiddleware(policy *meta.PropagationPolicy) HTTPMiddleware {
+	if policy == nil {
+		policy = meta.KeysPropagationPolicy(nil)
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			headers := metadata.New(nil)
+
+			for key, values := range r.Header {
+				if !strings.HasSuffix(strings.ToLower(key), "-bin") {
+					headers.Append(key, values...)
+				}
+			}
+
+			ctx := r.Context()
+
+			md, ok := metadata.FromOutgoingContext(ctx)
+			if ok {
+				md = md.Copy()
+			} else {
+				md = metadata.New(nil)
+			}
+
+			for key, values := range policy.Filter(headers) {
+				if len(md[key]) == 0 {
+					md.Set(key, values...)
+				}
+			}
+
+			next.ServeHTTP(w, r.WithContext(metadata.NewOutgoingContext(ctx, md)))
+		})
+	}
+}
+
+//
+// real ip
+//
+
+type httpRealIPKey struct{}
+
+// HTTPRealIPMiddleware the ip is the remote address, see grpce.HTTPGetRealIP.
+func HTTPRealIPMiddleware() HTTPMiddleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), httpRealIPKey{}, grpce.HTTPGetRealIP(r))))
+		})
+	}
+}
+
+// HTTPRealIPResolverMiddleware likes HTTPRealIPMiddleware, the ip is resolved by resolver.
+func HTTPRealIPResolverMiddleware(resolver *grpce.RealIPResolver) HTTPMiddleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), httpRealIPKey{}, resolver.ResolveHTTP(r))))
+		})
+	}
+}
+
+// HTTPRealIPFromContext returns the ip set by HTTPRealIPMiddleware.
+func HTTPRealIPFromContext(ctx context.Context) string {
+	ip, _ := ctx.Value(httpRealIPKey{}).(string)
+
+	return ip
+}
+
+func httpRealIP(r *http.Request) string {
+	if ip := HTTPRealIPFromContext(r.Context()); ip != "" {
+		return ip
+	}
+
+	return grpce.HTTPGetRealIP(r)
+}
+
+//
+// access log and metrics
+//
+
+// HTTPAccessLogMiddleware logs every request if logger is not nil, and reports it to observer if not nil.
+func HTTPAccessLogMiddleware(logger l.Wrapper, observer HTTPMetricsObserver) HTTPMiddleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			recorder := &httpResponseRecorder{ResponseWriter: w}
+
+			st := time.Now()
+
+			defer func() {
+				cost := time.Since(st)
+
+				statusCode := recorder.StatusCode()
+
+				if logger != nil {
+					logger.Infof("[HTTP][ACCESS] id:%v ip:%v method:%v uri:%v proto:%v status:%v size:%v cost:%v",
+						HTTPRequestID(r), httpRealIP(r), r.Method, r.RequestURI, r.Proto, statusCode, recorder.size, cost)
+				}
+
+				if observer != nil {
+					observer(r, statusCode, recorder.size, cost)
+				}
+			}()
+
+			next.ServeHTTP(recorder, r)
+		})
+	}
+}
+
+type httpResponseRecorder struct {
+	http.ResponseWriter
+
+	statusCode int
+	size       int64
+}
+
+func (w *httpResponseRecorder) StatusCode() int {
+	if w.statusCode == 0 {
+		return http.StatusOK
+	}
+
+	return w.statusCode
+}
+
+func (w *httpResponseRecorder) WriteHeader(statusCode int) {
+	if w.statusCode == 0 && statusCode >= http.StatusOK {
+		w.statusCode = statusCode
+	}
+
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *httpResponseRecorder) Write(p []byte) (int, error) {
+	if w.statusCode == 0 {
+		w.statusCode = http.StatusOK
+	}
+
+	n, err := w.ResponseWriter.Write(p)
+	w.size += int64(n)
+
+	return n, err
+}
+
+func (w *httpResponseRecorder) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (w *httpResponseRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if hijacker, ok := w.ResponseWriter.(http.Hijacker); ok {
+		return hijacker.Hijack()
+	}
+
+	return nil, nil, http.ErrNotSupported
+}
+
+func (w *httpResponseRecorder) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+//
+// recovery
+//
+
+func HTTPRecoveryMiddleware(logger l.Wrapper) HTTPMiddleware {
+	if logger == nil {
+		logger = l.NewNopLoggerWrapper()
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			recorder := &httpResponseRecorder{ResponseWriter: w}
+
+			defer func() {
+				v := recover()
+				if v == nil {
+					return
+				}
+
+				if v == http.ErrAbortHandler { // nolint: errorlint
+					panic(v)
+				}
+
+				logger.Errorf("[HTTP][PANIC] id:%v method:%v uri:%v panic:%v\n%s",
+					HTTPRequestID(r), r.Method, r.RequestURI, v, debug.Stack())
+
+				if recorder.statusCode == 0 {
+					http.Error(recorder, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				}
+			}()
+
+			next.ServeHTTP(recorder, r)
+		})
+	}
+}
+
+//
+// cors
+//
+
+func HTTPCORSMiddleware(cfg *HTTPCORSConfig) HTTPMiddleware {
+	origins, err := NewOriginMatcher(cfg.AllowedOrigins)
+	if err != nil {
+		// reported by validating the config, allow none here
+		origins, _ = NewOriginMatcher(nil)
+	}
+
+	allowedMethods := cfg.AllowedMethods
+	if len(allowedMethods) == 0 {
+		allowedMethods = []string{http.MethodGet, http.MethodPost, http.MethodHead}
+	}
+
+	methods := strings.Join(allowedMethods, ", ")
+	headers := strings.Join(cfg.AllowedHeaders, ", ")
+	exposedHeaders := strings.Join(cfg.ExposedHeaders, ", ")
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+
+			if origin == "" {
+				next.ServeHTTP(w, r)
+
+				return
+			}
+
+			h := w.Header()
+			h.Add("Vary", "Origin")
+
+			if !origins.Match(origin) {
+				if preflight {
+					w.WriteHeader(http.StatusForbidden)
+
+					return
+				}
+
+				next.ServeHTTP(w, r)
+
+				return
+			}
+
+			// the credentials are never allowed for all the origins, it's reported by validating the config
+			if origins.AllowAll() {
+				h.Set("Access-Control-Allow-Origin", "*")
+			} else {
+				h.Set("Access-Control-Allow-Origin", origin)
+			}
+
+			if cfg.AllowCredentials && !origins.AllowAll() {
+				h.Set("Access-Control-Allow-Credentials", "true")
+			}
+
+			if !preflight {
+				if exposedHeaders != "" {
+					h.Set("Access-Control-Expose-Headers", exposedHeaders)
+				}
+
+				next.ServeHTTP(w, r)
+
+				return
+			}
+
+			h.Add("Vary", "Access-Control-Request-Method")
+			h.Add("Vary", "Access-Control-Request-Headers")
+			h.Set("Access-Control-Allow-Methods", methods)
+
+			if headers != "" {
+				h.Set("Access-Control-Allow-Headers", headers)
+			} else if requestHeaders := r.Header.Get("Access-Control-Request-Headers"); requestHeaders != "" {
+				h.Set("Access-Control-Allow-Headers", requestHeaders)
+			}
+
+			if cfg.MaxAge > 0 {
+				h.Set("Access-Control-Max-Age", strconv.Itoa(int(cfg.MaxAge.Seconds())))
+			}
+
+			w.WriteHeader(http.StatusNoContent)
+		})
+	}
+}
+
+//
+// gzip
+//
+
+func HTTPGzipMiddleware(cfg *HTTPGzipConfig) HTTPMiddleware {
+	level := cfg.Level
+	if level == 0 {
+		level = gzip.DefaultCompression
+	}
+
+	minLength := cfg.MinLength
+	if minLength == 0 {
+		minLength = defaultHTTPGzipMinLength
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") || r.Header.Get("Upgrade") != "" ||
+				r.Method == http.MethodHead || strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+				next.ServeHTTP(w, r)
+
+				return
+			}
+
+			w.Header().Add("Vary", "Accept-Encoding")
+
+			gw := &gzipResponseWriter{
+				ResponseWriter: w,
+				level:          level,
+				minLength:      minLength,
+			}
+
+			next.ServeHTTP(gw, r)
+
+			// not deferred, the buffered response isn't sent on panic so the recovery can write the error
+			gw.close()
+		})
+	}
+}
+
+// gzipResponseWriter buffers the body until minLength is reached to decide whether to compress it.
+type gzipResponseWriter struct {
+	http.ResponseWriter
+
+	level     int
+	minLength int
+
+	statusCode  int
+	wroteHeader bool
+	plain       bool
+	buf         []byte
+	gz          *gzip.Writer
+}
+
+func (w *gzipResponseWriter) WriteHeader(statusCode int) {
+	if w.wroteHeader || w.statusCode != 0 {
+		return
+	}
+
+	if statusCode < http.StatusOK {
+		w.ResponseWriter.WriteHeader(statusCode)
+
+		return
+	}
+
+	w.statusCode = statusCode
+
+	if !w.compressible() {
+		w.startPlain()
+	}
+}
+
+func (w *gzipResponseWriter) Write(p []byte) (int, error) {
+	if w.statusCode == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	if w.plain {
+		return w.ResponseWriter.Write(p)
+	}
+
+	if w.gz != nil {
+		return w.gz.Write(p)
+	}
+
+	w.buf = append(w.buf, p...)
+
+	if len(w.buf) >= w.minLength {
+		if err := w.startGzip(); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(p), nil
+}
+
+// Flush commits the response to be compressed, streaming responses are compressed regardless of minLength.
+func (w *gzipResponseWriter) Flush() {
+	if w.statusCode == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	if !w.plain && w.gz == nil {
+		_ = w.startGzip()
+	}
+
+	if w.gz != nil {
+		_ = w.gz.Flush()
+	}
+
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (w *gzipResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if hijacker, ok := w.ResponseWriter.(http.Hijacker); ok {
+		return hijacker.Hijack()
+	}
+
+	return nil, nil, http.ErrNotSupported
+}
+
+func (w *gzipResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *gzipResponseWriter) compressible() bool {
+	if w.statusCode == http.StatusNoContent || w.statusCode == http.StatusNotModified {
+		return false
+	}
+
+	h := w.Header()
+
+	if h.Get("Content-Encoding") != "" {
+		return false
+	}
+
+	contentType := h.Get("Content-Type")
+	for _, prefix := range []string{"image/", "video/", "audio/", "application/zip", "application/gzip", "application/grpc"} {
+		if strings.HasPrefix(contentType, prefix) && !strings.HasPrefix(contentType, "image/svg") {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (w *gzipResponseWriter) startPlain() {
+	w.plain = true
+	w.wroteHeader = true
+
+	w.ResponseWriter.WriteHeader(w.statusCode)
+
+	if len(w.buf) > 0 {
+		_, _ = w.ResponseWriter.Write(w.buf)
+		w.buf = nil
+	}
+}
+
+func (w *gzipResponseWriter) startGzip() (err error) {
+	h := w.Header()
+
+	if h.Get("Content-Type") == "" {
+		h.Set("Content-Type", http.DetectContentType(w.buf))
+	}
+
+	if !w.compressible() {
+		w.startPlain()
+
+		return
+	}
+
+	h.Del("Content-Length")
+	h.Set("Content-Encoding", "gzip")
+
+	w.wroteHeader = true
+	w.ResponseWriter.WriteHeader(w.statusCode)
+
+	w.gz, err = gzip.NewWriterLevel(w.ResponseWriter, w.level)
+	if err != nil {
+		return
+	}
+
+	if len(w.buf) > 0 {
+		_, err = w.gz.Write(w.buf)
+		w.buf = nil
+	}
+
+	return
+}
+
+func (w *gzipResponseWriter) close() {
+	if w.gz != nil {
+		_ = w.gz.Close()
+
+		return
+	}
+
+	if !w.wroteHeader && (w.statusCode != 0 || len(w.buf) > 0) {
+		if w.statusCode == 0 {
+			w.statusCode = http.StatusOK
+		}
+
+		w.startPlain()
+	}
+}
@@ -0,0 +1,240 @@
+package servicetoolset
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sgostarter/libservicetoolset/grpce"
+	"github.com/sgostarter/libservicetoolset/grpce/meta"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/metadata"
+)
+
+func newTestHTTPMiddlewares(t *testing.T, cfg *HTTPMiddlewareConfig, observer HTTPMetricsObserver) []HTTPMiddleware {
+	middlewares, err := NewHTTPMiddlewares(cfg, observer, nil)
+	assert.Nil(t, err)
+
+	return middlewares
+}
+
+func TestHTTPMiddlewaresRequestID(t *testing.T) {
+	var idInHandler, ipInHandler string
+
+	handler := ChainHTTPMiddlewares(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		idInHandler = HTTPRequestID(r)
+		ipInHandler = HTTPRealIPFromContext(r.Context())
+	}), newTestHTTPMiddlewares(t, &HTTPMiddlewareConfig{RequestID: true, RealIP: true}, nil)...)
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(meta.RequestIDOnMetaData, "id1")
+	req.Header.Set("X-Forwarded-For", "10.0.0.1, 10.0.0.2")
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	assert.Equal(t, "id1", idInHandler)
+	assert.Equal(t, "id1", w.Header().Get(meta.RequestIDOnMetaData))
+	// the headers aren't trusted without the resolver
+	assert.Equal(t, "192.0.2.1", ipInHandler)
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	assert.NotEmpty(t, idInHandler)
+	assert.Equal(t, idInHandler, w.Header().Get(meta.RequestIDOnMetaData))
+
+	// the unsafe ids are replaced
+	for _, id := range []string{"id 1", "id1<script>", strings.Repeat("x", 129)} {
+		req = httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(meta.RequestIDOnMetaData, id)
+
+		w = httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		assert.NotEqual(t, id, idInHandler)
+		assert.True(t, meta.ValidRequestID(idInHandler))
+		assert.Equal(t, idInHandler, w.Header().Get(meta.RequestIDOnMetaData))
+	}
+}
+
+func TestHTTPMiddlewaresRealIPResolver(t *testing.T) {
+	var ipInHandler string
+
+	handler := ChainHTTPMiddlewares(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		ipInHandler = HTTPRealIPFromContext(r.Context())
+	}), newTestHTTPMiddlewares(t, &HTTPMiddlewareConfig{RealIP: true, RealIPResolver: &grpce.RealIPResolverConfig{
+		TrustedProxies: []string{"192.0.2.0/24"},
+	}}, nil)...)
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-Forwarded-For", "10.0.0.1, 10.0.0.2")
+
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	assert.Equal(t, "10.0.0.2", ipInHandler)
+
+	_, err := NewHTTPMiddlewares(&HTTPMiddlewareConfig{RealIP: true, RealIPResolver: &grpce.RealIPResolverConfig{
+		TrustedProxies: []string{"bad"},
+	}}, nil, nil)
+	assert.NotNil(t, err)
+}
+
+func TestHTTPMiddlewaresPropagation(t *testing.T) {
+	var md metadata.MD
+
+	handler := ChainHTTPMiddlewares(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		md, _ = metadata.FromOutgoingContext(meta.TransferContextMeta(r.Context(), nil))
+	}), newTestHTTPMiddlewares(t, &HTTPMiddlewareConfig{RequestID: true, Propagation: &meta.PropagationPolicy{
+		Allow: []string{"x-tenant"},
+	}}, nil)...)
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(meta.RequestIDOnMetaData, "id1")
+	req.Header.Set("X-Tenant", "t1")
+	req.Header.Set("X-Other", "o")
+	req.Header.Set("Ymi-Baggage-User", "u1")
+	req.Header.Set("Authorization", "Bearer x")
+	req.Header.Set("Cookie", "a=b")
+
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	assert.Equal(t, []string{"id1"}, md.Get(meta.RequestIDOnMetaData))
+	assert.Equal(t, []string{"t1"}, md.Get("x-tenant"))
+	assert.Equal(t, []string{"u1"}, md.Get("ymi-baggage-user"))
+	assert.Empty(t, md.Get("x-other"))
+	assert.Empty(t, md.Get("authorization"))
+	assert.Empty(t, md.Get("cookie"))
+}
+
+func TestHTTPPropagationMiddlewareDefaultPolicy(t *testing.T) {
+	var md metadata.MD
+
+	handler := HTTPPropagationMiddleware(nil)(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		md, _ = metadata.FromOutgoingContext(r.Context())
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-Tenant", "t1")
+	req.Header.Set("X-Forwarded-For", "10.0.0.1")
+	req.Header.Set("X-Forwarded-Host", "internal")
+	req.Header.Set("X-Real-Ip", "10.0.0.1")
+	req.Header.Set("Forwarded", "for=10.0.0.1")
+	req.Header.Set("Host", "internal")
+
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	assert.Equal(t, metadata.Pairs("x-tenant", "t1"), md)
+}
+
+func TestHTTPMiddlewaresRecoveryAndMetrics(t *testing.T) {
+	var statusCode int
+
+	handler := ChainHTTPMiddlewares(http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {
+		panic("boom")
+	}), newTestHTTPMiddlewares(t, &HTTPMiddlewareConfig{AccessLog: true, Recovery: true},
+		func(_ *http.Request, code int, _ int64, _ time.Duration) {
+			statusCode = code
+		})...)
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, http.StatusInternalServerError, statusCode)
+
+	// the partial response buffered by gzip isn't sent
+	handler = ChainHTTPMiddlewares(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("partial"))
+
+		panic("boom")
+	}), newTestHTTPMiddlewares(t, &HTTPMiddlewareConfig{Recovery: true, Gzip: &HTTPGzipConfig{}}, nil)...)
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.NotContains(t, w.Body.String(), "partial")
+}
+
+func TestHTTPMiddlewaresCORS(t *testing.T) {
+	handler := ChainHTTPMiddlewares(http.NotFoundHandler(), HTTPCORSMiddleware(&HTTPCORSConfig{
+		AllowedOrigins:   []string{"https://a.com"},
+		AllowCredentials: true,
+		MaxAge:           time.Minute,
+	}))
+
+	req := httptest.NewRequest(http.MethodOptions, "/", nil)
+	req.Header.Set("Origin", "https://a.com")
+	req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, "https://a.com", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "true", w.Header().Get("Access-Control-Allow-Credentials"))
+	assert.Equal(t, "60", w.Header().Get("Access-Control-Max-Age"))
+
+	req.Header.Set("Origin", "https://b.com")
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"))
+
+	// the credentials aren't allowed for all the origins
+	cfg := &HTTPMiddlewareConfig{CORS: &HTTPCORSConfig{AllowedOrigins: []string{"*"}, AllowCredentials: true}}
+	assert.NotNil(t, cfg.validate("http"))
+
+	w = httptest.NewRecorder()
+	ChainHTTPMiddlewares(http.NotFoundHandler(), HTTPCORSMiddleware(cfg.CORS)).ServeHTTP(w, req)
+
+	assert.Equal(t, "*", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Empty(t, w.Header().Get("Access-Control-Allow-Credentials"))
+}
+
+func TestHTTPMiddlewaresGzip(t *testing.T) {
+	body := strings.Repeat("hello ", 500)
+
+	handler := ChainHTTPMiddlewares(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/short" {
+			_, _ = w.Write([]byte("short"))
+
+			return
+		}
+
+		_, _ = w.Write([]byte(body))
+	}), HTTPGzipMiddleware(&HTTPGzipConfig{}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	assert.Equal(t, "gzip", w.Header().Get("Content-Encoding"))
+
+	gr, err := gzip.NewReader(w.Body)
+	assert.Nil(t, err)
+
+	d, err := io.ReadAll(gr)
+	assert.Nil(t, err)
+	assert.Equal(t, body, string(d))
+
+	req = httptest.NewRequest(http.MethodGet, "/short", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	assert.Empty(t, w.Header().Get("Content-Encoding"))
+	assert.Equal(t, "short", w.Body.String())
+}
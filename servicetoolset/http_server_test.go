@@ -0,0 +1,137 @@
+package servicetoolset
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/sgostarter/librediscovery/discovery"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/atomic"
+)
+
+func freeTestAddress(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+
+	defer listener.Close()
+
+	return listener.Addr().String()
+}
+
+type testDiscoveryRemover struct {
+	testDiscoverySetter
+	removed atomic.Int32
+}
+
+func (s *testDiscoveryRemover) Remove(services []*discovery.ServiceInfo) error {
+	s.removed.Add(int32(len(services)))
+
+	return nil
+}
+
+func TestNewHTTPServerNilLogger(t *testing.T) {
+	_, err := NewHTTPServerEx(nil, nil)
+	assert.NotNil(t, err)
+
+	for _, own := range []bool{false, true} {
+		setter := &testDiscoverySetter{}
+
+		s := NewHTTPServer("web", freeTestAddress(t), http.NotFoundHandler(), &DiscoveryExConfig{
+			Setter:    setter,
+			OwnSetter: own,
+		}, nil)
+		assert.NotNil(t, s)
+
+		ctx, cancel := context.WithCancel(context.Background())
+
+		go func() {
+			for !setter.started.Load() {
+				time.Sleep(time.Millisecond)
+			}
+
+			cancel()
+		}()
+
+		assert.Nil(t, s.Run(ctx))
+		assert.True(t, setter.started.Load())
+		assert.Equal(t, own, setter.stopped.Load())
+	}
+}
+
+func TestHTTPServerRemoveFromSharedSetter(t *testing.T) {
+	setter := &testDiscoveryRemover{}
+
+	s := NewHTTPServer("web", freeTestAddress(t), http.NotFoundHandler(), &DiscoveryExConfig{
+		Setter: setter,
+	}, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	go func() {
+		for !setter.started.Load() {
+			time.Sleep(time.Millisecond)
+		}
+
+		cancel()
+	}()
+
+	assert.Nil(t, s.Run(ctx))
+	assert.False(t, setter.stopped.Load())
+	assert.EqualValues(t, 1, setter.removed.Load())
+}
+
+func TestHTTPServerGracefulShutdown(t *testing.T) {
+	address := freeTestAddress(t)
+	chInHandler := make(chan struct{})
+
+	s, err := NewHTTPServerEx(&HTTPServerConfig{
+		Address: address,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			close(chInHandler)
+			time.Sleep(100 * time.Millisecond)
+			_, _ = w.Write([]byte("done"))
+		}),
+		ShutdownDrainTimeout: time.Second,
+	}, nil)
+	assert.Nil(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	chRunErr := make(chan error, 1)
+
+	go func() {
+		chRunErr <- s.Run(ctx)
+	}()
+
+	var resp *http.Response
+
+	for i := 0; i < 50; i++ {
+		req, _ := http.NewRequestWithContext(context.Background(), http.MethodGet, "http://"+address, nil)
+
+		go func() {
+			<-chInHandler
+			cancel()
+		}()
+
+		resp, err = http.DefaultClient.Do(req)
+		if err == nil {
+			break
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	assert.Nil(t, err)
+
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	assert.Nil(t, err)
+	assert.Equal(t, "done", string(body))
+	assert.Nil(t, <-chRunErr)
+}
@@ -2,72 +2,204 @@ package servicetoolset
 
 import (
 	"context"
-	"net"
+	"crypto/tls"
+	"errors"
 	"net/http"
 	"time"
 
+	"github.com/sgostarter/i/commerr"
 	"github.com/sgostarter/i/l"
 	"github.com/sgostarter/librediscovery/discovery"
+	"github.com/sgostarter/libservicetoolset/grpce"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 )
 
+const (
+	defaultHTTPReadHeaderTimeout    = time.Second * 30
+	defaultHTTPShutdownDrainTimeout = time.Second * 10
+)
+
+type HTTP2Config struct {
+	// H2C enables http/2 without tls
+	H2C                  bool          `yaml:"h2c" json:"h2c"`
+	MaxConcurrentStreams uint32        `yaml:"max_concurrent_streams" json:"max_concurrent_streams"`
+	MaxReadFrameSize     uint32        `yaml:"max_read_frame_size" json:"max_read_frame_size"`
+	IdleTimeout          time.Duration `yaml:"idle_timeout" json:"idle_timeout"`
+}
+
 type HTTPServerConfig struct {
 	Name              string            `yaml:"name" json:"name"`
 	Address           string            `yaml:"address" json:"address"`
-	Handler           http.Handler      `json:"-" yaml:"-"`
+	Handler           http.Handler      `json:"-" yaml:"-" ignored:"true"`
 	DiscoveryExConfig DiscoveryExConfig `yaml:"discovery_ex_config" json:"discovery_ex_config"`
+
+	TLSConfig *GRPCServerTLSConfig `yaml:"tls_config" json:"tls_config"`
+	// TLSFileConfig is used when TLSConfig is nil, the files are reloaded by ReloadTLS
+	TLSFileConfig *GRPCServerTLSFileConfig `yaml:"tls_file_config" json:"tls_file_config"`
+
+	ReadTimeout       time.Duration `yaml:"read_timeout" json:"read_timeout"`
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout" json:"read_header_timeout"`
+	WriteTimeout      time.Duration `yaml:"write_timeout" json:"write_timeout"`
+	IdleTimeout       time.Duration `yaml:"idle_timeout" json:"idle_timeout"`
+	MaxHeaderBytes    int           `yaml:"max_header_bytes" json:"max_header_bytes"`
+	HTTP2             *HTTP2Config  `yaml:"http2" json:"http2"`
+
+	// ProxyProtocol parses the PROXY protocol headers of the connections, see grpce.ProxyProtocolAddrFromContext
+	ProxyProtocol *grpce.ProxyProtocolConfig `yaml:"proxy_protocol" json:"proxy_protocol"`
+
+	// ShutdownDrainTimeout how long the in-flight requests are waited on shutdown before the connections are closed.
+	// The server is deregistered from discovery before draining only if it owns the setter, or the shared setter
+	// implements DiscoveryServiceRemover. Otherwise it stays advertised until the setter's owner stops it
+	ShutdownDrainTimeout time.Duration `yaml:"shutdown_drain_timeout" json:"shutdown_drain_timeout"`
+
+	Middleware *HTTPMiddlewareConfig `yaml:"middleware" json:"middleware"`
+	// MetricsObserver enables the metrics middleware if not nil
+	MetricsObserver HTTPMetricsObserver `json:"-" yaml:"-" ignored:"true"`
+	// Middlewares are applied inside the configured ones
+	Middlewares []HTTPMiddleware `json:"-" yaml:"-" ignored:"true"`
 }
 
 type HTTPServer interface {
 	Run(ctx context.Context) (err error)
 }
 
+// TLSReloadable is implemented by the servers created by NewHTTPServer and NewHTTPServerEx.
+type TLSReloadable interface {
+	// ReloadTLS reloads the tls files, does nothing if the server isn't serving tls from files
+	ReloadTLS() error
+}
+
 func NewHTTPServer(name, address string, handler http.Handler, discoveryExConfig *DiscoveryExConfig, logger l.Wrapper) HTTPServer {
-	if logger != nil {
+	cfg := &HTTPServerConfig{
+		Name:    name,
+		Address: address,
+		Handler: handler,
+	}
+
+	if discoveryExConfig != nil {
+		cfg.DiscoveryExConfig = *discoveryExConfig
+	}
+
+	server, _ := NewHTTPServerEx(cfg, logger)
+
+	return server
+}
+
+func NewHTTPServerEx(cfg *HTTPServerConfig, logger l.Wrapper) (HTTPServer, error) {
+	if cfg == nil {
+		return nil, commerr.ErrInvalidArgument
+	}
+
+	if logger == nil {
 		logger = l.NewNopLoggerWrapper()
 	}
 
-	return &httpServerImpl{
-		name:              name,
-		address:           address,
-		handler:           handler,
-		discoveryExConfig: discoveryExConfig,
-		logger:            logger.WithFields(l.StringField(l.ClsKey, "httpServerImpl")),
+	impl := &httpServerImpl{
+		cfg:    cfg,
+		logger: logger.WithFields(l.StringField(l.ClsKey, "httpServerImpl")),
+	}
+
+	if cfg.TLSConfig != nil || cfg.TLSFileConfig != nil {
+		tlsReloader, err := NewTLSReloader(cfg.TLSConfig, cfg.TLSFileConfig)
+		if err != nil {
+			return nil, err
+		}
+
+		impl.tlsReloader = tlsReloader
 	}
+
+	return impl, nil
 }
 
 type httpServerImpl struct {
-	name              string
-	address           string
-	handler           http.Handler
-	discoveryExConfig *DiscoveryExConfig
-	logger            l.Wrapper
+	cfg         *HTTPServerConfig
+	tlsReloader *TLSReloader
+	logger      l.Wrapper
+}
+
+func (impl *httpServerImpl) ReloadTLS() error {
+	if impl.tlsReloader == nil || impl.cfg.TLSConfig != nil {
+		return nil
+	}
+
+	return impl.tlsReloader.Reload()
+}
+
+func (impl *httpServerImpl) newServer() (*http.Server, error) {
+	readHeaderTimeout := impl.cfg.ReadHeaderTimeout
+	if readHeaderTimeout <= 0 {
+		readHeaderTimeout = defaultHTTPReadHeaderTimeout
+	}
+
+	middlewares, err := NewHTTPMiddlewares(impl.cfg.Middleware, impl.cfg.MetricsObserver, impl.logger)
+	if err != nil {
+		return nil, err
+	}
+
+	middlewares = append(middlewares, impl.cfg.Middlewares...)
+
+	server := &http.Server{
+		Handler:           ChainHTTPMiddlewares(impl.cfg.Handler, middlewares...),
+		ReadTimeout:       impl.cfg.ReadTimeout,
+		ReadHeaderTimeout: readHeaderTimeout,
+		WriteTimeout:      impl.cfg.WriteTimeout,
+		IdleTimeout:       impl.cfg.IdleTimeout,
+		MaxHeaderBytes:    impl.cfg.MaxHeaderBytes,
+		ConnContext:       grpce.ProxyProtocolConnContext,
+	}
+
+	http2Server := &http2.Server{}
+	if impl.cfg.HTTP2 != nil {
+		http2Server.MaxConcurrentStreams = impl.cfg.HTTP2.MaxConcurrentStreams
+		http2Server.MaxReadFrameSize = impl.cfg.HTTP2.MaxReadFrameSize
+		http2Server.IdleTimeout = impl.cfg.HTTP2.IdleTimeout
+	}
+
+	if impl.tlsReloader != nil {
+		if err := http2.ConfigureServer(server, http2Server); err != nil {
+			return nil, err
+		}
+	} else if impl.cfg.HTTP2 != nil && impl.cfg.HTTP2.H2C {
+		server.Handler = h2c.NewHandler(server.Handler, http2Server)
+	}
+
+	return server, nil
 }
 
 func (impl *httpServerImpl) Run(ctx context.Context) (err error) {
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
-	server := &http.Server{
-		ReadHeaderTimeout: time.Second * 30,
-		Handler:           impl.handler,
+	server, err := impl.newServer()
+	if err != nil {
+		return
 	}
 
-	l, err := net.Listen("tcp", impl.address)
+	listener, err := listenTCP(impl.cfg.Address, impl.cfg.ProxyProtocol)
 	if err != nil {
 		return
 	}
 
-	impl.logger.Infof("http server listening on %v", impl.address)
+	if impl.tlsReloader != nil {
+		listener = tls.NewListener(listener, impl.tlsReloader.TLSConfig(http2.NextProtoTLS, "http/1.1"))
+	}
 
-	err = impl.startDiscovery()
-	if err != nil {
-		impl.logger.Errorf("http server discovery failed: %w", err)
+	impl.logger.Infof("http server listening on %v", impl.cfg.Address)
+
+	serviceInfos, errD := impl.startDiscovery()
+	if errD != nil {
+		impl.logger.Errorf("http server discovery failed: %v", errD)
 	}
 
+	chServeErr := make(chan error, 1)
+
 	go func() {
-		err = server.Serve(l)
-		if err != nil {
-			impl.logger.Errorf("http server serve error: %v", err)
+		errS := server.Serve(listener)
+		if errS != nil && !errors.Is(errS, http.ErrServerClosed) {
+			impl.logger.Errorf("http server serve error: %v", errS)
+
+			chServeErr <- errS
 		}
 
 		cancel()
@@ -77,28 +209,77 @@ func (impl *httpServerImpl) Run(ctx context.Context) (err error) {
 
 	impl.logger.Infof("http server shutting down")
 
-	_ = server.Close()
+	impl.stopDiscovery(serviceInfos)
+
+	drainTimeout := impl.cfg.ShutdownDrainTimeout
+	if drainTimeout <= 0 {
+		drainTimeout = defaultHTTPShutdownDrainTimeout
+	}
+
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), drainTimeout)
+	defer shutdownCancel()
+
+	if errS := server.Shutdown(shutdownCtx); errS != nil {
+		impl.logger.Warnf("http server drain failed: %v, closing", errS)
+
+		_ = server.Close()
+	}
+
+	select {
+	case err = <-chServeErr:
+	default:
+	}
 
 	return
 }
 
-func (impl *httpServerImpl) startDiscovery() error {
-	if impl.name == "" || impl.discoveryExConfig == nil || impl.discoveryExConfig.Setter == nil {
-		return nil
+func (impl *httpServerImpl) startDiscovery() ([]*discovery.ServiceInfo, error) {
+	discoveryExConfig := &impl.cfg.DiscoveryExConfig
+
+	if impl.cfg.Name == "" || discoveryExConfig.Setter == nil {
+		return nil, nil
 	}
 
-	host, port, err := GetDiscoveryHostAndPort(impl.discoveryExConfig.ExternalAddress, impl.address)
+	host, port, err := GetDiscoveryHostAndPort(discoveryExConfig.ExternalAddress, impl.cfg.Address)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	serviceInfos := []*discovery.ServiceInfo{
 		{
 			Host:        host,
 			Port:        port,
-			ServiceName: discovery.BuildDiscoveryServerName(discovery.TypeBuildInHTTP, impl.name, ""),
+			ServiceName: discovery.BuildDiscoveryServerName(discovery.TypeBuildInHTTP, impl.cfg.Name, ""),
 		},
 	}
 
-	return impl.discoveryExConfig.Setter.Start(serviceInfos)
+	if err = discoveryExConfig.Setter.Start(serviceInfos); err != nil {
+		return nil, err
+	}
+
+	return serviceInfos, nil
+}
+
+func (impl *httpServerImpl) stopDiscovery(serviceInfos []*discovery.ServiceInfo) {
+	setter := impl.cfg.DiscoveryExConfig.Setter
+
+	if impl.cfg.DiscoveryExConfig.OwnSetter {
+		StopDiscoverySetter(setter)
+
+		return
+	}
+
+	if len(serviceInfos) == 0 {
+		return
+	}
+
+	if remover, ok := setter.(DiscoveryServiceRemover); ok {
+		if err := remover.Remove(serviceInfos); err != nil {
+			impl.logger.Warnf("http server discovery remove failed: %v", err)
+		}
+
+		return
+	}
+
+	impl.logger.Warnf("http server stays advertised while draining, the shared discovery setter can't remove it")
 }
@@ -0,0 +1,369 @@
+package servicetoolset
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sgostarter/i/commerr"
+	"github.com/sgostarter/i/l"
+	"github.com/sgostarter/libeasygo/cuserror"
+	"github.com/sgostarter/libservicetoolset/grpce"
+	"github.com/sgostarter/libservicetoolset/grpce/utils"
+	"go.uber.org/atomic"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// IPACLRule the client ips of the methods matching Method are checked against Deny first, then Allow
+// if it's not empty. Method is a method pattern, see RuntimeConfig.
+type IPACLRule struct {
+	Method string `yaml:"method" json:"method"`
+	// Allow the CIDRs or ips, all the others are denied if it's not empty
+	Allow []string `yaml:"allow" json:"allow"`
+	// Deny the CIDRs or ips
+	Deny []string `yaml:"deny" json:"deny"`
+}
+
+// IPACLConfig only the most specific rule matching the method is applied, the methods without rules are allowed.
+// The client ip is the one resolved by the real ip interceptor, otherwise the peer address, the headers sent by the
+// clients are never trusted; configure GRPCServerConfig.RealIP behind proxies.
+type IPACLConfig struct {
+	Rules []IPACLRule `yaml:"rules" json:"rules"`
+}
+
+func (cfg *IPACLConfig) Validate() error {
+	_, err := newIPACLSnapshot(cfg)
+
+	return err
+}
+
+// ipPrefixTrie a binary trie of the prefixes, the lookup costs at most 128 steps however many prefixes there are.
+type ipPrefixTrie struct {
+	v4, v6 *ipPrefixTrieNode
+}
+
+type ipPrefixTrieNode struct {
+	children [2]*ipPrefixTrieNode
+	terminal bool
+}
+
+func (trie *ipPrefixTrie) insert(prefix netip.Prefix) {
+	root := &trie.v6
+	if prefix.Addr().Is4() {
+		root = &trie.v4
+	}
+
+	if *root == nil {
+		*root = &ipPrefixTrieNode{}
+	}
+
+	node := *root
+	d := prefix.Addr().AsSlice()
+
+	for idx := 0; idx < prefix.Bits() && !node.terminal; idx++ {
+		bit := (d[idx/8] >> (7 - idx%8)) & 1
+		if node.children[bit] == nil {
+			node.children[bit] = &ipPrefixTrieNode{}
+		}
+
+		node = node.children[bit]
+	}
+
+	node.terminal = true
+	// the longer prefixes are covered
+	node.children = [2]*ipPrefixTrieNode{}
+}
+
+func (trie *ipPrefixTrie) contains(addr netip.Addr) bool {
+	node := trie.v6
+	if addr.Is4() {
+		node = trie.v4
+	}
+
+	d := addr.AsSlice()
+
+	for idx := 0; node != nil; idx++ {
+		if node.terminal {
+			return true
+		}
+
+		if idx >= len(d)*8 {
+			return false
+		}
+
+		node = node.children[(d[idx/8]>>(7-idx%8))&1]
+	}
+
+	return false
+}
+
+func parseIPPrefix(s string) (netip.Prefix, error) {
+	s = strings.TrimSpace(s)
+
+	if strings.Contains(s, "/") {
+		prefix, err := netip.ParsePrefix(s)
+		if err != nil {
+			return netip.Prefix{}, err
+		}
+
+		if prefix.Addr().Is4In6() && prefix.Bits() >= 96 {
+			prefix = netip.PrefixFrom(prefix.Addr().Unmap(), prefix.Bits()-96)
+		}
+
+		return prefix.Masked(), nil
+	}
+
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+
+	addr = addr.Unmap()
+
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+type ipACLRuleSnapshot struct {
+	rule     IPACLRule
+	allow    *ipPrefixTrie
+	deny     *ipPrefixTrie
+	hasAllow bool
+}
+
+type ipACLSnapshot struct {
+	cfg   *IPACLConfig
+	rules []*ipACLRuleSnapshot
+}
+
+func newIPACLSnapshot(cfg *IPACLConfig) (*ipACLSnapshot, error) {
+	snapshot := &ipACLSnapshot{
+		cfg: cfg,
+	}
+
+	var errs []error
+
+	for idx, rule := range cfg.Rules {
+		if !utils.ValidMethodPattern(rule.Method) {
+			errs = append(errs, cuserror.NewWithErrorMsg(fmt.Sprintf("rules[%v].method: invalid method pattern %q",
+				idx, rule.Method)))
+		}
+
+		ruleSnapshot := &ipACLRuleSnapshot{
+			rule:     rule,
+			allow:    &ipPrefixTrie{},
+			deny:     &ipPrefixTrie{},
+			hasAllow: len(rule.Allow) > 0,
+		}
+
+		for _, s := range rule.Allow {
+			prefix, err := parseIPPrefix(s)
+			if err != nil {
+				errs = append(errs, cuserror.NewWithErrorMsg(fmt.Sprintf("rules[%v].allow: %v", idx, err)))
+
+				continue
+			}
+
+			ruleSnapshot.allow.insert(prefix)
+		}
+
+		for _, s := range rule.Deny {
+			prefix, err := parseIPPrefix(s)
+			if err != nil {
+				errs = append(errs, cuserror.NewWithErrorMsg(fmt.Sprintf("rules[%v].deny: %v", idx, err)))
+
+				continue
+			}
+
+			ruleSnapshot.deny.insert(prefix)
+		}
+
+		snapshot.rules = append(snapshot.rules, ruleSnapshot)
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+
+	return snapshot, nil
+}
+
+func (snapshot *ipACLSnapshot) rule(fullMethod string) *ipACLRuleSnapshot {
+	var (
+		matched  *ipACLRuleSnapshot
+		priority int
+	)
+
+	for _, rule := range snapshot.rules {
+		if p := utils.MatchMethodPattern(rule.rule.Method, fullMethod); p > priority {
+			matched, priority = rule, p
+		}
+	}
+
+	return matched
+}
+
+// check returns the reason if ip is denied.
+func (rule *ipACLRuleSnapshot) check(ip string) (reason string, allowed bool) {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return "unknown client ip", false
+	}
+
+	addr = addr.Unmap().WithZone("")
+
+	if rule.deny.contains(addr) {
+		return "denied", false
+	}
+
+	if rule.hasAllow && !rule.allow.contains(addr) {
+		return "not allowed", false
+	}
+
+	return "", true
+}
+
+// IPACLManager keeps the IPACLConfig in an atomically swapped snapshot like RuntimeConfigManager.
+type IPACLManager struct {
+	logger l.Wrapper
+
+	updateLock sync.Mutex
+	snapshot   atomic.Pointer[ipACLSnapshot]
+}
+
+func NewIPACLManager(cfg *IPACLConfig, logger l.Wrapper) (*IPACLManager, error) {
+	if logger == nil {
+		logger = l.NewNopLoggerWrapper()
+	}
+
+	if cfg == nil {
+		cfg = &IPACLConfig{}
+	}
+
+	snapshot, err := newIPACLSnapshot(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &IPACLManager{
+		logger: logger.WithFields(l.StringField(l.ClsKey, "IPACLManager")),
+	}
+
+	m.snapshot.Store(snapshot)
+
+	return m, nil
+}
+
+// Update replaces the rules, the current rules are kept if cfg is invalid.
+func (m *IPACLManager) Update(cfg *IPACLConfig, source string) error {
+	if cfg == nil {
+		return commerr.ErrInvalidArgument
+	}
+
+	snapshot, err := newIPACLSnapshot(cfg)
+	if err != nil {
+		return err
+	}
+
+	m.updateLock.Lock()
+	defer m.updateLock.Unlock()
+
+	if reflect.DeepEqual(m.snapshot.Load().cfg, cfg) {
+		return nil
+	}
+
+	m.snapshot.Store(snapshot)
+
+	m.logger.WithFields(l.StringField("source", source), l.IntField("rules", len(cfg.Rules))).Info("ipACLUpdated")
+
+	return nil
+}
+
+func (m *IPACLManager) LoadFile(file string) error {
+	cfg := &IPACLConfig{}
+
+	if err := loadConfigFile(file, cfg); err != nil {
+		return err
+	}
+
+	return m.Update(cfg, file)
+}
+
+// WatchFile reloads the file when its modification time changes, until ctx is done.
+func (m *IPACLManager) WatchFile(ctx context.Context, file string, interval time.Duration) {
+	if interval <= 0 {
+		interval = defaultRuntimeConfigWatchInterval
+	}
+
+	utils.WatchFile(ctx, file, interval, func() error {
+		return m.LoadFile(file)
+	}, m.logger)
+}
+
+// Check returns PERMISSION_DENIED if the client of ctx isn't allowed to call fullMethod, the denials are logged.
+func (m *IPACLManager) Check(ctx context.Context, fullMethod string) error {
+	rule := m.snapshot.Load().rule(fullMethod)
+	if rule == nil {
+		return nil
+	}
+
+	ip := ipACLClientIP(ctx)
+
+	reason, allowed := rule.check(ip)
+	if allowed {
+		return nil
+	}
+
+	m.logger.WithFields(l.StringField("method", fullMethod), l.StringField("ip", ip),
+		l.StringField("rule", rule.rule.Method), l.StringField("reason", reason)).Warn("ipACLDenied")
+
+	return status.Errorf(codes.PermissionDenied, "ip %v is not allowed to call %v", ip, fullMethod)
+}
+
+// ipACLClientIP the ip of grpce.RealIPResolver if it's resolved, otherwise the peer address.
+func ipACLClientIP(ctx context.Context) string {
+	if ip, ok := grpce.RealIPFromContext(ctx); ok {
+		return ip
+	}
+
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+
+	return host
+}
+
+func (m *IPACLManager) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (
+		interface{}, error) {
+		if err := m.Check(ctx, info.FullMethod); err != nil {
+			return nil, err
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+func (m *IPACLManager) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := m.Check(ss.Context(), info.FullMethod); err != nil {
+			return err
+		}
+
+		return handler(srv, ss)
+	}
+}
@@ -0,0 +1,114 @@
+package servicetoolset
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sgostarter/libservicetoolset/grpce"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+func TestIPPrefixTrie(t *testing.T) {
+	trie := &ipPrefixTrie{}
+
+	for idx := 0; idx < 4096; idx++ {
+		trie.insert(netip.MustParsePrefix(fmt.Sprintf("10.%d.%d.0/24", idx/256, idx%256)))
+	}
+
+	trie.insert(netip.MustParsePrefix("2001:db8::/32"))
+	trie.insert(netip.MustParsePrefix("192.168.1.1/32"))
+
+	assert.True(t, trie.contains(netip.MustParseAddr("10.15.255.1")))
+	assert.False(t, trie.contains(netip.MustParseAddr("10.16.0.1")))
+	assert.True(t, trie.contains(netip.MustParseAddr("2001:db8::1")))
+	assert.False(t, trie.contains(netip.MustParseAddr("2001:db9::1")))
+	assert.True(t, trie.contains(netip.MustParseAddr("192.168.1.1")))
+	assert.False(t, trie.contains(netip.MustParseAddr("192.168.1.2")))
+
+	trie.insert(netip.MustParsePrefix("0.0.0.0/0"))
+	assert.True(t, trie.contains(netip.MustParseAddr("8.8.8.8")))
+	assert.False(t, trie.contains(netip.MustParseAddr("::2")))
+}
+
+func ipACLTestContext(ip string) context.Context {
+	return peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP(ip), Port: 1234}})
+}
+
+func TestIPACLManager(t *testing.T) {
+	m, err := NewIPACLManager(&IPACLConfig{
+		Rules: []IPACLRule{
+			{Method: "/pkg.Internal/*", Allow: []string{"10.0.0.0/8", "::1"}, Deny: []string{"10.0.0.1"}},
+			{Method: "/pkg.Internal/Public"},
+			{Method: "*", Deny: []string{"6.6.6.0/24"}},
+		},
+	}, nil)
+	assert.Nil(t, err)
+
+	interceptor := m.UnaryServerInterceptor()
+	handler := func(_ context.Context, _ interface{}) (interface{}, error) {
+		return "ok", nil
+	}
+
+	fnCall := func(ip, method string) codes.Code {
+		_, err := interceptor(ipACLTestContext(ip), nil, &grpc.UnaryServerInfo{FullMethod: method}, handler)
+
+		return status.Code(err)
+	}
+
+	assert.Equal(t, codes.OK, fnCall("10.1.2.3", "/pkg.Internal/A"))
+	assert.Equal(t, codes.OK, fnCall("::1", "/pkg.Internal/A"))
+	assert.Equal(t, codes.PermissionDenied, fnCall("10.0.0.1", "/pkg.Internal/A"))
+	assert.Equal(t, codes.PermissionDenied, fnCall("1.1.1.1", "/pkg.Internal/A"))
+	assert.Equal(t, codes.OK, fnCall("1.1.1.1", "/pkg.Internal/Public"))
+	assert.Equal(t, codes.OK, fnCall("6.6.6.6", "/pkg.Internal/Public"), "only the most specific rule is applied")
+	assert.Equal(t, codes.PermissionDenied, fnCall("6.6.6.6", "/pkg.Other/A"))
+	assert.Equal(t, codes.OK, fnCall("::ffff:1.1.1.1", "/pkg.Other/A"))
+
+	file := filepath.Join(t.TempDir(), "ip_acl.yaml")
+	assert.Nil(t, os.WriteFile(file, []byte("rules:\n  - method: \"*\"\n    allow: [\"1.1.1.1\"]\n"), 0600))
+	assert.Nil(t, m.LoadFile(file))
+
+	assert.Equal(t, codes.PermissionDenied, fnCall("10.1.2.3", "/pkg.Internal/A"))
+	assert.Equal(t, codes.OK, fnCall("1.1.1.1", "/pkg.Internal/A"))
+
+	assert.Nil(t, os.WriteFile(file, []byte("rules:\n  - method: \"*\"\n    allow: [\"x\"]\n"), 0600))
+	assert.NotNil(t, m.LoadFile(file))
+	assert.Equal(t, codes.OK, fnCall("1.1.1.1", "/pkg.Internal/A"), "the invalid rules are not applied")
+
+	_, err = NewIPACLManager(&IPACLConfig{Rules: []IPACLRule{{Method: "pkg"}}}, nil)
+	assert.NotNil(t, err)
+}
+
+func TestIPACLManagerSpoofedHeaders(t *testing.T) {
+	m, err := NewIPACLManager(&IPACLConfig{
+		Rules: []IPACLRule{
+			{Method: "/pkg.Internal/*", Allow: []string{"10.0.0.0/8"}},
+			{Method: "*", Deny: []string{"6.6.6.6"}},
+		},
+	}, nil)
+	assert.Nil(t, err)
+
+	for _, key := range []string{"x-forwarded-for", "x-real-ip"} {
+		// the headers don't get into the allowlist
+		ctx := metadata.NewIncomingContext(ipACLTestContext("1.1.1.1"), metadata.Pairs(key, "10.0.0.1"))
+		assert.Equal(t, codes.PermissionDenied, status.Code(m.Check(ctx, "/pkg.Internal/A")), key)
+
+		// nor get past the denylist
+		ctx = metadata.NewIncomingContext(ipACLTestContext("6.6.6.6"), metadata.Pairs(key, "1.1.1.1"))
+		assert.Equal(t, codes.PermissionDenied, status.Code(m.Check(ctx, "/pkg.Other/A")), key)
+	}
+
+	// the ip resolved with the trusted proxies is used
+	ctx := grpce.WithRealIP(ipACLTestContext("1.1.1.1"), "10.0.0.1")
+	assert.Nil(t, m.Check(ctx, "/pkg.Internal/A"))
+}
@@ -0,0 +1,1041 @@
+package servicetoolset
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/sgostarter/i/commerr"
+	"github.com/sgostarter/i/l"
+	"github.com/sgostarter/libservicetoolset/grpce/meta"
+	"go.uber.org/atomic"
+	"golang.org/x/net/http2"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+const (
+	// httpRuleExtensionNumber the field number of the google.api.http extension of google.protobuf.MethodOptions
+	httpRuleExtensionNumber = 72295728
+
+	jsonTranscodingMaxRequestBody = 4 * 1024 * 1024
+
+	// inProcessCallerMetadataKey identifies the http request of an in-process call, see inProcessConn
+	inProcessCallerMetadataKey = "ymi-in-process-caller"
+)
+
+type JSONTranscodingConfig struct {
+	// PathPrefix is stripped before routing, e.g. /api
+	PathPrefix      string `yaml:"path_prefix" json:"path_prefix"`
+	EmitUnpopulated bool   `yaml:"emit_unpopulated" json:"emit_unpopulated"`
+	UseProtoNames   bool   `yaml:"use_proto_names" json:"use_proto_names"`
+	DiscardUnknown  bool   `yaml:"discard_unknown" json:"discard_unknown"`
+	// ForwardHeaders the http headers forwarded as grpc metadata, besides Authorization, the request id and the
+	// Grpc-Metadata- prefixed ones
+	ForwardHeaders []string `yaml:"forward_headers" json:"forward_headers"`
+}
+
+type JSONTranscodingHandlerInputParameters struct {
+	// GRPCServer the services must be registered before creating the handler
+	GRPCServer *grpc.Server
+	Config     JSONTranscodingConfig
+	Logger     l.Wrapper
+}
+
+// JSONTranscodingHandler serves the services registered on a grpc server as JSON over HTTP, no generated code needed:
+//
+//	POST /package.Service/Method with the request as the JSON body
+//	the routes of the google.api.http annotations, if present
+//
+// The descriptors are resolved from protoregistry.GlobalFiles, which is also what reflection.Register serves.
+// The methods are invoked in-process through the interceptors of the server, with the peer address and the TLS
+// state of the http request, the transport credentials of the grpc server don't apply. Server streaming
+// responses are written as newline-delimited JSON. The request bodies over 4MB are responded with 413.
+type JSONTranscodingHandler struct {
+	cfg    JSONTranscodingConfig
+	logger l.Wrapper
+
+	conn *inProcessConn
+
+	directRoutes map[string]*jsonTranscodingRoute
+	ruleRoutes   []*jsonTranscodingRoute
+
+	marshalOptions   protojson.MarshalOptions
+	unmarshalOptions protojson.UnmarshalOptions
+}
+
+type jsonTranscodingRoute struct {
+	method     protoreflect.MethodDescriptor
+	fullMethod string
+
+	httpMethod   string
+	template     *httpPathTemplate
+	body         string
+	responseBody string
+}
+
+func NewJSONTranscodingHandler(parameters JSONTranscodingHandlerInputParameters) (*JSONTranscodingHandler, error) {
+	if parameters.GRPCServer == nil {
+		return nil, commerr.ErrInvalidArgument
+	}
+
+	logger := parameters.Logger
+	if logger == nil {
+		logger = l.NewNopLoggerWrapper()
+	}
+
+	h := &JSONTranscodingHandler{
+		cfg:          parameters.Config,
+		logger:       logger.WithFields(l.StringField(l.ClsKey, "JSONTranscodingHandler")),
+		directRoutes: make(map[string]*jsonTranscodingRoute),
+		marshalOptions: protojson.MarshalOptions{
+			EmitUnpopulated: parameters.Config.EmitUnpopulated,
+			UseProtoNames:   parameters.Config.UseProtoNames,
+		},
+		unmarshalOptions: protojson.UnmarshalOptions{
+			DiscardUnknown: parameters.Config.DiscardUnknown,
+		},
+	}
+
+	for _, sd := range serviceDescriptors(parameters.GRPCServer, h.logger) {
+		if err := h.addService(sd); err != nil {
+			return nil, err
+		}
+	}
+
+	conn, err := newInProcessConn(parameters.GRPCServer)
+	if err != nil {
+		return nil, err
+	}
+
+	h.conn = conn
+
+	return h, nil
+}
+
+// Close closes the in-process connection.
+func (h *JSONTranscodingHandler) Close() error {
+	return h.conn.Close()
+}
+
+func (h *JSONTranscodingHandler) addService(sd protoreflect.ServiceDescriptor) error {
+	methods := sd.Methods()
+	for idx := 0; idx < methods.Len(); idx++ {
+		md := methods.Get(idx)
+		fullMethod := fmt.Sprintf("/%s/%s", sd.FullName(), md.Name())
+
+		h.directRoutes[fullMethod] = &jsonTranscodingRoute{
+			method:     md,
+			fullMethod: fullMethod,
+			httpMethod: http.MethodPost,
+			body:       "*",
+		}
+
+		rule, err := httpRuleOfMethod(md)
+		if err != nil {
+			return fmt.Errorf("%v: invalid google.api.http annotation: %w", fullMethod, err)
+		}
+
+		if rule == nil {
+			continue
+		}
+
+		for _, r := range append([]*httpRule{rule}, rule.additionalBindings...) {
+			template, err := parseHTTPPathTemplate(r.path)
+			if err != nil {
+				return fmt.Errorf("%v: invalid path %q: %w", fullMethod, r.path, err)
+			}
+
+			h.ruleRoutes = append(h.ruleRoutes, &jsonTranscodingRoute{
+				method:       md,
+				fullMethod:   fullMethod,
+				httpMethod:   r.method,
+				template:     template,
+				body:         r.body,
+				responseBody: r.responseBody,
+			})
+		}
+	}
+
+	return nil
+}
+
+func (h *JSONTranscodingHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := r.URL.EscapedPath()
+
+	if h.cfg.PathPrefix != "" {
+		if !strings.HasPrefix(path, h.cfg.PathPrefix) {
+			writeTranscodingError(w, h.marshalOptions, status.Error(codes.NotFound, "no route"))
+
+			return
+		}
+
+		path = strings.TrimPrefix(path, h.cfg.PathPrefix)
+	}
+
+	route, vars := h.match(r.Method, path)
+	if route == nil {
+		writeTranscodingError(w, h.marshalOptions, status.Errorf(codes.NotFound, "no route for %v %v", r.Method, path))
+
+		return
+	}
+
+	if route.method.IsStreamingClient() {
+		writeTranscodingError(w, h.marshalOptions, status.Error(codes.Unimplemented, "client streaming methods are not supported"))
+
+		return
+	}
+
+	in := dynamicpb.NewMessage(route.method.Input())
+
+	if err := h.buildRequest(w, r, route, vars, in); err != nil {
+		writeTranscodingRequestError(w, h.marshalOptions, err)
+
+		return
+	}
+
+	ctx, release := h.conn.callerContext(metadata.NewOutgoingContext(r.Context(),
+		transcodingOutgoingMetadata(r, h.cfg.ForwardHeaders)), r)
+	defer release()
+
+	if route.method.IsStreamingServer() {
+		h.serveServerStream(ctx, w, route, in)
+
+		return
+	}
+
+	out := dynamicpb.NewMessage(route.method.Output())
+
+	var header, trailer metadata.MD
+
+	err := h.conn.Invoke(ctx, route.fullMethod, in, out, grpc.Header(&header), grpc.Trailer(&trailer))
+
+	writeTranscodingMetadata(w, header, trailer)
+
+	if err != nil {
+		writeTranscodingError(w, h.marshalOptions, err)
+
+		return
+	}
+
+	d, err := h.marshalResponse(out, route.responseBody)
+	if err != nil {
+		writeTranscodingError(w, h.marshalOptions, status.Error(codes.Internal, err.Error()))
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(d)
+}
+
+func (h *JSONTranscodingHandler) serveServerStream(ctx context.Context, w http.ResponseWriter, route *jsonTranscodingRoute,
+	in proto.Message) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	stream, err := h.conn.NewStream(ctx, &grpc.StreamDesc{ServerStreams: true}, route.fullMethod)
+	if err == nil {
+		err = stream.SendMsg(in)
+	}
+
+	if err == nil {
+		err = stream.CloseSend()
+	}
+
+	var header metadata.MD
+
+	if err == nil {
+		header, err = stream.Header()
+	}
+
+	if err != nil {
+		writeTranscodingError(w, h.marshalOptions, err)
+
+		return
+	}
+
+	writeTranscodingMetadata(w, header, nil)
+	w.Header().Set("Content-Type", "application/x-ndjson")
+
+	flusher, _ := w.(http.Flusher)
+
+	for {
+		out := dynamicpb.NewMessage(route.method.Output())
+
+		err = stream.RecvMsg(out)
+		if err != nil {
+			break
+		}
+
+		d, errM := h.marshalResponse(out, route.responseBody)
+		if errM != nil {
+			err = status.Error(codes.Internal, errM.Error())
+
+			break
+		}
+
+		_, _ = w.Write(append(d, '\n'))
+
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+
+	if errors.Is(err, io.EOF) {
+		return
+	}
+
+	// the status line is sent already, the error is reported as the last line
+	d, _ := json.Marshal(map[string]json.RawMessage{"error": marshalTranscodingStatus(h.marshalOptions, status.Convert(err))})
+	_, _ = w.Write(append(d, '\n'))
+}
+
+func (h *JSONTranscodingHandler) match(method, path string) (*jsonTranscodingRoute, map[string]string) {
+	if method == http.MethodPost {
+		if route, ok := h.directRoutes[path]; ok {
+			return route, nil
+		}
+	}
+
+	for _, route := range h.ruleRoutes {
+		if route.httpMethod != method && route.httpMethod != "*" {
+			continue
+		}
+
+		if vars, ok := route.template.match(path); ok {
+			return route, vars
+		}
+	}
+
+	return nil, nil
+}
+
+func (h *JSONTranscodingHandler) buildRequest(w http.ResponseWriter, r *http.Request, route *jsonTranscodingRoute,
+	vars map[string]string, in *dynamicpb.Message) error {
+	if route.body != "" {
+		d, err := readTranscodingBody(w, r)
+		if err != nil {
+			return err
+		}
+
+		if err = h.unmarshalBody(d, route.body, in); err != nil {
+			return err
+		}
+	}
+
+	for fieldPath, value := range vars {
+		if err := setFieldByPath(in, fieldPath, value); err != nil {
+			return err
+		}
+	}
+
+	if route.body == "*" {
+		return nil
+	}
+
+	for key, values := range r.URL.Query() {
+		if _, ok := vars[key]; ok {
+			continue
+		}
+
+		for _, value := range values {
+			err := setFieldByPath(in, key, value)
+			if err == nil {
+				continue
+			}
+
+			if h.cfg.DiscardUnknown && errors.Is(err, errFieldNotFound) {
+				break
+			}
+
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (h *JSONTranscodingHandler) unmarshalBody(d []byte, body string, in *dynamicpb.Message) error {
+	if len(strings.TrimSpace(string(d))) == 0 {
+		return nil
+	}
+
+	if body == "*" {
+		return h.unmarshalOptions.Unmarshal(d, in)
+	}
+
+	fd := in.Descriptor().Fields().ByName(protoreflect.Name(body))
+	if fd == nil {
+		return fmt.Errorf("body field %v: %w", body, errFieldNotFound)
+	}
+
+	wrapped, err := json.Marshal(map[string]json.RawMessage{fd.JSONName(): d})
+	if err != nil {
+		return err
+	}
+
+	tmp := in.New().Interface()
+
+	if err = h.unmarshalOptions.Unmarshal(wrapped, tmp); err != nil {
+		return err
+	}
+
+	proto.Merge(in, tmp)
+
+	return nil
+}
+
+func (h *JSONTranscodingHandler) marshalResponse(out proto.Message, responseBody string) ([]byte, error) {
+	d, err := h.marshalOptions.Marshal(out)
+	if err != nil || responseBody == "" || responseBody == "*" {
+		return d, err
+	}
+
+	fd := out.ProtoReflect().Descriptor().Fields().ByName(protoreflect.Name(responseBody))
+	if fd == nil {
+		return nil, fmt.Errorf("response body field %v: %w", responseBody, errFieldNotFound)
+	}
+
+	name := fd.JSONName()
+	if h.cfg.UseProtoNames {
+		name = string(fd.Name())
+	}
+
+	var fields map[string]json.RawMessage
+
+	if err = json.Unmarshal(d, &fields); err != nil {
+		return nil, err
+	}
+
+	if v, ok := fields[name]; ok {
+		return v, nil
+	}
+
+	return []byte("null"), nil
+}
+
+func transcodingOutgoingMetadata(r *http.Request, forwardHeaders []string) metadata.MD {
+	md := metadata.MD{}
+
+	for key, values := range r.Header {
+		if strings.HasPrefix(key, "Grpc-Metadata-") {
+			md.Append(strings.TrimPrefix(key, "Grpc-Metadata-"), values...)
+		}
+	}
+
+	for _, key := range append([]string{"Authorization"}, forwardHeaders...) {
+		if values := r.Header.Values(key); len(values) > 0 {
+			md.Set(key, values...)
+		}
+	}
+
+	id := meta.IDFromOutgoingContext(r.Context())
+	if id == "" {
+		id = r.Header.Get(meta.RequestIDOnMetaData)
+	}
+
+	if id != "" {
+		md.Set(meta.RequestIDOnMetaData, id)
+	}
+
+	return md
+}
+
+// readTranscodingBody reads the body up to jsonTranscodingMaxRequestBody, see writeTranscodingRequestError.
+func readTranscodingBody(w http.ResponseWriter, r *http.Request) ([]byte, error) {
+	return io.ReadAll(http.MaxBytesReader(w, r.Body, jsonTranscodingMaxRequestBody))
+}
+
+// writeTranscodingRequestError the bodies over jsonTranscodingMaxRequestBody are responded with 413, the other
+// errors with 400.
+func writeTranscodingRequestError(w http.ResponseWriter, marshalOptions protojson.MarshalOptions, err error) {
+	var maxBytesErr *http.MaxBytesError
+
+	if !errors.As(err, &maxBytesErr) {
+		writeTranscodingError(w, marshalOptions, status.Error(codes.InvalidArgument, err.Error()))
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusRequestEntityTooLarge)
+	_, _ = w.Write(marshalTranscodingStatus(marshalOptions, status.Newf(codes.ResourceExhausted,
+		"request body is larger than %v bytes", maxBytesErr.Limit)))
+}
+
+func writeTranscodingMetadata(w http.ResponseWriter, header, trailer metadata.MD) {
+	for key, values := range header {
+		if strings.HasSuffix(key, "-bin") {
+			continue
+		}
+
+		for _, value := range values {
+			w.Header().Add("Grpc-Metadata-"+key, value)
+		}
+	}
+
+	for key, values := range trailer {
+		if strings.HasSuffix(key, "-bin") {
+			continue
+		}
+
+		for _, value := range values {
+			w.Header().Add("Grpc-Trailer-"+key, value)
+		}
+	}
+}
+
+func writeTranscodingError(w http.ResponseWriter, marshalOptions protojson.MarshalOptions, err error) {
+	st := status.Convert(err)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(HTTPStatusFromCode(st.Code()))
+	_, _ = w.Write(marshalTranscodingStatus(marshalOptions, st))
+}
+
+func marshalTranscodingStatus(marshalOptions protojson.MarshalOptions, st *status.Status) []byte {
+	d, err := marshalOptions.Marshal(st.Proto())
+	if err == nil {
+		return d
+	}
+
+	// the types of the details are not linked
+	d, _ = json.Marshal(map[string]interface{}{
+		"code":    st.Code(),
+		"message": st.Message(),
+	})
+
+	return d
+}
+
+// HTTPStatusFromCode maps the grpc status code to the http status code.
+func HTTPStatusFromCode(code codes.Code) int {
+	switch code {
+	case codes.OK:
+		return http.StatusOK
+	case codes.Canceled:
+		return 499
+	case codes.InvalidArgument, codes.FailedPrecondition, codes.OutOfRange:
+		return http.StatusBadRequest
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.AlreadyExists, codes.Aborted:
+		return http.StatusConflict
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.Unimplemented:
+		return http.StatusNotImplemented
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+//
+// in-process connection
+//
+
+// inProcessConn a client connection to the grpc server without network, the streams are served by
+// grpc.Server.ServeHTTP over net.Pipe.
+//
+// The transport credentials of the server don't apply: the calls made with callerContext get the peer address
+// and the TLS state of the http request, so the authorization by the client certificates sees the ones verified
+// by the http listener, and no certificate if it's plaintext. The calls without a caller are refused.
+type inProcessConn struct {
+	*grpc.ClientConn
+
+	callerSeq atomic.Uint64
+	callers   sync.Map
+	closeOnce sync.Once
+}
+
+func newInProcessConn(s *grpc.Server) (*inProcessConn, error) {
+	c := &inProcessConn{}
+
+	h2s := &http2.Server{}
+	handler := c.handler(s)
+
+	conn, err := grpc.NewClient("passthrough:///inProcess",
+		grpc.WithContextDialer(func(_ context.Context, _ string) (net.Conn, error) {
+			client, server := net.Pipe()
+
+			go h2s.ServeConn(server, &http2.ServeConnOpts{
+				Handler: handler,
+			})
+
+			return client, nil
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, err
+	}
+
+	c.ClientConn = conn
+
+	return c, nil
+}
+
+// callerContext sets r as the caller of the calls made with ctx, release should be called once they are done.
+func (c *inProcessConn) callerContext(ctx context.Context, r *http.Request) (context.Context, func()) {
+	token := strconv.FormatUint(c.callerSeq.Inc(), 10)
+
+	c.callers.Store(token, r)
+
+	md, ok := metadata.FromOutgoingContext(ctx)
+	if ok {
+		md = md.Copy()
+	} else {
+		md = metadata.New(nil)
+	}
+
+	md.Set(inProcessCallerMetadataKey, token)
+
+	return metadata.NewOutgoingContext(ctx, md), func() {
+		c.callers.Delete(token)
+	}
+}
+
+func (c *inProcessConn) handler(s *grpc.Server) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := r.Header.Get(inProcessCallerMetadataKey)
+		r.Header.Del(inProcessCallerMetadataKey)
+
+		v, ok := c.callers.Load(token)
+		if !ok {
+			http.Error(w, "unknown in-process caller", http.StatusForbidden)
+
+			return
+		}
+
+		caller, _ := v.(*http.Request)
+
+		// grpc.Server.ServeHTTP builds the peer with them
+		r.RemoteAddr = caller.RemoteAddr
+		r.TLS = caller.TLS
+
+		s.ServeHTTP(w, r)
+	})
+}
+
+func (c *inProcessConn) Close() error {
+	var err error
+
+	c.closeOnce.Do(func() {
+		err = c.ClientConn.Close()
+	})
+
+	return err
+}
+
+// serviceDescriptors the descriptors of the services registered on s, resolved from protoregistry.GlobalFiles.
+func serviceDescriptors(s *grpc.Server, logger l.Wrapper) []protoreflect.ServiceDescriptor {
+	sds := make([]protoreflect.ServiceDescriptor, 0, len(s.GetServiceInfo()))
+
+	for serviceName := range s.GetServiceInfo() {
+		d, err := protoregistry.GlobalFiles.FindDescriptorByName(protoreflect.FullName(serviceName))
+		if err != nil {
+			logger.WithFields(l.StringField("service", serviceName), l.ErrorField(err)).Warn("serviceDescriptorNotFound")
+
+			continue
+		}
+
+		if sd, ok := d.(protoreflect.ServiceDescriptor); ok {
+			sds = append(sds, sd)
+		}
+	}
+
+	return sds
+}
+
+//
+// fields
+//
+
+var errFieldNotFound = errors.New("field not found")
+
+// setFieldByPath sets the scalar (or repeated scalar, appended) field of the dot separated path from a string.
+func setFieldByPath(msg protoreflect.Message, fieldPath, value string) error {
+	names := strings.Split(fieldPath, ".")
+
+	for idx, name := range names {
+		fields := msg.Descriptor().Fields()
+
+		fd := fields.ByName(protoreflect.Name(name))
+		if fd == nil {
+			fd = fields.ByJSONName(name)
+		}
+
+		if fd == nil {
+			return fmt.Errorf("%v: %w", fieldPath, errFieldNotFound)
+		}
+
+		if idx < len(names)-1 {
+			if fd.Kind() != protoreflect.MessageKind || fd.IsList() || fd.IsMap() {
+				return fmt.Errorf("%v: %v is not a message", fieldPath, name)
+			}
+
+			msg = msg.Mutable(fd).Message()
+
+			continue
+		}
+
+		if fd.IsMap() || fd.Kind() == protoreflect.MessageKind || fd.Kind() == protoreflect.GroupKind {
+			return fmt.Errorf("%v: only the scalar fields can be set from the path or query", fieldPath)
+		}
+
+		v, err := parseScalarField(fd, value)
+		if err != nil {
+			return fmt.Errorf("%v: %w", fieldPath, err)
+		}
+
+		if fd.IsList() {
+			msg.Mutable(fd).List().Append(v)
+		} else {
+			msg.Set(fd, v)
+		}
+	}
+
+	return nil
+}
+
+// nolint: cyclop
+func parseScalarField(fd protoreflect.FieldDescriptor, value string) (protoreflect.Value, error) {
+	switch fd.Kind() {
+	case protoreflect.StringKind:
+		return protoreflect.ValueOfString(value), nil
+	case protoreflect.BytesKind:
+		return protoreflect.ValueOfBytes([]byte(value)), nil
+	case protoreflect.BoolKind:
+		v, err := strconv.ParseBool(value)
+
+		return protoreflect.ValueOfBool(v), err
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		v, err := strconv.ParseInt(value, 10, 32)
+
+		return protoreflect.ValueOfInt32(int32(v)), err
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		v, err := strconv.ParseInt(value, 10, 64)
+
+		return protoreflect.ValueOfInt64(v), err
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		v, err := strconv.ParseUint(value, 10, 32)
+
+		return protoreflect.ValueOfUint32(uint32(v)), err
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		v, err := strconv.ParseUint(value, 10, 64)
+
+		return protoreflect.ValueOfUint64(v), err
+	case protoreflect.FloatKind:
+		v, err := strconv.ParseFloat(value, 32)
+
+		return protoreflect.ValueOfFloat32(float32(v)), err
+	case protoreflect.DoubleKind:
+		v, err := strconv.ParseFloat(value, 64)
+
+		return protoreflect.ValueOfFloat64(v), err
+	case protoreflect.EnumKind:
+		if ev := fd.Enum().Values().ByName(protoreflect.Name(value)); ev != nil {
+			return protoreflect.ValueOfEnum(ev.Number()), nil
+		}
+
+		v, err := strconv.ParseInt(value, 10, 32)
+
+		return protoreflect.ValueOfEnum(protoreflect.EnumNumber(v)), err
+	default:
+		return protoreflect.Value{}, fmt.Errorf("unsupported kind %v", fd.Kind())
+	}
+}
+
+//
+// google.api.http
+//
+
+type httpRule struct {
+	method             string
+	path               string
+	body               string
+	responseBody       string
+	additionalBindings []*httpRule
+}
+
+// httpRuleOfMethod the extension is read from the wire format of the options, so it works whether or not
+// google.golang.org/genproto/googleapis/api/annotations is linked.
+func httpRuleOfMethod(md protoreflect.MethodDescriptor) (*httpRule, error) {
+	options := md.Options()
+	if options == nil || !options.ProtoReflect().IsValid() {
+		return nil, nil
+	}
+
+	d, err := proto.Marshal(options)
+	if err != nil {
+		return nil, err
+	}
+
+	var rule *httpRule
+
+	err = walkProtoWire(d, func(num protowire.Number, typ protowire.Type, v []byte) error {
+		if num != httpRuleExtensionNumber || typ != protowire.BytesType {
+			return nil
+		}
+
+		var errP error
+
+		rule, errP = parseHTTPRule(v)
+
+		return errP
+	})
+
+	return rule, err
+}
+
+// parseHTTPRule parses the wire format of google.api.HttpRule.
+func parseHTTPRule(d []byte) (*httpRule, error) {
+	rule := &httpRule{}
+
+	err := walkProtoWire(d, func(num protowire.Number, typ protowire.Type, v []byte) error {
+		if typ != protowire.BytesType {
+			return nil
+		}
+
+		switch num {
+		case 2:
+			rule.method, rule.path = http.MethodGet, string(v)
+		case 3:
+			rule.method, rule.path = http.MethodPut, string(v)
+		case 4:
+			rule.method, rule.path = http.MethodPost, string(v)
+		case 5:
+			rule.method, rule.path = http.MethodDelete, string(v)
+		case 6:
+			rule.method, rule.path = http.MethodPatch, string(v)
+		case 7:
+			rule.body = string(v)
+		case 8: // CustomHttpPattern
+			return walkProtoWire(v, func(num protowire.Number, _ protowire.Type, v []byte) error {
+				switch num {
+				case 1:
+					rule.method = string(v)
+				case 2:
+					rule.path = string(v)
+				}
+
+				return nil
+			})
+		case 11:
+			binding, err := parseHTTPRule(v)
+			if err != nil {
+				return err
+			}
+
+			rule.additionalBindings = append(rule.additionalBindings, binding)
+		case 12:
+			rule.responseBody = string(v)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if rule.path == "" {
+		return nil, errors.New("no pattern")
+	}
+
+	return rule, nil
+}
+
+// walkProtoWire calls fn with the value of every length-delimited field, and nil for the others.
+func walkProtoWire(d []byte, fn func(num protowire.Number, typ protowire.Type, v []byte) error) error {
+	for len(d) > 0 {
+		num, typ, n := protowire.ConsumeTag(d)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+
+		d = d[n:]
+
+		var v []byte
+
+		if typ == protowire.BytesType {
+			v, n = protowire.ConsumeBytes(d)
+		} else {
+			n = protowire.ConsumeFieldValue(num, typ, d)
+		}
+
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+
+		d = d[n:]
+
+		if err := fn(num, typ, v); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+//
+// path template
+//
+
+type httpPathTemplate struct {
+	// segments literal, "*" or "**"
+	segments  []string
+	variables []httpPathVariable
+	verb      string
+}
+
+type httpPathVariable struct {
+	fieldPath string
+	start     int
+	// end -1 means to the end of the path
+	end int
+}
+
+// parseHTTPPathTemplate parses the path templates of google.api.http, e.g. /v1/{name=shelves/*/books/*}:get.
+func parseHTTPPathTemplate(path string) (*httpPathTemplate, error) {
+	if !strings.HasPrefix(path, "/") {
+		return nil, errors.New("should start with /")
+	}
+
+	t := &httpPathTemplate{}
+
+	path = path[1:]
+
+	if idx := strings.LastIndex(path, ":"); idx >= 0 && !strings.Contains(path[idx:], "/") && !strings.Contains(path[idx:], "}") {
+		path, t.verb = path[:idx], path[idx+1:]
+	}
+
+	for len(path) > 0 {
+		if path[0] != '{' {
+			idx := strings.Index(path, "/")
+			if idx < 0 {
+				idx = len(path)
+			}
+
+			t.segments = append(t.segments, path[:idx])
+			path = strings.TrimPrefix(path[idx:], "/")
+
+			continue
+		}
+
+		idx := strings.Index(path, "}")
+		if idx < 0 {
+			return nil, errors.New("unclosed variable")
+		}
+
+		fieldPath, pattern, _ := strings.Cut(path[1:idx], "=")
+		if pattern == "" {
+			pattern = "*"
+		}
+
+		variable := httpPathVariable{
+			fieldPath: fieldPath,
+			start:     len(t.segments),
+		}
+
+		t.segments = append(t.segments, strings.Split(pattern, "/")...)
+		variable.end = len(t.segments)
+
+		if t.segments[len(t.segments)-1] == "**" {
+			variable.end = -1
+		}
+
+		t.variables = append(t.variables, variable)
+		path = strings.TrimPrefix(path[idx+1:], "/")
+	}
+
+	for idx, segment := range t.segments {
+		if segment == "**" && idx != len(t.segments)-1 {
+			return nil, errors.New("** should be the last segment")
+		}
+	}
+
+	return t, nil
+}
+
+// match path is the escaped path.
+func (t *httpPathTemplate) match(path string) (map[string]string, bool) {
+	if !strings.HasPrefix(path, "/") {
+		return nil, false
+	}
+
+	path = path[1:]
+
+	if t.verb != "" {
+		if !strings.HasSuffix(path, ":"+t.verb) {
+			return nil, false
+		}
+
+		path = strings.TrimSuffix(path, ":"+t.verb)
+	}
+
+	var segments []string
+	if path != "" {
+		segments = strings.Split(path, "/")
+	}
+
+	if n := len(t.segments); n > 0 && t.segments[n-1] == "**" {
+		if len(segments) < n-1 {
+			return nil, false
+		}
+	} else if len(segments) != n {
+		return nil, false
+	}
+
+	for idx, segment := range t.segments {
+		if segment == "**" {
+			break
+		}
+
+		if segment != "*" && segment != segments[idx] {
+			return nil, false
+		}
+	}
+
+	vars := make(map[string]string, len(t.variables))
+
+	for _, variable := range t.variables {
+		end := variable.end
+		if end < 0 {
+			end = len(segments)
+		}
+
+		value, err := url.PathUnescape(strings.Join(segments[variable.start:end], "/"))
+		if err != nil {
+			return nil, false
+		}
+
+		vars[variable.fieldPath] = value
+	}
+
+	return vars, true
+}
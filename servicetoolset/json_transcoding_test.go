@@ -0,0 +1,264 @@
+package servicetoolset
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/sgostarter/libservicetoolset/grpce"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/examples/helloworld/helloworld"
+	"google.golang.org/grpc/examples/route_guide/routeguide"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+type testGreeterServer struct {
+	helloworld.UnimplementedGreeterServer
+
+	peers chan *peer.Peer
+}
+
+func (s *testGreeterServer) SayHello(ctx context.Context, req *helloworld.HelloRequest) (*helloworld.HelloReply, error) {
+	if req.GetName() == "" {
+		return nil, status.Error(codes.InvalidArgument, "no name")
+	}
+
+	if req.GetName() == "panic" {
+		panic("handler")
+	}
+
+	if code, ok := strings.CutPrefix(req.GetName(), "code:"); ok {
+		n, _ := strconv.Atoi(code)
+
+		return nil, status.Error(codes.Code(n), "failed")
+	}
+
+	if s.peers != nil {
+		p, _ := peer.FromContext(ctx)
+		s.peers <- p
+	}
+
+	return &helloworld.HelloReply{Message: "hello " + req.GetName() + " from " + grpce.GrpcGetRealIP(ctx)}, nil
+}
+
+type testRouteGuideServer struct {
+	routeguide.UnimplementedRouteGuideServer
+}
+
+func (s *testRouteGuideServer) ListFeatures(_ *routeguide.Rectangle, stream grpc.ServerStreamingServer[routeguide.Feature]) error {
+	for _, name := range []string{"a", "b"} {
+		if err := stream.Send(&routeguide.Feature{Name: name}); err != nil {
+			return err
+		}
+	}
+
+	return status.Error(codes.Aborted, "done")
+}
+
+func newTestJSONTranscodingHandler(t *testing.T) *JSONTranscodingHandler {
+	var intercepted bool
+
+	s := grpc.NewServer(grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler) (interface{}, error) {
+		intercepted = true
+
+		return handler(ctx, req)
+	}), grpc.StreamInterceptor(func(srv interface{}, ss grpc.ServerStream, _ *grpc.StreamServerInfo,
+		handler grpc.StreamHandler) error {
+		intercepted = true
+
+		return handler(srv, ss)
+	}))
+	helloworld.RegisterGreeterServer(s, &testGreeterServer{})
+	routeguide.RegisterRouteGuideServer(s, &testRouteGuideServer{})
+
+	h, err := NewJSONTranscodingHandler(JSONTranscodingHandlerInputParameters{
+		GRPCServer: s,
+	})
+	assert.Nil(t, err)
+
+	t.Cleanup(func() {
+		assert.True(t, intercepted)
+
+		_ = h.Close()
+		s.Stop()
+	})
+
+	return h
+}
+
+func TestJSONTranscodingUnary(t *testing.T) {
+	h := newTestJSONTranscodingHandler(t)
+
+	req := httptest.NewRequest(http.MethodPost, "/helloworld.Greeter/SayHello", strings.NewReader(`{"name":"x"}`))
+	req.RemoteAddr = "10.0.0.1:1234"
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"message":"hello x from 10.0.0.1"}`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/helloworld.Greeter/SayHello", strings.NewReader(`{}`)))
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.JSONEq(t, `{"code":3,"message":"no name"}`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/helloworld.Greeter/SayHello", strings.NewReader(`{"x":1}`)))
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/helloworld.Greeter/SayHello", nil))
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestJSONTranscodingHTTPServer(t *testing.T) {
+	s := grpc.NewServer()
+	svr := &testGreeterServer{peers: make(chan *peer.Peer, 1)}
+	helloworld.RegisterGreeterServer(s, svr)
+
+	h, err := NewJSONTranscodingHandler(JSONTranscodingHandlerInputParameters{
+		GRPCServer: s,
+	})
+	assert.Nil(t, err)
+
+	defer func() {
+		_ = h.Close()
+		s.Stop()
+	}()
+
+	hs := httptest.NewTLSServer(h)
+	defer hs.Close()
+
+	fnPost := func(body string) (int, string) {
+		resp, err := hs.Client().Post(hs.URL+"/helloworld.Greeter/SayHello", "application/json", strings.NewReader(body))
+		assert.Nil(t, err)
+
+		defer func() {
+			_ = resp.Body.Close()
+		}()
+
+		d, err := io.ReadAll(resp.Body)
+		assert.Nil(t, err)
+
+		return resp.StatusCode, string(d)
+	}
+
+	code, body := fnPost(`{"name":"x"}`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Contains(t, body, `"message":"hello x from 127.0.0.1"`)
+
+	// the peer and the TLS state of the http request
+	p := <-svr.peers
+	assert.Contains(t, p.Addr.String(), "127.0.0.1:")
+
+	tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo)
+	assert.True(t, ok)
+	assert.True(t, tlsInfo.State.HandshakeComplete)
+
+	for grpcCode, httpCode := range map[codes.Code]int{
+		codes.InvalidArgument:   http.StatusBadRequest,
+		codes.NotFound:          http.StatusNotFound,
+		codes.PermissionDenied:  http.StatusForbidden,
+		codes.Unauthenticated:   http.StatusUnauthorized,
+		codes.ResourceExhausted: http.StatusTooManyRequests,
+		codes.Unavailable:       http.StatusServiceUnavailable,
+		codes.Internal:          http.StatusInternalServerError,
+	} {
+		code, body = fnPost(fmt.Sprintf(`{"name":"code:%d"}`, grpcCode))
+		assert.Equal(t, httpCode, code, grpcCode.String())
+		assert.JSONEq(t, fmt.Sprintf(`{"code":%d,"message":"failed"}`, grpcCode), body)
+	}
+
+	code, body = fnPost(`{"name":"` + strings.Repeat("x", jsonTranscodingMaxRequestBody) + `"}`)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, code)
+	assert.Contains(t, body, fmt.Sprintf(`"code":%d`, codes.ResourceExhausted))
+}
+
+func TestJSONTranscodingServerStream(t *testing.T) {
+	h := newTestJSONTranscodingHandler(t)
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/routeguide.RouteGuide/ListFeatures", strings.NewReader(`{}`)))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/x-ndjson", w.Header().Get("Content-Type"))
+
+	var lines []map[string]interface{}
+
+	scanner := bufio.NewScanner(w.Body)
+	for scanner.Scan() {
+		var line map[string]interface{}
+
+		assert.Nil(t, json.Unmarshal(scanner.Bytes(), &line))
+
+		lines = append(lines, line)
+	}
+
+	assert.Equal(t, 3, len(lines))
+	assert.Equal(t, "a", lines[0]["name"])
+	assert.Equal(t, "b", lines[1]["name"])
+	assert.EqualValues(t, codes.Aborted, lines[2]["error"].(map[string]interface{})["code"])
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/routeguide.RouteGuide/RecordRoute", strings.NewReader(`{}`)))
+
+	assert.Equal(t, http.StatusNotImplemented, w.Code)
+}
+
+func TestParseHTTPRule(t *testing.T) {
+	var binding []byte
+	binding = protowire.AppendTag(binding, 2, protowire.BytesType)
+	binding = protowire.AppendString(binding, "/v1/users/{user_id}/items")
+
+	var d []byte
+	d = protowire.AppendTag(d, 4, protowire.BytesType)
+	d = protowire.AppendString(d, "/v1/{name=shelves/*/books/*}:publish")
+	d = protowire.AppendTag(d, 7, protowire.BytesType)
+	d = protowire.AppendString(d, "*")
+	d = protowire.AppendTag(d, 11, protowire.BytesType)
+	d = protowire.AppendBytes(d, binding)
+
+	rule, err := parseHTTPRule(d)
+	assert.Nil(t, err)
+	assert.Equal(t, http.MethodPost, rule.method)
+	assert.Equal(t, "*", rule.body)
+	assert.Equal(t, 1, len(rule.additionalBindings))
+	assert.Equal(t, http.MethodGet, rule.additionalBindings[0].method)
+
+	template, err := parseHTTPPathTemplate(rule.path)
+	assert.Nil(t, err)
+
+	vars, ok := template.match("/v1/shelves/s1/books/b%201:publish")
+	assert.True(t, ok)
+	assert.Equal(t, map[string]string{"name": "shelves/s1/books/b 1"}, vars)
+
+	_, ok = template.match("/v1/shelves/s1/books/b1")
+	assert.False(t, ok)
+
+	_, ok = template.match("/v1/shelves/s1/books:publish")
+	assert.False(t, ok)
+
+	template, err = parseHTTPPathTemplate("/v1/{path=files/**}")
+	assert.Nil(t, err)
+
+	vars, ok = template.match("/v1/files/a/b/c")
+	assert.True(t, ok)
+	assert.Equal(t, "files/a/b/c", vars["path"])
+}
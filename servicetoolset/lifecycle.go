@@ -0,0 +1,207 @@
+package servicetoolset
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/sgostarter/i/commerr"
+	"github.com/sgostarter/i/l"
+	"github.com/sgostarter/libeasygo/cuserror"
+)
+
+// Lifecycle is implemented by components which need to prepare resources before the servers
+// start serving (e.g. db pools) and release them after the servers stopped (e.g. flush queues).
+//
+// ctx of the hooks is canceled when the StartTimeout/StopTimeout of the component expires or the hook is
+// abandoned, the hooks must return once ctx is done: a hook which ignores ctx keeps its goroutine running after
+// the timeout was reported.
+type Lifecycle interface {
+	OnStart(ctx context.Context) error
+	OnStop(ctx context.Context) error
+}
+
+type LifecycleFuncs struct {
+	OnStartFunc func(ctx context.Context) error
+	OnStopFunc  func(ctx context.Context) error
+}
+
+func (fns LifecycleFuncs) OnStart(ctx context.Context) error {
+	if fns.OnStartFunc == nil {
+		return nil
+	}
+
+	return fns.OnStartFunc(ctx)
+}
+
+func (fns LifecycleFuncs) OnStop(ctx context.Context) error {
+	if fns.OnStopFunc == nil {
+		return nil
+	}
+
+	return fns.OnStopFunc(ctx)
+}
+
+type ComponentConfig struct {
+	Name      string
+	Lifecycle Lifecycle
+	// DependsOn names of components which must be started before this one, and stopped after it
+	DependsOn []string
+
+	StartTimeout time.Duration
+	StopTimeout  time.Duration
+}
+
+type lifecycleManager struct {
+	logger     l.Wrapper
+	components []*ComponentConfig
+	started    []*ComponentConfig
+}
+
+func newLifecycleManager(logger l.Wrapper) *lifecycleManager {
+	if logger == nil {
+		logger = l.NewNopLoggerWrapper()
+	}
+
+	return &lifecycleManager{
+		logger: logger.WithFields(l.StringField(l.ClsKey, "lifecycleManager")),
+	}
+}
+
+func (m *lifecycleManager) Register(cfg *ComponentConfig) error {
+	if cfg == nil || cfg.Name == "" || cfg.Lifecycle == nil {
+		return commerr.ErrInvalidArgument
+	}
+
+	for _, component := range m.components {
+		if component.Name == cfg.Name {
+			return commerr.ErrAlreadyExists
+		}
+	}
+
+	m.components = append(m.components, cfg)
+
+	return nil
+}
+
+// StartOrder resolves the declared dependencies into a start order, registration order is kept
+// between components which don't depend on each other.
+func (m *lifecycleManager) StartOrder() ([]*ComponentConfig, error) {
+	indexes := make(map[string]int, len(m.components))
+	for idx, component := range m.components {
+		indexes[component.Name] = idx
+	}
+
+	inDegrees := make([]int, len(m.components))
+	dependents := make([][]int, len(m.components))
+
+	for idx, component := range m.components {
+		for _, dep := range component.DependsOn {
+			depIdx, ok := indexes[dep]
+			if !ok {
+				return nil, cuserror.NewWithErrorMsg(fmt.Sprintf("component %v depends on unknown component %v",
+					component.Name, dep))
+			}
+
+			inDegrees[idx]++
+			dependents[depIdx] = append(dependents[depIdx], idx)
+		}
+	}
+
+	order := make([]*ComponentConfig, 0, len(m.components))
+	done := make([]bool, len(m.components))
+
+	for len(order) < len(m.components) {
+		next := -1
+
+		for idx := range m.components {
+			if !done[idx] && inDegrees[idx] == 0 {
+				next = idx
+
+				break
+			}
+		}
+
+		if next == -1 {
+			return nil, cuserror.NewWithErrorMsg("components have cyclic dependencies")
+		}
+
+		done[next] = true
+		order = append(order, m.components[next])
+
+		for _, idx := range dependents[next] {
+			inDegrees[idx]--
+		}
+	}
+
+	return order, nil
+}
+
+// Start calls OnStart on all the components in dependency order, components already started
+// are stopped in reverse order if one of them fails.
+func (m *lifecycleManager) Start(ctx context.Context) error {
+	order, err := m.StartOrder()
+	if err != nil {
+		return err
+	}
+
+	for _, component := range order {
+		err = m.callHook(ctx, component.Name, "OnStart", component.StartTimeout, component.Lifecycle.OnStart)
+		if err != nil {
+			m.Stop()
+
+			return cuserror.NewWithErrorMsg(fmt.Sprintf("start component %v failed: %v", component.Name, err))
+		}
+
+		m.started = append(m.started, component)
+	}
+
+	return nil
+}
+
+// Stop calls OnStop on the started components in reverse order. The servers' context is usually
+// done at this point, so the hooks get a fresh one.
+func (m *lifecycleManager) Stop() {
+	for idx := len(m.started) - 1; idx >= 0; idx-- {
+		component := m.started[idx]
+
+		err := m.callHook(context.Background(), component.Name, "OnStop", component.StopTimeout, component.Lifecycle.OnStop)
+		if err != nil {
+			m.logger.WithFields(l.StringField("component", component.Name), l.ErrorField(err)).Error("stopComponentFailed")
+		}
+	}
+
+	m.started = nil
+}
+
+func (m *lifecycleManager) callHook(ctx context.Context, name, hook string, timeout time.Duration,
+	fn func(ctx context.Context) error) error {
+	var cancel context.CancelFunc
+
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+	} else {
+		ctx, cancel = context.WithCancel(ctx)
+	}
+
+	// the hook is told to give up by ctx when callHook returns without its result
+	defer cancel()
+
+	m.logger.WithFields(l.StringField("component", name), l.StringField("hook", hook)).Debug("callHook")
+
+	chErr := make(chan error, 1)
+
+	go func() {
+		chErr <- fn(ctx)
+	}()
+
+	select {
+	case err := <-chErr:
+		return err
+	case <-ctx.Done():
+		m.logger.WithFields(l.StringField("component", name), l.StringField("hook", hook), l.ErrorField(ctx.Err())).
+			Warn("hookAbandoned")
+
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,112 @@
+package servicetoolset
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sgostarter/i/commerr"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLifecycleStartOrder(t *testing.T) {
+	var calls []string
+
+	fnComponent := func(name string, dependsOn ...string) *ComponentConfig {
+		return &ComponentConfig{
+			Name: name,
+			Lifecycle: LifecycleFuncs{
+				OnStartFunc: func(_ context.Context) error {
+					calls = append(calls, "start:"+name)
+
+					return nil
+				},
+				OnStopFunc: func(_ context.Context) error {
+					calls = append(calls, "stop:"+name)
+
+					return nil
+				},
+			},
+			DependsOn: dependsOn,
+		}
+	}
+
+	m := newLifecycleManager(nil)
+	assert.Nil(t, m.Register(fnComponent("queue", "db")))
+	assert.Nil(t, m.Register(fnComponent("db")))
+	assert.Nil(t, m.Register(fnComponent("cache")))
+	assert.Equal(t, commerr.ErrAlreadyExists, m.Register(fnComponent("db")))
+
+	assert.Nil(t, m.Start(context.Background()))
+	m.Stop()
+
+	assert.Equal(t, []string{"start:db", "start:queue", "start:cache", "stop:cache", "stop:queue", "stop:db"}, calls)
+
+	m = newLifecycleManager(nil)
+	assert.Nil(t, m.Register(fnComponent("a", "b")))
+	assert.Nil(t, m.Register(fnComponent("b", "a")))
+	assert.NotNil(t, m.Start(context.Background()))
+
+	m = newLifecycleManager(nil)
+	assert.Nil(t, m.Register(fnComponent("a", "unknown")))
+	assert.NotNil(t, m.Start(context.Background()))
+}
+
+func TestLifecycleStartFailed(t *testing.T) {
+	var stopped bool
+
+	m := newLifecycleManager(nil)
+	assert.Nil(t, m.Register(&ComponentConfig{
+		Name: "db",
+		Lifecycle: LifecycleFuncs{
+			OnStopFunc: func(_ context.Context) error {
+				stopped = true
+
+				return nil
+			},
+		},
+	}))
+	assert.Nil(t, m.Register(&ComponentConfig{
+		Name: "slow",
+		Lifecycle: LifecycleFuncs{
+			OnStartFunc: func(ctx context.Context) error {
+				<-ctx.Done()
+
+				return ctx.Err()
+			},
+		},
+		DependsOn:    []string{"db"},
+		StartTimeout: 10 * time.Millisecond,
+	}))
+
+	assert.NotNil(t, m.Start(context.Background()))
+	assert.True(t, stopped)
+}
+
+func TestLifecycleHookAbandoned(t *testing.T) {
+	exited := make(chan struct{})
+
+	m := newLifecycleManager(nil)
+	assert.Nil(t, m.Register(&ComponentConfig{
+		Name: "slow",
+		Lifecycle: LifecycleFuncs{
+			OnStartFunc: func(ctx context.Context) error {
+				<-ctx.Done()
+				close(exited)
+
+				return ctx.Err()
+			},
+		},
+	}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	assert.NotNil(t, m.Start(ctx))
+
+	select {
+	case <-exited:
+	case <-time.After(time.Second):
+		assert.Fail(t, "the abandoned hook is still running")
+	}
+}
@@ -0,0 +1,82 @@
+package servicetoolset
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/sgostarter/libeasygo/cuserror"
+)
+
+const (
+	originRegexPrefix = "regex:"
+)
+
+// OriginMatcher matches the Origin header against the patterns:
+//
+//	exact     https://a.com
+//	wildcard  * for all, or https://*.a.com, * matches one or more characters except /
+//	regex     regex:^https://a[0-9]+\.com$
+//
+// The exact and the wildcard patterns are case-insensitive.
+type OriginMatcher struct {
+	allowAll bool
+	exacts   map[string]bool
+	regexps  []*regexp.Regexp
+}
+
+func NewOriginMatcher(patterns []string) (*OriginMatcher, error) {
+	m := &OriginMatcher{
+		exacts: make(map[string]bool, len(patterns)),
+	}
+
+	for _, pattern := range patterns {
+		switch {
+		case pattern == "*":
+			m.allowAll = true
+		case strings.HasPrefix(pattern, originRegexPrefix):
+			re, err := regexp.Compile(strings.TrimPrefix(pattern, originRegexPrefix))
+			if err != nil {
+				return nil, cuserror.NewWithErrorMsg(fmt.Sprintf("invalid origin pattern %q: %v", pattern, err))
+			}
+
+			m.regexps = append(m.regexps, re)
+		case strings.Contains(pattern, "*"):
+			parts := strings.Split(strings.ToLower(pattern), "*")
+			for idx, part := range parts {
+				parts[idx] = regexp.QuoteMeta(part)
+			}
+
+			m.regexps = append(m.regexps, regexp.MustCompile("^"+strings.Join(parts, "[^/]+")+"$"))
+		default:
+			m.exacts[strings.ToLower(pattern)] = true
+		}
+	}
+
+	return m, nil
+}
+
+// AllowAll reports whether the patterns contain *.
+func (m *OriginMatcher) AllowAll() bool {
+	return m.allowAll
+}
+
+func (m *OriginMatcher) Match(origin string) bool {
+	if m.allowAll {
+		return true
+	}
+
+	lowerOrigin := strings.ToLower(origin)
+
+	if m.exacts[lowerOrigin] {
+		return true
+	}
+
+	for _, re := range m.regexps {
+		if re.MatchString(origin) || re.MatchString(lowerOrigin) {
+			return true
+		}
+	}
+
+	return false
+}
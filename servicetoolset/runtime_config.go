@@ -0,0 +1,329 @@
+package servicetoolset
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sgostarter/i/commerr"
+	"github.com/sgostarter/i/l"
+	"github.com/sgostarter/libeasygo/cuserror"
+	"github.com/sgostarter/libservicetoolset/grpce/meta"
+	"github.com/sgostarter/libservicetoolset/grpce/utils"
+	"go.uber.org/atomic"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	LogVerbosityNone = iota
+	// LogVerbositySummary the payloads aren't logged here, interceptors.CallLogger redacts them
+	LogVerbositySummary
+)
+
+const (
+	defaultRuntimeConfigWatchInterval = 5 * time.Second
+)
+
+type RateLimitConfig struct {
+	QPS   float64 `yaml:"qps" json:"qps"`
+	Burst int     `yaml:"burst" json:"burst"`
+}
+
+// RuntimeConfig the settings of gRPCServerImpl which can be changed without restarting.
+//
+// The keys of RateLimits and the items of DisabledMethods are method patterns: a full method
+// (/pkg.Service/Method), all the methods of a service (/pkg.Service/*) or all the methods (*). The
+// RuntimeConfigAdmin service can't be disabled, so the config can always be changed back.
+type RuntimeConfig struct {
+	// MetaTransKeys nil means transfer all the incoming metadata except meta.DefaultDenyKeys
+	MetaTransKeys []string `yaml:"meta_trans_keys" json:"meta_trans_keys"`
+	// Propagation replaces MetaTransKeys if not nil
+	Propagation     *meta.PropagationPolicy    `yaml:"propagation" json:"propagation"`
+	LogVerbosity    int                        `yaml:"log_verbosity" json:"log_verbosity"`
+	RateLimits      map[string]RateLimitConfig `yaml:"rate_limits" json:"rate_limits"`
+	DisabledMethods []string                   `yaml:"disabled_methods" json:"disabled_methods"`
+}
+
+func (cfg *RuntimeConfig) clone() *RuntimeConfig {
+	n := &RuntimeConfig{
+		LogVerbosity: cfg.LogVerbosity,
+	}
+
+	if cfg.MetaTransKeys != nil {
+		n.MetaTransKeys = append([]string{}, cfg.MetaTransKeys...)
+	}
+
+	if cfg.Propagation != nil {
+		n.Propagation = cfg.Propagation.Clone()
+	}
+
+	if cfg.RateLimits != nil {
+		n.RateLimits = make(map[string]RateLimitConfig, len(cfg.RateLimits))
+		for k, v := range cfg.RateLimits {
+			n.RateLimits[k] = v
+		}
+	}
+
+	if cfg.DisabledMethods != nil {
+		n.DisabledMethods = append([]string{}, cfg.DisabledMethods...)
+	}
+
+	return n
+}
+
+func (cfg *RuntimeConfig) Validate() error {
+	if cfg.LogVerbosity < LogVerbosityNone || cfg.LogVerbosity > LogVerbositySummary {
+		return cuserror.NewWithErrorMsg(fmt.Sprintf("log_verbosity: unknown verbosity %v", cfg.LogVerbosity))
+	}
+
+	if cfg.Propagation != nil {
+		if err := cfg.Propagation.Validate(); err != nil {
+			return cuserror.NewWithErrorMsg(fmt.Sprintf("propagation.%v", err))
+		}
+	}
+
+	for pattern, limit := range cfg.RateLimits {
+		if !utils.ValidMethodPattern(pattern) {
+			return cuserror.NewWithErrorMsg(fmt.Sprintf("rate_limits.%v: invalid method pattern", pattern))
+		}
+
+		if limit.QPS <= 0 {
+			return cuserror.NewWithErrorMsg(fmt.Sprintf("rate_limits.%v.qps: should be positive", pattern))
+		}
+	}
+
+	for idx, pattern := range cfg.DisabledMethods {
+		if !utils.ValidMethodPattern(pattern) {
+			return cuserror.NewWithErrorMsg(fmt.Sprintf("disabled_methods[%v]: invalid method pattern %q", idx, pattern))
+		}
+	}
+
+	return nil
+}
+
+// diffRuntimeConfig returns "field: old -> new" of the changed fields.
+func diffRuntimeConfig(o, n *RuntimeConfig) []string {
+	var diffs []string
+
+	ov, nv := reflect.ValueOf(o).Elem(), reflect.ValueOf(n).Elem()
+
+	for idx := 0; idx < ov.NumField(); idx++ {
+		if reflect.DeepEqual(ov.Field(idx).Interface(), nv.Field(idx).Interface()) {
+			continue
+		}
+
+		field := ov.Type().Field(idx)
+		name, _ := configFieldName(&field)
+		diffs = append(diffs, fmt.Sprintf("%v: %v -> %v", name, ov.Field(idx).Interface(), nv.Field(idx).Interface()))
+	}
+
+	return diffs
+}
+
+type runtimeConfigSnapshot struct {
+	cfg         *RuntimeConfig
+	propagation *meta.PropagationPolicy
+	limiters    map[string]*utils.TokenBucket
+}
+
+// newRuntimeConfigSnapshot the limiters of prev are kept if their patterns and limits are unchanged, so
+// an update doesn't refill the buckets.
+func newRuntimeConfigSnapshot(cfg *RuntimeConfig, prev *runtimeConfigSnapshot) *runtimeConfigSnapshot {
+	snapshot := &runtimeConfigSnapshot{
+		cfg:         cfg,
+		propagation: cfg.Propagation,
+		limiters:    make(map[string]*utils.TokenBucket, len(cfg.RateLimits)),
+	}
+
+	if snapshot.propagation == nil {
+		snapshot.propagation = meta.KeysPropagationPolicy(cfg.MetaTransKeys)
+	}
+
+	for pattern, limit := range cfg.RateLimits {
+		if prev != nil {
+			if prevLimit, ok := prev.cfg.RateLimits[pattern]; ok && prevLimit == limit {
+				snapshot.limiters[pattern] = prev.limiters[pattern]
+
+				continue
+			}
+		}
+
+		snapshot.limiters[pattern] = utils.NewTokenBucket(limit.QPS, limit.Burst)
+	}
+
+	return snapshot
+}
+
+func (snapshot *runtimeConfigSnapshot) methodDisabled(fullMethod string) bool {
+	if strings.HasPrefix(fullMethod, "/"+RuntimeConfigAdminServiceName+"/") {
+		return false
+	}
+
+	for _, pattern := range snapshot.cfg.DisabledMethods {
+		if utils.MatchMethodPattern(pattern, fullMethod) > 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (snapshot *runtimeConfigSnapshot) limiter(fullMethod string) *utils.TokenBucket {
+	var (
+		limiter  *utils.TokenBucket
+		priority int
+	)
+
+	for pattern, bucket := range snapshot.limiters {
+		if p := utils.MatchMethodPattern(pattern, fullMethod); p > priority {
+			limiter, priority = bucket, p
+		}
+	}
+
+	return limiter
+}
+
+func (snapshot *runtimeConfigSnapshot) check(fullMethod string) error {
+	if snapshot.methodDisabled(fullMethod) {
+		return status.Errorf(codes.Unavailable, "method %v is disabled", fullMethod)
+	}
+
+	if limiter := snapshot.limiter(fullMethod); limiter != nil && !limiter.Allow() {
+		return status.Errorf(codes.ResourceExhausted, "method %v is rate limited", fullMethod)
+	}
+
+	return nil
+}
+
+// RuntimeConfigManager keeps the RuntimeConfig in an atomically swapped snapshot, the interceptors
+// always see a consistent config.
+type RuntimeConfigManager struct {
+	logger l.Wrapper
+
+	updateLock sync.Mutex
+	base       *RuntimeConfig
+	snapshot   atomic.Pointer[runtimeConfigSnapshot]
+}
+
+// NewRuntimeConfigManager base is the initial config, and also the base the watched file is applied on.
+func NewRuntimeConfigManager(base *RuntimeConfig, logger l.Wrapper) *RuntimeConfigManager {
+	if logger == nil {
+		logger = l.NewNopLoggerWrapper()
+	}
+
+	if base == nil {
+		base = &RuntimeConfig{}
+	}
+
+	m := &RuntimeConfigManager{
+		logger: logger.WithFields(l.StringField(l.ClsKey, "RuntimeConfigManager")),
+		base:   base.clone(),
+	}
+
+	m.snapshot.Store(newRuntimeConfigSnapshot(base.clone(), nil))
+
+	return m
+}
+
+// Get returns a copy of the current config.
+func (m *RuntimeConfigManager) Get() *RuntimeConfig {
+	return m.snapshot.Load().cfg.clone()
+}
+
+// Update replaces the current config, the changes are logged.
+func (m *RuntimeConfigManager) Update(cfg *RuntimeConfig, source string) error {
+	if cfg == nil {
+		return commerr.ErrInvalidArgument
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+
+	m.updateLock.Lock()
+	defer m.updateLock.Unlock()
+
+	cfg = cfg.clone()
+
+	prev := m.snapshot.Load()
+
+	diffs := diffRuntimeConfig(prev.cfg, cfg)
+	if len(diffs) == 0 {
+		return nil
+	}
+
+	m.snapshot.Store(newRuntimeConfigSnapshot(cfg, prev))
+
+	m.logger.WithFields(l.StringField("source", source), l.StringField("diff", strings.Join(diffs, "; "))).
+		Info("runtimeConfigUpdated")
+
+	return nil
+}
+
+// LoadFile applies the file on the base config, and updates the current config with it.
+func (m *RuntimeConfigManager) LoadFile(file string) error {
+	m.updateLock.Lock()
+	cfg := m.base.clone()
+	m.updateLock.Unlock()
+
+	if err := loadConfigFile(file, cfg); err != nil {
+		return err
+	}
+
+	return m.Update(cfg, file)
+}
+
+// WatchFile reloads the file when its modification time changes, until ctx is done.
+func (m *RuntimeConfigManager) WatchFile(ctx context.Context, file string, interval time.Duration) {
+	if interval <= 0 {
+		interval = defaultRuntimeConfigWatchInterval
+	}
+
+	utils.WatchFile(ctx, file, interval, func() error {
+		return m.LoadFile(file)
+	}, m.logger)
+}
+
+func (m *RuntimeConfigManager) logCall(fullMethod string, verbosity int, st time.Time, err error) {
+	if verbosity == LogVerbositySummary {
+		m.logger.Infof("[SRV] method:%v cost:%v code:%v", fullMethod, time.Since(st), status.Code(err))
+	}
+}
+
+func (m *RuntimeConfigManager) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (
+		resp interface{}, err error) {
+		snapshot := m.snapshot.Load()
+
+		st := time.Now()
+
+		if err = snapshot.check(info.FullMethod); err == nil {
+			resp, err = handler(meta.TransferContextMetaWithPolicy(ctx, snapshot.propagation), req)
+		}
+
+		m.logCall(info.FullMethod, snapshot.cfg.LogVerbosity, st, err)
+
+		return
+	}
+}
+
+func (m *RuntimeConfigManager) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+		snapshot := m.snapshot.Load()
+
+		st := time.Now()
+
+		if err = snapshot.check(info.FullMethod); err == nil {
+			err = handler(srv, utils.NewServerStreamWrapper(meta.TransferContextMetaWithPolicy(ss.Context(), snapshot.propagation), ss))
+		}
+
+		m.logCall(info.FullMethod, snapshot.cfg.LogVerbosity, st, err)
+
+		return
+	}
+}
@@ -0,0 +1,114 @@
+package servicetoolset
+
+import (
+	"context"
+	"encoding/json"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+const (
+	RuntimeConfigAdminServiceName = "servicetoolset.RuntimeConfigAdmin"
+)
+
+// RuntimeConfigAdminServer the RuntimeConfig is transferred as json in a google.protobuf.StringValue,
+// so no generated code is needed on either side:
+//
+//	Get(google.protobuf.Empty) returns (google.protobuf.StringValue)
+//	Update(google.protobuf.StringValue) returns (google.protobuf.StringValue)
+type RuntimeConfigAdminServer interface {
+	Get(ctx context.Context, req *emptypb.Empty) (*wrapperspb.StringValue, error)
+	Update(ctx context.Context, req *wrapperspb.StringValue) (*wrapperspb.StringValue, error)
+}
+
+// RegisterRuntimeConfigAdminServer the service can kill methods, protect it with interceptors or an admin listener.
+func RegisterRuntimeConfigAdminServer(s grpc.ServiceRegistrar, m *RuntimeConfigManager) {
+	s.RegisterService(&runtimeConfigAdminServiceDesc, &runtimeConfigAdminServer{m: m})
+}
+
+type runtimeConfigAdminServer struct {
+	m *RuntimeConfigManager
+}
+
+func (s *runtimeConfigAdminServer) Get(_ context.Context, _ *emptypb.Empty) (*wrapperspb.StringValue, error) {
+	d, err := json.Marshal(s.m.Get())
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	return wrapperspb.String(string(d)), nil
+}
+
+func (s *runtimeConfigAdminServer) Update(ctx context.Context, req *wrapperspb.StringValue) (*wrapperspb.StringValue, error) {
+	cfg := &RuntimeConfig{}
+
+	if err := json.Unmarshal([]byte(req.GetValue()), cfg); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	if err := s.m.Update(cfg, "adminRPC"); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	return s.Get(ctx, &emptypb.Empty{})
+}
+
+// nolint: forcetypeassert
+var runtimeConfigAdminServiceDesc = grpc.ServiceDesc{
+	ServiceName: RuntimeConfigAdminServiceName,
+	HandlerType: (*RuntimeConfigAdminServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Get",
+			Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error,
+				interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+				in := new(emptypb.Empty)
+				if err := dec(in); err != nil {
+					return nil, err
+				}
+
+				if interceptor == nil {
+					return srv.(RuntimeConfigAdminServer).Get(ctx, in)
+				}
+
+				info := &grpc.UnaryServerInfo{
+					Server:     srv,
+					FullMethod: "/" + RuntimeConfigAdminServiceName + "/Get",
+				}
+
+				return interceptor(ctx, in, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+					return srv.(RuntimeConfigAdminServer).Get(ctx, req.(*emptypb.Empty))
+				})
+			},
+		},
+		{
+			MethodName: "Update",
+			Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error,
+				interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+				in := new(wrapperspb.StringValue)
+				if err := dec(in); err != nil {
+					return nil, err
+				}
+
+				if interceptor == nil {
+					return srv.(RuntimeConfigAdminServer).Update(ctx, in)
+				}
+
+				info := &grpc.UnaryServerInfo{
+					Server:     srv,
+					FullMethod: "/" + RuntimeConfigAdminServiceName + "/Update",
+				}
+
+				return interceptor(ctx, in, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+					return srv.(RuntimeConfigAdminServer).Update(ctx, req.(*wrapperspb.StringValue))
+				})
+			},
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "servicetoolset/runtime_config_admin.go",
+}
@@ -0,0 +1,90 @@
+package servicetoolset
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestRuntimeConfigManager(t *testing.T) {
+	m := NewRuntimeConfigManager(&RuntimeConfig{
+		RateLimits: map[string]RateLimitConfig{
+			"/pkg.Svc/*": {QPS: 0.001, Burst: 1},
+		},
+	}, nil)
+
+	interceptor := m.UnaryServerInterceptor()
+	handler := func(_ context.Context, _ interface{}) (interface{}, error) {
+		return "ok", nil
+	}
+
+	fnCall := func(method string) error {
+		_, err := interceptor(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: method}, handler)
+
+		return err
+	}
+
+	assert.Nil(t, fnCall("/pkg.Svc/A"))
+	assert.Equal(t, codes.ResourceExhausted, status.Code(fnCall("/pkg.Svc/B")))
+	assert.Nil(t, fnCall("/pkg.Other/A"))
+
+	cfg := m.Get()
+	cfg.DisabledMethods = []string{"/pkg.Other/A"}
+	cfg.RateLimits = nil
+	assert.Nil(t, m.Update(cfg, "test"))
+
+	assert.Equal(t, codes.Unavailable, status.Code(fnCall("/pkg.Other/A")))
+	assert.Nil(t, fnCall("/pkg.Svc/B"))
+
+	cfg.DisabledMethods = []string{"pkg.Other"}
+	assert.NotNil(t, m.Update(cfg, "test"))
+
+	diffs := diffRuntimeConfig(&RuntimeConfig{LogVerbosity: 0}, &RuntimeConfig{LogVerbosity: 1})
+	assert.Equal(t, []string{"log_verbosity: 0 -> 1"}, diffs)
+
+	// the payloads are logged by interceptors.CallLogger only
+	assert.NotNil(t, (&RuntimeConfig{LogVerbosity: 2}).Validate())
+}
+
+func TestRuntimeConfigManagerKeepLimiters(t *testing.T) {
+	m := NewRuntimeConfigManager(&RuntimeConfig{
+		RateLimits: map[string]RateLimitConfig{
+			"/pkg.Svc/*":   {QPS: 0.001, Burst: 1},
+			"/pkg.Other/*": {QPS: 0.001, Burst: 1},
+		},
+	}, nil)
+
+	interceptor := m.UnaryServerInterceptor()
+	handler := func(_ context.Context, _ interface{}) (interface{}, error) {
+		return "ok", nil
+	}
+
+	fnCall := func(method string) error {
+		_, err := interceptor(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: method}, handler)
+
+		return err
+	}
+
+	assert.Nil(t, fnCall("/pkg.Svc/A"))
+	assert.Nil(t, fnCall("/pkg.Other/A"))
+
+	// the unchanged limit keeps its bucket, the changed one is refilled
+	cfg := m.Get()
+	cfg.LogVerbosity = LogVerbositySummary
+	cfg.RateLimits["/pkg.Other/*"] = RateLimitConfig{QPS: 0.001, Burst: 2}
+	assert.Nil(t, m.Update(cfg, "test"))
+
+	assert.Equal(t, codes.ResourceExhausted, status.Code(fnCall("/pkg.Svc/A")))
+	assert.Nil(t, fnCall("/pkg.Other/A"))
+
+	// the admin service can't be disabled
+	cfg.DisabledMethods = []string{"*"}
+	assert.Nil(t, m.Update(cfg, "test"))
+
+	assert.Equal(t, codes.Unavailable, status.Code(fnCall("/pkg.Other/B")))
+	assert.Nil(t, fnCall("/"+RuntimeConfigAdminServiceName+"/Update"))
+}
@@ -3,6 +3,7 @@ package servicetoolset
 import (
 	"context"
 	"strings"
+	"time"
 
 	"github.com/sgostarter/i/commerr"
 	"github.com/sgostarter/i/l"
@@ -16,8 +17,13 @@ type ServerToolset struct {
 	serverHelper *ServerHelper
 	gRPCServer   GRPCServer
 	httpServer   HTTPServer
+	adminServer  AbstractServer
+	lifecycle    *lifecycleManager
 
 	started atomic.Bool
+	// startDone is closed once Start finished, startErr is read after it
+	startDone chan struct{}
+	startErr  error
 }
 
 func NewServerToolset(ctx context.Context, logger l.Wrapper) *ServerToolset {
@@ -26,11 +32,13 @@ func NewServerToolset(ctx context.Context, logger l.Wrapper) *ServerToolset {
 	}
 
 	sst := &ServerToolset{
-		ctx:    ctx,
-		logger: logger.WithFields(l.StringField(l.ClsKey, "ServerToolset")),
+		ctx:       ctx,
+		logger:    logger.WithFields(l.StringField(l.ClsKey, "ServerToolset")),
+		startDone: make(chan struct{}),
 	}
 
 	sst.serverHelper = NewServerHelper(ctx, logger)
+	sst.lifecycle = newLifecycleManager(logger)
 
 	return sst
 }
@@ -42,11 +50,28 @@ func (st *ServerToolset) CreateGRpcServer(cfg *GRPCServerConfig, opts []grpc.Ser
 		return
 	}
 
-	st.gRPCServer, err = NewGRPCServer(nil, cfg, opts, beforeServerStart, st.logger)
+	// the admin config is checked first, so a failure doesn't leave the gRPC server behind
+	var adminServer *adminServer
+
+	if cfg.Admin != nil {
+		adminServer, err = newAdminServer(cfg.Admin, cfg, st.logger)
+		if err != nil {
+			return
+		}
+	}
+
+	gRPCServer, err := NewGRPCServer(nil, cfg, opts, beforeServerStart, st.logger)
 	if err != nil {
 		return
 	}
 
+	if adminServer != nil {
+		adminServer.gRPCServer = gRPCServer
+		st.adminServer = adminServer
+	}
+
+	st.gRPCServer = gRPCServer
+
 	return
 }
 
@@ -59,16 +84,60 @@ func (st *ServerToolset) CreateHTTPServer(cfg *HTTPServerConfig) error {
 		return commerr.ErrInvalidArgument
 	}
 
-	st.httpServer = NewHTTPServer(cfg.Name, cfg.Address, cfg.Handler, &cfg.DiscoveryExConfig, st.logger)
+	httpServer, err := NewHTTPServerEx(cfg, st.logger)
+	if err != nil {
+		return err
+	}
+
+	st.httpServer = httpServer
+
+	if reloadable, ok := httpServer.(TLSReloadable); ok && cfg.TLSConfig == nil && cfg.TLSFileConfig != nil {
+		st.RegisterReloadCallback("httpServerTLS", reloadable.ReloadTLS)
+	}
 
 	return nil
 }
 
+// RegisterComponent registers a lifecycle component, components are started before the servers
+// and stopped after all the servers exited.
+func (st *ServerToolset) RegisterComponent(cfg *ComponentConfig) error {
+	if st.started.Load() {
+		return commerr.ErrReject
+	}
+
+	return st.lifecycle.Register(cfg)
+}
+
+// SetFailurePolicy decides what happens to the other servers when one of them fails, should be called before Start.
+func (st *ServerToolset) SetFailurePolicy(cfg *FailurePolicyConfig) {
+	st.serverHelper.SetFailurePolicy(cfg)
+}
+
+// SetShutdownDeadline caps the total shutdown time after the shutdown began, 0 means no deadline.
+func (st *ServerToolset) SetShutdownDeadline(d time.Duration) {
+	st.serverHelper.SignalManager().SetShutdownDeadline(d)
+}
+
+// RegisterReloadCallback registers a callback called on SIGHUP, e.g. reloading TLS certs or log levels.
+func (st *ServerToolset) RegisterReloadCallback(name string, cb ReloadCallback) {
+	st.serverHelper.SignalManager().RegisterReloadCallback(name, cb)
+}
+
 func (st *ServerToolset) Start() error {
 	if !st.started.CompareAndSwap(false, true) {
 		return commerr.ErrAlreadyExists
 	}
 
+	defer close(st.startDone)
+
+	if err := st.lifecycle.Start(st.ctx); err != nil {
+		st.logger.WithFields(l.ErrorField(err)).Error("startComponentsFailed")
+
+		st.startErr = err
+
+		return err
+	}
+
 	if st.gRPCServer != nil {
 		st.serverHelper.StartServer(st.gRPCServer)
 	}
@@ -77,10 +146,28 @@ func (st *ServerToolset) Start() error {
 		st.serverHelper.StartServer(st.httpServer)
 	}
 
+	if st.adminServer != nil {
+		st.serverHelper.StartServer(st.adminServer)
+	}
+
 	return nil
 }
 
-func (st *ServerToolset) Wait() {
+// Wait waits all the servers exit, and returns the aggregated errors of the startup and the servers.
+func (st *ServerToolset) Wait() error {
 	_ = st.Start()
-	st.serverHelper.Wait()
+
+	<-st.startDone
+
+	defer st.serverHelper.SignalManager().Stop()
+
+	if st.startErr != nil {
+		return st.startErr
+	}
+
+	err := st.serverHelper.Wait()
+
+	st.lifecycle.Stop()
+
+	return err
 }
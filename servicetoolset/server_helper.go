@@ -2,46 +2,52 @@ package servicetoolset
 
 import (
 	"context"
-	"os"
-	"os/signal"
+	"errors"
 	"sync"
-	"syscall"
+	"time"
 
 	"github.com/sgostarter/i/l"
 )
 
-func SignalContext(ctx context.Context, logger l.Wrapper) context.Context {
-	if logger == nil {
-		logger = l.NewNopLoggerWrapper()
-	}
-
-	ctx, cancel := context.WithCancel(ctx)
+type AbstractServer interface {
+	Run(ctx context.Context) error
+}
 
-	sigs := make(chan os.Signal, 1)
-	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+type FailurePolicy int
 
-	go func() {
-		logger.Info("listening for shutdown signal")
+const (
+	// FailurePolicyFailAll cancels the shared context so the other servers shut down gracefully
+	FailurePolicyFailAll FailurePolicy = iota
+	// FailurePolicyRestart runs the failed server again after a backoff
+	FailurePolicyRestart
+	// FailurePolicyIgnore records the error and leaves the other servers running
+	FailurePolicyIgnore
+)
 
-		<-sigs
-		logger.Info("shutdown signal received")
+const (
+	defaultRestartMinBackoff = time.Second
+	defaultRestartMaxBackoff = time.Minute
+)
 
-		signal.Stop(sigs)
-		close(sigs)
-		cancel()
-	}()
+type FailurePolicyConfig struct {
+	Policy FailurePolicy `yaml:"policy" json:"policy"`
 
-	return ctx
-}
-
-type AbstractServer interface {
-	Run(ctx context.Context) error
+	RestartMinBackoff time.Duration `yaml:"restart_min_backoff" json:"restart_min_backoff"`
+	RestartMaxBackoff time.Duration `yaml:"restart_max_backoff" json:"restart_max_backoff"`
+	// MaxRestarts 0 means no limit, the server fails all when reached
+	MaxRestarts int `yaml:"max_restarts" json:"max_restarts"`
 }
 
 type ServerHelper struct {
-	ctx    context.Context
-	wg     sync.WaitGroup
-	logger l.Wrapper
+	ctx           context.Context
+	signalManager *SignalManager
+	wg            sync.WaitGroup
+	logger        l.Wrapper
+
+	policy FailurePolicyConfig
+
+	errsLock sync.Mutex
+	errs     []error
 }
 
 func NewServerHelper(ctx context.Context, logger l.Wrapper) *ServerHelper {
@@ -49,24 +55,125 @@ func NewServerHelper(ctx context.Context, logger l.Wrapper) *ServerHelper {
 		logger = l.NewNopLoggerWrapper()
 	}
 
-	return &ServerHelper{
-		ctx:    SignalContext(ctx, logger),
-		logger: logger.WithFields(l.StringField(l.ClsKey, "ServerHelper")),
+	signalManager := NewSignalManager(ctx, logger)
+
+	sh := &ServerHelper{
+		ctx:           signalManager.Context(),
+		signalManager: signalManager,
+		logger:        logger.WithFields(l.StringField(l.ClsKey, "ServerHelper")),
+	}
+
+	sh.SetFailurePolicy(nil)
+
+	return sh
+}
+
+// SetFailurePolicy should be called before StartServer.
+func (sh *ServerHelper) SetFailurePolicy(cfg *FailurePolicyConfig) {
+	if cfg == nil {
+		cfg = &FailurePolicyConfig{}
+	}
+
+	sh.policy = *cfg
+
+	if sh.policy.RestartMinBackoff <= 0 {
+		sh.policy.RestartMinBackoff = defaultRestartMinBackoff
+	}
+
+	if sh.policy.RestartMaxBackoff < sh.policy.RestartMinBackoff {
+		sh.policy.RestartMaxBackoff = defaultRestartMaxBackoff
 	}
 }
 
+func (sh *ServerHelper) Context() context.Context {
+	return sh.ctx
+}
+
+func (sh *ServerHelper) SignalManager() *SignalManager {
+	return sh.signalManager
+}
+
+// Cancel shuts down all the servers.
+func (sh *ServerHelper) Cancel() {
+	sh.signalManager.Shutdown("canceled")
+}
+
 func (sh *ServerHelper) StartServer(s AbstractServer) {
 	sh.wg.Add(1)
 
 	go func() {
 		defer sh.wg.Done()
 
-		if err := s.Run(sh.ctx); err != nil {
-			sh.logger.Fatalf("runServer error:%v", err)
-		}
+		sh.runServer(s)
 	}()
 }
 
-func (sh *ServerHelper) Wait() {
+func (sh *ServerHelper) runServer(s AbstractServer) {
+	backoff := sh.policy.RestartMinBackoff
+
+	for restarts := 0; ; restarts++ {
+		err := s.Run(sh.ctx)
+		if err == nil {
+			return
+		}
+
+		sh.logger.WithFields(l.ErrorField(err), l.IntField("restarts", restarts)).Error("runServerFailed")
+
+		sh.addError(err)
+
+		switch sh.policy.Policy {
+		case FailurePolicyIgnore:
+			return
+		case FailurePolicyRestart:
+			if sh.policy.MaxRestarts > 0 && restarts >= sh.policy.MaxRestarts {
+				sh.signalManager.Shutdown("server restarts exhausted")
+
+				return
+			}
+
+			if !sh.waitBackoff(backoff) {
+				return
+			}
+
+			backoff *= 2
+			if backoff > sh.policy.RestartMaxBackoff {
+				backoff = sh.policy.RestartMaxBackoff
+			}
+		case FailurePolicyFailAll:
+			fallthrough
+		default:
+			sh.signalManager.Shutdown("server failed")
+
+			return
+		}
+	}
+}
+
+func (sh *ServerHelper) waitBackoff(backoff time.Duration) bool {
+	timer := time.NewTimer(backoff)
+	defer timer.Stop()
+
+	select {
+	case <-sh.ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+func (sh *ServerHelper) addError(err error) {
+	sh.errsLock.Lock()
+	defer sh.errsLock.Unlock()
+
+	sh.errs = append(sh.errs, err)
+}
+
+// Wait waits all the servers exit, and returns the errors they failed with.
+func (sh *ServerHelper) Wait() error {
 	sh.wg.Wait()
+
+	sh.errsLock.Lock()
+	defer sh.errsLock.Unlock()
+
+	return errors.Join(sh.errs...)
 }
@@ -0,0 +1,76 @@
+package servicetoolset
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type funcServer func(ctx context.Context) error
+
+func (fn funcServer) Run(ctx context.Context) error {
+	return fn(ctx)
+}
+
+func TestServerHelperFailAll(t *testing.T) {
+	errFailed := errors.New("failed")
+
+	sh := NewServerHelper(context.Background(), nil)
+	sh.StartServer(funcServer(func(ctx context.Context) error {
+		<-ctx.Done()
+
+		return nil
+	}))
+	sh.StartServer(funcServer(func(_ context.Context) error {
+		return errFailed
+	}))
+
+	assert.ErrorIs(t, sh.Wait(), errFailed)
+}
+
+func TestServerHelperRestart(t *testing.T) {
+	errFailed := errors.New("failed")
+
+	sh := NewServerHelper(context.Background(), nil)
+	sh.SetFailurePolicy(&FailurePolicyConfig{
+		Policy:            FailurePolicyRestart,
+		RestartMinBackoff: time.Millisecond,
+		MaxRestarts:       2,
+	})
+
+	runs := 0
+
+	sh.StartServer(funcServer(func(_ context.Context) error {
+		runs++
+
+		return errFailed
+	}))
+
+	assert.ErrorIs(t, sh.Wait(), errFailed)
+	assert.Equal(t, 3, runs)
+}
+
+func TestServerToolsetStartFailed(t *testing.T) {
+	errFailed := errors.New("failed")
+
+	st := NewServerToolset(context.Background(), nil)
+	assert.Nil(t, st.RegisterComponent(&ComponentConfig{
+		Name: "db",
+		Lifecycle: LifecycleFuncs{
+			OnStartFunc: func(_ context.Context) error {
+				time.Sleep(10 * time.Millisecond)
+
+				return errFailed
+			},
+		},
+	}))
+
+	go func() {
+		_ = st.Start()
+	}()
+
+	assert.ErrorContains(t, st.Wait(), errFailed.Error())
+}
@@ -0,0 +1,278 @@
+package servicetoolset
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/sgostarter/i/l"
+)
+
+type ReloadCallback func() error
+
+// signalHub the signals are listened once in the process and dispatched to all the running SignalManagers, the
+// listening stops (so SIGHUP gets its default behavior back) when the last one stopped.
+var signalHub struct {
+	lock        sync.Mutex
+	sigs        chan os.Signal
+	subscribers map[*SignalManager]struct{}
+}
+
+func subscribeSignals(sm *SignalManager) {
+	signalHub.lock.Lock()
+	defer signalHub.lock.Unlock()
+
+	if len(signalHub.subscribers) == 0 {
+		signalHub.sigs = make(chan os.Signal, 1)
+		signalHub.subscribers = make(map[*SignalManager]struct{})
+
+		signal.Notify(signalHub.sigs, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+
+		go dispatchSignals(signalHub.sigs)
+	}
+
+	signalHub.subscribers[sm] = struct{}{}
+}
+
+func unsubscribeSignals(sm *SignalManager) {
+	signalHub.lock.Lock()
+	defer signalHub.lock.Unlock()
+
+	if _, ok := signalHub.subscribers[sm]; !ok {
+		return
+	}
+
+	delete(signalHub.subscribers, sm)
+
+	if len(signalHub.subscribers) == 0 {
+		// no signal is sent to sigs after signal.Stop returned
+		signal.Stop(signalHub.sigs)
+		close(signalHub.sigs)
+		signalHub.sigs = nil
+	}
+}
+
+func dispatchSignals(sigs chan os.Signal) {
+	for sig := range sigs {
+		signalHub.lock.Lock()
+		subscribers := make([]*SignalManager, 0, len(signalHub.subscribers))
+
+		for sm := range signalHub.subscribers {
+			subscribers = append(subscribers, sm)
+		}
+		signalHub.lock.Unlock()
+
+		for _, sm := range subscribers {
+			select {
+			case sm.sigs <- sig:
+			default:
+				sm.logger.WithFields(l.StringField("signal", sig.String())).Warn("signalDropped")
+			}
+		}
+	}
+}
+
+// SignalManager cancels its context on the first SIGINT/SIGTERM, forces exit on the second one or when
+// the shutdown deadline passes, and dispatches SIGHUP to the registered reload callbacks.
+//
+// All the SignalManagers of the process receive the signals, Stop should be called once the manager isn't needed.
+type SignalManager struct {
+	parent context.Context
+	ctx    context.Context
+	cancel context.CancelFunc
+	logger l.Wrapper
+
+	sigs   chan os.Signal
+	chStop chan struct{}
+
+	lock             sync.Mutex
+	shutdownDeadline time.Duration
+	deadlineTimer    *time.Timer
+	shuttingDown     bool
+	stopped          bool
+	reloadNames      []string
+	reloadCallbacks  map[string]ReloadCallback
+
+	exitFunc func(code int)
+}
+
+func NewSignalManager(ctx context.Context, logger l.Wrapper) *SignalManager {
+	if logger == nil {
+		logger = l.NewNopLoggerWrapper()
+	}
+
+	sm := newSignalManager(ctx, logger)
+
+	subscribeSignals(sm)
+
+	go sm.signalRoutine()
+
+	return sm
+}
+
+func newSignalManager(parent context.Context, logger l.Wrapper) *SignalManager {
+	ctx, cancel := context.WithCancel(parent)
+
+	return &SignalManager{
+		parent:          parent,
+		ctx:             ctx,
+		cancel:          cancel,
+		logger:          logger.WithFields(l.StringField(l.ClsKey, "SignalManager")),
+		sigs:            make(chan os.Signal, 2),
+		chStop:          make(chan struct{}),
+		reloadCallbacks: make(map[string]ReloadCallback),
+		exitFunc:        os.Exit,
+	}
+}
+
+// Context is canceled when the shutdown begins.
+func (sm *SignalManager) Context() context.Context {
+	return sm.ctx
+}
+
+// SetShutdownDeadline caps the total shutdown time, the process exits when the deadline passes. 0 means no deadline.
+func (sm *SignalManager) SetShutdownDeadline(d time.Duration) {
+	sm.lock.Lock()
+	defer sm.lock.Unlock()
+
+	sm.shutdownDeadline = d
+}
+
+// RegisterReloadCallback registers a callback called on SIGHUP, a callback with the same name is replaced.
+func (sm *SignalManager) RegisterReloadCallback(name string, cb ReloadCallback) {
+	sm.lock.Lock()
+	defer sm.lock.Unlock()
+
+	if _, ok := sm.reloadCallbacks[name]; !ok {
+		sm.reloadNames = append(sm.reloadNames, name)
+	}
+
+	sm.reloadCallbacks[name] = cb
+}
+
+// Shutdown begins the shutdown as if a shutdown signal was received.
+func (sm *SignalManager) Shutdown(reason string) {
+	sm.lock.Lock()
+	defer sm.lock.Unlock()
+
+	if sm.shuttingDown || sm.stopped {
+		return
+	}
+
+	sm.shuttingDown = true
+
+	sm.logger.WithFields(l.StringField("reason", reason)).Info("shutdown")
+
+	if sm.shutdownDeadline > 0 {
+		deadline := sm.shutdownDeadline
+
+		sm.deadlineTimer = time.AfterFunc(deadline, func() {
+			sm.logger.WithFields(l.DurationField("deadline", deadline)).Error("shutdown deadline exceeded, force exit")
+			sm.exitFunc(1)
+		})
+	}
+
+	sm.cancel()
+}
+
+// Stop stops listening signals and disarms the shutdown deadline, should be called after the shutdown completed.
+func (sm *SignalManager) Stop() {
+	sm.lock.Lock()
+	defer sm.lock.Unlock()
+
+	if sm.stopped {
+		return
+	}
+
+	sm.stopped = true
+
+	if sm.deadlineTimer != nil {
+		sm.deadlineTimer.Stop()
+	}
+
+	unsubscribeSignals(sm)
+	close(sm.chStop)
+	sm.cancel()
+}
+
+func (sm *SignalManager) signalRoutine() {
+	sm.logger.Info("listening for shutdown signal")
+
+	parentDone := sm.parent.Done()
+
+	for {
+		select {
+		case <-sm.chStop:
+			return
+		case <-parentDone:
+			// arm the shutdown deadline as well when the shutdown is started by the parent context
+			parentDone = nil
+
+			sm.Shutdown("context done")
+		case sig := <-sm.sigs:
+			sm.handleSignal(sig)
+		}
+	}
+}
+
+func (sm *SignalManager) handleSignal(sig os.Signal) {
+	if sig == syscall.SIGHUP {
+		sm.reload()
+
+		return
+	}
+
+	sm.lock.Lock()
+	shuttingDown := sm.shuttingDown
+	sm.lock.Unlock()
+
+	if shuttingDown {
+		sm.logger.WithFields(l.StringField("signal", sig.String())).Error("second shutdown signal received, force exit")
+		sm.exitFunc(1)
+
+		return
+	}
+
+	sm.logger.WithFields(l.StringField("signal", sig.String())).Info("shutdown signal received")
+
+	sm.Shutdown(sig.String())
+}
+
+func (sm *SignalManager) reload() {
+	sm.lock.Lock()
+	names := make([]string, len(sm.reloadNames))
+	copy(names, sm.reloadNames)
+	callbacks := make(map[string]ReloadCallback, len(sm.reloadCallbacks))
+
+	for name, cb := range sm.reloadCallbacks {
+		callbacks[name] = cb
+	}
+	sm.lock.Unlock()
+
+	sm.logger.Info("reload signal received")
+
+	for _, name := range names {
+		if err := callbacks[name](); err != nil {
+			sm.logger.WithFields(l.StringField("callback", name), l.ErrorField(err)).Error("reloadFailed")
+		}
+	}
+}
+
+// SignalContext returns a context canceled on the first SIGINT/SIGTERM, the signals are listened for the process
+// lifetime. See SignalContextWithStop to stop listening, or SignalManager for more control.
+func SignalContext(ctx context.Context, logger l.Wrapper) context.Context {
+	ctx, _ = SignalContextWithStop(ctx, logger)
+
+	return ctx
+}
+
+// SignalContextWithStop is SignalContext with stop, which stops listening the signals and cancels the context,
+// it should be called once the context isn't needed.
+func SignalContextWithStop(ctx context.Context, logger l.Wrapper) (context.Context, func()) {
+	sm := NewSignalManager(ctx, logger)
+
+	return sm.Context(), sm.Stop
+}
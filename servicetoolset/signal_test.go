@@ -0,0 +1,123 @@
+package servicetoolset
+
+import (
+	"context"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/sgostarter/i/l"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSignalManager(t *testing.T) {
+	sm := newSignalManager(context.Background(), l.NewNopLoggerWrapper())
+
+	chExit := make(chan int, 2)
+	sm.exitFunc = func(code int) {
+		chExit <- code
+	}
+
+	reloads := 0
+
+	sm.RegisterReloadCallback("tls", func() error {
+		reloads++
+
+		return nil
+	})
+
+	sm.handleSignal(syscall.SIGHUP)
+	assert.Equal(t, 1, reloads)
+	assert.Nil(t, sm.Context().Err())
+
+	sm.handleSignal(syscall.SIGTERM)
+	assert.NotNil(t, sm.Context().Err())
+	assert.Len(t, chExit, 0)
+
+	sm.handleSignal(syscall.SIGINT)
+	assert.Equal(t, 1, <-chExit)
+}
+
+func TestSignalManagerDeadline(t *testing.T) {
+	sm := newSignalManager(context.Background(), l.NewNopLoggerWrapper())
+
+	chExit := make(chan int, 1)
+	sm.exitFunc = func(code int) {
+		chExit <- code
+	}
+
+	sm.SetShutdownDeadline(10 * time.Millisecond)
+	sm.Shutdown("test")
+
+	select {
+	case code := <-chExit:
+		assert.Equal(t, 1, code)
+	case <-time.After(time.Second):
+		assert.Fail(t, "deadline not fired")
+	}
+
+	sm = newSignalManager(context.Background(), l.NewNopLoggerWrapper())
+	sm.exitFunc = func(code int) {
+		chExit <- code
+	}
+
+	sm.SetShutdownDeadline(10 * time.Millisecond)
+	sm.Shutdown("test")
+	sm.Stop()
+
+	time.Sleep(50 * time.Millisecond)
+	assert.Len(t, chExit, 0)
+}
+
+func signalSubscribers() int {
+	signalHub.lock.Lock()
+	defer signalHub.lock.Unlock()
+
+	return len(signalHub.subscribers)
+}
+
+func TestSignalManagerSubscription(t *testing.T) {
+	subscribers := signalSubscribers()
+
+	sm1 := NewSignalManager(context.Background(), nil)
+	sm2 := NewSignalManager(context.Background(), nil)
+
+	assert.Equal(t, subscribers+2, signalSubscribers())
+
+	sm1.Stop()
+	sm1.Stop()
+	sm2.Stop()
+
+	assert.Equal(t, subscribers, signalSubscribers())
+
+	ctx, stop := SignalContextWithStop(context.Background(), nil)
+	assert.Equal(t, subscribers+1, signalSubscribers())
+	stop()
+	assert.NotNil(t, ctx.Err())
+	assert.Equal(t, subscribers, signalSubscribers())
+}
+
+func TestSignalManagerParentDone(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	sm := NewSignalManager(ctx, nil)
+	defer sm.Stop()
+
+	chExit := make(chan int, 1)
+
+	sm.lock.Lock()
+	sm.exitFunc = func(code int) {
+		chExit <- code
+	}
+	sm.lock.Unlock()
+
+	sm.SetShutdownDeadline(10 * time.Millisecond)
+	cancel()
+
+	select {
+	case code := <-chExit:
+		assert.Equal(t, 1, code)
+	case <-time.After(time.Second):
+		assert.Fail(t, "deadline not armed by the parent context")
+	}
+}
@@ -0,0 +1,386 @@
+package servicetoolset
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sgostarter/i/commerr"
+	"github.com/sgostarter/i/l"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+const (
+	// SSELastEventIDMetadataKey the Last-Event-ID of the reconnecting clients is passed to the grpc handler with it
+	SSELastEventIDMetadataKey = "last-event-id"
+
+	defaultSSEHeartbeatInterval = 15 * time.Second
+)
+
+type SSEConfig struct {
+	// PathPrefix is stripped before routing, e.g. /events
+	PathPrefix      string `yaml:"path_prefix" json:"path_prefix"`
+	EmitUnpopulated bool   `yaml:"emit_unpopulated" json:"emit_unpopulated"`
+	UseProtoNames   bool   `yaml:"use_proto_names" json:"use_proto_names"`
+	// HeartbeatInterval the interval of the comment lines keeping the connection alive, 15s if 0
+	HeartbeatInterval time.Duration `yaml:"heartbeat_interval" json:"heartbeat_interval"`
+	// RetryInterval the reconnection time sent to the clients, not sent if 0
+	RetryInterval time.Duration `yaml:"retry_interval" json:"retry_interval"`
+	// ForwardHeaders see JSONTranscodingConfig
+	ForwardHeaders []string `yaml:"forward_headers" json:"forward_headers"`
+}
+
+// SSEEventIDFunc returns the id of the seq-th (starting from 1) message of the stream, the seq is used if nil.
+// The CR and LF characters are removed from the id.
+type SSEEventIDFunc func(msg proto.Message, seq uint64) string
+
+// SSEResumeFunc is called with the Last-Event-ID of the reconnecting clients before invoking the method,
+// in is the request which can be modified to resume the stream. The Last-Event-ID is also passed to the
+// grpc handler as the SSELastEventIDMetadataKey metadata.
+type SSEResumeFunc func(ctx context.Context, fullMethod string, lastEventID string, in proto.Message) error
+
+type SSEHandlerInputParameters struct {
+	// GRPCServer the services must be registered before creating the handler
+	GRPCServer *grpc.Server
+	Config     SSEConfig
+	EventID    SSEEventIDFunc
+	Resume     SSEResumeFunc
+	Logger     l.Wrapper
+}
+
+// SSEHandler exposes the server streaming methods as text/event-stream:
+//
+//	GET /package.Service/Method?field=value, the query parameters are set to the request fields
+//	POST /package.Service/Method with the request as the JSON body
+//
+// Every response message is sent as a "message" event with the protojson data, the stream is ended with an
+// "end" event, or an "error" event with the status. The method context is canceled when the client disconnects.
+type SSEHandler struct {
+	cfg      SSEConfig
+	eventID  SSEEventIDFunc
+	resume   SSEResumeFunc
+	logger   l.Wrapper
+	conn     *inProcessConn
+	methods  map[string]protoreflect.MethodDescriptor
+	retryMsg string
+
+	marshalOptions protojson.MarshalOptions
+}
+
+func NewSSEHandler(parameters SSEHandlerInputParameters) (*SSEHandler, error) {
+	if parameters.GRPCServer == nil {
+		return nil, commerr.ErrInvalidArgument
+	}
+
+	logger := parameters.Logger
+	if logger == nil {
+		logger = l.NewNopLoggerWrapper()
+	}
+
+	h := &SSEHandler{
+		cfg:     parameters.Config,
+		eventID: parameters.EventID,
+		resume:  parameters.Resume,
+		logger:  logger.WithFields(l.StringField(l.ClsKey, "SSEHandler")),
+		methods: make(map[string]protoreflect.MethodDescriptor),
+		marshalOptions: protojson.MarshalOptions{
+			EmitUnpopulated: parameters.Config.EmitUnpopulated,
+			UseProtoNames:   parameters.Config.UseProtoNames,
+		},
+	}
+
+	if h.cfg.HeartbeatInterval <= 0 {
+		h.cfg.HeartbeatInterval = defaultSSEHeartbeatInterval
+	}
+
+	if h.cfg.RetryInterval > 0 {
+		h.retryMsg = fmt.Sprintf("retry: %d\n\n", h.cfg.RetryInterval.Milliseconds())
+	}
+
+	if h.eventID == nil {
+		h.eventID = func(_ proto.Message, seq uint64) string {
+			return strconv.FormatUint(seq, 10)
+		}
+	}
+
+	for _, sd := range serviceDescriptors(parameters.GRPCServer, h.logger) {
+		methods := sd.Methods()
+		for idx := 0; idx < methods.Len(); idx++ {
+			md := methods.Get(idx)
+			if md.IsStreamingServer() && !md.IsStreamingClient() {
+				h.methods[fmt.Sprintf("/%s/%s", sd.FullName(), md.Name())] = md
+			}
+		}
+	}
+
+	conn, err := newInProcessConn(parameters.GRPCServer)
+	if err != nil {
+		return nil, err
+	}
+
+	h.conn = conn
+
+	return h, nil
+}
+
+// Close closes the in-process connection.
+func (h *SSEHandler) Close() error {
+	return h.conn.Close()
+}
+
+// route returns the server streaming method of the request path.
+func (h *SSEHandler) route(r *http.Request) (string, protoreflect.MethodDescriptor, bool) {
+	fullMethod, ok := trimSSEPathPrefix(r.URL.Path, h.cfg.PathPrefix)
+	if !ok {
+		return "", nil, false
+	}
+
+	md, ok := h.methods[fullMethod]
+
+	return fullMethod, md, ok
+}
+
+func (h *SSEHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	fullMethod, md, ok := h.route(r)
+	if !ok {
+		writeTranscodingError(w, h.marshalOptions, status.Errorf(codes.NotFound, "no server streaming method %v", r.URL.Path))
+
+		return
+	}
+
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		writeTranscodingError(w, h.marshalOptions, status.Error(codes.Unimplemented, "only GET and POST are supported"))
+
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeTranscodingError(w, h.marshalOptions, status.Error(codes.Internal, "streaming unsupported"))
+
+		return
+	}
+
+	in := dynamicpb.NewMessage(md.Input())
+
+	if err := h.buildRequest(w, r, in); err != nil {
+		writeTranscodingRequestError(w, h.marshalOptions, err)
+
+		return
+	}
+
+	// canceled when the client disconnects, which cancels the context of the grpc handler
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	outgoingMD := transcodingOutgoingMetadata(r, h.cfg.ForwardHeaders)
+
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID != "" {
+		outgoingMD.Set(SSELastEventIDMetadataKey, lastEventID)
+
+		if h.resume != nil {
+			if err := h.resume(ctx, fullMethod, lastEventID, in); err != nil {
+				writeTranscodingError(w, h.marshalOptions, err)
+
+				return
+			}
+		}
+	}
+
+	streamCtx, release := h.conn.callerContext(metadata.NewOutgoingContext(ctx, outgoingMD), r)
+	defer release()
+
+	stream, err := h.conn.NewStream(streamCtx, &grpc.StreamDesc{ServerStreams: true}, fullMethod)
+	if err == nil {
+		err = stream.SendMsg(in)
+	}
+
+	if err == nil {
+		err = stream.CloseSend()
+	}
+
+	if err != nil {
+		writeTranscodingError(w, h.marshalOptions, err)
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	// the status of the stream is reported as an event, EventSource can't read the http status anyway
+	w.WriteHeader(http.StatusOK)
+
+	if h.retryMsg != "" {
+		_, _ = io.WriteString(w, h.retryMsg)
+	}
+
+	flusher.Flush()
+
+	h.pump(ctx, w, flusher, md, stream)
+}
+
+func (h *SSEHandler) buildRequest(w http.ResponseWriter, r *http.Request, in *dynamicpb.Message) error {
+	if r.Method == http.MethodPost {
+		d, err := readTranscodingBody(w, r)
+		if err != nil {
+			return err
+		}
+
+		if len(strings.TrimSpace(string(d))) > 0 {
+			if err = protojson.Unmarshal(d, in); err != nil {
+				return err
+			}
+		}
+	}
+
+	for key, values := range r.URL.Query() {
+		for _, value := range values {
+			if err := setFieldByPath(in, key, value); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+type sseRecvResult struct {
+	msg proto.Message
+	err error
+}
+
+// pump only this goroutine writes to w, the messages are received in another one.
+func (h *SSEHandler) pump(ctx context.Context, w io.Writer, flusher http.Flusher, md protoreflect.MethodDescriptor,
+	stream grpc.ClientStream) {
+	chRecv := make(chan sseRecvResult)
+
+	go func() {
+		for {
+			out := dynamicpb.NewMessage(md.Output())
+			err := stream.RecvMsg(out)
+
+			select {
+			case chRecv <- sseRecvResult{msg: out, err: err}:
+			case <-ctx.Done():
+				return
+			}
+
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	heartbeat := time.NewTicker(h.cfg.HeartbeatInterval)
+	defer heartbeat.Stop()
+
+	var seq uint64
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-heartbeat.C:
+			_, _ = io.WriteString(w, ": ping\n\n")
+		case result := <-chRecv:
+			if result.err == io.EOF { // nolint: errorlint
+				_, _ = io.WriteString(w, "event: end\ndata: {}\n\n")
+				flusher.Flush()
+
+				return
+			}
+
+			if result.err != nil {
+				writeSSEEvent(w, "", "error", marshalTranscodingStatus(h.marshalOptions, status.Convert(result.err)))
+				flusher.Flush()
+
+				return
+			}
+
+			d, err := h.marshalOptions.Marshal(result.msg)
+			if err != nil {
+				writeSSEEvent(w, "", "error", marshalTranscodingStatus(h.marshalOptions, status.New(codes.Internal, err.Error())))
+				flusher.Flush()
+
+				return
+			}
+
+			seq++
+
+			writeSSEEvent(w, h.eventID(result.msg, seq), "message", d)
+		}
+
+		flusher.Flush()
+	}
+}
+
+// trimSSEPathPrefix the prefix matches at a / boundary only, /eventsX isn't under /events.
+func trimSSEPathPrefix(path, prefix string) (string, bool) {
+	prefix = strings.TrimSuffix(prefix, "/")
+	if prefix == "" {
+		return path, true
+	}
+
+	trimmed := strings.TrimPrefix(path, prefix)
+	if trimmed == path || !strings.HasPrefix(trimmed, "/") {
+		return "", false
+	}
+
+	return trimmed, true
+}
+
+// sseFieldReplacer a CR or LF in a field would start another field or event.
+var sseFieldReplacer = strings.NewReplacer("\r", "", "\n", "")
+
+func writeSSEEvent(w io.Writer, id, event string, data []byte) {
+	var sb strings.Builder
+
+	id = sseFieldReplacer.Replace(id)
+
+	if id != "" {
+		sb.WriteString("id: " + id + "\n")
+	}
+
+	sb.WriteString("event: " + event + "\n")
+
+	for _, line := range strings.Split(string(data), "\n") {
+		sb.WriteString("data: " + line + "\n")
+	}
+
+	sb.WriteString("\n")
+
+	_, _ = io.WriteString(w, sb.String())
+}
+
+// sseOrNextHandler the requests under pathPrefix are served by sh, the others accepting text/event-stream are
+// served by sh only if they are to the server streaming methods.
+func sseOrNextHandler(sh *SSEHandler, pathPrefix string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := trimSSEPathPrefix(r.URL.Path, pathPrefix); ok && pathPrefix != "" {
+			sh.ServeHTTP(w, r)
+
+			return
+		}
+
+		if _, _, ok := sh.route(r); ok && strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+			sh.ServeHTTP(w, r)
+
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
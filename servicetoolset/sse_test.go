@@ -0,0 +1,174 @@
+package servicetoolset
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/examples/route_guide/routeguide"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+)
+
+type testSSERouteGuideServer struct {
+	routeguide.UnimplementedRouteGuideServer
+
+	lastEventID string
+	chCanceled  chan struct{}
+}
+
+func (s *testSSERouteGuideServer) ListFeatures(rect *routeguide.Rectangle, stream grpc.ServerStreamingServer[routeguide.Feature]) error {
+	if md, ok := metadata.FromIncomingContext(stream.Context()); ok && len(md.Get(SSELastEventIDMetadataKey)) > 0 {
+		s.lastEventID = md.Get(SSELastEventIDMetadataKey)[0]
+	}
+
+	if rect.GetLo().GetLatitude() == 0 {
+		return stream.Send(&routeguide.Feature{Name: "a"})
+	}
+
+	_ = stream.Send(&routeguide.Feature{Name: "forever"})
+
+	<-stream.Context().Done()
+	close(s.chCanceled)
+
+	return stream.Context().Err()
+}
+
+func TestSSEHandler(t *testing.T) {
+	routeGuideServer := &testSSERouteGuideServer{chCanceled: make(chan struct{})}
+
+	s := grpc.NewServer()
+	routeguide.RegisterRouteGuideServer(s, routeGuideServer)
+
+	defer s.Stop()
+
+	var resumedFrom string
+
+	h, err := NewSSEHandler(SSEHandlerInputParameters{
+		GRPCServer: s,
+		Config: SSEConfig{
+			HeartbeatInterval: time.Millisecond * 10,
+			RetryInterval:     time.Second,
+		},
+		Resume: func(_ context.Context, _ string, lastEventID string, _ proto.Message) error {
+			resumedFrom = lastEventID
+
+			return nil
+		},
+	})
+	assert.Nil(t, err)
+
+	defer h.Close()
+
+	req := httptest.NewRequest(http.MethodGet, "/routeguide.RouteGuide/ListFeatures", nil)
+	req.Header.Set("Last-Event-ID", "7")
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+
+	assert.Equal(t, "text/event-stream", w.Header().Get("Content-Type"))
+	assert.Equal(t, "retry: 1000\n\nid: 1\nevent: message\ndata: {\"name\":\"a\"}\n\nevent: end\ndata: {}\n\n",
+		strings.ReplaceAll(w.Body.String(), ": ping\n\n", ""))
+	assert.Equal(t, "7", resumedFrom)
+	assert.Equal(t, "7", routeGuideServer.lastEventID)
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/routeguide.RouteGuide/GetFeature", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/routeguide.RouteGuide/ListFeatures",
+		strings.NewReader(strings.Repeat(" ", jsonTranscodingMaxRequestBody+1))))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+
+	// only the server streaming methods accepting text/event-stream are taken
+	var nextCalled int
+
+	dispatcher := sseOrNextHandler(h, "", http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {
+		nextCalled++
+	}))
+
+	for _, path := range []string{"/index.html", "/routeguide.RouteGuide/GetFeature"} {
+		req = httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Accept", "text/event-stream")
+
+		dispatcher.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	assert.Equal(t, 2, nextCalled)
+
+	req = httptest.NewRequest(http.MethodGet, "/routeguide.RouteGuide/ListFeatures", nil)
+	req.Header.Set("Accept", "text/event-stream")
+
+	w = httptest.NewRecorder()
+	dispatcher.ServeHTTP(w, req)
+
+	assert.Equal(t, 2, nextCalled)
+	assert.Equal(t, "text/event-stream", w.Header().Get("Content-Type"))
+}
+
+func TestSSEHandlerClientDisconnect(t *testing.T) {
+	routeGuideServer := &testSSERouteGuideServer{chCanceled: make(chan struct{})}
+
+	s := grpc.NewServer()
+	routeguide.RegisterRouteGuideServer(s, routeGuideServer)
+
+	defer s.Stop()
+
+	h, err := NewSSEHandler(SSEHandlerInputParameters{GRPCServer: s})
+	assert.Nil(t, err)
+
+	defer h.Close()
+
+	server := httptest.NewServer(h)
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet,
+		server.URL+"/routeguide.RouteGuide/ListFeatures?lo.latitude=1", nil)
+
+	resp, err := http.DefaultClient.Do(req)
+	assert.Nil(t, err)
+
+	line, err := bufio.NewReader(resp.Body).ReadString('\n')
+	assert.Nil(t, err)
+	assert.Equal(t, "id: 1\n", line)
+
+	cancel()
+	_ = resp.Body.Close()
+
+	select {
+	case <-routeGuideServer.chCanceled:
+	case <-time.After(time.Second * 5):
+		assert.Fail(t, "the handler context is not canceled")
+	}
+}
+
+func TestSSEPathPrefixAndEventID(t *testing.T) {
+	path, ok := trimSSEPathPrefix("/events/pkg.Svc/M", "/events")
+	assert.True(t, ok)
+	assert.Equal(t, "/pkg.Svc/M", path)
+
+	path, ok = trimSSEPathPrefix("/events/pkg.Svc/M", "/events/")
+	assert.True(t, ok)
+	assert.Equal(t, "/pkg.Svc/M", path)
+
+	_, ok = trimSSEPathPrefix("/eventsX/pkg.Svc/M", "/events")
+	assert.False(t, ok)
+
+	path, ok = trimSSEPathPrefix("/pkg.Svc/M", "")
+	assert.True(t, ok)
+	assert.Equal(t, "/pkg.Svc/M", path)
+
+	var sb strings.Builder
+
+	writeSSEEvent(&sb, "1\r\nevent: end\n\ndata: x", "message", []byte("{}"))
+	assert.Equal(t, "id: 1event: enddata: x\nevent: message\ndata: {}\n\n", sb.String())
+}
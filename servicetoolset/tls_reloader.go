@@ -0,0 +1,75 @@
+package servicetoolset
+
+import (
+	"crypto/tls"
+
+	"github.com/sgostarter/i/commerr"
+	"go.uber.org/atomic"
+)
+
+// TLSReloader keeps the server tls config in an atomic pointer, so the certs loaded from files can be
+// replaced (e.g. on SIGHUP) without restarting the listener.
+type TLSReloader struct {
+	cfg     *GRPCServerTLSConfig
+	fileCfg *GRPCServerTLSFileConfig
+
+	current atomic.Pointer[tls.Config]
+}
+
+// NewTLSReloader cfg is used if not nil, otherwise the config is loaded from fileCfg on every Reload.
+func NewTLSReloader(cfg *GRPCServerTLSConfig, fileCfg *GRPCServerTLSFileConfig) (*TLSReloader, error) {
+	if cfg == nil && fileCfg == nil {
+		return nil, commerr.ErrInvalidArgument
+	}
+
+	r := &TLSReloader{
+		cfg:     cfg,
+		fileCfg: fileCfg,
+	}
+
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func (r *TLSReloader) Reload() error {
+	cfg := r.cfg
+
+	if cfg == nil {
+		var err error
+
+		cfg, err = GRPCServerTLSConfigMap(r.fileCfg)
+		if err != nil {
+			return err
+		}
+	}
+
+	tlsConfig, err := GenServerTLSConfig(cfg)
+	if err != nil {
+		return err
+	}
+
+	r.current.Store(tlsConfig)
+
+	return nil
+}
+
+// TLSConfig returns a config which always serves the latest loaded one, nextProtos overrides the NextProtos if not empty.
+func (r *TLSReloader) TLSConfig(nextProtos ...string) *tls.Config {
+	// nolint: gosec
+	return &tls.Config{
+		NextProtos: nextProtos,
+		GetConfigForClient: func(_ *tls.ClientHelloInfo) (*tls.Config, error) {
+			tlsConfig := r.current.Load()
+
+			if len(nextProtos) > 0 {
+				tlsConfig = tlsConfig.Clone()
+				tlsConfig.NextProtos = nextProtos
+			}
+
+			return tlsConfig, nil
+		},
+	}
+}